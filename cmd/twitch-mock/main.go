@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/env"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchmock"
+)
+
+func main() {
+	port := env.Get("MOCK_PORT", "8089")
+
+	cfg := twitchmock.Config{
+		ClientID:           env.Get("MOCK_CLIENT_ID", ""),
+		ClientSecret:       env.Get("MOCK_CLIENT_SECRET", ""),
+		Chatters:           env.Int("MOCK_CHATTERS", 250),
+		ModeratedChannels:  env.Int("MOCK_MODERATED_CHANNELS", 5),
+		RateLimitPerMinute: env.Int("MOCK_RATE_LIMIT", 800),
+		Seed:               int64(env.Int("MOCK_SEED", 42)),
+		EventSubKeepalive:  env.Duration("MOCK_EVENTSUB_KEEPALIVE", 10*time.Second),
+		ImageBaseURL:       env.Get("MOCK_IMAGE_BASE_URL", ""),
+	}
+	mock := twitchmock.New(cfg)
+
+	// Scénario appliqué au démarrage : preset (MOCK_SCENARIO) ou fichier JSON (MOCK_SCENARIO_FILE)
+	if name := env.Get("MOCK_SCENARIO", ""); name != "" {
+		sc, ok := twitchmock.Presets[name]
+		if !ok {
+			log.Fatalf("unknown MOCK_SCENARIO %q", name)
+		}
+		if err := mock.Run(sc); err != nil {
+			log.Fatalf("cannot run scenario: %v", err)
+		}
+	}
+	if path := env.Get("MOCK_SCENARIO_FILE", ""); path != "" {
+		sc, err := twitchmock.LoadScenarioFile(path)
+		if err != nil {
+			log.Fatalf("cannot load scenario: %v", err)
+		}
+		if err := mock.Run(sc); err != nil {
+			log.Fatalf("cannot run scenario: %v", err)
+		}
+	}
+
+	httpServer := &http.Server{
+		Addr:              ":" + port,
+		Handler:           loggingMiddleware(mock.Handler()),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf("twitch-mock listening on %s (chatters: %d, moderated channels: %d)", httpServer.Addr, cfg.Chatters, cfg.ModeratedChannels)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("server error: %v", err)
+	}
+}
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		log.Printf("%s %s from %s in %s", r.Method, r.URL.Path, r.RemoteAddr, time.Since(start))
+	})
+}
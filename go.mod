@@ -3,8 +3,10 @@ module github.com/vignemail1/twitch-chatters-analyser
 go 1.25.6
 
 require (
+	github.com/coder/websocket v1.8.15
 	github.com/go-sql-driver/mysql v1.9.3
 	github.com/redis/go-redis/v9 v9.7.0
+	golang.org/x/sync v0.19.0
 	golang.org/x/time v0.9.0
 )
 
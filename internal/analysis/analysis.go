@@ -0,0 +1,557 @@
+// Package analysis est le service analysis : résumé d'une session d'analyse (comptes par
+// jour de création, renommages, profils de bots, chat, followers) servi en JSON au gateway.
+// Le binaire cmd/analysis le sert sur APP_PORT ; les tests d'intégration le démarrent en
+// mémoire avec New et Handler.
+package analysis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/chat"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/followers"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+)
+
+// App est le service analysis
+type App struct {
+	store *store.Store
+}
+
+type SessionSummary struct {
+	SessionUUID            string              `json:"session_uuid"`
+	TotalAccounts          int64               `json:"total_accounts"`
+	TopDays                []TopDay            `json:"top_days"`
+	Broadcasters           []Broadcaster       `json:"broadcasters"`
+	SuspiciousRenamesCount int64               `json:"suspicious_renames_count"`
+	SuspiciousAccounts     []SuspiciousAccount `json:"suspicious_accounts,omitempty"`
+	MissingAccountsCount   int64               `json:"missing_accounts_count"` // comptes supprimés/suspendus depuis
+	DefaultAvatarCount     int64               `json:"default_avatar_count"`
+	EmptyDescriptionCount  int64               `json:"empty_description_count"`
+	AvatarClusters         []AvatarCluster     `json:"avatar_clusters"`
+	Chat                   *ChatSummary        `json:"chat,omitempty"`      // absent si aucun chat n'a été écouté
+	Followers              *FollowerSummary    `json:"followers,omitempty"` // absent sans followers récupérés
+	GeneratedAt            time.Time           `json:"generated_at"`
+}
+
+type TopDay struct {
+	Date   string   `json:"date"` // YYYY-MM-DD
+	Count  int64    `json:"count"`
+	Logins []string `json:"logins"` // Liste des logins créés ce jour-là
+}
+
+type Broadcaster struct {
+	BroadcasterID    string `json:"broadcaster_id"`
+	BroadcasterLogin string `json:"broadcaster_login"`
+	CaptureCount     int64  `json:"capture_count"`
+}
+
+// AvatarCluster regroupe des comptes partageant la même image de profil (hors avatar par défaut)
+type AvatarCluster struct {
+	ProfileImageURL string   `json:"profile_image_url"`
+	Count           int64    `json:"count"`
+	Logins          []string `json:"logins"`
+}
+
+// ChatSummary classe les chatters d'après leurs messages sur les chaînes dont le chat a été
+// écouté (worker chat) : silencieux, actifs ou spammeurs (messages majoritairement répétés)
+type ChatSummary struct {
+	Channels         []ChatChannel     `json:"channels"`
+	Messages         int64             `json:"messages"`
+	SilentCount      int64             `json:"silent_count"` // comptes capturés sans aucun message
+	ActiveCount      int64             `json:"active_count"`
+	SpamCount        int64             `json:"spam_count"`
+	SpamAccounts     []ChatAccount     `json:"spam_accounts"`
+	RepeatedMessages []RepeatedMessage `json:"repeated_messages"`
+}
+
+type ChatChannel struct {
+	BroadcasterID    string    `json:"broadcaster_id"`
+	BroadcasterLogin string    `json:"broadcaster_login"`
+	ListeningSince   time.Time `json:"listening_since"`
+}
+
+type ChatAccount struct {
+	TwitchUserID   string    `json:"twitch_user_id"`
+	Login          string    `json:"login"`
+	MessageCount   int64     `json:"message_count"`
+	DuplicateCount int64     `json:"duplicate_count"`
+	FirstMessageAt time.Time `json:"first_message_at"`
+	LastMessageAt  time.Time `json:"last_message_at"`
+}
+
+// RepeatedMessage est un message envoyé plusieurs fois sur une chaîne
+type RepeatedMessage struct {
+	BroadcasterID string    `json:"broadcaster_id"`
+	Sample        string    `json:"sample"`
+	Count         int64     `json:"count"`
+	FirstSeenAt   time.Time `json:"first_seen_at"`
+	LastSeenAt    time.Time `json:"last_seen_at"`
+}
+
+// FollowerSummary repère les vagues de follows des chaînes dont les followers ont été
+// récupérés (FETCH_FOLLOWERS) et les croise avec les chatters capturés de la session
+type FollowerSummary struct {
+	Channels []FollowerChannel `json:"channels"`
+	Spikes   []FollowSpike     `json:"spikes"`
+}
+
+type FollowerChannel struct {
+	BroadcasterID    string    `json:"broadcaster_id"`
+	BroadcasterLogin string    `json:"broadcaster_login"`
+	Total            int64     `json:"total"`   // followers de la chaîne selon Twitch
+	Fetched          int64     `json:"fetched"` // followers récupérés, les plus récents
+	FetchedAt        time.Time `json:"fetched_at"`
+}
+
+// FollowSpike est une fenêtre de follows anormalement nombreux sur une chaîne
+type FollowSpike struct {
+	BroadcasterID    string              `json:"broadcaster_id"`
+	BroadcasterLogin string              `json:"broadcaster_login"`
+	Start            time.Time           `json:"start"`
+	End              time.Time           `json:"end"`
+	Follows          int64               `json:"follows"`
+	Expected         float64             `json:"expected"`       // follows attendus au rythme habituel
+	KnownAccounts    int64               `json:"known_accounts"` // comptes enrichis (création connue)
+	InChatCount      int64               `json:"in_chat_count"`  // comptes parmi les chatters capturés
+	TopCreationDays  []FollowCreationDay `json:"top_creation_days"`
+	Logins           []string            `json:"logins"`
+}
+
+// FollowCreationDay est un jour de création de comptes d'une vague de follows
+type FollowCreationDay struct {
+	Date     string `json:"date"` // YYYY-MM-DD
+	Count    int64  `json:"count"`
+	Chatters int64  `json:"chatters"` // chatters capturés de la session créés ce jour-là
+}
+
+type SuspiciousAccount struct {
+	TwitchUserID string `json:"twitch_user_id"`
+	Login        string `json:"login"`
+	DisplayName  string `json:"display_name"`
+	RenameCount  int64  `json:"rename_count"`
+}
+
+// New crée le service sur la base st
+func New(st *store.Store) *App {
+	return &App{store: st}
+}
+
+// Handler retourne le routeur HTTP du service
+func (a *App) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", a.handleHealth)
+	mux.HandleFunc("/sessions/", a.handleSessionSummary)
+	return loggingMiddleware(mux)
+}
+
+func (a *App) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if err := a.store.Ping(r.Context()); err != nil {
+		log.Printf("health db error: %v", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// GET /sessions/{uuid}/summary
+func (a *App) handleSessionSummary(w http.ResponseWriter, r *http.Request) {
+	// URL attendue : /sessions/<session_uuid>/summary
+	path := r.URL.Path // ex: /sessions/abcd-1234/summary
+
+	const prefix = "/sessions/"
+	if !strings.HasPrefix(path, prefix) {
+		http.NotFound(w, r)
+		return
+	}
+
+	rest := strings.TrimPrefix(path, prefix) // ex: "abcd-1234/summary"
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 || parts[1] != "summary" || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	sessionUUID := parts[0]
+
+	// Optionnel : filtre broadcaster_id (peut être une liste séparée par des virgules)
+	broadcasterIDs := r.URL.Query().Get("broadcaster_id")
+
+	summary, err := a.buildSessionSummary(r.Context(), sessionUUID, broadcasterIDs)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("buildSessionSummary error: %v", err)
+		http.Error(w, "failed to build summary", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(summary); err != nil {
+		log.Printf("json encode error: %v", err)
+	}
+}
+
+func (a *App) buildSessionSummary(ctx context.Context, sessionUUID, broadcasterIDs string) (*SessionSummary, error) {
+	// Récupérer l'id interne de la session
+	session, err := a.store.Sessions.ByUUID(ctx, sessionUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Récupérer la liste des broadcasters pour cette session
+	captured, err := a.store.Captures.Broadcasters(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	broadcasters := make([]Broadcaster, 0, len(captured))
+	for _, b := range captured {
+		broadcasters = append(broadcasters, Broadcaster{
+			BroadcasterID:    b.BroadcasterID,
+			BroadcasterLogin: b.BroadcasterLogin,
+			CaptureCount:     b.CaptureCount,
+		})
+	}
+
+	// Parser les broadcaster_ids filtrés (peut être vide ou une liste séparée par des virgules)
+	var filterBroadcasters []string
+	if broadcasterIDs != "" {
+		filterBroadcasters = strings.Split(broadcasterIDs, ",")
+	}
+
+	// Nombre total de comptes distincts pour cette session (et broadcasters filtrés si spécifié)
+	total, err := a.store.Chatters.CountDistinct(ctx, session.ID, filterBroadcasters)
+	if err != nil {
+		return nil, err
+	}
+
+	// Top 10 des jours de création avec les logins
+	topDays, err := a.getTopDaysWithLogins(ctx, session.ID, filterBroadcasters)
+	if err != nil {
+		return nil, err
+	}
+
+	// Détection des comptes suspects avec renommages multiples (seuil: 3+)
+	suspiciousAccounts, err := a.getSuspiciousRenames(ctx, session.ID, filterBroadcasters)
+	if err != nil {
+		log.Printf("getSuspiciousRenames error: %v", err)
+		// Non-bloquant, on continue sans cette stat
+		suspiciousAccounts = []SuspiciousAccount{}
+	}
+
+	// Profils typiques de bots : avatar par défaut, bio vide, image partagée
+	profiles, err := a.store.TwitchUsers.ProfileSignals(ctx, session.ID, filterBroadcasters)
+	if err != nil {
+		log.Printf("ProfileSignals error: %v", err)
+		// Non-bloquant, on continue sans cette stat
+	}
+	avatarClusters, err := a.getAvatarClusters(ctx, session.ID, filterBroadcasters)
+	if err != nil {
+		log.Printf("getAvatarClusters error: %v", err)
+		avatarClusters = []AvatarCluster{}
+	}
+
+	// Comptes disparus depuis la capture (supprimés, suspendus ou bannis)
+	missing, err := a.store.TwitchUsers.CountMissing(ctx, session.ID, filterBroadcasters)
+	if err != nil {
+		log.Printf("CountMissing error: %v", err)
+		// Non-bloquant, on continue sans cette stat
+	}
+
+	// Activité du chat, si le listener a écouté une des chaînes
+	chatSummary, err := a.getChatSummary(ctx, session.ID, filterBroadcasters)
+	if err != nil {
+		log.Printf("getChatSummary error: %v", err)
+		// Non-bloquant, on continue sans cette stat
+	}
+
+	// Vagues de follows, si les followers d'une des chaînes ont été récupérés
+	followerSummary, err := a.getFollowerSummary(ctx, session.ID, filterBroadcasters)
+	if err != nil {
+		log.Printf("getFollowerSummary error: %v", err)
+		// Non-bloquant, on continue sans cette stat
+	}
+
+	return &SessionSummary{
+		SessionUUID:            sessionUUID,
+		TotalAccounts:          total,
+		TopDays:                topDays,
+		Broadcasters:           broadcasters,
+		SuspiciousRenamesCount: int64(len(suspiciousAccounts)),
+		SuspiciousAccounts:     suspiciousAccounts,
+		MissingAccountsCount:   missing,
+		DefaultAvatarCount:     profiles.DefaultAvatar,
+		EmptyDescriptionCount:  profiles.EmptyDescription,
+		AvatarClusters:         avatarClusters,
+		Chat:                   chatSummary,
+		Followers:              followerSummary,
+		GeneratedAt:            time.Now().UTC(),
+	}, nil
+}
+
+// getTopDaysWithLogins récupère le top 10 des jours de création avec la liste des logins
+func (a *App) getTopDaysWithLogins(ctx context.Context, sessionID int64, filterBroadcasters []string) ([]TopDay, error) {
+	days, err := a.store.TwitchUsers.CreationDays(ctx, sessionID, filterBroadcasters, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pour chaque date, récupérer les logins
+	topDays := make([]TopDay, 0, len(days))
+	for _, d := range days {
+		logins, err := a.store.TwitchUsers.LoginsCreatedOn(ctx, sessionID, d.Date, filterBroadcasters)
+		if err != nil {
+			log.Printf("getLoginsForDate error for %s: %v", d.Date.Format("2006-01-02"), err)
+			logins = []string{} // En cas d'erreur, on continue avec une liste vide
+		}
+
+		topDays = append(topDays, TopDay{
+			Date:   d.Date.Format("2006-01-02"),
+			Count:  d.Count,
+			Logins: logins,
+		})
+	}
+
+	return topDays, nil
+}
+
+// getSuspiciousRenames retourne les comptes qui ont changé de nom 3+ fois
+func (a *App) getSuspiciousRenames(ctx context.Context, sessionID int64, filterBroadcasters []string) ([]SuspiciousAccount, error) {
+	const minRenames = 3 // Seuil de suspicion
+
+	renamers, err := a.store.NameHistory.FrequentRenamers(ctx, sessionID, filterBroadcasters, minRenames, 50)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]SuspiciousAccount, 0, len(renamers))
+	for _, rn := range renamers {
+		accounts = append(accounts, SuspiciousAccount{
+			TwitchUserID: rn.TwitchUserID,
+			Login:        rn.Login,
+			DisplayName:  rn.DisplayName,
+			RenameCount:  rn.RenameCount,
+		})
+	}
+
+	log.Printf("[SUSPICIOUS_RENAMES] session_id=%d found=%d accounts with %d+ renames", sessionID, len(accounts), minRenames)
+	return accounts, nil
+}
+
+// getAvatarClusters retourne les images de profil partagées par 3+ chatters, avec leurs logins
+func (a *App) getAvatarClusters(ctx context.Context, sessionID int64, filterBroadcasters []string) ([]AvatarCluster, error) {
+	const minClusterSize = 3 // Seuil de suspicion
+
+	found, err := a.store.TwitchUsers.AvatarClusters(ctx, sessionID, filterBroadcasters, minClusterSize, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := make([]AvatarCluster, 0, len(found))
+	for _, c := range found {
+		logins, err := a.store.TwitchUsers.LoginsWithAvatar(ctx, sessionID, c.Hash, filterBroadcasters)
+		if err != nil {
+			log.Printf("LoginsWithAvatar error for %s: %v", c.Hash, err)
+			logins = []string{} // En cas d'erreur, on continue avec une liste vide
+		}
+		clusters = append(clusters, AvatarCluster{
+			ProfileImageURL: c.ProfileImageURL,
+			Count:           c.Count,
+			Logins:          logins,
+		})
+	}
+	return clusters, nil
+}
+
+// getChatSummary classe les chatters d'une session d'après leur activité dans le chat ; nil si
+// aucune des chaînes n'a été écoutée
+func (a *App) getChatSummary(ctx context.Context, sessionID int64, filterBroadcasters []string) (*ChatSummary, error) {
+	const (
+		maxSpamAccounts     = 50
+		maxRepeatedMessages = 10
+	)
+
+	channels, err := a.store.Chat.Channels(ctx, sessionID, filterBroadcasters)
+	if err != nil || len(channels) == 0 {
+		return nil, err
+	}
+	summary := &ChatSummary{
+		Channels:         make([]ChatChannel, 0, len(channels)),
+		SpamAccounts:     []ChatAccount{},
+		RepeatedMessages: []RepeatedMessage{},
+	}
+	for _, ch := range channels {
+		summary.Channels = append(summary.Channels, ChatChannel{
+			BroadcasterID:    ch.BroadcasterID,
+			BroadcasterLogin: ch.BroadcasterLogin,
+			ListeningSince:   ch.ListeningSince,
+		})
+	}
+
+	activity, err := a.store.Chat.Activity(ctx, sessionID, filterBroadcasters)
+	if err != nil {
+		return nil, err
+	}
+	for _, act := range activity {
+		summary.Messages += act.MessageCount
+		switch chat.Classify(act.MessageCount, act.DuplicateCount) {
+		case chat.ClassSpam:
+			summary.SpamCount++
+			if len(summary.SpamAccounts) < maxSpamAccounts {
+				summary.SpamAccounts = append(summary.SpamAccounts, ChatAccount{
+					TwitchUserID:   act.TwitchUserID,
+					Login:          act.Login,
+					MessageCount:   act.MessageCount,
+					DuplicateCount: act.DuplicateCount,
+					FirstMessageAt: act.FirstMessageAt,
+					LastMessageAt:  act.LastMessageAt,
+				})
+			}
+		case chat.ClassActive:
+			summary.ActiveCount++
+		}
+	}
+
+	if summary.SilentCount, err = a.store.Chat.CountSilent(ctx, sessionID, filterBroadcasters); err != nil {
+		return nil, err
+	}
+
+	repeated, err := a.store.Chat.RepeatedMessages(ctx, sessionID, filterBroadcasters, 2, maxRepeatedMessages)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range repeated {
+		summary.RepeatedMessages = append(summary.RepeatedMessages, RepeatedMessage{
+			BroadcasterID: m.BroadcasterID,
+			Sample:        m.Sample,
+			Count:         m.MessageCount,
+			FirstSeenAt:   m.FirstSeenAt,
+			LastSeenAt:    m.LastSeenAt,
+		})
+	}
+
+	log.Printf("[CHAT] session_id=%d messages=%d silent=%d active=%d spam=%d", sessionID, summary.Messages, summary.SilentCount, summary.ActiveCount, summary.SpamCount)
+	return summary, nil
+}
+
+// getFollowerSummary repère les vagues de follows des chaînes d'une session, avec les dates de
+// création de leurs comptes ; nil si aucun follower n'a été récupéré
+func (a *App) getFollowerSummary(ctx context.Context, sessionID int64, filterBroadcasters []string) (*FollowerSummary, error) {
+	const (
+		maxCreationDays = 5
+		maxSpikeLogins  = 50
+	)
+
+	fetches, err := a.store.Followers.Fetches(ctx, sessionID, filterBroadcasters)
+	if err != nil || len(fetches) == 0 {
+		return nil, err
+	}
+	summary := &FollowerSummary{
+		Channels: make([]FollowerChannel, 0, len(fetches)),
+		Spikes:   []FollowSpike{},
+	}
+	for _, f := range fetches {
+		summary.Channels = append(summary.Channels, FollowerChannel{
+			BroadcasterID:    f.BroadcasterID,
+			BroadcasterLogin: f.BroadcasterLogin,
+			Total:            f.Total,
+			Fetched:          f.Fetched,
+			FetchedAt:        f.FetchedAt,
+		})
+
+		times, err := a.store.Followers.FollowTimes(ctx, sessionID, f.BroadcasterID)
+		if err != nil {
+			return nil, err
+		}
+		for _, sp := range followers.Spikes(times) {
+			window, err := a.store.Followers.Window(ctx, sessionID, f.BroadcasterID, sp.Start, sp.End)
+			if err != nil {
+				return nil, err
+			}
+			spike := FollowSpike{
+				BroadcasterID:    f.BroadcasterID,
+				BroadcasterLogin: f.BroadcasterLogin,
+				Start:            sp.Start,
+				End:              sp.End,
+				Follows:          sp.Follows,
+				Expected:         sp.Expected,
+				TopCreationDays:  []FollowCreationDay{},
+				Logins:           []string{},
+			}
+			created := make(map[string]int64)
+			for _, wf := range window {
+				if wf.InChat {
+					spike.InChatCount++
+				}
+				if wf.CreatedAt != nil {
+					spike.KnownAccounts++
+					created[wf.CreatedAt.Format("2006-01-02")]++
+				}
+				if wf.Login != "" && len(spike.Logins) < maxSpikeLogins {
+					spike.Logins = append(spike.Logins, wf.Login)
+				}
+			}
+
+			if spike.TopCreationDays, err = a.topFollowCreationDays(ctx, sessionID, filterBroadcasters, created, maxCreationDays); err != nil {
+				return nil, err
+			}
+			summary.Spikes = append(summary.Spikes, spike)
+		}
+	}
+
+	log.Printf("[FOLLOWERS] session_id=%d channels=%d spikes=%d", sessionID, len(summary.Channels), len(summary.Spikes))
+	return summary, nil
+}
+
+// topFollowCreationDays retourne les limit jours de création les plus fréquents d'une vague
+// de follows, avec le nombre de chatters de la session créés les mêmes jours
+func (a *App) topFollowCreationDays(ctx context.Context, sessionID int64, filterBroadcasters []string, created map[string]int64, limit int) ([]FollowCreationDay, error) {
+	days := make([]FollowCreationDay, 0, len(created))
+	for date, n := range created {
+		days = append(days, FollowCreationDay{Date: date, Count: n})
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if days[i].Count != days[j].Count {
+			return days[i].Count > days[j].Count
+		}
+		return days[i].Date < days[j].Date
+	})
+	if len(days) > limit {
+		days = days[:limit]
+	}
+
+	dates := make([]time.Time, 0, len(days))
+	for _, d := range days {
+		t, err := time.Parse("2006-01-02", d.Date)
+		if err != nil {
+			return nil, err
+		}
+		dates = append(dates, t)
+	}
+	chatters, err := a.store.TwitchUsers.CountCreatedOn(ctx, sessionID, dates, filterBroadcasters)
+	if err != nil {
+		return nil, err
+	}
+	for i := range days {
+		days[i].Chatters = chatters[days[i].Date]
+	}
+	return days, nil
+}
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		log.Printf("%s %s from %s in %s", r.Method, r.URL.Path, r.RemoteAddr, time.Since(start))
+	})
+}
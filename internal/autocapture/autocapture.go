@@ -0,0 +1,179 @@
+// Package autocapture planifie les captures de chatters : captures demandées par un
+// utilisateur et captures déclenchées par une notification EventSub, quel que soit son
+// transport (callback webhook du gateway, session WebSocket du worker).
+package autocapture
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/eventsub"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+)
+
+// Scheduler crée les jobs FETCH_CHATTERS et FETCH_FOLLOWERS dans la session d'analyse active
+// des utilisateurs
+type Scheduler struct {
+	Store *store.Store
+	// SessionTTL est la durée de vie d'une session d'analyse créée pour une capture
+	SessionTTL time.Duration
+}
+
+// Notification est une notification EventSub reçue
+type Notification struct {
+	MessageID    string
+	Subscription eventsub.Subscription
+	Event        json.RawMessage
+	ReceivedAt   time.Time
+}
+
+// Enqueue crée un job FETCH_CHATTERS pour la chaîne dans la session d'analyse active de
+// l'utilisateur (créée au besoin), exécuté à partir de runAfter (zéro : immédiatement)
+func (s *Scheduler) Enqueue(ctx context.Context, userID int64, twitchUserID, broadcasterID, broadcasterLogin string, runAfter time.Time) (jobID int64, sessionUUID string, err error) {
+	return s.enqueue(ctx, store.JobFetchChatters, userID, twitchUserID, broadcasterID, broadcasterLogin, runAfter)
+}
+
+// EnqueueFollowers crée un job FETCH_FOLLOWERS pour la chaîne dans la session d'analyse
+// active de l'utilisateur (créée au besoin)
+func (s *Scheduler) EnqueueFollowers(ctx context.Context, userID int64, twitchUserID, broadcasterID, broadcasterLogin string) (jobID int64, sessionUUID string, err error) {
+	return s.enqueue(ctx, store.JobFetchFollowers, userID, twitchUserID, broadcasterID, broadcasterLogin, time.Time{})
+}
+
+func (s *Scheduler) enqueue(ctx context.Context, jobType string, userID int64, twitchUserID, broadcasterID, broadcasterLogin string, runAfter time.Time) (jobID int64, sessionUUID string, err error) {
+	sess, err := s.activeSession(ctx, userID)
+	if err != nil {
+		return 0, "", fmt.Errorf("analysis session: %w", err)
+	}
+
+	payload := map[string]interface{}{
+		"session_id":        sess.ID,
+		"twitch_user_id":    twitchUserID,
+		"broadcaster_id":    broadcasterID,
+		"broadcaster_login": broadcasterLogin,
+	}
+	jobID, err = s.Store.Jobs.EnqueueForSessionAt(ctx, jobType, sess.ID, payload, runAfter)
+	if err != nil {
+		return 0, "", fmt.Errorf("enqueue job: %w", err)
+	}
+	return jobID, sess.UUID, nil
+}
+
+// activeSession récupère ou crée la session d'analyse active de l'utilisateur ;
+// les sessions actives arrivées à expiration passent en 'expired'
+func (s *Scheduler) activeSession(ctx context.Context, userID int64) (*store.Session, error) {
+	if n, err := s.Store.Sessions.ExpireOverdue(ctx, userID); err != nil {
+		return nil, err
+	} else if n > 0 {
+		log.Printf("%d analysis session(s) of user %d expired", n, userID)
+	}
+
+	sess, err := s.Store.Sessions.Active(ctx, userID)
+	if err == nil || !errors.Is(err, store.ErrNotFound) {
+		return sess, err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	sess = &store.Session{
+		UUID:      hex.EncodeToString(b),
+		UserID:    userID,
+		Status:    store.SessionActive,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.SessionTTL),
+		UpdatedAt: now,
+	}
+	if sess.ID, err = s.Store.Sessions.Create(ctx, *sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Handle enregistre une notification et planifie, pour chaque utilisateur abonné, une
+// capture par délai de son abonnement. Un message déjà reçu (même identifiant) est ignoré.
+// Les captures sont planifiées dans une transaction ; si elle échoue, la notification est
+// effacée pour que le message renvoyé par Twitch soit traité à nouveau.
+func (s *Scheduler) Handle(ctx context.Context, n Notification) (captures int, err error) {
+	sub := n.Subscription
+	eventID, created, err := s.Store.EventSub.RecordEvent(ctx, store.EventSubEvent{
+		MessageID:            n.MessageID,
+		TwitchSubscriptionID: sub.ID,
+		Type:                 sub.Type,
+		BroadcasterID:        eventsub.Broadcaster(sub.Condition),
+		Event:                n.Event,
+		ReceivedAt:           n.ReceivedAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !created {
+		// Message renvoyé par Twitch : déjà traité
+		return 0, nil
+	}
+
+	err = s.Store.InTx(ctx, func(tx *store.Store) error {
+		captures, err = (&Scheduler{Store: tx, SessionTTL: s.SessionTTL}).schedule(ctx, n, eventID)
+		return err
+	})
+	if err != nil {
+		// Contexte indépendant : celui de la requête peut être la cause de l'échec
+		dctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if derr := s.Store.EventSub.DeleteEvent(dctx, eventID); derr != nil {
+			log.Printf("delete eventsub event %d: %v", eventID, derr)
+		}
+		return 0, err
+	}
+	if captures > 0 {
+		log.Printf("eventsub %s on %s: %d capture(s) scheduled", sub.Type, eventsub.Broadcaster(sub.Condition), captures)
+	}
+	return captures, nil
+}
+
+// schedule planifie les captures de la notification enregistrée sous eventID
+func (s *Scheduler) schedule(ctx context.Context, n Notification, eventID int64) (captures int, err error) {
+	sub := n.Subscription
+	subs, err := s.Store.EventSub.ByTwitchID(ctx, sub.ID)
+	if err != nil {
+		return 0, err
+	}
+	// Vérification reçue avant l'enregistrement de l'abonnement : il est actif puisqu'il notifie
+	if slices.ContainsFunc(subs, func(s store.EventSubSubscription) bool { return s.Status != eventsub.StatusEnabled }) {
+		if _, err := s.Store.EventSub.SetStatus(ctx, sub.ID, eventsub.StatusEnabled); err != nil {
+			return 0, fmt.Errorf("set eventsub status: %w", err)
+		}
+	}
+
+	for _, es := range subs {
+		if len(es.CaptureOffsets) == 0 {
+			continue
+		}
+		owner, err := s.Store.Users.ByID(ctx, es.UserID)
+		if errors.Is(err, store.ErrNotFound) {
+			log.Printf("user %d of eventsub subscription %d not found", es.UserID, es.ID)
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("load user %d for eventsub subscription %d: %w", es.UserID, es.ID, err)
+		}
+		for _, offset := range es.CaptureOffsets {
+			if _, _, err := s.Enqueue(ctx, owner.ID, owner.TwitchUserID, es.BroadcasterID, es.BroadcasterLogin, n.ReceivedAt.Add(offset)); err != nil {
+				return 0, fmt.Errorf("schedule capture for eventsub subscription %d: %w", es.ID, err)
+			}
+			captures++
+		}
+	}
+	if captures == 0 {
+		return 0, nil
+	}
+	return captures, s.Store.EventSub.SetEventCaptures(ctx, eventID, captures)
+}
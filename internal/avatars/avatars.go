@@ -0,0 +1,127 @@
+// Package avatars identifie les images de profil Twitch par leur contenu : Twitch attribue
+// une URL distincte à chaque image envoyée, seul le SHA-256 des octets de l'image regroupe les
+// comptes ayant envoyé la même. Les images sont téléchargées par l'enrichissement du worker,
+// depuis les seuls hôtes autorisés (static-cdn.jtvnw.net en production) et dans une taille bornée.
+package avatars
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxImageSize borne la taille d'une image téléchargée (les images de profil servies par
+// Twitch, en 300x300, font quelques dizaines de Kio)
+const MaxImageSize = 1 << 20
+
+// concurrency est le nombre de téléchargements simultanés de HashAll
+const concurrency = 8
+
+// ErrHostNotAllowed est retournée pour une image hors des hôtes autorisés
+var ErrHostNotAllowed = errors.New("profile image host not allowed")
+
+// Hasher télécharge des images de profil et calcule le hash de leur contenu
+type Hasher struct {
+	client *http.Client
+	hosts  map[string]bool
+}
+
+// NewHasher retourne un Hasher limité aux hôtes hosts (noms sans port), chaque
+// téléchargement borné par timeout ; nil si hosts est vide (pas de téléchargement)
+func NewHasher(hosts []string, timeout time.Duration) *Hasher {
+	allowed := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			allowed[h] = true
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	return &Hasher{
+		client: &http.Client{
+			Timeout: timeout,
+			// Une redirection pourrait sortir des hôtes autorisés
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		hosts: allowed,
+	}
+}
+
+// Hash télécharge l'image imageURL et retourne le SHA-256 hexadécimal de son contenu
+func (h *Hasher) Hash(ctx context.Context, imageURL string) (string, error) {
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || !h.hosts[strings.ToLower(u.Hostname())] {
+		return "", ErrHostNotAllowed
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("profile image returned %d", resp.StatusCode)
+	}
+
+	sum := sha256.New()
+	n, err := io.Copy(sum, io.LimitReader(resp.Body, MaxImageSize+1))
+	if err != nil {
+		return "", err
+	}
+	if n > MaxImageSize {
+		return "", fmt.Errorf("profile image larger than %d bytes", MaxImageSize)
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// HashAll calcule le hash des images urls, plusieurs à la fois. Une image en échec est
+// absente du résultat (journalisée) : son compte n'est regroupé avec aucun autre jusqu'au
+// prochain enrichissement.
+func (h *Hasher) HashAll(ctx context.Context, urls []string) map[string]string {
+	hashes := make(map[string]string, len(urls))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	todo := make(chan string)
+	for i := 0; i < min(concurrency, len(urls)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range todo {
+				hash, err := h.Hash(ctx, u)
+				if err != nil {
+					log.Printf("cannot hash profile image %s: %v", u, err)
+					continue
+				}
+				mu.Lock()
+				hashes[u] = hash
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, u := range urls {
+		if ctx.Err() != nil {
+			break
+		}
+		todo <- u
+	}
+	close(todo)
+	wg.Wait()
+	return hashes
+}
@@ -0,0 +1,49 @@
+package avatars
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHashAll(t *testing.T) {
+	images := map[string]string{
+		"/a-profile_image-300x300.png": "same picture",
+		"/b-profile_image-300x300.png": "same picture",
+		"/c-profile_image-300x300.png": "other picture",
+		"/big.png":                     strings.Repeat("x", MaxImageSize+1),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		img, ok := images[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(img))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	h := NewHasher([]string{u.Hostname()}, 5*time.Second)
+
+	a, b, c := srv.URL+"/a-profile_image-300x300.png", srv.URL+"/b-profile_image-300x300.png", srv.URL+"/c-profile_image-300x300.png"
+	hashes := h.HashAll(context.Background(), []string{a, b, c, srv.URL + "/big.png", srv.URL + "/missing.png"})
+	if len(hashes) != 3 {
+		t.Fatalf("HashAll = %v, want the 3 served images only", hashes)
+	}
+	if hashes[a] != hashes[b] || hashes[a] == hashes[c] || len(hashes[a]) != 64 {
+		t.Errorf("hashes = %v: same picture under two URLs must share its hash", hashes)
+	}
+
+	other := NewHasher([]string{"static-cdn.jtvnw.net"}, time.Second)
+	if _, err := other.Hash(context.Background(), a); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("Hash from a host not allowed = %v, want ErrHostNotAllowed", err)
+	}
+	if NewHasher([]string{" "}, time.Second) != nil {
+		t.Error("NewHasher without host should be nil")
+	}
+}
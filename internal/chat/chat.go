@@ -0,0 +1,182 @@
+// Package chat lit le chat Twitch : messages IRC (tags IRCv3 compris), empreintes des
+// messages pour repérer les doublons et classement des chatters selon leur activité.
+//
+// Twitch sert le chat en IRC sur WebSocket (un ou plusieurs messages IRC par trame texte,
+// séparés par CRLF). Une connexion anonyme (pseudo justinfan<nombre>, sans PASS) suffit à
+// lire le chat des chaînes publiques.
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// IRCURL est le serveur IRC Twitch sur WebSocket
+const IRCURL = "wss://irc-ws.chat.twitch.tv:443"
+
+// Capacités IRCv3 demandées : tags (user-id, room-id...) et commandes Twitch (RECONNECT...)
+const Capabilities = "twitch.tv/tags twitch.tv/commands"
+
+// Classes d'activité d'un chatter
+const (
+	ClassSilent = "silent" // présent dans le chat, aucun message
+	ClassActive = "active" // messages, peu répétés
+	ClassSpam   = "spam"   // messages majoritairement déjà vus sur la chaîne
+)
+
+// Seuils du classement en spam : au moins SpamMinMessages messages, dont au moins la moitié
+// (SpamMinDuplicateRatio) reprend un message déjà envoyé sur la chaîne pendant la session
+const (
+	SpamMinMessages       = 3
+	SpamMinDuplicateRatio = 0.5
+)
+
+// Classify classe un chatter d'après son nombre de messages et de messages en double
+func Classify(messages, duplicates int64) string {
+	switch {
+	case messages <= 0:
+		return ClassSilent
+	case messages >= SpamMinMessages && float64(duplicates) >= SpamMinDuplicateRatio*float64(messages):
+		return ClassSpam
+	default:
+		return ClassActive
+	}
+}
+
+// ErrEmptyMessage est retournée pour une ligne IRC vide
+var ErrEmptyMessage = errors.New("chat: empty IRC message")
+
+// Message est un message IRC : @tags :prefix COMMANDE params... :trailing
+type Message struct {
+	Tags    map[string]string
+	Prefix  string
+	Command string
+	Params  []string // le paramètre final (trailing) compris
+}
+
+// ParseMessage analyse une ligne IRC, sans CRLF
+func ParseMessage(line string) (Message, error) {
+	var m Message
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "@") {
+		tags, rest, _ := strings.Cut(line[1:], " ")
+		m.Tags = make(map[string]string)
+		for _, tag := range strings.Split(tags, ";") {
+			key, value, _ := strings.Cut(tag, "=")
+			m.Tags[key] = unescapeTag(value)
+		}
+		line = strings.TrimLeft(rest, " ")
+	}
+	if strings.HasPrefix(line, ":") {
+		m.Prefix, line, _ = strings.Cut(line[1:], " ")
+		line = strings.TrimLeft(line, " ")
+	}
+	m.Command, line, _ = strings.Cut(line, " ")
+	if m.Command == "" {
+		return m, ErrEmptyMessage
+	}
+	for line != "" {
+		if strings.HasPrefix(line, ":") {
+			m.Params = append(m.Params, line[1:])
+			break
+		}
+		var param string
+		param, line, _ = strings.Cut(line, " ")
+		if param != "" {
+			m.Params = append(m.Params, param)
+		}
+	}
+	return m, nil
+}
+
+// unescapeTag décode une valeur de tag IRCv3 (\s espace, \: point-virgule...)
+func unescapeTag(v string) string {
+	if !strings.Contains(v, `\`) {
+		return v
+	}
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' || i == len(v)-1 {
+			b.WriteByte(v[i])
+			continue
+		}
+		i++
+		switch v[i] {
+		case 's':
+			b.WriteByte(' ')
+		case ':':
+			b.WriteByte(';')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(v[i])
+		}
+	}
+	return b.String()
+}
+
+// Nick retourne le pseudo de l'auteur (prefix nick!user@host)
+func (m Message) Nick() string {
+	nick, _, _ := strings.Cut(m.Prefix, "!")
+	return nick
+}
+
+// Param retourne le i-ème paramètre, ou "" s'il est absent
+func (m Message) Param(i int) string {
+	if i < len(m.Params) {
+		return m.Params[i]
+	}
+	return ""
+}
+
+// Text retourne le texte d'un PRIVMSG, sans l'enveloppe CTCP d'un /me
+func (m Message) Text() string {
+	text := m.Param(1)
+	if strings.HasPrefix(text, "\x01ACTION ") {
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "\x01ACTION "), "\x01")
+	}
+	return text
+}
+
+// Fingerprint retourne l'empreinte d'un message : SHA-256 tronqué (16 caractères hexadécimaux)
+// du texte normalisé, sans casse ni espaces superflus ni caractères invisibles (ajoutés par
+// certains clients pour contourner le filtre anti-doublon de Twitch). "" pour un message vide.
+func Fingerprint(text string) string {
+	normalized := normalize(text)
+	if normalized == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:8])
+}
+
+func normalize(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range text {
+		switch {
+		case invisible(r):
+			continue
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// invisible indique un caractère sans rendu : tags Unicode (U+E0000...), espaces de largeur
+// nulle, marques de format
+func invisible(r rune) bool {
+	return (r >= 0xE0000 && r <= 0xE007F) || unicode.Is(unicode.Cf, r)
+}
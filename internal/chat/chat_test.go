@@ -0,0 +1,77 @@
+package chat
+
+import "testing"
+
+func TestParseMessage(t *testing.T) {
+	m, err := ParseMessage("@badge-info=;display-name=Viewer\\s1;room-id=1000;user-id=100123 :viewer1!viewer1@viewer1.tmi.twitch.tv PRIVMSG #mockstreamer :hello  there :)\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Command != "PRIVMSG" || m.Nick() != "viewer1" || m.Param(0) != "#mockstreamer" || m.Text() != "hello  there :)" {
+		t.Errorf("PRIVMSG parsed as %+v", m)
+	}
+	if m.Tags["user-id"] != "100123" || m.Tags["room-id"] != "1000" || m.Tags["display-name"] != "Viewer 1" || m.Tags["badge-info"] != "" {
+		t.Errorf("tags = %v", m.Tags)
+	}
+
+	m, err = ParseMessage("PING :tmi.twitch.tv")
+	if err != nil || m.Command != "PING" || m.Prefix != "" || m.Param(0) != "tmi.twitch.tv" {
+		t.Errorf("PING parsed as %+v, %v", m, err)
+	}
+
+	m, err = ParseMessage(":tmi.twitch.tv 001 justinfan123 :Welcome, GLHF!")
+	if err != nil || m.Command != "001" || m.Param(0) != "justinfan123" || m.Param(1) != "Welcome, GLHF!" || m.Param(2) != "" {
+		t.Errorf("001 parsed as %+v, %v", m, err)
+	}
+
+	m, _ = ParseMessage(":a!a@a.tmi.twitch.tv PRIVMSG #c :\x01ACTION waves\x01")
+	if m.Text() != "waves" {
+		t.Errorf("/me text = %q", m.Text())
+	}
+
+	if _, err := ParseMessage("@a=b :prefix"); err != ErrEmptyMessage {
+		t.Errorf("message without command: %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	base := Fingerprint("Buy followers at example.com")
+	if len(base) != 16 {
+		t.Fatalf("fingerprint %q", base)
+	}
+	for _, variant := range []string{
+		"buy followers at example.com",
+		"  Buy   followers\tat example.com ",
+		"Buy followers at example.com \U000E0000",
+		"Buy fol\u200blowers at example.com",
+	} {
+		if got := Fingerprint(variant); got != base {
+			t.Errorf("Fingerprint(%q) = %s, want %s", variant, got, base)
+		}
+	}
+	if Fingerprint("Buy followers at example.org") == base {
+		t.Error("different messages share a fingerprint")
+	}
+	if Fingerprint(" \U000E0000 ") != "" {
+		t.Error("blank message has a fingerprint")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for _, c := range []struct {
+		messages, duplicates int64
+		want                 string
+	}{
+		{0, 0, ClassSilent},
+		{1, 1, ClassActive},
+		{2, 2, ClassActive},
+		{3, 1, ClassActive},
+		{3, 2, ClassSpam},
+		{10, 5, ClassSpam},
+		{10, 4, ClassActive},
+	} {
+		if got := Classify(c.messages, c.duplicates); got != c.want {
+			t.Errorf("Classify(%d, %d) = %s, want %s", c.messages, c.duplicates, got, c.want)
+		}
+	}
+}
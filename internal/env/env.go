@@ -0,0 +1,44 @@
+// Package env lit la configuration des services depuis les variables d'environnement.
+// Une variable absente ou invalide donne la valeur par défaut.
+package env
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Get récupère une variable d'environnement avec une valeur par défaut
+func Get(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Int récupère un entier avec une valeur par défaut
+func Int(key string, def int) int {
+	i, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return i
+}
+
+// Bool récupère un booléen ("true", "1", "false", "0"...) avec une valeur par défaut
+func Bool(key string, def bool) bool {
+	b, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// Duration récupère une durée (ex: "5m", "90s") avec une valeur par défaut
+func Duration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return d
+}
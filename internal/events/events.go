@@ -0,0 +1,152 @@
+// Package events diffuse les événements des sessions d'analyse (capture enregistrée,
+// enrichissement terminé, job en échec, comptes suspects, alerte déclenchée) sur le pub/sub Redis : le worker
+// les publie, chaque réplique du gateway les relaie à ses clients en Server-Sent Events.
+//
+// Un canal par session (Channel). La diffusion est au mieux : un événement publié sans
+// abonné, ou pendant une coupure Redis, est perdu ; la base reste la source de vérité.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/redis"
+)
+
+// Types d'événements
+const (
+	CaptureStored      = "capture_stored"      // capture enregistrée (CaptureStoredData)
+	EnrichmentFinished = "enrichment_finished" // enrichissement des comptes terminé (EnrichmentFinishedData)
+	JobFailed          = "job_failed"          // job de la session en échec (JobFailedData)
+	SuspiciousAccounts = "suspicious_accounts" // comptes suspects détectés à l'enrichissement (SuspiciousAccountsData)
+	AlertTriggered     = "alert_triggered"     // règle d'alerte déclenchée par une capture (AlertTriggeredData)
+)
+
+// Event est un événement d'une session d'analyse
+type Event struct {
+	Type      string          `json:"type"`
+	SessionID int64           `json:"session_id"`
+	JobID     int64           `json:"job_id,omitempty"`
+	At        time.Time       `json:"at"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// CaptureStoredData accompagne CaptureStored
+type CaptureStoredData struct {
+	CaptureID        int64  `json:"capture_id"`
+	BroadcasterID    string `json:"broadcaster_id"`
+	BroadcasterLogin string `json:"broadcaster_login"`
+	Chatters         int    `json:"chatters"`
+	UsersToEnrich    int    `json:"users_to_enrich"`
+}
+
+// EnrichmentFinishedData accompagne EnrichmentFinished
+type EnrichmentFinishedData struct {
+	UsersEnriched int `json:"users_enriched"`
+	Missing       int `json:"missing"`
+}
+
+// JobFailedData accompagne JobFailed
+type JobFailedData struct {
+	JobType string `json:"job_type"`
+	Error   string `json:"error"`
+}
+
+// SuspiciousAccountsData accompagne SuspiciousAccounts : comptes disparus de Twitch,
+// à l'avatar par défaut ou renommés parmi ceux qui viennent d'être enrichis
+type SuspiciousAccountsData struct {
+	Missing        int      `json:"missing"`
+	DefaultAvatars int      `json:"default_avatars"`
+	Renamed        []Rename `json:"renamed"`
+}
+
+// Rename est un changement de login
+type Rename struct {
+	TwitchUserID string `json:"twitch_user_id"`
+	OldLogin     string `json:"old_login"`
+	NewLogin     string `json:"new_login"`
+}
+
+// AlertTriggeredData accompagne AlertTriggered : la règle, la valeur mesurée sur la capture
+// et l'alerte enregistrée
+type AlertTriggeredData struct {
+	AlertID          int64   `json:"alert_id"`
+	RuleID           int64   `json:"rule_id"`
+	CaptureID        int64   `json:"capture_id"`
+	BroadcasterID    string  `json:"broadcaster_id"`
+	BroadcasterLogin string  `json:"broadcaster_login"`
+	Metric           string  `json:"metric"`
+	Threshold        float64 `json:"threshold"`
+	WindowDays       int     `json:"window_days"`
+	Value            float64 `json:"value"`
+}
+
+// New construit un événement daté de maintenant ; data est encodé en JSON
+func New(typ string, sessionID, jobID int64, data any) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Type: typ, SessionID: sessionID, JobID: jobID, At: time.Now().UTC(), Data: raw}, nil
+}
+
+// Channel retourne le canal pub/sub des événements d'une session
+func Channel(sessionID int64) string {
+	return fmt.Sprintf("tca:sessions:%d:events", sessionID)
+}
+
+// Bus publie et reçoit les événements sur Redis
+type Bus struct {
+	rc *redis.Client
+}
+
+// NewBus retourne un bus sur le client Redis rc
+func NewBus(rc *redis.Client) *Bus {
+	return &Bus{rc: rc}
+}
+
+// Publish publie un événement sur le canal de sa session
+func (b *Bus) Publish(ctx context.Context, ev Event) error {
+	return b.rc.Publish(ctx, Channel(ev.SessionID), ev)
+}
+
+// Subscribe s'abonne aux événements d'une session. Le canal retourné est fermé quand ctx
+// est annulé ou que la connexion Redis est perdue.
+func (b *Bus) Subscribe(ctx context.Context, sessionID int64) (<-chan Event, error) {
+	sub, err := b.rc.Subscribe(ctx, Channel(sessionID))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Event)
+	go func() {
+		<-ctx.Done()
+		_ = sub.Close() // débloque Receive
+	}()
+	go func() {
+		defer close(out)
+		for {
+			payload, err := sub.Receive(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("events subscription for session %d closed: %v", sessionID, err)
+				}
+				return
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+				log.Printf("invalid event on %s: %v", Channel(sessionID), err)
+				continue
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
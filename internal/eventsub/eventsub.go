@@ -0,0 +1,235 @@
+// Package eventsub décrit les abonnements Twitch EventSub utilisés par l'application : types
+// d'abonnements, messages reçus sur le callback (transport webhook) et leur signature, messages
+// reçus sur une session WebSocket (transport websocket).
+//
+// Twitch signe chaque message avec le secret de l'abonnement : l'en-tête
+// Twitch-Eventsub-Message-Signature vaut sha256=<hex HMAC-SHA256 de id + timestamp + corps>.
+// Le gateway vérifie la signature et l'âge du message avant de le traiter ; le mock Twitch
+// (internal/twitchmock) signe ses messages avec Sign.
+package eventsub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// En-têtes des messages envoyés au callback
+const (
+	HeaderMessageID        = "Twitch-Eventsub-Message-Id"
+	HeaderMessageTimestamp = "Twitch-Eventsub-Message-Timestamp" // RFC3339 avec nanosecondes
+	HeaderMessageSignature = "Twitch-Eventsub-Message-Signature"
+	HeaderMessageType      = "Twitch-Eventsub-Message-Type"
+	HeaderMessageRetry     = "Twitch-Eventsub-Message-Retry"
+	HeaderSubscriptionType = "Twitch-Eventsub-Subscription-Type"
+)
+
+// Transports d'un abonnement
+const (
+	TransportWebhook   = "webhook"
+	TransportWebSocket = "websocket"
+)
+
+// WebSocketURL est l'adresse du serveur EventSub WebSocket de Twitch
+const WebSocketURL = "wss://eventsub.wss.twitch.tv/ws"
+
+// Types de messages (notification et revocation sont communs aux deux transports)
+const (
+	MessageVerification     = "webhook_callback_verification"
+	MessageNotification     = "notification"
+	MessageRevocation       = "revocation"
+	MessageSessionWelcome   = "session_welcome"
+	MessageSessionKeepalive = "session_keepalive"
+	MessageSessionReconnect = "session_reconnect"
+)
+
+// Types d'abonnements suivis
+const (
+	StreamOnline  = "stream.online"
+	ChannelRaid   = "channel.raid"
+	ChannelFollow = "channel.follow"
+)
+
+// Statuts d'un abonnement (ceux de Twitch, plus NotFound)
+const (
+	StatusEnabled               = "enabled"
+	StatusVerificationPending   = "webhook_callback_verification_pending"
+	StatusVerificationFailed    = "webhook_callback_verification_failed"
+	StatusAuthorizationRevoked  = "authorization_revoked"
+	StatusUserRemoved           = "user_removed"
+	StatusFailuresExceeded      = "notification_failures_exceeded"
+	StatusWebSocketDisconnected = "websocket_disconnected"
+	// StatusNotFound : abonnement absent de la liste Twitch (état local, jamais envoyé par Twitch)
+	StatusNotFound = "not_found"
+	// StatusPending : abonnement websocket pas encore créé par le listener (état local)
+	StatusPending = "pending"
+)
+
+// MaxMessageAge est l'âge au-delà duquel un message est refusé (protection contre le rejeu)
+const MaxMessageAge = 10 * time.Minute
+
+// Erreurs de Verify
+var (
+	ErrInvalidSignature = errors.New("eventsub: invalid signature")
+	ErrStaleMessage     = errors.New("eventsub: message too old")
+)
+
+// Version retourne la version d'API d'un type d'abonnement
+func Version(subType string) string {
+	if subType == ChannelFollow {
+		return "2"
+	}
+	return "1"
+}
+
+// Condition retourne la condition d'un abonnement sur broadcasterID ; channel.follow exige
+// en plus le modérateur dont l'autorisation (moderator:read:followers) est utilisée.
+// Pour channel.raid, ce sont les raids reçus par la chaîne.
+func Condition(subType, broadcasterID, moderatorID string) map[string]string {
+	switch subType {
+	case ChannelRaid:
+		return map[string]string{"to_broadcaster_user_id": broadcasterID}
+	case ChannelFollow:
+		return map[string]string{"broadcaster_user_id": broadcasterID, "moderator_user_id": moderatorID}
+	default:
+		return map[string]string{"broadcaster_user_id": broadcasterID}
+	}
+}
+
+// Broadcaster retourne la chaîne visée par la condition d'un abonnement
+func Broadcaster(condition map[string]string) string {
+	if id := condition["to_broadcaster_user_id"]; id != "" {
+		return id
+	}
+	return condition["broadcaster_user_id"]
+}
+
+// Transport est le transport d'un abonnement : Callback et Secret pour un webhook (Secret
+// n'est jamais retourné par Twitch), SessionID pour une session WebSocket
+type Transport struct {
+	Method    string `json:"method"`
+	Callback  string `json:"callback,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// Subscription est un abonnement EventSub
+type Subscription struct {
+	ID        string            `json:"id"`
+	Status    string            `json:"status"`
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Condition map[string]string `json:"condition"`
+	Transport Transport         `json:"transport"`
+	CreatedAt time.Time         `json:"created_at"`
+	Cost      int               `json:"cost"`
+}
+
+// Message est le corps d'un message reçu sur le callback : Challenge pour la vérification,
+// Event pour une notification
+type Message struct {
+	Subscription Subscription    `json:"subscription"`
+	Challenge    string          `json:"challenge,omitempty"`
+	Event        json.RawMessage `json:"event,omitempty"`
+}
+
+// WSMessage est un message reçu sur une session WebSocket
+type WSMessage struct {
+	Metadata WSMetadata `json:"metadata"`
+	Payload  WSPayload  `json:"payload"`
+}
+
+// WSMetadata décrit un message WebSocket ; les champs Subscription* sont vides hors
+// notification et révocation
+type WSMetadata struct {
+	MessageID           string    `json:"message_id"`
+	MessageType         string    `json:"message_type"`
+	MessageTimestamp    time.Time `json:"message_timestamp"`
+	SubscriptionType    string    `json:"subscription_type,omitempty"`
+	SubscriptionVersion string    `json:"subscription_version,omitempty"`
+}
+
+// WSPayload porte Session (welcome, reconnect) ou Subscription et Event (notification,
+// révocation)
+type WSPayload struct {
+	Session      *WSSession      `json:"session,omitempty"`
+	Subscription *Subscription   `json:"subscription,omitempty"`
+	Event        json.RawMessage `json:"event,omitempty"`
+}
+
+// WSSession est une session WebSocket. KeepaliveTimeoutSeconds est le silence maximal du
+// serveur avant de considérer la connexion perdue ; ReconnectURL n'est renseignée que par
+// session_reconnect.
+type WSSession struct {
+	ID                      string    `json:"id"`
+	Status                  string    `json:"status"`
+	KeepaliveTimeoutSeconds int       `json:"keepalive_timeout_seconds"`
+	ReconnectURL            string    `json:"reconnect_url"`
+	ConnectedAt             time.Time `json:"connected_at"`
+}
+
+// StreamOnlineEvent est l'événement stream.online
+type StreamOnlineEvent struct {
+	ID                   string    `json:"id"`
+	BroadcasterUserID    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	BroadcasterUserName  string    `json:"broadcaster_user_name"`
+	Type                 string    `json:"type"`
+	StartedAt            time.Time `json:"started_at"`
+}
+
+// RaidEvent est l'événement channel.raid
+type RaidEvent struct {
+	FromBroadcasterUserID    string `json:"from_broadcaster_user_id"`
+	FromBroadcasterUserLogin string `json:"from_broadcaster_user_login"`
+	FromBroadcasterUserName  string `json:"from_broadcaster_user_name"`
+	ToBroadcasterUserID      string `json:"to_broadcaster_user_id"`
+	ToBroadcasterUserLogin   string `json:"to_broadcaster_user_login"`
+	ToBroadcasterUserName    string `json:"to_broadcaster_user_name"`
+	Viewers                  int    `json:"viewers"`
+}
+
+// FollowEvent est l'événement channel.follow
+type FollowEvent struct {
+	UserID               string    `json:"user_id"`
+	UserLogin            string    `json:"user_login"`
+	UserName             string    `json:"user_name"`
+	BroadcasterUserID    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	BroadcasterUserName  string    `json:"broadcaster_user_name"`
+	FollowedAt           time.Time `json:"followed_at"`
+}
+
+// Sign retourne la signature d'un message : sha256=<hex HMAC-SHA256 de id + timestamp + corps>
+func Sign(secret, messageID, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(messageID))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify vérifie la signature d'un message reçu à now et refuse les messages de plus de
+// MaxMessageAge (ou datés de plus de MaxMessageAge dans le futur)
+func Verify(secret string, h http.Header, body []byte, now time.Time) error {
+	id, timestamp := h.Get(HeaderMessageID), h.Get(HeaderMessageTimestamp)
+	if id == "" || timestamp == "" {
+		return ErrInvalidSignature
+	}
+	expected := Sign(secret, id, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(h.Get(HeaderMessageSignature))) {
+		return ErrInvalidSignature
+	}
+	sent, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(sent); age > MaxMessageAge || age < -MaxMessageAge {
+		return ErrStaleMessage
+	}
+	return nil
+}
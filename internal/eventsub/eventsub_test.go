@@ -0,0 +1,63 @@
+package eventsub
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// printf 'idts{}' | openssl dgst -sha256 -hmac secret-0123456789
+	want := "sha256=43ef948f0982929dbad7032d5e78696d5fcd9752d4bf7e453e6672fa6f7a23a5"
+	if got := Sign("secret-0123456789", "id", "ts", []byte("{}")); got != want {
+		t.Errorf("Sign = %q, want %q", got, want)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const secret = "secret-0123456789"
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"subscription":{"type":"stream.online"}}`)
+	signed := func(sentAt time.Time, body []byte) http.Header {
+		h := http.Header{}
+		ts := sentAt.Format(time.RFC3339Nano)
+		h.Set(HeaderMessageID, "msg-1")
+		h.Set(HeaderMessageTimestamp, ts)
+		h.Set(HeaderMessageSignature, Sign(secret, "msg-1", ts, body))
+		return h
+	}
+
+	if err := Verify(secret, signed(now.Add(-time.Minute), body), body, now); err != nil {
+		t.Errorf("valid message: %v", err)
+	}
+	if err := Verify("other-secret-123", signed(now, body), body, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong secret: %v", err)
+	}
+	if err := Verify(secret, signed(now, body), []byte(`{"subscription":{"type":"channel.raid"}}`), now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered body: %v", err)
+	}
+	tampered := signed(now, body)
+	tampered.Set(HeaderMessageID, "msg-2")
+	if err := Verify(secret, tampered, body, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered message id: %v", err)
+	}
+	if err := Verify(secret, http.Header{}, body, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("unsigned message: %v", err)
+	}
+	if err := Verify(secret, signed(now.Add(-MaxMessageAge-time.Second), body), body, now); !errors.Is(err, ErrStaleMessage) {
+		t.Errorf("stale message: %v", err)
+	}
+}
+
+func TestCondition(t *testing.T) {
+	if c := Condition(ChannelRaid, "1000", "2000"); c["to_broadcaster_user_id"] != "1000" || len(c) != 1 || Broadcaster(c) != "1000" {
+		t.Errorf("raid condition = %v", c)
+	}
+	if c := Condition(ChannelFollow, "1000", "2000"); c["moderator_user_id"] != "2000" || Broadcaster(c) != "1000" || Version(ChannelFollow) != "2" {
+		t.Errorf("follow condition = %v", c)
+	}
+	if c := Condition(StreamOnline, "1000", ""); Broadcaster(c) != "1000" || Version(StreamOnline) != "1" {
+		t.Errorf("stream.online condition = %v", c)
+	}
+}
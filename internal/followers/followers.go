@@ -0,0 +1,90 @@
+// Package followers repère les vagues de follows d'une chaîne : intervalles de BucketWidth
+// où elle gagne bien plus de followers que son rythme habituel, signe d'une attaque de
+// follow-bots.
+package followers
+
+import (
+	"sort"
+	"time"
+)
+
+// Seuils d'un pic de follows
+const (
+	BucketWidth     = 10 * time.Minute
+	SpikeMinFollows = 20 // follows minimum d'un intervalle en pic
+	SpikeFactor     = 5  // multiple minimum du rythme habituel d'un intervalle
+)
+
+// Spike est une fenêtre de follows anormalement nombreux : des intervalles en pic consécutifs
+type Spike struct {
+	Start    time.Time
+	End      time.Time // exclu
+	Follows  int64
+	Expected float64 // follows attendus sur la fenêtre au rythme habituel
+}
+
+// Spikes retourne les pics de follows, dans l'ordre chronologique. Un intervalle est candidat
+// s'il compte au moins SpikeMinFollows follows et SpikeFactor fois l'intervalle médian, entre
+// le premier et le dernier follow ; le rythme habituel est la moyenne des autres intervalles.
+func Spikes(followedAt []time.Time) []Spike {
+	if len(followedAt) == 0 {
+		return nil
+	}
+	counts := make(map[time.Time]int64)
+	first, last := followedAt[0], followedAt[0]
+	for _, t := range followedAt {
+		counts[t.Truncate(BucketWidth)]++
+		if t.Before(first) {
+			first = t
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+	buckets := make([]time.Time, 0, len(counts))
+	for b := range counts {
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Before(buckets[j]) })
+
+	// Intervalle médian : les intervalles sans follow comptent pour 0
+	span := int64(last.Truncate(BucketWidth).Sub(first.Truncate(BucketWidth))/BucketWidth) + 1
+	sorted := make([]int64, 0, len(counts))
+	for _, n := range counts {
+		sorted = append(sorted, n)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var median int64
+	if mid := span / 2; mid >= span-int64(len(sorted)) {
+		median = sorted[mid-(span-int64(len(sorted)))]
+	}
+
+	candidate := func(n int64) bool { return n >= SpikeMinFollows && n >= SpikeFactor*median }
+	usual, usualBuckets := int64(len(followedAt)), span
+	for _, b := range buckets {
+		if candidate(counts[b]) {
+			usual -= counts[b]
+			usualBuckets--
+		}
+	}
+	var baseline float64
+	if usualBuckets > 0 {
+		baseline = float64(usual) / float64(usualBuckets)
+	}
+
+	var spikes []Spike
+	for _, b := range buckets {
+		n := counts[b]
+		if !candidate(n) || float64(n) < SpikeFactor*baseline {
+			continue
+		}
+		if k := len(spikes) - 1; k >= 0 && spikes[k].End.Equal(b) {
+			spikes[k].End = b.Add(BucketWidth)
+			spikes[k].Follows += n
+			spikes[k].Expected += baseline
+			continue
+		}
+		spikes = append(spikes, Spike{Start: b, End: b.Add(BucketWidth), Follows: n, Expected: baseline})
+	}
+	return spikes
+}
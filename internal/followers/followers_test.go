@@ -0,0 +1,66 @@
+package followers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpikes(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var times []time.Time
+	// Rythme habituel : un follow toutes les 7 heures pendant 30 jours
+	for i := 0; i < 100; i++ {
+		times = append(times, t0.Add(time.Duration(i)*7*time.Hour))
+	}
+	// Vague de 50 follows en 3 minutes, puis de 60 à cheval sur deux intervalles
+	wave := t0.Add(10*24*time.Hour + 2*time.Minute)
+	for i := 0; i < 50; i++ {
+		times = append(times, wave.Add(time.Duration(i)*3*time.Second))
+	}
+	straddle := t0.Add(20*24*time.Hour + 5*time.Minute)
+	for i := 0; i < 60; i++ {
+		times = append(times, straddle.Add(time.Duration(i)*10*time.Second))
+	}
+	// 10 follows rapprochés : sous le minimum
+	small := t0.Add(25 * 24 * time.Hour)
+	for i := 0; i < 10; i++ {
+		times = append(times, small.Add(time.Duration(i)*time.Second))
+	}
+
+	spikes := Spikes(times)
+	if len(spikes) != 2 {
+		t.Fatalf("Spikes = %+v, want 2", spikes)
+	}
+	if s := spikes[0]; !s.Start.Equal(t0.Add(10*24*time.Hour)) || !s.End.Equal(s.Start.Add(BucketWidth)) || s.Follows != 50 {
+		t.Errorf("spike 0 = %+v", s)
+	}
+	if s := spikes[1]; !s.Start.Equal(t0.Add(20*24*time.Hour)) || !s.End.Equal(s.Start.Add(2*BucketWidth)) || s.Follows != 60 {
+		t.Errorf("spike 1 = %+v", s)
+	}
+	if spikes[0].Expected <= 0 || spikes[0].Expected >= 1 {
+		t.Errorf("expected = %f, want the usual rate of one bucket", spikes[0].Expected)
+	}
+}
+
+func TestSpikesEdgeCases(t *testing.T) {
+	if got := Spikes(nil); got != nil {
+		t.Errorf("Spikes(nil) = %+v", got)
+	}
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Tous les follows récupérés dans un seul intervalle : rien à quoi le comparer
+	var burst []time.Time
+	for i := 0; i < 3*SpikeMinFollows; i++ {
+		burst = append(burst, t0.Add(time.Duration(i)*time.Second))
+	}
+	if got := Spikes(burst); len(got) != 0 {
+		t.Errorf("Spikes(burst) = %+v", got)
+	}
+	// Chaîne très suivie : 30 follows par intervalle en continu, pas de pic
+	var steady []time.Time
+	for i := 0; i < 30*144; i++ {
+		steady = append(steady, t0.Add(time.Duration(i)*20*time.Second))
+	}
+	if got := Spikes(steady); len(got) != 0 {
+		t.Errorf("Spikes(steady) = %+v", got)
+	}
+}
@@ -0,0 +1,510 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+)
+
+// Alertes : l'utilisateur définit des seuils par chaîne ; le worker les évalue sur chaque
+// capture terminée de ses sessions et enregistre une alerte par règle atteinte, à acquitter.
+
+// AlertMetric décrit une métrique dans le formulaire de création
+type AlertMetric struct {
+	Name        string
+	Description string
+	Percent     bool // seuil en pourcentage (sinon en nombre de comptes)
+}
+
+var alertMetrics = []AlertMetric{
+	{store.AlertRecentAccountsPct, "% des chatters dont le compte a moins de N jours", true},
+	{store.AlertCreationDayAccounts, "Comptes créés le même jour (jour le plus fréquent)", false},
+	{store.AlertDefaultAvatarPct, "% des chatters à l'avatar par défaut", true},
+}
+
+// Limites des règles et des listes d'alertes
+const (
+	alertRulesMax      = 50  // règles par utilisateur
+	alertDefaultWindow = 7   // jours, recent_accounts_pct
+	alertWindowDaysMax = 365 // jours
+	alertsShown        = 50  // alertes affichées sur la page
+	alertsAPILimit     = 50  // alertes retournées par l'API par défaut
+	alertsAPILimitMax  = 200
+)
+
+func alertMetric(name string) (AlertMetric, bool) {
+	i := slices.IndexFunc(alertMetrics, func(m AlertMetric) bool { return m.Name == name })
+	if i < 0 {
+		return AlertMetric{}, false
+	}
+	return alertMetrics[i], true
+}
+
+// alertRuleError retourne la raison (en anglais, pour l'API) pour laquelle une règle est invalide, ou ""
+func alertRuleError(rule store.AlertRule) string {
+	m, ok := alertMetric(rule.Metric)
+	switch {
+	case rule.BroadcasterID == "" || len(rule.BroadcasterID) > 64 || rule.BroadcasterLogin == "" || len(rule.BroadcasterLogin) > 255:
+		return "broadcaster_id and broadcaster_login are required"
+	case !ok:
+		return "unknown metric"
+	case rule.Threshold <= 0 || (m.Percent && rule.Threshold > 100):
+		return "threshold must be positive (at most 100 for a percentage)"
+	case rule.WindowDays < 1 || rule.WindowDays > alertWindowDaysMax:
+		return "window_days must be between 1 and 365"
+	}
+	return ""
+}
+
+// createAlertRule enregistre une règle valide si l'utilisateur n'a pas atteint la limite
+func (a *App) createAlertRule(r *http.Request, u *CurrentUser, rule store.AlertRule) (int64, bool, error) {
+	rules, err := a.store.Alerts.ListRules(r.Context(), u.ID)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(rules) >= alertRulesMax {
+		return 0, false, nil
+	}
+	rule.UserID = u.ID
+	rule.Enabled = true
+	rule.CreatedAt = time.Now().UTC()
+	id, err := a.store.Alerts.CreateRule(r.Context(), rule)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := a.store.Audit.Log(r.Context(), store.AuditAlertRuleCreated, u.ID, 0, map[string]any{
+		"rule_id": id, "broadcaster_id": rule.BroadcasterID, "metric": rule.Metric, "threshold": rule.Threshold,
+	}); err != nil {
+		log.Printf("audit log error: %v", err)
+	}
+	return id, true, nil
+}
+
+// deleteAlertRule supprime une règle de l'utilisateur ; ErrNotFound si elle n'existe pas
+func (a *App) deleteAlertRule(r *http.Request, u *CurrentUser, id int64) error {
+	if err := a.store.Alerts.DeleteRule(r.Context(), u.ID, id); err != nil {
+		return err
+	}
+	if err := a.store.Audit.Log(r.Context(), store.AuditAlertRuleDeleted, u.ID, 0, map[string]any{"rule_id": id}); err != nil {
+		log.Printf("audit log error: %v", err)
+	}
+	return nil
+}
+
+// unacknowledgedAlerts retourne les alertes à acquitter de l'utilisateur par broadcaster_id
+// et leur total ; une erreur est journalisée (pas de badge)
+func (a *App) unacknowledgedAlerts(r *http.Request, u *CurrentUser) (map[string]int, int) {
+	counts, err := a.store.Alerts.Unacknowledged(r.Context(), u.ID)
+	if err != nil {
+		log.Printf("count alerts error: %v", err)
+		return nil, 0
+	}
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return counts, total
+}
+
+// handleAlerts affiche les règles d'alerte, le formulaire de création (prérempli par
+// ?broadcaster_id=&broadcaster_login=) et les dernières alertes
+func (a *App) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+	a.renderAlerts(w, r, u, "")
+}
+
+func (a *App) renderAlerts(w http.ResponseWriter, r *http.Request, u *CurrentUser, formError string) {
+	rules, err := a.store.Alerts.ListRules(r.Context(), u.ID)
+	if err != nil {
+		log.Printf("list alert rules error: %v", err)
+		http.Error(w, "failed to load alerts", http.StatusInternalServerError)
+		return
+	}
+	alerts, err := a.store.Alerts.ListAlerts(r.Context(), u.ID, false, alertsShown)
+	if err != nil {
+		log.Printf("list alerts error: %v", err)
+		http.Error(w, "failed to load alerts", http.StatusInternalServerError)
+		return
+	}
+	_, unacknowledged := a.unacknowledgedAlerts(r, u)
+
+	// Formulaire prérempli : chaîne choisie sur /channels, ou saisie refusée
+	form := r.URL.Query()
+	if r.Method == http.MethodPost {
+		form = r.Form
+	}
+
+	data := struct {
+		Title            string
+		CurrentUser      *CurrentUser
+		HasActiveSession bool
+		Rules            []store.AlertRule
+		Alerts           []store.Alert
+		Unacknowledged   int
+		Metrics          []AlertMetric
+		BroadcasterID    string
+		BroadcasterLogin string
+		FormError        string
+		Notice           string
+	}{
+		Title:            "Alertes",
+		CurrentUser:      u,
+		HasActiveSession: a.hasActiveSession(r.Context(), u.ID),
+		Rules:            rules,
+		Alerts:           alerts,
+		Unacknowledged:   unacknowledged,
+		Metrics:          alertMetrics,
+		BroadcasterID:    form.Get("broadcaster_id"),
+		BroadcasterLogin: form.Get("broadcaster_login"),
+		FormError:        formError,
+		Notice:           r.URL.Query().Get("notice"),
+	}
+
+	if err := a.templates.ExecuteTemplate(w, "alerts.html", data); err != nil {
+		log.Printf("template error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// handleCreateAlertRule enregistre une règle d'alerte
+func (a *App) handleCreateAlertRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	rule := store.AlertRule{
+		BroadcasterID:    strings.TrimSpace(r.Form.Get("broadcaster_id")),
+		BroadcasterLogin: strings.ToLower(strings.TrimSpace(r.Form.Get("broadcaster_login"))),
+		Metric:           r.Form.Get("metric"),
+		WindowDays:       alertDefaultWindow,
+	}
+	threshold, errThreshold := strconv.ParseFloat(strings.Replace(r.Form.Get("threshold"), ",", ".", 1), 64)
+	rule.Threshold = threshold
+	if v := r.Form.Get("window_days"); v != "" {
+		rule.WindowDays, _ = strconv.Atoi(v) // 0 si invalide, refusé ci-dessous
+	}
+
+	metric, metricOK := alertMetric(rule.Metric)
+	switch {
+	case rule.BroadcasterID == "" || len(rule.BroadcasterID) > 64 || rule.BroadcasterLogin == "" || len(rule.BroadcasterLogin) > 255:
+		a.renderAlerts(w, r, u, "Choisissez la chaîne depuis la page Mes chaînes.")
+		return
+	case !metricOK:
+		a.renderAlerts(w, r, u, "Métrique invalide.")
+		return
+	case errThreshold != nil || threshold <= 0 || (metric.Percent && threshold > 100):
+		a.renderAlerts(w, r, u, "Le seuil doit être un nombre positif (100 au plus pour un pourcentage).")
+		return
+	case rule.WindowDays < 1 || rule.WindowDays > alertWindowDaysMax:
+		a.renderAlerts(w, r, u, "La période doit être comprise entre 1 et 365 jours.")
+		return
+	}
+
+	_, created, err := a.createAlertRule(r, u, rule)
+	if err != nil {
+		log.Printf("create alert rule error: %v", err)
+		http.Error(w, "failed to create alert rule", http.StatusInternalServerError)
+		return
+	}
+	if !created {
+		a.renderAlerts(w, r, u, "Limite de "+strconv.Itoa(alertRulesMax)+" règles atteinte : supprimez-en une.")
+		return
+	}
+
+	http.Redirect(w, r, "/alerts?notice=created", http.StatusFound)
+}
+
+// handleDeleteAlertRule supprime une règle d'alerte ; ses alertes sont conservées
+func (a *App) handleDeleteAlertRule(w http.ResponseWriter, r *http.Request) {
+	u, id, ok := alertFormID(w, r, "rule_id")
+	if !ok {
+		return
+	}
+
+	if err := a.deleteAlertRule(r, u, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("delete alert rule error: %v", err)
+		http.Error(w, "failed to delete alert rule", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/alerts?notice=deleted", http.StatusFound)
+}
+
+// handleAcknowledgeAlert acquitte une alerte
+func (a *App) handleAcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	u, id, ok := alertFormID(w, r, "alert_id")
+	if !ok {
+		return
+	}
+
+	if err := a.store.Alerts.Acknowledge(r.Context(), u.ID, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("acknowledge alert error: %v", err)
+		http.Error(w, "failed to acknowledge alert", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/alerts", http.StatusFound)
+}
+
+// handleAcknowledgeAllAlerts acquitte toutes les alertes de l'utilisateur
+func (a *App) handleAcknowledgeAllAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+
+	if _, err := a.store.Alerts.AcknowledgeAll(r.Context(), u.ID); err != nil {
+		log.Printf("acknowledge alerts error: %v", err)
+		http.Error(w, "failed to acknowledge alerts", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/alerts", http.StatusFound)
+}
+
+// alertFormID retourne l'utilisateur et l'id du champ field d'un formulaire POST ; en cas
+// d'erreur, la réponse est déjà écrite
+func alertFormID(w http.ResponseWriter, r *http.Request, field string) (*CurrentUser, int64, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, 0, false
+	}
+
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return nil, 0, false
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return nil, 0, false
+	}
+	id, err := strconv.ParseInt(r.Form.Get(field), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid "+field, http.StatusBadRequest)
+		return nil, 0, false
+	}
+	return u, id, true
+}
+
+// APIAlertRule est une règle d'alerte, dans l'API
+type APIAlertRule struct {
+	ID               int64     `json:"id"`
+	BroadcasterID    string    `json:"broadcaster_id"`
+	BroadcasterLogin string    `json:"broadcaster_login"`
+	Metric           string    `json:"metric"`
+	Threshold        float64   `json:"threshold"`
+	WindowDays       int       `json:"window_days"`
+	Enabled          bool      `json:"enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// APIAlert est une alerte déclenchée, dans l'API
+type APIAlert struct {
+	ID               int64           `json:"id"`
+	RuleID           *int64          `json:"rule_id"` // null si la règle a été supprimée
+	SessionUUID      string          `json:"session_uuid,omitempty"`
+	CaptureID        int64           `json:"capture_id"`
+	BroadcasterID    string          `json:"broadcaster_id"`
+	BroadcasterLogin string          `json:"broadcaster_login"`
+	Metric           string          `json:"metric"`
+	Threshold        float64         `json:"threshold"`
+	WindowDays       int             `json:"window_days"`
+	Value            float64         `json:"value"`
+	Details          json.RawMessage `json:"details,omitempty"`
+	TriggeredAt      time.Time       `json:"triggered_at"`
+	AcknowledgedAt   *time.Time      `json:"acknowledged_at"`
+}
+
+func toAPIAlertRule(r store.AlertRule) APIAlertRule {
+	return APIAlertRule{
+		ID:               r.ID,
+		BroadcasterID:    r.BroadcasterID,
+		BroadcasterLogin: r.BroadcasterLogin,
+		Metric:           r.Metric,
+		Threshold:        r.Threshold,
+		WindowDays:       r.WindowDays,
+		Enabled:          r.Enabled,
+		CreatedAt:        r.CreatedAt,
+	}
+}
+
+func toAPIAlert(a store.Alert) APIAlert {
+	return APIAlert{
+		ID:               a.ID,
+		RuleID:           a.RuleID,
+		SessionUUID:      a.SessionUUID,
+		CaptureID:        a.CaptureID,
+		BroadcasterID:    a.BroadcasterID,
+		BroadcasterLogin: a.BroadcasterLogin,
+		Metric:           a.Metric,
+		Threshold:        a.Threshold,
+		WindowDays:       a.WindowDays,
+		Value:            a.Value,
+		Details:          a.Details,
+		TriggeredAt:      a.TriggeredAt,
+		AcknowledgedAt:   a.AcknowledgedAt,
+	}
+}
+
+// apiAlertRules liste les règles d'alerte de l'utilisateur
+func (a *App) apiAlertRules(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	rules, err := a.store.Alerts.ListRules(r.Context(), u.ID)
+	if err != nil {
+		apiInternalError(w, "list alert rules", err)
+		return
+	}
+	out := make([]APIAlertRule, 0, len(rules))
+	for _, rule := range rules {
+		out = append(out, toAPIAlertRule(rule))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"rules": out})
+}
+
+// apiCreateAlertRule crée une règle d'alerte
+func (a *App) apiCreateAlertRule(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	var req struct {
+		BroadcasterID    string  `json:"broadcaster_id"`
+		BroadcasterLogin string  `json:"broadcaster_login"`
+		Metric           string  `json:"metric"`
+		Threshold        float64 `json:"threshold"`
+		WindowDays       *int    `json:"window_days"`
+	}
+	if err := decodeJSONBody(r, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	rule := store.AlertRule{
+		BroadcasterID:    strings.TrimSpace(req.BroadcasterID),
+		BroadcasterLogin: strings.ToLower(strings.TrimSpace(req.BroadcasterLogin)),
+		Metric:           req.Metric,
+		Threshold:        req.Threshold,
+		WindowDays:       alertDefaultWindow,
+	}
+	if req.WindowDays != nil {
+		rule.WindowDays = *req.WindowDays
+	}
+	if msg := alertRuleError(rule); msg != "" {
+		writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, msg)
+		return
+	}
+
+	id, created, err := a.createAlertRule(r, u, rule)
+	if err != nil {
+		apiInternalError(w, "create alert rule", err)
+		return
+	}
+	if !created {
+		writeAPIError(w, http.StatusConflict, apiErrConflict, "alert rules limit reached")
+		return
+	}
+	saved, err := a.store.Alerts.GetRule(r.Context(), u.ID, id)
+	if err != nil {
+		apiInternalError(w, "load alert rule", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toAPIAlertRule(*saved))
+}
+
+// apiDeleteAlertRule supprime une règle d'alerte
+func (a *App) apiDeleteAlertRule(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "invalid alert rule id")
+		return
+	}
+	err = a.deleteAlertRule(r, u, id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeAPIError(w, http.StatusNotFound, apiErrNotFound, "alert rule not found")
+		return
+	}
+	if err != nil {
+		apiInternalError(w, "delete alert rule", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiAlerts liste les dernières alertes (paramètres unacknowledged et limit, 50 par défaut)
+func (a *App) apiAlerts(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	query := r.URL.Query()
+	unacknowledged := false
+	if v := query.Get("unacknowledged"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "unacknowledged must be a boolean")
+			return
+		}
+		unacknowledged = b
+	}
+	limit := alertsAPILimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > alertsAPILimitMax {
+			writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "limit must be between 1 and 200")
+			return
+		}
+		limit = n
+	}
+
+	alerts, err := a.store.Alerts.ListAlerts(r.Context(), u.ID, unacknowledged, limit)
+	if err != nil {
+		apiInternalError(w, "list alerts", err)
+		return
+	}
+	_, total := a.unacknowledgedAlerts(r, u)
+	out := make([]APIAlert, 0, len(alerts))
+	for _, alert := range alerts {
+		out = append(out, toAPIAlert(alert))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"alerts": out, "unacknowledged": total})
+}
+
+// apiAcknowledgeAlert acquitte une alerte
+func (a *App) apiAcknowledgeAlert(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "invalid alert id")
+		return
+	}
+	err = a.store.Alerts.Acknowledge(r.Context(), u.ID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeAPIError(w, http.StatusNotFound, apiErrNotFound, "alert not found")
+		return
+	}
+	if err != nil {
+		apiInternalError(w, "acknowledge alert", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,167 @@
+package gateway
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+)
+
+// API JSON versionnée du gateway (/api/v1). Les routes sont déclarées dans apiRoutes et
+// décrites par openapi.json, servi sur /api/v1/openapi.json ; TestAPIRoutesMatchSpec vérifie
+// que les deux restent alignés. Toutes les erreurs ont le corps :
+//
+//	{"error": {"code": "not_found", "message": "session not found"}}
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// Codes d'erreur de l'API
+const (
+	apiErrInvalidRequest   = "invalid_request"
+	apiErrUnauthorized     = "unauthorized"
+	apiErrTwitchAuth       = "twitch_unauthorized"
+	apiErrForbidden        = "insufficient_scope"
+	apiErrNotFound         = "not_found"
+	apiErrMethodNotAllowed = "method_not_allowed"
+	apiErrConflict         = "conflict"
+	apiErrQuotaExceeded    = "quota_exceeded"
+	apiErrUpstream         = "upstream_error"
+	apiErrUnavailable      = "unavailable"
+	apiErrInternal         = "internal_error"
+)
+
+// APIError est le corps d'une réponse d'erreur de l'API
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// apiRoute est une opération de l'API ; le motif suit la syntaxe de http.ServeMux.
+// scope est la portée exigée des tokens d'API (x-scope dans openapi.json)
+type apiRoute struct {
+	method  string
+	path    string
+	scope   string
+	handler http.HandlerFunc
+}
+
+// apiRoutes liste les opérations de l'API ; chacune doit figurer dans openapi.json
+func (a *App) apiRoutes() []apiRoute {
+	auth := func(method, path, scope string, h func(w http.ResponseWriter, r *http.Request, u *CurrentUser)) apiRoute {
+		return apiRoute{method, path, scope, a.apiAuth(scope, h)}
+	}
+	return []apiRoute{
+		{http.MethodGet, "/api/v1/openapi.json", "", a.apiOpenAPI},
+		auth(http.MethodGet, "/api/v1/me", "", a.apiMe),
+		auth(http.MethodGet, "/api/v1/channels", scopeAnalysisRead, a.apiChannels),
+		auth(http.MethodPost, "/api/v1/captures", scopeCapture, a.apiCreateCapture),
+		auth(http.MethodPost, "/api/v1/followers", scopeCapture, a.apiCreateFollowersFetch),
+		auth(http.MethodGet, "/api/v1/jobs/{id}", scopeAnalysisRead, a.apiJob),
+		auth(http.MethodGet, "/api/v1/sessions", scopeAnalysisRead, a.apiSessions),
+		auth(http.MethodGet, "/api/v1/sessions/{uuid}", scopeAnalysisRead, a.apiSession),
+		auth(http.MethodDelete, "/api/v1/sessions/{uuid}", scopeSessionsManage, a.apiDeleteSession),
+		auth(http.MethodPost, "/api/v1/sessions/{uuid}/save", scopeSessionsManage, a.apiSaveSession),
+		auth(http.MethodPost, "/api/v1/sessions/{uuid}/purge", scopeSessionsManage, a.apiPurgeSession),
+		auth(http.MethodGet, "/api/v1/sessions/{uuid}/summary", scopeAnalysisRead, a.apiSummary),
+		auth(http.MethodGet, "/api/v1/sessions/{uuid}/export", scopeAnalysisRead, a.apiExport),
+		auth(http.MethodGet, "/api/v1/sessions/{uuid}/jobs", scopeAnalysisRead, a.apiSessionJobs),
+		auth(http.MethodGet, "/api/v1/sessions/{uuid}/events", scopeAnalysisRead, a.apiSessionEvents),
+		auth(http.MethodGet, "/api/v1/alerts", scopeAnalysisRead, a.apiAlerts),
+		auth(http.MethodPost, "/api/v1/alerts/{id}/acknowledge", scopeAlertsManage, a.apiAcknowledgeAlert),
+		auth(http.MethodGet, "/api/v1/alert-rules", scopeAnalysisRead, a.apiAlertRules),
+		auth(http.MethodPost, "/api/v1/alert-rules", scopeAlertsManage, a.apiCreateAlertRule),
+		auth(http.MethodDelete, "/api/v1/alert-rules/{id}", scopeAlertsManage, a.apiDeleteAlertRule),
+	}
+}
+
+// apiHandler retourne le routeur de /api/v1/ : les routes inconnues et les méthodes non
+// supportées reçoivent aussi une erreur JSON
+func (a *App) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	for _, route := range a.apiRoutes() {
+		mux.HandleFunc(route.method+" "+route.path, route.handler)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern == "" {
+			// 404 ou 405 (avec l'en-tête Allow) : statut repris du ServeMux, corps JSON
+			rec := &statusRecorder{header: http.Header{}, status: http.StatusOK}
+			h.ServeHTTP(rec, r)
+			switch rec.status {
+			case http.StatusNotFound:
+				writeAPIError(w, http.StatusNotFound, apiErrNotFound, "no such API route")
+				return
+			case http.StatusMethodNotAllowed:
+				w.Header().Set("Allow", rec.header.Get("Allow"))
+				writeAPIError(w, http.StatusMethodNotAllowed, apiErrMethodNotAllowed, "method not allowed")
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder retient le statut et les en-têtes d'une réponse sans en garder le corps
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (s *statusRecorder) Header() http.Header         { return s.header }
+func (s *statusRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (s *statusRecorder) WriteHeader(code int)        { s.status = code }
+
+// apiAuth exige un utilisateur connecté (session web ou token d'API de portée scope)
+func (a *App) apiAuth(scope string, next func(w http.ResponseWriter, r *http.Request, u *CurrentUser)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := currentUser(r.Context())
+		if u == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeAPIError(w, http.StatusUnauthorized, apiErrUnauthorized, "authentication required")
+			return
+		}
+		if !u.hasScope(scope) {
+			writeAPIErrorDetails(w, http.StatusForbidden, apiErrForbidden, "token lacks the "+scope+" scope",
+				map[string]string{"required_scope": scope})
+			return
+		}
+		next(w, r, u)
+	}
+}
+
+// apiOpenAPI sert la description OpenAPI de l'API
+func (a *App) apiOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("json encode error: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]APIError{"error": {Code: code, Message: message}})
+}
+
+func writeAPIErrorDetails(w http.ResponseWriter, status int, code, message string, details any) {
+	writeJSON(w, status, map[string]APIError{"error": {Code: code, Message: message, Details: details}})
+}
+
+// decodeJSONBody décode le corps JSON d'une requête dans dest ; un corps vide est accepté
+func decodeJSONBody(r *http.Request, dest any) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dest); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
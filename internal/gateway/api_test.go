@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestAPIRoutesMatchSpec vérifie que openapi.json décrit exactement les routes de apiRoutes
+func TestAPIRoutesMatchSpec(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]struct {
+			OperationID string          `json:"operationId"`
+			Scope       string          `json:"x-scope"`
+			Security    json.RawMessage `json:"security"`
+			Responses   map[string]any  `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("invalid openapi.json: %v", err)
+	}
+
+	documented := map[string]string{} // opération -> x-scope
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			key := strings.ToUpper(method) + " " + path
+			documented[key] = op.Scope
+			if op.OperationID == "" {
+				t.Errorf("%s: missing operationId", key)
+			}
+			// Opérations authentifiées (security globale) : 401 documenté
+			if op.Security == nil {
+				if _, ok := op.Responses["401"]; !ok {
+					t.Errorf("%s: 401 response not documented", key)
+				}
+			}
+			if _, ok := op.Responses["403"]; op.Scope != "" && !ok {
+				t.Errorf("%s: 403 response not documented", key)
+			}
+		}
+	}
+
+	var missing []string
+	for _, route := range (&App{}).apiRoutes() {
+		key := route.method + " " + route.path
+		scope, ok := documented[key]
+		if !ok {
+			missing = append(missing, key)
+		} else if scope != route.scope {
+			t.Errorf("%s: x-scope = %q, want %q", key, scope, route.scope)
+		}
+		delete(documented, key)
+	}
+	var extra []string
+	for key := range documented {
+		extra = append(extra, key)
+	}
+	sort.Strings(extra)
+	if len(missing) > 0 {
+		t.Errorf("routes missing from openapi.json: %v", missing)
+	}
+	if len(extra) > 0 {
+		t.Errorf("openapi.json documents unknown routes: %v", extra)
+	}
+}
+
+// TestAPIErrors vérifie le format JSON des erreurs produites hors des handlers
+func TestAPIErrors(t *testing.T) {
+	h := (&App{}).apiHandler()
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{http.MethodGet, "/api/v1/unknown", http.StatusNotFound, apiErrNotFound},
+		{http.MethodPut, "/api/v1/sessions", http.StatusMethodNotAllowed, apiErrMethodNotAllowed},
+		{http.MethodGet, "/api/v1/sessions", http.StatusUnauthorized, apiErrUnauthorized},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+
+		var body struct {
+			Error APIError `json:"error"`
+		}
+		if rec.Code != tc.status || json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.Error.Code != tc.code {
+			t.Errorf("%s %s = %d %s, want %d with code %s", tc.method, tc.path, rec.Code, rec.Body, tc.status, tc.code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: Content-Type = %q", tc.method, tc.path, ct)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/v1/sessions", nil))
+	if allow := rec.Header().Get("Allow"); !strings.Contains(allow, http.MethodGet) {
+		t.Errorf("405 Allow = %q, want GET", allow)
+	}
+
+	// Token d'API sans la portée de l'opération
+	u := &CurrentUser{ID: 1, APITokenID: 1, Scopes: []string{scopeCapture}}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req.WithContext(context.WithValue(req.Context(), ctxKeyUser, u)))
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), scopeAnalysisRead) {
+		t.Errorf("GET /api/v1/sessions without scope = %d %s, want 403 naming %s", rec.Code, rec.Body, scopeAnalysisRead)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                   "",
+		"Bearer tca_abc":     "tca_abc",
+		"bearer  tca_abc ":   "tca_abc",
+		"Basic dXNlcjpwYXNz": "",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		if got := bearerToken(r); got != want {
+			t.Errorf("bearerToken(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitch"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchauth"
+)
+
+// channelsCache conserve la liste des chaînes modérées de chaque utilisateur,
+// pour ne pas repaginer /moderation/channels à chaque affichage de /channels
+type channelsCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[int64]channelsCacheEntry
+}
+
+type channelsCacheEntry struct {
+	channels  []twitch.ModeratedChannel
+	expiresAt time.Time
+}
+
+func newChannelsCache(ttl time.Duration) *channelsCache {
+	return &channelsCache{
+		ttl:     ttl,
+		entries: make(map[int64]channelsCacheEntry),
+	}
+}
+
+func (c *channelsCache) get(userID int64) ([]twitch.ModeratedChannel, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[userID]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.channels, true
+}
+
+func (c *channelsCache) set(userID int64, channels []twitch.ModeratedChannel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Purge opportuniste des entrées expirées
+	now := time.Now()
+	for id, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+	c.entries[userID] = channelsCacheEntry{channels: channels, expiresAt: now.Add(c.ttl)}
+}
+
+// invalidate supprime la liste en cache d'un utilisateur (rafraîchissement, déconnexion)
+func (c *channelsCache) invalidate(userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, userID)
+}
+
+// moderatedChannels retourne les chaînes modérées de l'utilisateur, depuis le cache si possible.
+// Avec refresh, le cache local et celui du proxy twitch-api sont ignorés.
+func (a *App) moderatedChannels(ctx context.Context, u *CurrentUser, token *twitchauth.Token, refresh bool) ([]twitch.ModeratedChannel, error) {
+	if refresh {
+		a.channelsCache.invalidate(u.ID)
+		ctx = twitch.NoCache(ctx)
+	} else if channels, ok := a.channelsCache.get(u.ID); ok {
+		return channels, nil
+	}
+
+	var channels []twitch.ModeratedChannel
+	err := token.Do(ctx, func(accessToken string) (err error) {
+		channels, err = a.fetchModeratedChannels(ctx, accessToken, u.TwitchUserID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.channelsCache.set(u.ID, channels)
+	return channels, nil
+}
+
+// filterChannels retourne les chaînes dont l'ID, le login ou le nom contient query (insensible à la casse)
+func filterChannels(channels []twitch.ModeratedChannel, query string) []twitch.ModeratedChannel {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return channels
+	}
+	out := make([]twitch.ModeratedChannel, 0, len(channels))
+	for _, c := range channels {
+		if strings.Contains(strings.ToLower(c.BroadcasterLogin), query) ||
+			strings.Contains(strings.ToLower(c.BroadcasterName), query) ||
+			c.BroadcasterID == query {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// sortChannels trie une copie de la liste selon sortBy :
+// "login", "login_desc", "name" ou "id" ; toute autre valeur conserve l'ordre Twitch
+// (propre chaîne en premier).
+func sortChannels(channels []twitch.ModeratedChannel, sortBy string) []twitch.ModeratedChannel {
+	out := make([]twitch.ModeratedChannel, len(channels))
+	copy(out, channels)
+
+	var less func(i, j int) bool
+	switch sortBy {
+	case "login":
+		less = func(i, j int) bool { return out[i].BroadcasterLogin < out[j].BroadcasterLogin }
+	case "login_desc":
+		less = func(i, j int) bool { return out[i].BroadcasterLogin > out[j].BroadcasterLogin }
+	case "name":
+		less = func(i, j int) bool {
+			return strings.ToLower(out[i].BroadcasterName) < strings.ToLower(out[j].BroadcasterName)
+		}
+	case "id":
+		// Les IDs Twitch sont numériques : comparer d'abord la longueur
+		less = func(i, j int) bool {
+			a, b := out[i].BroadcasterID, out[j].BroadcasterID
+			if len(a) != len(b) {
+				return len(a) < len(b)
+			}
+			return a < b
+		}
+	default:
+		return out
+	}
+	sort.SliceStable(out, less)
+	return out
+}
@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchauth"
+)
+
+// upsertUser crée ou met à jour un utilisateur dans la base de données
+func (a *App) upsertUser(ctx context.Context, u twitchUser) (int64, error) {
+	return a.store.Users.Upsert(ctx, store.User{
+		TwitchUserID: u.ID,
+		Login:        u.Login,
+		DisplayName:  u.DisplayName,
+		AvatarURL:    u.ProfileImageURL,
+	})
+}
+
+// createWebSession crée une nouvelle session web
+func (a *App) createWebSession(ctx context.Context, userID int64, accessToken, refreshToken string, scopes []string) (string, error) {
+	sessionID, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	err = a.store.WebSessions.Create(ctx, store.WebSession{
+		SessionID:      sessionID,
+		UserID:         userID,
+		AccessToken:    accessToken,
+		RefreshToken:   refreshToken,
+		Scopes:         scopes,
+		CreatedAt:      now,
+		LastActivityAt: now,
+		ExpiresAt:      now.Add(24 * time.Hour), // durée de session à ajuster
+	})
+	if err != nil {
+		return "", err
+	}
+	return sessionID, nil
+}
+
+// setSessionCookie définit le cookie de session
+func (a *App) setSessionCookie(w http.ResponseWriter, sessionID string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "tca_session",
+		Value:    sessionID,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   false, // à passer à true en prod avec HTTPS
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   24 * 60 * 60, // 24h
+	})
+}
+
+// getSessionData récupère les données d'une session web
+func (a *App) getSessionData(ctx context.Context, sessionID string) (*SessionData, error) {
+	ws, err := a.store.WebSessions.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionData{
+		SessionID:    sessionID,
+		UserID:       ws.UserID,
+		AccessToken:  ws.AccessToken,
+		RefreshToken: ws.RefreshToken,
+	}, nil
+}
+
+// twitchToken retourne le token Twitch de la session web, renouvelé si Twitch le refuse
+func (a *App) twitchToken(sess *SessionData) *twitchauth.Token {
+	return twitchauth.New(a.store, a.twitch, store.WebSession{
+		SessionID:    sess.SessionID,
+		UserID:       sess.UserID,
+		AccessToken:  sess.AccessToken,
+		RefreshToken: sess.RefreshToken,
+	})
+}
+
+// getActiveSessionUUID récupère l'UUID de la session active d'un utilisateur
+func (a *App) getActiveSessionUUID(ctx context.Context, userID int64) (string, error) {
+	sess, err := a.store.Sessions.Active(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return sess.UUID, nil
+}
+
+// hasActiveSession indique si l'utilisateur a une session d'analyse active (bandeaux des pages)
+func (a *App) hasActiveSession(ctx context.Context, userID int64) bool {
+	active, err := a.store.Sessions.HasActive(ctx, userID)
+	if err != nil {
+		log.Printf("HasActive error for user %d: %v", userID, err)
+	}
+	return active
+}
@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Flux Server-Sent Events d'une session d'analyse : le worker publie les événements sur le
+// pub/sub Redis (internal/events) et la réplique du gateway qui tient la connexion du client
+// les relaie. Chaque message SSE porte le type de l'événement (event:) et l'événement
+// complet en JSON (data:).
+
+// sseHeartbeat : intervalle des commentaires qui gardent la connexion ouverte derrière les proxys
+const sseHeartbeat = 25 * time.Second
+
+// sseRetry : délai de reconnexion du navigateur après une coupure, en millisecondes
+const sseRetry = 5000
+
+// apiSessionEvents diffuse les événements d'une session en text/event-stream jusqu'à la
+// déconnexion du client ; 503 unavailable si les événements sont désactivés (sans REDIS_URL)
+func (a *App) apiSessionEvents(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	sess, ok := a.apiUserSession(w, r, u)
+	if !ok {
+		return
+	}
+	if a.events == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, apiErrUnavailable, "live session events are disabled")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	evs, err := a.events.Subscribe(ctx, sess.ID)
+	if err != nil {
+		log.Printf("subscribe to session %d events error: %v", sess.ID, err)
+		writeAPIError(w, http.StatusServiceUnavailable, apiErrUnavailable, "event stream unavailable")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // pas de mise en tampon par un proxy nginx
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry)
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		if err := rc.Flush(); err != nil {
+			log.Printf("sse flush error: %v", err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-evs:
+			if !ok {
+				// Abonnement Redis perdu : le navigateur se reconnecte après sseRetry
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Printf("sse encode error: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+	}
+}
@@ -0,0 +1,458 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/autocapture"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/eventsub"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitch"
+)
+
+// Captures automatiques : l'utilisateur abonne une chaîne qu'il modère à un événement
+// EventSub ; à chaque notification, une capture est planifiée pour chacun des délais de
+// l'abonnement (internal/autocapture). En transport webhook, les notifications arrivent sur
+// /eventsub/callback et un abonnement Twitch est partagé par tous les utilisateurs abonnés au
+// même événement de la même chaîne. En transport websocket, le gateway enregistre seulement
+// l'abonnement : le worker eventsub-ws le crée chez Twitch sur la session WebSocket de
+// l'utilisateur et reçoit ses notifications.
+
+// EventSubType décrit un type d'abonnement dans le formulaire de création
+type EventSubType struct {
+	Name           string
+	Description    string
+	DefaultOffsets string
+}
+
+var eventSubTypes = []EventSubType{
+	{eventsub.StreamOnline, "Début de live", "5m, 30m"},
+	{eventsub.ChannelRaid, "Raid reçu", "0s, 2m, 10m"},
+	{eventsub.ChannelFollow, "Nouveau follower (journalisé, sans capture par défaut)", ""},
+}
+
+// Limites des abonnements
+const (
+	eventSubMax         = 50            // abonnements par utilisateur
+	eventSubOffsetsMax  = 5             // captures par notification
+	eventSubOffsetMax   = 6 * time.Hour // délai maximal d'une capture
+	eventSubEventsShown = 50            // notifications affichées sur la page
+	eventSubMaxBody     = 1 << 20       // corps d'un message reçu sur le callback
+)
+
+// parseCaptureOffsets lit une liste de délais séparés par des virgules ou des espaces
+// ("0s, 2m, 10m") ; le résultat est trié, sans doublon, à la seconde près
+func parseCaptureOffsets(s string) ([]time.Duration, error) {
+	var out []time.Duration
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		d, err := time.ParseDuration(f)
+		if err != nil {
+			return nil, err
+		}
+		if d < 0 || d > eventSubOffsetMax {
+			return nil, errors.New("offset out of range")
+		}
+		out = append(out, d.Truncate(time.Second))
+	}
+	slices.Sort(out)
+	out = slices.Compact(out)
+	if len(out) > eventSubOffsetsMax {
+		return nil, errors.New("too many offsets")
+	}
+	return out, nil
+}
+
+// handleEventSub affiche les abonnements EventSub de l'utilisateur, le formulaire de
+// création (prérempli par ?broadcaster_id=&broadcaster_login=) et les dernières notifications
+func (a *App) handleEventSub(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+	a.renderEventSub(w, r, u, "")
+}
+
+func (a *App) renderEventSub(w http.ResponseWriter, r *http.Request, u *CurrentUser, formError string) {
+	subs, err := a.store.EventSub.ListByUser(r.Context(), u.ID)
+	if err != nil {
+		log.Printf("list eventsub subscriptions error: %v", err)
+		http.Error(w, "failed to load subscriptions", http.StatusInternalServerError)
+		return
+	}
+	events, err := a.store.EventSub.ListEvents(r.Context(), u.ID, eventSubEventsShown)
+	if err != nil {
+		log.Printf("list eventsub events error: %v", err)
+		http.Error(w, "failed to load subscriptions", http.StatusInternalServerError)
+		return
+	}
+
+	form := r.URL.Query()
+	if r.Method == http.MethodPost {
+		form = r.Form
+	}
+
+	data := struct {
+		Title            string
+		CurrentUser      *CurrentUser
+		HasActiveSession bool
+		Enabled          bool
+		Transport        string
+		Subscriptions    []store.EventSubSubscription
+		Events           []store.EventSubEvent
+		Types            []EventSubType
+		BroadcasterID    string
+		BroadcasterLogin string
+		FormError        string
+		Notice           string
+	}{
+		Title:            "Captures automatiques",
+		CurrentUser:      u,
+		HasActiveSession: a.hasActiveSession(r.Context(), u.ID),
+		Enabled:          a.eventsubTransport != "",
+		Transport:        a.eventsubTransport,
+		Subscriptions:    subs,
+		Events:           events,
+		Types:            eventSubTypes,
+		BroadcasterID:    form.Get("broadcaster_id"),
+		BroadcasterLogin: form.Get("broadcaster_login"),
+		FormError:        formError,
+		Notice:           r.URL.Query().Get("notice"),
+	}
+
+	if err := a.templates.ExecuteTemplate(w, "eventsub.html", data); err != nil {
+		log.Printf("template error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// handleCreateEventSubSubscription abonne une chaîne modérée à un événement. En webhook,
+// l'abonnement Twitch existant pour le même événement est réutilisé, sinon il est créé ; en
+// websocket, l'abonnement attend le worker eventsub-ws (statut pending).
+func (a *App) handleCreateEventSubSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	if a.eventsubTransport == "" {
+		a.renderEventSub(w, r, u, "Les captures automatiques ne sont pas configurées sur ce serveur.")
+		return
+	}
+
+	broadcasterID := strings.TrimSpace(r.Form.Get("broadcaster_id"))
+	subType := r.Form.Get("type")
+	offsets, errOffsets := parseCaptureOffsets(r.Form.Get("offsets"))
+	switch {
+	case broadcasterID == "":
+		a.renderEventSub(w, r, u, "Choisissez la chaîne depuis la page Mes chaînes.")
+		return
+	case !slices.ContainsFunc(eventSubTypes, func(t EventSubType) bool { return t.Name == subType }):
+		a.renderEventSub(w, r, u, "Type d'événement invalide.")
+		return
+	case errOffsets != nil:
+		a.renderEventSub(w, r, u, "Délais invalides : au plus "+strconv.Itoa(eventSubOffsetsMax)+
+			" durées entre 0s et 6h, séparées par des virgules (ex. 0s, 2m, 10m).")
+		return
+	}
+
+	// La chaîne doit être modérée par l'utilisateur (le login vient de la liste Twitch)
+	token, err := a.requestTwitchToken(r, u)
+	if err != nil {
+		log.Printf("load Twitch token error: %v", err)
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+	channels, err := a.moderatedChannels(r.Context(), u, token, false)
+	if err != nil {
+		log.Printf("moderated channels error: %v", err)
+		http.Error(w, "failed to load moderated channels", http.StatusBadGateway)
+		return
+	}
+	i := slices.IndexFunc(channels, func(c twitch.ModeratedChannel) bool { return c.BroadcasterID == broadcasterID })
+	if i < 0 {
+		a.renderEventSub(w, r, u, "Vous ne modérez pas cette chaîne.")
+		return
+	}
+	channel := channels[i]
+
+	n, err := a.store.EventSub.CountByUser(r.Context(), u.ID)
+	if err != nil {
+		log.Printf("count eventsub subscriptions error: %v", err)
+		http.Error(w, "failed to create subscription", http.StatusInternalServerError)
+		return
+	}
+	if n >= eventSubMax {
+		a.renderEventSub(w, r, u, "Limite de "+strconv.Itoa(eventSubMax)+" abonnements atteinte : supprimez-en un.")
+		return
+	}
+	exists, err := a.store.EventSub.Exists(r.Context(), u.ID, broadcasterID, subType)
+	if err != nil {
+		log.Printf("check eventsub subscription error: %v", err)
+		http.Error(w, "failed to create subscription", http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		a.renderEventSub(w, r, u, "Cette chaîne est déjà abonnée à cet événement.")
+		return
+	}
+
+	// channel.follow s'appuie sur l'autorisation moderator:read:followers de l'utilisateur
+	moderatorID := ""
+	if subType == eventsub.ChannelFollow {
+		moderatorID = u.TwitchUserID
+	}
+	twitchID, status := "", eventsub.StatusPending
+	if a.eventsubTransport == eventsub.TransportWebhook {
+		if twitchID, status, err = a.twitchSubscription(r, subType, broadcasterID, moderatorID); err != nil {
+			log.Printf("create eventsub subscription error: %v", err)
+			a.renderEventSub(w, r, u, "Twitch a refusé l'abonnement ; réessayez plus tard.")
+			return
+		}
+	}
+
+	id, err := a.store.EventSub.Create(r.Context(), store.EventSubSubscription{
+		UserID:               u.ID,
+		BroadcasterID:        broadcasterID,
+		BroadcasterLogin:     channel.BroadcasterLogin,
+		Type:                 subType,
+		ModeratorID:          moderatorID,
+		CaptureOffsets:       offsets,
+		Transport:            a.eventsubTransport,
+		TwitchSubscriptionID: twitchID,
+		Status:               status,
+		CreatedAt:            time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("store eventsub subscription error: %v", err)
+		http.Error(w, "failed to create subscription", http.StatusInternalServerError)
+		return
+	}
+	if err := a.store.Audit.Log(r.Context(), store.AuditEventSubCreated, u.ID, 0, map[string]any{
+		"subscription_id": id, "broadcaster_id": broadcasterID, "type": subType, "twitch_subscription_id": twitchID,
+	}); err != nil {
+		log.Printf("audit log error: %v", err)
+	}
+
+	http.Redirect(w, r, "/eventsub?notice=created", http.StatusFound)
+}
+
+// twitchSubscription retourne l'id et le statut de l'abonnement Twitch d'un événement :
+// celui d'un autre utilisateur s'il existe, sinon un abonnement créé (ou retrouvé si Twitch
+// le connaît déjà)
+func (a *App) twitchSubscription(r *http.Request, subType, broadcasterID, moderatorID string) (string, string, error) {
+	id, status, err := a.store.EventSub.Shared(r.Context(), subType, broadcasterID, moderatorID)
+	if err == nil {
+		return id, status, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return "", "", err
+	}
+
+	condition := eventsub.Condition(subType, broadcasterID, moderatorID)
+	sub, err := a.twitch.CreateEventSubSubscription(r.Context(), subType, condition, a.eventsubCallbackURL, a.eventsubSecret)
+	if err == nil {
+		return sub.ID, sub.Status, nil
+	}
+	if !errors.Is(err, twitch.ErrConflict) {
+		return "", "", err
+	}
+
+	// Abonnement créé auparavant (base réinitialisée, abonnement supprimé localement...)
+	subs, listErr := a.twitch.EventSubSubscriptions(r.Context())
+	if listErr != nil {
+		return "", "", listErr
+	}
+	for _, s := range subs {
+		if s.Type == subType && s.Transport.Callback == a.eventsubCallbackURL && sameCondition(s.Condition, condition) {
+			return s.ID, s.Status, nil
+		}
+	}
+	return "", "", err
+}
+
+func sameCondition(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// handleDeleteEventSubSubscription supprime un abonnement ; l'abonnement Twitch webhook est
+// supprimé quand plus aucun utilisateur ne l'utilise, l'abonnement websocket par le worker
+// eventsub-ws à sa prochaine synchronisation
+func (a *App) handleDeleteEventSubSubscription(w http.ResponseWriter, r *http.Request) {
+	u, id, ok := alertFormID(w, r, "subscription_id")
+	if !ok {
+		return
+	}
+
+	sub, err := a.store.EventSub.Get(r.Context(), u.ID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Redirect(w, r, "/eventsub?notice=deleted", http.StatusFound)
+		return
+	}
+	if err != nil {
+		log.Printf("load eventsub subscription error: %v", err)
+		http.Error(w, "failed to delete subscription", http.StatusInternalServerError)
+		return
+	}
+	stillUsed, err := a.store.EventSub.Delete(r.Context(), u.ID, id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("delete eventsub subscription error: %v", err)
+		http.Error(w, "failed to delete subscription", http.StatusInternalServerError)
+		return
+	}
+	if err == nil && !stillUsed && sub.TwitchSubscriptionID != "" && sub.Transport == eventsub.TransportWebhook {
+		err := a.twitch.DeleteEventSubSubscription(r.Context(), "", sub.TwitchSubscriptionID)
+		if err != nil && !errors.Is(err, twitch.ErrNotFound) {
+			// L'abonnement reste chez Twitch : ses notifications seront ignorées
+			log.Printf("delete Twitch eventsub subscription %s error: %v", sub.TwitchSubscriptionID, err)
+		}
+	}
+	if err := a.store.Audit.Log(r.Context(), store.AuditEventSubDeleted, u.ID, 0, map[string]any{
+		"subscription_id": id, "broadcaster_id": sub.BroadcasterID, "type": sub.Type,
+	}); err != nil {
+		log.Printf("audit log error: %v", err)
+	}
+
+	http.Redirect(w, r, "/eventsub?notice=deleted", http.StatusFound)
+}
+
+// handleSyncEventSub relit le statut des abonnements webhook de l'utilisateur auprès de
+// Twitch ; un abonnement absent de la liste passe en not_found. Le worker eventsub-ws tient
+// à jour le statut des abonnements websocket.
+func (a *App) handleSyncEventSub(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+
+	subs, err := a.store.EventSub.ListByUser(r.Context(), u.ID)
+	if err != nil {
+		log.Printf("list eventsub subscriptions error: %v", err)
+		http.Error(w, "failed to sync subscriptions", http.StatusInternalServerError)
+		return
+	}
+	remote, err := a.twitch.EventSubSubscriptions(r.Context())
+	if err != nil {
+		log.Printf("list Twitch eventsub subscriptions error: %v", err)
+		http.Error(w, "failed to list Twitch subscriptions", http.StatusBadGateway)
+		return
+	}
+	statuses := make(map[string]string, len(remote))
+	for _, s := range remote {
+		statuses[s.ID] = s.Status
+	}
+
+	for _, sub := range subs {
+		if sub.TwitchSubscriptionID == "" || sub.Transport != eventsub.TransportWebhook {
+			continue
+		}
+		status, ok := statuses[sub.TwitchSubscriptionID]
+		if !ok {
+			status = eventsub.StatusNotFound
+		}
+		if status == sub.Status {
+			continue
+		}
+		if _, err := a.store.EventSub.SetStatus(r.Context(), sub.TwitchSubscriptionID, status); err != nil {
+			log.Printf("set eventsub status error: %v", err)
+			http.Error(w, "failed to sync subscriptions", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/eventsub?notice=synced", http.StatusFound)
+}
+
+// handleEventSubCallback reçoit les messages EventSub de Twitch (route publique) : la
+// signature HMAC et l'âge du message sont vérifiés avant tout traitement
+func (a *App) handleEventSubCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.eventsubSecret == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, eventSubMaxBody))
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := eventsub.Verify(a.eventsubSecret, r.Header, body, time.Now()); err != nil {
+		log.Printf("eventsub callback rejected: %v", err)
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	var msg eventsub.Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	sub := msg.Subscription
+
+	switch r.Header.Get(eventsub.HeaderMessageType) {
+	case eventsub.MessageVerification:
+		if _, err := a.store.EventSub.SetStatus(r.Context(), sub.ID, eventsub.StatusEnabled); err != nil {
+			log.Printf("set eventsub status error: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, msg.Challenge)
+
+	case eventsub.MessageRevocation:
+		log.Printf("eventsub subscription %s (%s) revoked: %s", sub.ID, sub.Type, sub.Status)
+		if _, err := a.store.EventSub.SetStatus(r.Context(), sub.ID, sub.Status); err != nil {
+			log.Printf("set eventsub status error: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case eventsub.MessageNotification:
+		if _, err := a.captures.Handle(r.Context(), autocapture.Notification{
+			MessageID:    r.Header.Get(eventsub.HeaderMessageID),
+			Subscription: sub,
+			Event:        msg.Event,
+			ReceivedAt:   time.Now().UTC(),
+		}); err != nil {
+			// 5xx : Twitch renverra le message
+			log.Printf("eventsub notification error: %v", err)
+			http.Error(w, "failed to handle notification", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
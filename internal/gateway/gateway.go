@@ -0,0 +1,219 @@
+// Package gateway est le service gateway : interface web, OAuth Twitch, sessions d'analyse,
+// API JSON /api/v1 et callback EventSub. Le binaire cmd/gateway le sert sur APP_PORT ; les
+// tests d'intégration le démarrent en mémoire avec New et Handler.
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/autocapture"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/env"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/events"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/eventsub"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/redis"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitch"
+)
+
+// Config est la configuration du service
+type Config struct {
+	TwitchClientID     string
+	TwitchClientSecret string
+	TwitchRedirectURL  string
+	// Endpoints OAuth Twitch (voir App.twitchAuthBaseURL) ; AuthorizeURL vide : AuthBaseURL/authorize
+	TwitchAuthBaseURL  string
+	TwitchAuthorizeURL string
+
+	AnalysisBaseURL  string
+	TwitchAPIBaseURL string
+
+	ChannelsCacheTTL time.Duration
+	SessionTTL       time.Duration
+	// Quotas de sessions sauvegardées par palier, au format de SAVED_SESSIONS_QUOTAS
+	SavedSessionsQuotas string
+
+	// Pub/sub des événements de session (vide : désactivé)
+	RedisURL string
+
+	EventSubTransport   string
+	EventSubCallbackURL string
+	EventSubSecret      string
+
+	// Répertoires des templates et des fichiers statiques (relatifs au répertoire courant)
+	TemplatesDir string
+	StaticDir    string
+}
+
+// ConfigFromEnv lit la configuration dans les variables d'environnement
+func ConfigFromEnv() Config {
+	return Config{
+		TwitchClientID:     env.Get("TWITCH_CLIENT_ID", ""),
+		TwitchClientSecret: env.Get("TWITCH_CLIENT_SECRET", ""),
+		TwitchRedirectURL:  env.Get("TWITCH_REDIRECT_URL", ""),
+		TwitchAuthBaseURL:  env.Get("TWITCH_AUTH_BASE_URL", "https://id.twitch.tv/oauth2"),
+		// En local, le navigateur n'atteint pas forcément le mock sous le même nom que le gateway
+		TwitchAuthorizeURL:  env.Get("TWITCH_AUTHORIZE_URL", ""),
+		AnalysisBaseURL:     env.Get("ANALYSIS_BASE_URL", "http://analysis:8083"),
+		TwitchAPIBaseURL:    env.Get("TWITCH_API_BASE_URL", "http://twitch-api:8081"),
+		ChannelsCacheTTL:    env.Duration("CHANNELS_CACHE_TTL", 5*time.Minute),
+		SessionTTL:          env.Duration("SESSION_TTL", 24*time.Hour),
+		SavedSessionsQuotas: env.Get("SAVED_SESSIONS_QUOTAS", ""),
+		RedisURL:            env.Get("REDIS_URL", ""),
+		EventSubTransport:   env.Get("EVENTSUB_TRANSPORT", eventsub.TransportWebhook),
+		EventSubCallbackURL: env.Get("EVENTSUB_CALLBACK_URL", ""),
+		EventSubSecret:      env.Get("EVENTSUB_SECRET", ""),
+		TemplatesDir:        "web/templates",
+		StaticDir:           "web/static",
+	}
+}
+
+// New crée le service à partir de sa configuration
+func New(st *store.Store, cfg Config) (*App, error) {
+	if cfg.TwitchClientID == "" || cfg.TwitchClientSecret == "" || cfg.TwitchRedirectURL == "" {
+		log.Println("warning: TWITCH_CLIENT_ID/SECRET/REDIRECT_URL not fully set; auth will not work correctly")
+	}
+
+	// Ajouter les fonctions personnalisées pour les templates
+	funcMap := template.FuncMap{
+		"add": func(a, b int64) int64 { return a + b },
+		"mul": func(a, b int64) int64 { return a * b },
+		"div": func(a, b int64) int64 {
+			if b == 0 {
+				return 0
+			}
+			return a / b
+		},
+		"contains": func(slice []string, item string) bool {
+			for _, s := range slice {
+				if s == item {
+					return true
+				}
+			}
+			return false
+		},
+	}
+
+	tmpls, err := template.New("").Funcs(funcMap).ParseGlob(filepath.Join(cfg.TemplatesDir, "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot load templates: %w", err)
+	}
+
+	savedQuotas, err := parseSavedQuotas(cfg.SavedSessionsQuotas)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAVED_SESSIONS_QUOTAS: %w", err)
+	}
+
+	authBaseURL := strings.TrimRight(cfg.TwitchAuthBaseURL, "/")
+	authorizeURL := cfg.TwitchAuthorizeURL
+	if authorizeURL == "" {
+		authorizeURL = authBaseURL + "/authorize"
+	}
+
+	app := &App{
+		store:              st,
+		templates:          tmpls,
+		staticDir:          cfg.StaticDir,
+		twitchClientID:     cfg.TwitchClientID,
+		twitchClientSecret: cfg.TwitchClientSecret,
+		twitchRedirectURL:  cfg.TwitchRedirectURL,
+		twitchAuthBaseURL:  authBaseURL,
+		twitchAuthorizeURL: authorizeURL,
+		analysisBaseURL:    cfg.AnalysisBaseURL,
+		twitch:             twitch.NewClient(cfg.TwitchAPIBaseURL),
+		channelsCache:      newChannelsCache(cfg.ChannelsCacheTTL),
+		sessionTTL:         cfg.SessionTTL,
+		savedQuotas:        savedQuotas,
+	}
+	app.captures = &autocapture.Scheduler{Store: st, SessionTTL: app.sessionTTL}
+
+	// Pub/sub Redis des événements de session : facultatif, sans lui l'analyse se rafraîchit
+	// par le suivi des jobs
+	if cfg.RedisURL != "" {
+		rc, err := redis.NewClient(cfg.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to Redis: %w", err)
+		}
+		app.events = events.NewBus(rc)
+	} else {
+		log.Println("warning: REDIS_URL not set; live session events are disabled")
+	}
+
+	// EventSub : en webhook, Twitch doit pouvoir joindre le callback, signé avec le secret
+	// partagé ; en websocket, le worker eventsub-ws reçoit les notifications. Le callback reste
+	// actif dès que le secret est défini (abonnements webhook créés avant un changement de mode).
+	app.eventsubTransport = cfg.EventSubTransport
+	app.eventsubCallbackURL = cfg.EventSubCallbackURL
+	app.eventsubSecret = cfg.EventSubSecret
+	if app.eventsubCallbackURL == "" || app.eventsubSecret == "" {
+		app.eventsubCallbackURL, app.eventsubSecret = "", ""
+	} else if n := len(app.eventsubSecret); n < 10 || n > 100 {
+		return nil, errors.New("invalid EVENTSUB_SECRET: must be between 10 and 100 characters")
+	}
+	switch app.eventsubTransport {
+	case eventsub.TransportWebhook:
+		if app.eventsubSecret == "" {
+			log.Println("warning: EVENTSUB_CALLBACK_URL/EVENTSUB_SECRET not set; automatic captures are disabled")
+			app.eventsubTransport = ""
+		}
+	case eventsub.TransportWebSocket:
+		log.Println("eventsub: websocket transport, notifications are received by the worker eventsub-ws mode")
+	default:
+		return nil, fmt.Errorf("invalid EVENTSUB_TRANSPORT %q: must be webhook or websocket", app.eventsubTransport)
+	}
+
+	return app, nil
+}
+
+// Handler retourne le routeur HTTP du service
+func (a *App) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/analysis", a.handleAnalysis)
+	mux.HandleFunc("/analysis/export", a.handleAnalysisExport)
+	mux.HandleFunc("/analysis/saved/", a.handleSavedAnalysis)
+	mux.HandleFunc("/sessions", a.handleSessions)
+	mux.HandleFunc("/sessions/capture", a.handleCreateCapture)
+	mux.HandleFunc("/sessions/followers", a.handleCreateFollowersFetch)
+	mux.HandleFunc("/sessions/save", a.handleSaveSession)
+	mux.HandleFunc("/sessions/delete", a.handleDeleteSession)
+	mux.HandleFunc("/sessions/purge", a.handlePurgeSession)
+	mux.HandleFunc("/sessions/export/", a.handleSessionExport)
+	mux.HandleFunc("/channels", a.handleChannels)
+	mux.HandleFunc("/channels/refresh", a.handleRefreshChannels)
+	mux.HandleFunc("/accounts/", a.handleAccountHistory)
+	mux.HandleFunc("/tokens", a.handleTokens)
+	mux.HandleFunc("/tokens/create", a.handleCreateToken)
+	mux.HandleFunc("/tokens/revoke", a.handleRevokeToken)
+	mux.HandleFunc("/webhooks", a.handleWebhooks)
+	mux.HandleFunc("/webhooks/create", a.handleCreateWebhook)
+	mux.HandleFunc("/webhooks/delete", a.handleDeleteWebhook)
+	mux.HandleFunc("/webhooks/toggle", a.handleToggleWebhook)
+	mux.HandleFunc("/webhooks/test", a.handleTestWebhook)
+	mux.HandleFunc("/alerts", a.handleAlerts)
+	mux.HandleFunc("/alerts/rules/create", a.handleCreateAlertRule)
+	mux.HandleFunc("/alerts/rules/delete", a.handleDeleteAlertRule)
+	mux.HandleFunc("/alerts/acknowledge", a.handleAcknowledgeAlert)
+	mux.HandleFunc("/alerts/acknowledge-all", a.handleAcknowledgeAllAlerts)
+	mux.HandleFunc("/eventsub", a.handleEventSub)
+	mux.HandleFunc("/eventsub/subscriptions/create", a.handleCreateEventSubSubscription)
+	mux.HandleFunc("/eventsub/subscriptions/delete", a.handleDeleteEventSubSubscription)
+	mux.HandleFunc("/eventsub/sync", a.handleSyncEventSub)
+	mux.HandleFunc("/eventsub/callback", a.handleEventSubCallback)
+	mux.HandleFunc("/auth/login", a.handleAuthLogin)
+	mux.HandleFunc("/auth/callback", a.handleAuthCallback)
+	mux.HandleFunc("/auth/logout", a.handleLogout)
+	mux.Handle("/api/v1/", a.apiHandler())
+	mux.HandleFunc("/healthz", a.handleHealth)
+	mux.HandleFunc("/", a.handleIndex)
+
+	fileServer := http.FileServer(http.Dir(a.staticDir))
+	mux.Handle("/static/", http.StripPrefix("/static/", fileServer))
+
+	return loggingMiddleware(a.loadCurrentUser(mux))
+}
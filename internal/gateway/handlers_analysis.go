@@ -1,10 +1,10 @@
-package main
+package gateway
 
 import (
 	"context"
-	"database/sql"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,6 +12,8 @@ import (
 	"net/url"
 	"strings"
 	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
 )
 
 // handleAnalysis affiche l'analyse de la session active
@@ -23,12 +25,13 @@ func (a *App) handleAnalysis(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Récupérer la session d'analyse active
-	sessionUUID, err := a.getActiveSessionUUID(r.Context(), u.ID)
+	sess, err := a.store.Sessions.Active(r.Context(), u.ID)
 	if err != nil {
-		log.Printf("getActiveSessionUUID error: %v", err)
+		log.Printf("query active session error: %v", err)
 		http.Error(w, "no active analysis session", http.StatusNotFound)
 		return
 	}
+	sessionUUID := sess.UUID
 
 	// Optionnel : filtre broadcaster_id en query string
 	broadcasterIDs := r.URL.Query()["broadcaster_id"]
@@ -40,6 +43,12 @@ func (a *App) handleAnalysis(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Non bloquant : sans quota, la sauvegarde ne prévient pas des sessions supprimées
+	quota, err := a.savedQuota(r.Context(), u)
+	if err != nil {
+		log.Printf("savedQuota error for user %d: %v", u.ID, err)
+	}
+
 	data := struct {
 		Title          string
 		CurrentUser    *CurrentUser
@@ -48,6 +57,9 @@ func (a *App) handleAnalysis(w http.ResponseWriter, r *http.Request) {
 		BroadcasterIDs []string
 		Purged         bool
 		IsSaved        bool
+		ExpiresAt      *time.Time
+		SaveQuota      *SavedQuota
+		QuotaReached   bool
 	}{
 		Title:          "Analyse de session",
 		CurrentUser:    u,
@@ -56,6 +68,9 @@ func (a *App) handleAnalysis(w http.ResponseWriter, r *http.Request) {
 		BroadcasterIDs: broadcasterIDs,
 		Purged:         r.URL.Query().Get("purged") == "1",
 		IsSaved:        false,
+		ExpiresAt:      &sess.ExpiresAt,
+		SaveQuota:      quota,
+		QuotaReached:   r.URL.Query().Get("save_quota") == "1",
 	}
 
 	if err := a.templates.ExecuteTemplate(w, "analysis_page", data); err != nil {
@@ -82,13 +97,9 @@ func (a *App) handleSavedAnalysis(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Vérifier que la session existe et appartient à l'utilisateur
-	var status string
-	err := a.db.QueryRowContext(r.Context(),
-		`SELECT status FROM sessions WHERE user_id = ? AND session_uuid = ? AND status = 'saved' LIMIT 1`,
-		u.ID, sessionUUID,
-	).Scan(&status)
+	_, err := a.store.Sessions.Saved(r.Context(), u.ID, sessionUUID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, store.ErrNotFound) {
 			http.Error(w, "session not found or not saved", http.StatusNotFound)
 			return
 		}
@@ -115,6 +126,9 @@ func (a *App) handleSavedAnalysis(w http.ResponseWriter, r *http.Request) {
 		BroadcasterIDs []string
 		Purged         bool
 		IsSaved        bool
+		ExpiresAt      *time.Time
+		SaveQuota      *SavedQuota
+		QuotaReached   bool
 	}{
 		Title:          "Analyse de session sauvegardée",
 		CurrentUser:    u,
@@ -204,13 +218,9 @@ func (a *App) handleSessionExport(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Vérifier que la session appartient à l'utilisateur
-	var status string
-	err := a.db.QueryRowContext(r.Context(),
-		`SELECT status FROM sessions WHERE user_id = ? AND session_uuid = ? AND status = 'saved' LIMIT 1`,
-		u.ID, sessionUUID,
-	).Scan(&status)
+	_, err := a.store.Sessions.Saved(r.Context(), u.ID, sessionUUID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, store.ErrNotFound) {
 			http.Error(w, "session not found", http.StatusNotFound)
 			return
 		}
@@ -230,75 +240,25 @@ func (a *App) handleSessionExport(w http.ResponseWriter, r *http.Request) {
 // exportSession exporte les données d'une session en CSV ou JSON
 func (a *App) exportSession(w http.ResponseWriter, r *http.Request, sessionUUID, format string) {
 	// Récupérer les données de la session
-	var sessionID int64
-	err := a.db.QueryRowContext(r.Context(),
-		`SELECT id FROM sessions WHERE session_uuid = ? LIMIT 1`,
-		sessionUUID,
-	).Scan(&sessionID)
+	sess, err := a.store.Sessions.ByUUID(r.Context(), sessionUUID)
 	if err != nil {
 		log.Printf("query session error: %v", err)
 		http.Error(w, "session not found", http.StatusNotFound)
 		return
 	}
 
-	// Récupérer tous les accounts capturés
-	query := `
-SELECT 
-    a.twitch_user_id,
-    a.login,
-    a.display_name,
-    a.created_at,
-    COUNT(DISTINCT cc.capture_id) as seen_count,
-    MIN(c.captured_at) as first_seen,
-    MAX(c.captured_at) as last_seen
-FROM capture_chatters cc
-JOIN captures c ON cc.capture_id = c.id
-JOIN accounts a ON cc.account_id = a.id
-WHERE c.session_id = ?
-GROUP BY a.id, a.twitch_user_id, a.login, a.display_name, a.created_at
-ORDER BY seen_count DESC, a.login ASC
-`
-
-	rows, err := a.db.QueryContext(r.Context(), query, sessionID)
+	// Récupérer tous les comptes capturés
+	accounts, err := a.sessionAccounts(r.Context(), sess.ID)
 	if err != nil {
 		log.Printf("query accounts error: %v", err)
 		http.Error(w, "failed to load accounts", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var accounts []ExportAccountData
-	for rows.Next() {
-		var acc ExportAccountData
-		if err := rows.Scan(&acc.TwitchUserID, &acc.Login, &acc.DisplayName, &acc.CreatedAt, &acc.SeenCount, &acc.FirstSeen, &acc.LastSeen); err != nil {
-			log.Printf("scan account error: %v", err)
-			continue
-		}
-		accounts = append(accounts, acc)
-	}
 
 	if format == "csv" {
 		w.Header().Set("Content-Type", "text/csv")
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=session_%s.csv", sessionUUID))
-
-		csvWriter := csv.NewWriter(w)
-		defer csvWriter.Flush()
-
-		// Header
-		_ = csvWriter.Write([]string{"twitch_user_id", "login", "display_name", "created_at", "seen_count", "first_seen", "last_seen"})
-
-		// Rows
-		for _, acc := range accounts {
-			_ = csvWriter.Write([]string{
-				acc.TwitchUserID,
-				acc.Login,
-				acc.DisplayName,
-				acc.CreatedAt.Format(time.RFC3339),
-				fmt.Sprintf("%d", acc.SeenCount),
-				acc.FirstSeen.Format(time.RFC3339),
-				acc.LastSeen.Format(time.RFC3339),
-			})
-		}
+		writeAccountsCSV(w, accounts)
 	} else {
 		// JSON
 		exportData := ExportData{
@@ -315,3 +275,51 @@ ORDER BY seen_count DESC, a.login ASC
 		}
 	}
 }
+
+// sessionAccounts retourne les comptes capturés d'une session, au format d'export
+func (a *App) sessionAccounts(ctx context.Context, sessionID int64) ([]ExportAccountData, error) {
+	stats, err := a.store.Chatters.SessionStats(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]ExportAccountData, 0, len(stats))
+	for _, st := range stats {
+		accounts = append(accounts, ExportAccountData{
+			TwitchUserID: st.TwitchUserID,
+			Login:        st.Login,
+			DisplayName:  st.DisplayName,
+			CreatedAt:    st.CreatedAt,
+			SeenCount:    st.SeenCount,
+			FirstSeen:    st.FirstSeen,
+			LastSeen:     st.LastSeen,
+		})
+	}
+	return accounts, nil
+}
+
+// writeAccountsCSV écrit l'export CSV des comptes (une ligne d'en-tête puis un compte par ligne)
+func writeAccountsCSV(w io.Writer, accounts []ExportAccountData) {
+	csvWriter := csv.NewWriter(w)
+	defer csvWriter.Flush()
+
+	// Header
+	_ = csvWriter.Write([]string{"twitch_user_id", "login", "display_name", "created_at", "seen_count", "first_seen", "last_seen"})
+
+	// Rows
+	for _, acc := range accounts {
+		createdAt := ""
+		if acc.CreatedAt != nil {
+			createdAt = acc.CreatedAt.Format(time.RFC3339)
+		}
+		_ = csvWriter.Write([]string{
+			acc.TwitchUserID,
+			acc.Login,
+			acc.DisplayName,
+			createdAt,
+			fmt.Sprintf("%d", acc.SeenCount),
+			acc.FirstSeen.Format(time.RFC3339),
+			acc.LastSeen.Format(time.RFC3339),
+		})
+	}
+}
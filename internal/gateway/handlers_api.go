@@ -0,0 +1,419 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitch"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchauth"
+)
+
+// apiInternalError journalise err et répond 500
+func apiInternalError(w http.ResponseWriter, what string, err error) {
+	log.Printf("api %s error: %v", what, err)
+	writeAPIError(w, http.StatusInternalServerError, apiErrInternal, "failed to "+what)
+}
+
+func toAPISession(s store.Session) APISession {
+	out := APISession{SessionUUID: s.UUID, Status: s.Status, CreatedAt: s.CreatedAt, UpdatedAt: s.UpdatedAt}
+	if s.Status == store.SessionActive {
+		expiresAt := s.ExpiresAt
+		out.ExpiresAt = &expiresAt
+	}
+	return out
+}
+
+func toAPIJob(job store.Job) APIJob {
+	return APIJob{
+		ID:     job.ID,
+		Type:   job.Type,
+		Status: job.Status,
+		Progress: APIJobProgress{
+			Done:    job.Progress.Done,
+			Total:   job.Progress.Total,
+			Message: job.Progress.Message,
+		},
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+		Error:      job.Error,
+	}
+}
+
+// userSession retourne la session active (non expirée) ou sauvegardée de l'utilisateur ;
+// ErrNotFound pour toute autre session, y compris celles d'un autre utilisateur
+func (a *App) userSession(ctx context.Context, u *CurrentUser, sessionUUID string) (*store.Session, error) {
+	sess, err := a.store.Sessions.ByUUID(ctx, sessionUUID)
+	if err != nil {
+		return nil, err
+	}
+	visible := sess.Status == store.SessionSaved ||
+		(sess.Status == store.SessionActive && sess.ExpiresAt.After(time.Now()))
+	if sess.UserID != u.ID || !visible {
+		return nil, store.ErrNotFound
+	}
+	return sess, nil
+}
+
+// apiUserSession résout la session {uuid} de la route, ou répond 404
+func (a *App) apiUserSession(w http.ResponseWriter, r *http.Request, u *CurrentUser) (*store.Session, bool) {
+	sess, err := a.userSession(r.Context(), u, r.PathValue("uuid"))
+	if errors.Is(err, store.ErrNotFound) {
+		writeAPIError(w, http.StatusNotFound, apiErrNotFound, "session not found")
+		return nil, false
+	}
+	if err != nil {
+		apiInternalError(w, "load session", err)
+		return nil, false
+	}
+	return sess, true
+}
+
+// requestTwitchToken retourne le token Twitch de la session web de la requête ; pour un token
+// d'API, celui de la session web la plus récemment active de l'utilisateur
+func (a *App) requestTwitchToken(r *http.Request, u *CurrentUser) (*twitchauth.Token, error) {
+	if u.APITokenID != 0 {
+		return twitchauth.Latest(r.Context(), a.store, a.twitch, u.ID)
+	}
+	c, err := r.Cookie("tca_session")
+	if err != nil || c.Value == "" {
+		return nil, store.ErrNotFound
+	}
+	sess, err := a.getSessionData(r.Context(), c.Value)
+	if err != nil {
+		return nil, err
+	}
+	return a.twitchToken(sess), nil
+}
+
+// apiMe retourne l'utilisateur connecté
+func (a *App) apiMe(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	writeJSON(w, http.StatusOK, APIUser{TwitchUserID: u.TwitchUserID, Login: u.Login, DisplayName: u.DisplayName, Tier: u.Tier})
+}
+
+// apiChannels liste les chaînes modérées (paramètres q, sort et refresh comme /channels)
+func (a *App) apiChannels(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	token, err := a.requestTwitchToken(r, u)
+	if errors.Is(err, store.ErrNotFound) {
+		writeAPIError(w, http.StatusUnauthorized, apiErrTwitchAuth, "no Twitch token, log in to the web UI")
+		return
+	}
+	if err != nil {
+		apiInternalError(w, "load Twitch token", err)
+		return
+	}
+
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+	channels, err := a.moderatedChannels(r.Context(), u, token, refresh)
+	if errors.Is(err, twitch.ErrUnauthorized) {
+		writeAPIError(w, http.StatusUnauthorized, apiErrTwitchAuth, "Twitch token expired, log in again")
+		return
+	}
+	if err != nil {
+		log.Printf("api moderatedChannels error: %v", err)
+		writeAPIError(w, http.StatusBadGateway, apiErrUpstream, "failed to load channels")
+		return
+	}
+
+	visible := sortChannels(filterChannels(channels, r.URL.Query().Get("q")), r.URL.Query().Get("sort"))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"channels": visible,
+		"total":    len(channels),
+	})
+}
+
+// apiCreateCapture crée un job de capture dans la session active (créée au besoin)
+func (a *App) apiCreateCapture(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	var req struct {
+		BroadcasterID    string `json:"broadcaster_id"`
+		BroadcasterLogin string `json:"broadcaster_login"`
+	}
+	if err := decodeJSONBody(r, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if req.BroadcasterID == "" || req.BroadcasterLogin == "" {
+		writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "broadcaster_id and broadcaster_login are required")
+		return
+	}
+
+	jobID, sessionUUID, err := a.enqueueCapture(r.Context(), u, req.BroadcasterID, req.BroadcasterLogin)
+	if err != nil {
+		apiInternalError(w, "enqueue capture", err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"job_id":       jobID,
+		"session_uuid": sessionUUID,
+	})
+}
+
+// apiCreateFollowersFetch crée un job de récupération des followers dans la session active
+// (créée au besoin)
+func (a *App) apiCreateFollowersFetch(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	var req struct {
+		BroadcasterID    string `json:"broadcaster_id"`
+		BroadcasterLogin string `json:"broadcaster_login"`
+	}
+	if err := decodeJSONBody(r, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if req.BroadcasterID == "" || req.BroadcasterLogin == "" {
+		writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "broadcaster_id and broadcaster_login are required")
+		return
+	}
+
+	jobID, sessionUUID, err := a.captures.EnqueueFollowers(r.Context(), u.ID, u.TwitchUserID, req.BroadcasterID, req.BroadcasterLogin)
+	if err != nil {
+		apiInternalError(w, "enqueue followers fetch", err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"job_id":       jobID,
+		"session_uuid": sessionUUID,
+	})
+}
+
+// apiJob retourne l'état d'un job portant sur une session de l'utilisateur
+func (a *App) apiJob(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "invalid job id")
+		return
+	}
+
+	job, err := a.store.Jobs.Get(r.Context(), id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		apiInternalError(w, "load job", err)
+		return
+	}
+	// Seuls les jobs d'une session de l'utilisateur sont visibles (pas les jobs de maintenance)
+	if job == nil || job.SessionID == 0 || job.UserID != u.ID {
+		writeAPIError(w, http.StatusNotFound, apiErrNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIJob(*job))
+}
+
+// apiSessionJobs liste les derniers jobs d'une session (paramètre limit, 10 par défaut)
+func (a *App) apiSessionJobs(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	sess, ok := a.apiUserSession(w, r, u)
+	if !ok {
+		return
+	}
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 50 {
+			writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "limit must be between 1 and 50")
+			return
+		}
+		limit = n
+	}
+
+	jobs, err := a.store.Jobs.ListBySession(r.Context(), sess.ID, limit)
+	if err != nil {
+		apiInternalError(w, "list jobs", err)
+		return
+	}
+	out := make([]APIJob, 0, len(jobs))
+	for _, job := range jobs {
+		out = append(out, toAPIJob(job))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": out})
+}
+
+// apiSessions retourne la session active, les sessions sauvegardées et le quota de l'utilisateur
+func (a *App) apiSessions(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	var active *APISession
+	sess, err := a.store.Sessions.Active(r.Context(), u.ID)
+	switch {
+	case err == nil:
+		s := toAPISession(*sess)
+		active = &s
+	case !errors.Is(err, store.ErrNotFound):
+		apiInternalError(w, "load active session", err)
+		return
+	}
+
+	saved, err := a.store.Sessions.ListSaved(r.Context(), u.ID)
+	if err != nil {
+		apiInternalError(w, "load sessions", err)
+		return
+	}
+	list := make([]APISession, 0, len(saved))
+	for _, s := range saved {
+		list = append(list, toAPISession(s))
+	}
+
+	quota := a.savedQuotaOf(u, saved)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"active": active,
+		"saved":  list,
+		"quota":  APIQuota{Tier: quota.Tier, Limit: quota.Limit, Used: quota.Used},
+	})
+}
+
+// apiSession retourne une session de l'utilisateur
+func (a *App) apiSession(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	sess, ok := a.apiUserSession(w, r, u)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPISession(*sess))
+}
+
+// apiSaveSession sauvegarde la session active. Quota atteint : 409 quota_exceeded, sauf avec
+// {"evict": true} qui supprime les plus anciennes sessions sauvegardées
+func (a *App) apiSaveSession(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	var req struct {
+		Evict bool `json:"evict"`
+	}
+	if err := decodeJSONBody(r, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	sess, ok := a.apiUserSession(w, r, u)
+	if !ok {
+		return
+	}
+	if sess.Status != store.SessionActive {
+		writeAPIError(w, http.StatusConflict, apiErrConflict, "only the active session can be saved")
+		return
+	}
+
+	evicted, err := a.store.Sessions.Save(r.Context(), sess.ID, u.ID, a.savedQuotas.limit(u.Tier), req.Evict)
+	if errors.Is(err, store.ErrQuotaExceeded) {
+		quota, errQuota := a.savedQuota(r.Context(), u)
+		if errQuota != nil {
+			apiInternalError(w, "load quota", errQuota)
+			return
+		}
+		wouldEvict := make([]APISession, 0, len(quota.Evicted))
+		for _, s := range quota.Evicted {
+			wouldEvict = append(wouldEvict, APISession{SessionUUID: s.SessionUUID, Status: s.Status, CreatedAt: s.CreatedAt, UpdatedAt: s.UpdatedAt})
+		}
+		writeAPIErrorDetails(w, http.StatusConflict, apiErrQuotaExceeded,
+			fmt.Sprintf("saved sessions quota reached (%d/%d), retry with evict to delete the oldest", quota.Used, quota.Limit),
+			map[string]any{
+				"quota":       APIQuota{Tier: quota.Tier, Limit: quota.Limit, Used: quota.Used},
+				"would_evict": wouldEvict,
+			})
+		return
+	}
+	if err != nil {
+		apiInternalError(w, "save session", err)
+		return
+	}
+	for _, s := range evicted {
+		log.Printf("saved session %d of user %d evicted by quota", s.ID, u.ID)
+	}
+	log.Printf("session %d saved by user %d (api)", sess.ID, u.ID)
+
+	saved, err := a.store.Sessions.ByID(r.Context(), sess.ID)
+	if err != nil {
+		apiInternalError(w, "load session", err)
+		return
+	}
+	evictedList := make([]APISession, 0, len(evicted))
+	for _, s := range evicted {
+		evictedList = append(evictedList, toAPISession(s))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"session": toAPISession(*saved),
+		"evicted": evictedList,
+	})
+}
+
+// apiPurgeSession supprime les captures de la session active, qui passe en 'deleted'
+func (a *App) apiPurgeSession(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	sess, ok := a.apiUserSession(w, r, u)
+	if !ok {
+		return
+	}
+	if sess.Status != store.SessionActive {
+		writeAPIError(w, http.StatusConflict, apiErrConflict, "only the active session can be purged, delete saved sessions instead")
+		return
+	}
+	if err := a.store.Sessions.Purge(r.Context(), sess.ID); err != nil {
+		apiInternalError(w, "purge session", err)
+		return
+	}
+	log.Printf("session %d purged by user %d (api)", sess.ID, u.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiDeleteSession supprime une session sauvegardée et ses données
+func (a *App) apiDeleteSession(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	sess, ok := a.apiUserSession(w, r, u)
+	if !ok {
+		return
+	}
+	if sess.Status != store.SessionSaved {
+		writeAPIError(w, http.StatusConflict, apiErrConflict, "only saved sessions can be deleted, purge the active session instead")
+		return
+	}
+	if err := a.store.Sessions.Delete(r.Context(), sess.ID); err != nil {
+		apiInternalError(w, "delete session", err)
+		return
+	}
+	log.Printf("saved session %d deleted by user %d (api)", sess.ID, u.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiSummary retourne le résumé d'analyse d'une session (filtre broadcaster_id répétable)
+func (a *App) apiSummary(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	sess, ok := a.apiUserSession(w, r, u)
+	if !ok {
+		return
+	}
+	summary, err := a.fetchAnalysisSummary(r.Context(), sess.UUID, strings.Join(r.URL.Query()["broadcaster_id"], ","))
+	if err != nil {
+		log.Printf("api fetchAnalysisSummary error: %v", err)
+		writeAPIError(w, http.StatusBadGateway, apiErrUpstream, "failed to load analysis")
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// apiExport exporte les comptes d'une session en JSON (défaut) ou en CSV
+func (a *App) apiExport(w http.ResponseWriter, r *http.Request, u *CurrentUser) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		writeAPIError(w, http.StatusBadRequest, apiErrInvalidRequest, "format must be json or csv")
+		return
+	}
+
+	sess, ok := a.apiUserSession(w, r, u)
+	if !ok {
+		return
+	}
+	accounts, err := a.sessionAccounts(r.Context(), sess.ID)
+	if err != nil {
+		apiInternalError(w, "load accounts", err)
+		return
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		writeAccountsCSV(w, accounts)
+		return
+	}
+	writeJSON(w, http.StatusOK, ExportData{
+		SessionUUID: sess.UUID,
+		ExportedAt:  time.Now().UTC(),
+		Accounts:    accounts,
+	})
+}
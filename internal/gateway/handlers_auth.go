@@ -1,4 +1,4 @@
-package main
+package gateway
 
 import (
 	"log"
@@ -34,10 +34,10 @@ func (a *App) handleAuthLogin(w http.ResponseWriter, r *http.Request) {
 	params.Set("client_id", a.twitchClientID)
 	params.Set("redirect_uri", a.twitchRedirectURL)
 	params.Set("response_type", "code")
-	params.Set("scope", "user:read:moderated_channels moderator:read:chatters")
+	params.Set("scope", "user:read:moderated_channels moderator:read:chatters moderator:read:followers")
 	params.Set("state", state)
 
-	authURL := "https://id.twitch.tv/oauth2/authorize?" + params.Encode()
+	authURL := a.twitchAuthorizeURL + "?" + params.Encode()
 	http.Redirect(w, r, authURL, http.StatusFound)
 }
 
@@ -126,27 +126,20 @@ func (a *App) handleLogout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Purger la session active si elle existe et n'est pas saved
-	var sessionID int64
-	var status string
-	err = a.db.QueryRowContext(r.Context(),
-		`SELECT id, status FROM sessions WHERE user_id = ? AND status = 'active' LIMIT 1`,
-		u.ID,
-	).Scan(&sessionID, &status)
-	if err == nil {
-		// Supprimer les captures
-		_, _ = a.db.ExecContext(r.Context(), `
-DELETE cc FROM capture_chatters cc
-JOIN captures c ON cc.capture_id = c.id
-WHERE c.session_id = ?
-`, sessionID)
-		_, _ = a.db.ExecContext(r.Context(), `DELETE FROM captures WHERE session_id = ?`, sessionID)
-		_, _ = a.db.ExecContext(r.Context(), `UPDATE sessions SET status = 'deleted', updated_at = NOW(6) WHERE id = ?`, sessionID)
-		log.Printf("session %d auto-purged on logout by user %d", sessionID, u.ID)
+	if sess, err := a.store.Sessions.Active(r.Context(), u.ID); err == nil {
+		if err := a.store.Sessions.Purge(r.Context(), sess.ID); err != nil {
+			log.Printf("purge session %d on logout error: %v", sess.ID, err)
+		} else {
+			log.Printf("session %d auto-purged on logout by user %d", sess.ID, u.ID)
+		}
 	}
 
+	// Oublier la liste des chaînes modérées
+	a.channelsCache.invalidate(u.ID)
+
 	// Supprimer la web_session
 	if c != nil && c.Value != "" {
-		_, _ = a.db.ExecContext(r.Context(), `DELETE FROM web_sessions WHERE session_id = ?`, c.Value)
+		_ = a.store.WebSessions.Delete(r.Context(), c.Value)
 	}
 
 	// Révoquer le token Twitch
@@ -1,11 +1,14 @@
-package main
+package gateway
 
 import (
-	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitch"
 )
 
 // handleIndex affiche la page d'accueil
@@ -20,14 +23,7 @@ func (a *App) handleIndex(w http.ResponseWriter, r *http.Request) {
 	// Vérifier s'il y a une session active
 	hasActiveSession := false
 	if u != nil {
-		var count int
-		err := a.db.QueryRowContext(r.Context(),
-			`SELECT COUNT(*) FROM sessions WHERE user_id = ? AND status = 'active'`,
-			u.ID,
-		).Scan(&count)
-		if err == nil && count > 0 {
-			hasActiveSession = true
-		}
+		hasActiveSession = a.hasActiveSession(r.Context(), u.ID)
 	}
 
 	data := struct {
@@ -49,7 +45,7 @@ func (a *App) handleIndex(w http.ResponseWriter, r *http.Request) {
 // handleHealth vérifie l'état de santé de l'application
 func (a *App) handleHealth(w http.ResponseWriter, r *http.Request) {
 	// Vérifie aussi la DB
-	if err := a.db.PingContext(r.Context()); err != nil {
+	if err := a.store.Ping(r.Context()); err != nil {
 		log.Printf("healthz db error: %v", err)
 		http.Error(w, "db error", http.StatusInternalServerError)
 		return
@@ -80,16 +76,16 @@ func (a *App) handleChannels(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	channels, err := a.fetchModeratedChannels(r.Context(), sess.AccessToken, u.TwitchUserID)
+	channels, err := a.moderatedChannels(r.Context(), u, a.twitchToken(sess), false)
 	if err != nil {
-		log.Printf("fetchModeratedChannels error: %v", err)
+		log.Printf("moderatedChannels error: %v", err)
 		
 		// Si erreur d'authentification (token expiré/invalide), supprimer la session et rediriger
-		if strings.Contains(err.Error(), "401") || strings.Contains(err.Error(), "Unauthorized") {
+		if errors.Is(err, twitch.ErrUnauthorized) {
 			log.Printf("token expired or invalid for user %d, clearing session", u.ID)
 			
 			// Supprimer la web_session
-			_, _ = a.db.ExecContext(r.Context(), `DELETE FROM web_sessions WHERE session_id = ?`, c.Value)
+			_ = a.store.WebSessions.Delete(r.Context(), c.Value)
 			
 			// Supprimer le cookie
 			http.SetCookie(w, &http.Cookie{
@@ -110,34 +106,48 @@ func (a *App) handleChannels(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Vérifier s'il y a une session active
-	hasActiveSession := false
-	var count int
-	err = a.db.QueryRowContext(r.Context(),
-		`SELECT COUNT(*) FROM sessions WHERE user_id = ? AND status = 'active'`,
-		u.ID,
-	).Scan(&count)
-	if err == nil && count > 0 {
-		hasActiveSession = true
+	hasActiveSession := a.hasActiveSession(r.Context(), u.ID)
+	activeSessionUUID := ""
+	if hasActiveSession {
+		activeSessionUUID, _ = a.getActiveSessionUUID(r.Context(), u.ID)
 	}
 
+	// Recherche et tri
+	query := r.URL.Query().Get("q")
+	sortBy := r.URL.Query().Get("sort")
+	visible := sortChannels(filterChannels(channels, query), sortBy)
+	alerts, alertCount := a.unacknowledgedAlerts(r, u)
+
 	data := struct {
 		Title            string
 		CurrentUser      *CurrentUser
-		Channels         []struct {
-			BroadcasterID    string
-			BroadcasterLogin string
-			BroadcasterName  string
-		}
+		Channels         []twitch.ModeratedChannel
+		TotalChannels    int
+		Query            string
+		Sort             string
 		CaptureEnqueued  bool
+		FollowersEnqueued bool
+		SessionUUID      string // session active, pour l'avancement des jobs
 		SessionPurged    bool
+		Refreshed        bool
 		HasActiveSession bool
+		Alerts           map[string]int // alertes à acquitter par broadcaster_id
+		AlertCount       int
 	}{
 		Title:            "Mes chaînes modérées",
 		CurrentUser:      u,
-		Channels:         channels,
+		Channels:         visible,
+		TotalChannels:    len(channels),
+		Query:            query,
+		Sort:             sortBy,
 		CaptureEnqueued:  r.URL.Query().Get("capture_enqueued") == "1",
+		FollowersEnqueued: r.URL.Query().Get("followers_enqueued") == "1",
+		SessionUUID:      activeSessionUUID,
 		SessionPurged:    r.URL.Query().Get("purged") == "1",
+		Refreshed:        r.URL.Query().Get("refreshed") == "1",
 		HasActiveSession: hasActiveSession,
+		Alerts:           alerts,
+		AlertCount:       alertCount,
 	}
 
 	if err := a.templates.ExecuteTemplate(w, "channels.html", data); err != nil {
@@ -146,6 +156,40 @@ func (a *App) handleChannels(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleRefreshChannels invalide la liste des chaînes modérées en cache et la recharge depuis Twitch
+func (a *App) handleRefreshChannels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+
+	c, err := r.Cookie("tca_session")
+	if err != nil || c.Value == "" {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+	sess, err := a.getSessionData(r.Context(), c.Value)
+	if err != nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+
+	if _, err := a.moderatedChannels(r.Context(), u, a.twitchToken(sess), true); err != nil {
+		// La page /channels gère l'affichage de l'erreur (token expiré, etc.)
+		log.Printf("refresh moderated channels for user %d: %v", u.ID, err)
+		http.Redirect(w, r, "/channels", http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/channels?refreshed=1", http.StatusFound)
+}
+
 // handleAccountHistory affiche l'historique de changements d'un compte
 func (a *App) handleAccountHistory(w http.ResponseWriter, r *http.Request) {
 	u := currentUser(r.Context())
@@ -165,14 +209,9 @@ func (a *App) handleAccountHistory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Récupérer les infos actuelles du compte
-	var currentLogin, currentDisplayName string
-	var accountCreatedAt time.Time
-	err := a.db.QueryRowContext(r.Context(),
-		`SELECT login, display_name, created_at FROM accounts WHERE twitch_user_id = ? LIMIT 1`,
-		twitchUserID,
-	).Scan(&currentLogin, &currentDisplayName, &accountCreatedAt)
+	account, err := a.store.TwitchUsers.Get(r.Context(), twitchUserID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, store.ErrNotFound) {
 			http.Error(w, "account not found", http.StatusNotFound)
 			return
 		}
@@ -182,28 +221,22 @@ func (a *App) handleAccountHistory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Récupérer l'historique des changements
-	rows, err := a.db.QueryContext(r.Context(),
-		`SELECT changed_at, old_login, new_login, old_display_name, new_display_name 
-         FROM account_history 
-         WHERE twitch_user_id = ? 
-         ORDER BY changed_at DESC`,
-		twitchUserID,
-	)
+	changes, err := a.store.NameHistory.ForUser(r.Context(), twitchUserID)
 	if err != nil {
 		log.Printf("query history error: %v", err)
 		http.Error(w, "failed to load history", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var history []AccountHistoryChange
-	for rows.Next() {
-		var h AccountHistoryChange
-		if err := rows.Scan(&h.ChangedAt, &h.OldLogin, &h.NewLogin, &h.OldDisplayName, &h.NewDisplayName); err != nil {
-			log.Printf("scan history error: %v", err)
-			continue
-		}
-		history = append(history, h)
+	history := make([]AccountHistoryChange, 0, len(changes))
+	for _, c := range changes {
+		history = append(history, AccountHistoryChange{
+			ChangedAt:      c.ChangedAt,
+			OldLogin:       c.OldLogin,
+			NewLogin:       c.NewLogin,
+			OldDisplayName: c.OldDisplayName,
+			NewDisplayName: c.NewDisplayName,
+		})
 	}
 
 	data := struct {
@@ -212,15 +245,17 @@ func (a *App) handleAccountHistory(w http.ResponseWriter, r *http.Request) {
 		TwitchUserID       string
 		CurrentLogin       string
 		CurrentDisplayName string
-		AccountCreatedAt   time.Time
+		AccountCreatedAt   *time.Time
+		DisappearedAt      *time.Time // compte supprimé/suspendu depuis
 		History            []AccountHistoryChange
 	}{
 		Title:              "Historique des changements de noms",
 		CurrentUser:        u,
 		TwitchUserID:       twitchUserID,
-		CurrentLogin:       currentLogin,
-		CurrentDisplayName: currentDisplayName,
-		AccountCreatedAt:   accountCreatedAt,
+		CurrentLogin:       account.Login,
+		CurrentDisplayName: account.DisplayName,
+		AccountCreatedAt:   account.CreatedAt,
+		DisappearedAt:      account.DisappearedAt,
 		History:            history,
 	}
 
@@ -1,10 +1,15 @@
-package main
+package gateway
 
 import (
-	"database/sql"
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
 )
 
 // handleCreateCapture crée un job de capture de chatters
@@ -32,51 +37,53 @@ func (a *App) handleCreateCapture(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Récupérer la session pour avoir le token
-	c, err := r.Cookie("tca_session")
-	if err != nil || c.Value == "" {
-		http.Redirect(w, r, "/auth/login", http.StatusFound)
+	if _, _, err := a.enqueueCapture(r.Context(), u, broadcasterID, broadcasterLogin); err != nil {
+		log.Printf("enqueueCapture error: %v", err)
+		http.Error(w, "failed to enqueue job", http.StatusInternalServerError)
 		return
 	}
-	sessData, err := a.getSessionData(r.Context(), c.Value)
-	if err != nil {
-		http.Redirect(w, r, "/auth/login", http.StatusFound)
+
+	http.Redirect(w, r, "/channels?capture_enqueued=1", http.StatusFound)
+}
+
+// enqueueCapture crée un job FETCH_CHATTERS dans la session d'analyse active de l'utilisateur
+// (créée au besoin) et retourne l'id du job et l'UUID de la session
+func (a *App) enqueueCapture(ctx context.Context, u *CurrentUser, broadcasterID, broadcasterLogin string) (int64, string, error) {
+	return a.captures.Enqueue(ctx, u.ID, u.TwitchUserID, broadcasterID, broadcasterLogin, time.Time{})
+}
+
+// handleCreateFollowersFetch crée un job de récupération des followers d'une chaîne
+func (a *App) handleCreateFollowersFetch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Créer ou récupérer une session d'analyse
-	sessionID, _, err := a.getOrCreateAnalysisSession(r.Context(), sessData.UserID)
-	if err != nil {
-		log.Printf("getOrCreateAnalysisSession error: %v", err)
-		http.Error(w, "failed to create analysis session", http.StatusInternalServerError)
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
 		return
 	}
 
-	// Créer un job FETCH_CHATTERS
-	payload := map[string]interface{}{
-		"session_id":        sessionID,
-		"twitch_user_id":    u.TwitchUserID,
-		"broadcaster_id":    broadcasterID,
-		"broadcaster_login": broadcasterLogin,
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
 	}
-	payloadJSON, err := json.Marshal(payload)
-	if err != nil {
-		log.Printf("marshal job payload error: %v", err)
-		http.Error(w, "failed to enqueue job", http.StatusInternalServerError)
+
+	broadcasterID := r.Form.Get("broadcaster_id")
+	broadcasterLogin := r.Form.Get("broadcaster_login")
+	if broadcasterID == "" || broadcasterLogin == "" {
+		http.Error(w, "missing broadcaster", http.StatusBadRequest)
 		return
 	}
 
-	_, err = a.db.ExecContext(r.Context(),
-		`INSERT INTO jobs (type, payload, status, created_at) VALUES ('FETCH_CHATTERS', ?, 'pending', NOW(6))`,
-		string(payloadJSON),
-	)
-	if err != nil {
-		log.Printf("insert job error: %v", err)
+	if _, _, err := a.captures.EnqueueFollowers(r.Context(), u.ID, u.TwitchUserID, broadcasterID, broadcasterLogin); err != nil {
+		log.Printf("enqueueFollowers error: %v", err)
 		http.Error(w, "failed to enqueue job", http.StatusInternalServerError)
 		return
 	}
 
-	http.Redirect(w, r, "/channels?capture_enqueued=1", http.StatusFound)
+	http.Redirect(w, r, "/channels?followers_enqueued=1", http.StatusFound)
 }
 
 // handleSaveSession marque une session active comme sauvegardée
@@ -93,13 +100,9 @@ func (a *App) handleSaveSession(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Récupérer la session active
-	var sessionID int64
-	err := a.db.QueryRowContext(r.Context(),
-		`SELECT id FROM sessions WHERE user_id = ? AND status = 'active' LIMIT 1`,
-		u.ID,
-	).Scan(&sessionID)
+	sess, err := a.store.Sessions.Active(r.Context(), u.ID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, store.ErrNotFound) {
 			http.Redirect(w, r, "/analysis?save_no_session=1", http.StatusFound)
 			return
 		}
@@ -107,17 +110,32 @@ func (a *App) handleSaveSession(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to query session", http.StatusInternalServerError)
 		return
 	}
+	sessionID := sess.ID
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	// Au-delà du quota, les plus anciennes sessions ne sont supprimées qu'après confirmation
+	evict := r.Form.Get("evict") == "1"
 
 	// Marquer comme 'saved'
-	_, err = a.db.ExecContext(r.Context(), `UPDATE sessions SET status = 'saved', updated_at = NOW(6) WHERE id = ?`, sessionID)
+	evicted, err := a.store.Sessions.Save(r.Context(), sessionID, u.ID, a.savedQuotas.limit(u.Tier), evict)
+	if errors.Is(err, store.ErrQuotaExceeded) {
+		http.Redirect(w, r, "/analysis?save_quota=1", http.StatusFound)
+		return
+	}
 	if err != nil {
-		log.Printf("update session error: %v", err)
+		log.Printf("save session error: %v", err)
 		http.Error(w, "failed to save session", http.StatusInternalServerError)
 		return
 	}
+	for _, s := range evicted {
+		log.Printf("saved session %d of user %d evicted by quota", s.ID, u.ID)
+	}
 
 	log.Printf("session %d saved by user %d", sessionID, u.ID)
-	http.Redirect(w, r, "/sessions?saved=1", http.StatusFound)
+	http.Redirect(w, r, fmt.Sprintf("/sessions?saved=1&evicted=%d", len(evicted)), http.StatusFound)
 }
 
 // handlePurgeSession supprime une session active et ses données
@@ -134,13 +152,9 @@ func (a *App) handlePurgeSession(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Récupérer la session active
-	var sessionID int64
-	err := a.db.QueryRowContext(r.Context(),
-		`SELECT id FROM sessions WHERE user_id = ? AND status = 'active' LIMIT 1`,
-		u.ID,
-	).Scan(&sessionID)
+	sess, err := a.store.Sessions.Active(r.Context(), u.ID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, store.ErrNotFound) {
 			http.Redirect(w, r, "/channels?purge_no_session=1", http.StatusFound)
 			return
 		}
@@ -148,29 +162,11 @@ func (a *App) handlePurgeSession(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to query session", http.StatusInternalServerError)
 		return
 	}
+	sessionID := sess.ID
 
-	// Suppression en cascade : capture_chatters -> captures -> session
-	_, err = a.db.ExecContext(r.Context(), `
-DELETE cc FROM capture_chatters cc
-JOIN captures c ON cc.capture_id = c.id
-WHERE c.session_id = ?
-`, sessionID)
-	if err != nil {
-		log.Printf("delete capture_chatters error: %v", err)
-		http.Error(w, "failed to purge session", http.StatusInternalServerError)
-		return
-	}
-
-	_, err = a.db.ExecContext(r.Context(), `DELETE FROM captures WHERE session_id = ?`, sessionID)
-	if err != nil {
-		log.Printf("delete captures error: %v", err)
-		http.Error(w, "failed to purge session", http.StatusInternalServerError)
-		return
-	}
-
-	_, err = a.db.ExecContext(r.Context(), `UPDATE sessions SET status = 'deleted', updated_at = NOW(6) WHERE id = ?`, sessionID)
-	if err != nil {
-		log.Printf("update session error: %v", err)
+	// Suppression des captures, la session passe en 'deleted'
+	if err := a.store.Sessions.Purge(r.Context(), sessionID); err != nil {
+		log.Printf("purge session error: %v", err)
 		http.Error(w, "failed to purge session", http.StatusInternalServerError)
 		return
 	}
@@ -204,13 +200,9 @@ func (a *App) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Récupérer l'ID de la session
-	var sessionID int64
-	err := a.db.QueryRowContext(r.Context(),
-		`SELECT id FROM sessions WHERE user_id = ? AND session_uuid = ? AND status = 'saved' LIMIT 1`,
-		u.ID, sessionUUID,
-	).Scan(&sessionID)
+	sess, err := a.store.Sessions.Saved(r.Context(), u.ID, sessionUUID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, store.ErrNotFound) {
 			http.Redirect(w, r, "/sessions?delete_not_found=1", http.StatusFound)
 			return
 		}
@@ -218,28 +210,10 @@ func (a *App) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to query session", http.StatusInternalServerError)
 		return
 	}
+	sessionID := sess.ID
 
 	// Suppression en cascade
-	_, err = a.db.ExecContext(r.Context(), `
-DELETE cc FROM capture_chatters cc
-JOIN captures c ON cc.capture_id = c.id
-WHERE c.session_id = ?
-`, sessionID)
-	if err != nil {
-		log.Printf("delete capture_chatters error: %v", err)
-		http.Error(w, "failed to delete session", http.StatusInternalServerError)
-		return
-	}
-
-	_, err = a.db.ExecContext(r.Context(), `DELETE FROM captures WHERE session_id = ?`, sessionID)
-	if err != nil {
-		log.Printf("delete captures error: %v", err)
-		http.Error(w, "failed to delete session", http.StatusInternalServerError)
-		return
-	}
-
-	_, err = a.db.ExecContext(r.Context(), `DELETE FROM sessions WHERE id = ?`, sessionID)
-	if err != nil {
+	if err := a.store.Sessions.Delete(r.Context(), sessionID); err != nil {
 		log.Printf("delete session error: %v", err)
 		http.Error(w, "failed to delete session", http.StatusInternalServerError)
 		return
@@ -258,55 +232,48 @@ func (a *App) handleSessions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Récupérer toutes les sessions saved
-	rows, err := a.db.QueryContext(r.Context(),
-		`SELECT id, session_uuid, status, created_at, updated_at 
-         FROM sessions 
-         WHERE user_id = ? AND status = 'saved' 
-         ORDER BY updated_at DESC`,
-		u.ID,
-	)
+	saved, err := a.store.Sessions.ListSaved(r.Context(), u.ID)
 	if err != nil {
 		log.Printf("query sessions error: %v", err)
 		http.Error(w, "failed to load sessions", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var sessions []SavedSession
-	for rows.Next() {
-		var s SavedSession
-		if err := rows.Scan(&s.ID, &s.SessionUUID, &s.Status, &s.CreatedAt, &s.UpdatedAt); err != nil {
-			log.Printf("scan session error: %v", err)
-			continue
-		}
-		sessions = append(sessions, s)
+	sessions := make([]SavedSession, 0, len(saved))
+	for _, s := range saved {
+		sessions = append(sessions, SavedSession{
+			ID:          s.ID,
+			SessionUUID: s.UUID,
+			Status:      s.Status,
+			CreatedAt:   s.CreatedAt,
+			UpdatedAt:   s.UpdatedAt,
+		})
 	}
 
 	// Vérifier s'il y a une session active
-	hasActiveSession := false
-	var count int
-	err = a.db.QueryRowContext(r.Context(),
-		`SELECT COUNT(*) FROM sessions WHERE user_id = ? AND status = 'active'`,
-		u.ID,
-	).Scan(&count)
-	if err == nil && count > 0 {
-		hasActiveSession = true
-	}
+	hasActiveSession := a.hasActiveSession(r.Context(), u.ID)
+
+	quota := a.savedQuotaOf(u, saved)
+	evicted, _ := strconv.Atoi(r.URL.Query().Get("evicted"))
 
 	data := struct {
 		Title            string
 		CurrentUser      *CurrentUser
 		Sessions         []SavedSession
 		Saved            bool
+		Evicted          int
 		Deleted          bool
 		HasActiveSession bool
+		Quota            *SavedQuota
 	}{
 		Title:            "Mes sessions sauvegardées",
 		CurrentUser:      u,
 		Sessions:         sessions,
 		Saved:            r.URL.Query().Get("saved") == "1",
+		Evicted:          evicted,
 		Deleted:          r.URL.Query().Get("deleted") == "1",
 		HasActiveSession: hasActiveSession,
+		Quota:            quota,
 	}
 
 	if err := a.templates.ExecuteTemplate(w, "sessions.html", data); err != nil {
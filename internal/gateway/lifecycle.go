@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+)
+
+// Cycle de vie des sessions d'analyse : une session active expire SESSION_TTL après sa
+// création ; le nombre de sessions sauvegardées est limité par palier d'utilisateur
+// (SAVED_SESSIONS_QUOTAS). Au-delà, sauvegarder supprime les plus anciennes sessions
+// sauvegardées, après confirmation de l'utilisateur.
+
+// defaultSavedQuota est le quota du palier free, et celui d'un palier non configuré
+const defaultSavedQuota = 10
+
+// savedQuotas associe un palier d'utilisateur à son nombre maximal de sessions sauvegardées
+type savedQuotas map[string]int
+
+// parseSavedQuotas lit une liste "palier=quota" séparée par des virgules (ex: "free=10,premium=50")
+func parseSavedQuotas(s string) (savedQuotas, error) {
+	quotas := savedQuotas{store.TierFree: defaultSavedQuota}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		tier, value, ok := strings.Cut(item, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid saved sessions quota %q", item)
+		}
+		quotas[strings.TrimSpace(tier)] = n
+	}
+	return quotas, nil
+}
+
+// limit retourne le quota d'un palier (celui du palier free si le palier n'est pas configuré)
+func (q savedQuotas) limit(tier string) int {
+	if n, ok := q[tier]; ok {
+		return n
+	}
+	return q[store.TierFree]
+}
+
+// SavedQuota est l'occupation du quota de sessions sauvegardées d'un utilisateur
+type SavedQuota struct {
+	Tier  string
+	Limit int
+	Used  int
+	// Sessions supprimées par la prochaine sauvegarde, les plus anciennes d'abord
+	Evicted []SavedSession
+}
+
+// Full indique si la prochaine sauvegarde supprimera des sessions
+func (q SavedQuota) Full() bool {
+	return q.Used >= q.Limit
+}
+
+// savedQuota calcule l'occupation du quota de l'utilisateur
+func (a *App) savedQuota(ctx context.Context, u *CurrentUser) (*SavedQuota, error) {
+	saved, err := a.store.Sessions.ListSaved(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	return a.savedQuotaOf(u, saved), nil
+}
+
+// savedQuotaOf calcule l'occupation du quota à partir des sessions sauvegardées de l'utilisateur
+func (a *App) savedQuotaOf(u *CurrentUser, saved []store.Session) *SavedQuota {
+	q := &SavedQuota{Tier: u.Tier, Limit: a.savedQuotas.limit(u.Tier), Used: len(saved)}
+
+	// ListSaved retourne les plus récentes d'abord
+	for i := len(saved) - 1; i >= 0 && len(q.Evicted) < q.Used-q.Limit+1; i-- {
+		s := saved[i]
+		q.Evicted = append(q.Evicted, SavedSession{
+			ID:          s.ID,
+			SessionUUID: s.UUID,
+			Status:      s.Status,
+			CreatedAt:   s.CreatedAt,
+			UpdatedAt:   s.UpdatedAt,
+		})
+	}
+	return q
+}
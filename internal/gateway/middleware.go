@@ -0,0 +1,103 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+)
+
+// loggingMiddleware logs HTTP requests with status code, method, path, and duration
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// Wrap the ResponseWriter to capture status code
+		wrapped := &responseWriter{
+			ResponseWriter: w,
+			statusCode:     200, // default status
+			written:        false,
+		}
+
+		next.ServeHTTP(wrapped, r)
+
+		log.Printf("%d %s %s from %s in %s",
+			wrapped.statusCode,
+			r.Method,
+			r.URL.Path,
+			r.RemoteAddr,
+			time.Since(start),
+		)
+	})
+}
+
+// loadCurrentUser middleware charge l'utilisateur depuis la session, ou depuis le token
+// d'API (Authorization: Bearer) pour les routes /api/
+func (a *App) loadCurrentUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := bearerToken(r); token != "" && strings.HasPrefix(r.URL.Path, "/api/") {
+			a.loadTokenUser(next, w, r, token)
+			return
+		}
+
+		c, err := r.Cookie("tca_session")
+		if err != nil || c.Value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sessionID := c.Value
+
+		// Jointure web_sessions -> users, vérifier que la session n'est pas expirée
+		user, err := a.store.Users.ByWebSession(r.Context(), sessionID)
+		if err != nil {
+			// Session invalide/expirée : on ignore silencieusement
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Mettre à jour last_activity_at
+		_ = a.store.WebSessions.Touch(r.Context(), sessionID)
+
+		u := &CurrentUser{
+			ID:           user.ID,
+			TwitchUserID: user.TwitchUserID,
+			Login:        user.Login,
+			DisplayName:  user.DisplayName,
+			Tier:         user.Tier,
+		}
+
+		ctx := context.WithValue(r.Context(), ctxKeyUser, u)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// loadTokenUser authentifie la requête par un token d'API ; un token inconnu, révoqué ou
+// expiré laisse la requête anonyme (l'API répond 401)
+func (a *App) loadTokenUser(next http.Handler, w http.ResponseWriter, r *http.Request, token string) {
+	t, user, err := a.store.APITokens.Authenticate(r.Context(), hashAPIToken(token))
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("api token authentication error: %v", err)
+		}
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	u := &CurrentUser{
+		ID:           user.ID,
+		TwitchUserID: user.TwitchUserID,
+		Login:        user.Login,
+		DisplayName:  user.DisplayName,
+		Tier:         user.Tier,
+		APITokenID:   t.ID,
+		Scopes:       t.Scopes,
+	}
+
+	ctx := context.WithValue(r.Context(), ctxKeyUser, u)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
@@ -0,0 +1,231 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+)
+
+// Tokens d'accès personnels à l'API : "tca_" suivi de 32 octets aléatoires en hexadécimal,
+// transmis dans l'en-tête Authorization: Bearer. Seule leur empreinte SHA-256 est stockée ;
+// le token n'est affiché qu'une fois, à sa création. Ils n'authentifient que /api/v1.
+
+const apiTokenPrefix = "tca_"
+
+// Portées des tokens (une session web les a toutes)
+const (
+	scopeAnalysisRead   = "analysis:read"   // lecture : chaînes, sessions, jobs, analyses, exports, alertes
+	scopeCapture        = "capture"         // création de captures
+	scopeSessionsManage = "sessions:manage" // sauvegarde, purge et suppression de sessions
+	scopeAlertsManage   = "alerts:manage"   // règles d'alerte et acquittement des alertes
+)
+
+// APITokenScope décrit une portée dans le formulaire de création
+type APITokenScope struct {
+	Name        string
+	Description string
+}
+
+var apiTokenScopes = []APITokenScope{
+	{scopeAnalysisRead, "Lecture des chaînes, sessions, jobs, analyses, exports et alertes"},
+	{scopeCapture, "Création de captures"},
+	{scopeSessionsManage, "Sauvegarde, purge et suppression de sessions"},
+	{scopeAlertsManage, "Règles d'alerte et acquittement des alertes"},
+}
+
+// Durées de validité proposées, en jours
+var apiTokenLifetimes = []int{7, 30, 90, 365}
+
+// newAPIToken génère un token et retourne le token en clair, son empreinte et son préfixe affichable
+func newAPIToken() (token, hash, prefix string, err error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	token = apiTokenPrefix + secret
+	return token, hashAPIToken(token), token[:len(apiTokenPrefix)+8], nil
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken retourne le token de l'en-tête Authorization: Bearer, ou ""
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// hasScope indique si l'utilisateur peut utiliser une opération de portée scope
+// ("" : toute requête authentifiée) ; une session web a toutes les portées
+func (u *CurrentUser) hasScope(scope string) bool {
+	return u.APITokenID == 0 || scope == "" || slices.Contains(u.Scopes, scope)
+}
+
+// handleTokens affiche les tokens d'API de l'utilisateur et le formulaire de création
+func (a *App) handleTokens(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+	a.renderTokens(w, r, u, "", "")
+}
+
+// renderTokens affiche la page /tokens ; newToken n'est renseigné qu'après une création
+func (a *App) renderTokens(w http.ResponseWriter, r *http.Request, u *CurrentUser, newToken, formError string) {
+	tokens, err := a.store.APITokens.ListByUser(r.Context(), u.ID)
+	if err != nil {
+		log.Printf("list api tokens error: %v", err)
+		http.Error(w, "failed to load tokens", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Title            string
+		CurrentUser      *CurrentUser
+		HasActiveSession bool
+		Tokens           []store.APIToken
+		Scopes           []APITokenScope
+		Lifetimes        []int
+		NewToken         string
+		FormError        string
+		Revoked          bool
+	}{
+		Title:            "Tokens d'API",
+		CurrentUser:      u,
+		HasActiveSession: a.hasActiveSession(r.Context(), u.ID),
+		Tokens:           tokens,
+		Scopes:           apiTokenScopes,
+		Lifetimes:        apiTokenLifetimes,
+		NewToken:         newToken,
+		FormError:        formError,
+		Revoked:          r.URL.Query().Get("revoked") == "1",
+	}
+
+	if err := a.templates.ExecuteTemplate(w, "tokens.html", data); err != nil {
+		log.Printf("template error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// handleCreateToken crée un token et l'affiche une seule fois
+func (a *App) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(r.Form.Get("name"))
+	var scopes []string
+	for _, s := range apiTokenScopes {
+		if slices.Contains(r.Form["scopes"], s.Name) {
+			scopes = append(scopes, s.Name)
+		}
+	}
+	days, _ := strconv.Atoi(r.Form.Get("expires_in_days"))
+
+	switch {
+	case name == "" || len(name) > 100:
+		a.renderTokens(w, r, u, "", "Le nom est obligatoire (100 caractères au plus).")
+		return
+	case len(scopes) == 0:
+		a.renderTokens(w, r, u, "", "Choisissez au moins une portée.")
+		return
+	case !slices.Contains(apiTokenLifetimes, days):
+		a.renderTokens(w, r, u, "", "Durée de validité invalide.")
+		return
+	}
+
+	token, hash, prefix, err := newAPIToken()
+	if err != nil {
+		log.Printf("generate api token error: %v", err)
+		http.Error(w, "failed to create token", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	id, err := a.store.APITokens.Create(r.Context(), store.APIToken{
+		UserID:      u.ID,
+		Name:        name,
+		TokenHash:   hash,
+		TokenPrefix: prefix,
+		Scopes:      scopes,
+		CreatedAt:   now,
+		ExpiresAt:   now.AddDate(0, 0, days),
+	})
+	if err != nil {
+		log.Printf("create api token error: %v", err)
+		http.Error(w, "failed to create token", http.StatusInternalServerError)
+		return
+	}
+	if err := a.store.Audit.Log(r.Context(), store.AuditAPITokenCreated, u.ID, 0, map[string]any{
+		"token_id": id, "name": name, "scopes": scopes, "expires_in_days": days,
+	}); err != nil {
+		log.Printf("audit log error: %v", err)
+	}
+
+	a.renderTokens(w, r, u, token, "")
+}
+
+// handleRevokeToken révoque un token de l'utilisateur
+func (a *App) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.ParseInt(r.Form.Get("token_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid token_id", http.StatusBadRequest)
+		return
+	}
+
+	err = a.store.APITokens.Revoke(r.Context(), u.ID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Redirect(w, r, "/tokens", http.StatusFound)
+		return
+	}
+	if err != nil {
+		log.Printf("revoke api token error: %v", err)
+		http.Error(w, "failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	if err := a.store.Audit.Log(r.Context(), store.AuditAPITokenRevoked, u.ID, 0, map[string]any{"token_id": id}); err != nil {
+		log.Printf("audit log error: %v", err)
+	}
+
+	http.Redirect(w, r, "/tokens?revoked=1", http.StatusFound)
+}
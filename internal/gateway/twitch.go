@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitch"
+)
+
+// exchangeCodeForToken échange un code OAuth contre un token d'accès
+func (a *App) exchangeCodeForToken(ctx context.Context, code string) (*twitchTokenResponse, error) {
+	if a.twitchClientID == "" || a.twitchClientSecret == "" || a.twitchRedirectURL == "" {
+		return nil, fmt.Errorf("twitch client not configured")
+	}
+
+	data := url.Values{}
+	data.Set("client_id", a.twitchClientID)
+	data.Set("client_secret", a.twitchClientSecret)
+	data.Set("code", code)
+	data.Set("grant_type", "authorization_code")
+	data.Set("redirect_uri", a.twitchRedirectURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.twitchAuthBaseURL+"/token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("twitch token endpoint returned %s", resp.Status)
+	}
+
+	var tr twitchTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return nil, err
+	}
+	return &tr, nil
+}
+
+// fetchTwitchUser récupère les informations de l'utilisateur associé au token (via le proxy twitch-api)
+func (a *App) fetchTwitchUser(ctx context.Context, accessToken string) (*twitchUser, error) {
+	u, err := a.twitch.GetCurrentUser(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return &twitchUser{
+		ID:              u.ID,
+		Login:           u.Login,
+		DisplayName:     u.DisplayName,
+		ProfileImageURL: u.ProfileImageURL,
+	}, nil
+}
+
+// fetchBroadcasterInfo récupère les informations du broadcaster (l'utilisateur connecté)
+func (a *App) fetchBroadcasterInfo(ctx context.Context, accessToken, userID string) (*twitchUser, error) {
+	u, err := a.twitch.GetUser(ctx, accessToken, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &twitchUser{
+		ID:              u.ID,
+		Login:           u.Login,
+		DisplayName:     u.DisplayName,
+		ProfileImageURL: u.ProfileImageURL,
+	}, nil
+}
+
+// fetchModeratedChannels récupère les chaînes modérées par un utilisateur + sa propre chaîne
+func (a *App) fetchModeratedChannels(ctx context.Context, accessToken, userID string) ([]twitch.ModeratedChannel, error) {
+	// Récupérer les informations du broadcaster (pour sa propre chaîne)
+	broadcaster, err := a.fetchBroadcasterInfo(ctx, accessToken, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch broadcaster info: %w", err)
+	}
+
+	// Initialiser la liste avec la propre chaîne du broadcaster
+	out := []twitch.ModeratedChannel{
+		{
+			BroadcasterID:    broadcaster.ID,
+			BroadcasterLogin: broadcaster.Login,
+			BroadcasterName:  broadcaster.DisplayName,
+		},
+	}
+
+	// Récupérer les chaînes où l'utilisateur est modérateur
+	channels, err := a.twitch.GetModeratedChannels(ctx, accessToken, userID)
+	if err != nil {
+		if errors.Is(err, twitch.ErrUnauthorized) {
+			return nil, err
+		}
+		// Scope absent (403) ou erreur temporaire : retourner au moins la propre chaîne
+		log.Printf("fetch moderated channels for %s: %v", userID, err)
+		return out, nil
+	}
+
+	// Ajouter les chaînes modérées (en évitant les doublons si par hasard l'API retournait la propre chaîne)
+	for _, c := range channels {
+		if c.BroadcasterID == broadcaster.ID {
+			continue
+		}
+		out = append(out, c)
+	}
+
+	return out, nil
+}
+
+// revokeTwitchToken révoque un token d'accès Twitch
+func (a *App) revokeTwitchToken(ctx context.Context, accessToken string) error {
+	data := url.Values{}
+	data.Set("client_id", a.twitchClientID)
+	data.Set("token", accessToken)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.twitchAuthBaseURL+"/revoke", strings.NewReader(data.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("twitch revoke returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package gateway
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/autocapture"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/events"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitch"
+)
+
+// App contient la configuration et les dépendances de l'application
+type App struct {
+	store     *store.Store
+	templates *template.Template
+	staticDir string
+
+	twitchClientID     string
+	twitchClientSecret string
+	twitchRedirectURL  string
+
+	// Endpoints OAuth Twitch (surchargés pour pointer vers twitch-mock) :
+	// twitchAuthBaseURL est appelé par le serveur (token, revoke),
+	// twitchAuthorizeURL est l'URL vers laquelle le navigateur est redirigé.
+	twitchAuthBaseURL  string
+	twitchAuthorizeURL string
+
+	analysisBaseURL string
+
+	// Client du proxy twitch-api (tous les appels Helix passent par lui)
+	twitch *twitch.Client
+
+	// Chaînes modérées par utilisateur (invalidées sur rafraîchissement ou déconnexion)
+	channelsCache *channelsCache
+
+	// Cycle de vie des sessions d'analyse (voir lifecycle.go)
+	sessionTTL  time.Duration
+	savedQuotas savedQuotas
+
+	// Planification des captures (manuelles et EventSub)
+	captures *autocapture.Scheduler
+
+	// Événements des sessions, relayés en Server-Sent Events (nil sans REDIS_URL)
+	events *events.Bus
+
+	// Transport des nouveaux abonnements EventSub (webhook, websocket ; vide : captures
+	// automatiques désactivées), callback public et secret du transport webhook
+	eventsubTransport   string
+	eventsubCallbackURL string
+	eventsubSecret      string
+}
+
+// CurrentUser représente l'utilisateur actuellement connecté
+type CurrentUser struct {
+	ID           int64
+	TwitchUserID string
+	Login        string
+	DisplayName  string
+	Tier         string
+
+	// Requête authentifiée par un token d'API (0 pour une session web) et ses portées
+	APITokenID int64
+	Scopes     []string
+}
+
+// SessionData contient les données d'une session web
+type SessionData struct {
+	SessionID    string
+	UserID       int64
+	AccessToken  string
+	RefreshToken string
+}
+
+// SavedSession représente une session d'analyse sauvegardée
+type SavedSession struct {
+	ID          int64
+	SessionUUID string
+	Status      string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// ExportData structure pour l'export de données
+type ExportData struct {
+	SessionUUID string              `json:"session_uuid"`
+	ExportedAt  time.Time           `json:"exported_at"`
+	Accounts    []ExportAccountData `json:"accounts"`
+}
+
+// ExportAccountData données d'un compte pour l'export
+type ExportAccountData struct {
+	TwitchUserID string     `json:"twitch_user_id"`
+	Login        string     `json:"login"`
+	DisplayName  string     `json:"display_name"`
+	CreatedAt    *time.Time `json:"created_at"` // nil tant que le compte n'est pas enrichi
+	SeenCount    int64      `json:"seen_count"`
+	FirstSeen    time.Time  `json:"first_seen"`
+	LastSeen     time.Time  `json:"last_seen"`
+}
+
+// AccountHistoryChange représente un changement de nom de compte
+type AccountHistoryChange struct {
+	ChangedAt      time.Time
+	OldLogin       string
+	NewLogin       string
+	OldDisplayName string
+	NewDisplayName string
+}
+
+// Broadcaster représente un broadcaster Twitch
+type Broadcaster struct {
+	BroadcasterID    string `json:"broadcaster_id"`
+	BroadcasterLogin string `json:"broadcaster_login"`
+	CaptureCount     int64  `json:"capture_count"`
+}
+
+// SuspiciousAccount représente un compte suspect
+type SuspiciousAccount struct {
+	TwitchUserID string `json:"twitch_user_id"`
+	Login        string `json:"login"`
+	DisplayName  string `json:"display_name"`
+	RenameCount  int64  `json:"rename_count"`
+}
+
+// AnalysisSummary résumé d'une analyse de session
+type AnalysisSummary struct {
+	SessionUUID            string              `json:"session_uuid"`
+	TotalAccounts          int64               `json:"total_accounts"`
+	TopDays                []struct {
+		Date   string   `json:"date"`
+		Count  int64    `json:"count"`
+		Logins []string `json:"logins"`
+	} `json:"top_days"`
+	Broadcasters           []Broadcaster       `json:"broadcasters"`
+	SuspiciousRenamesCount int64               `json:"suspicious_renames_count"`
+	SuspiciousAccounts     []SuspiciousAccount `json:"suspicious_accounts"`
+	MissingAccountsCount   int64               `json:"missing_accounts_count"`
+	DefaultAvatarCount     int64               `json:"default_avatar_count"`
+	EmptyDescriptionCount  int64               `json:"empty_description_count"`
+	AvatarClusters         []struct {
+		ProfileImageURL string   `json:"profile_image_url"`
+		Count           int64    `json:"count"`
+		Logins          []string `json:"logins"`
+	} `json:"avatar_clusters"`
+	Chat                   *ChatSummary        `json:"chat,omitempty"`
+	Followers              *FollowerSummary    `json:"followers,omitempty"`
+	GeneratedAt            time.Time           `json:"generated_at"`
+}
+
+// ChatSummary activité du chat des chaînes écoutées (absente si aucune ne l'a été)
+type ChatSummary struct {
+	Channels []struct {
+		BroadcasterID    string    `json:"broadcaster_id"`
+		BroadcasterLogin string    `json:"broadcaster_login"`
+		ListeningSince   time.Time `json:"listening_since"`
+	} `json:"channels"`
+	Messages     int64 `json:"messages"`
+	SilentCount  int64 `json:"silent_count"`
+	ActiveCount  int64 `json:"active_count"`
+	SpamCount    int64 `json:"spam_count"`
+	SpamAccounts []struct {
+		TwitchUserID   string    `json:"twitch_user_id"`
+		Login          string    `json:"login"`
+		MessageCount   int64     `json:"message_count"`
+		DuplicateCount int64     `json:"duplicate_count"`
+		FirstMessageAt time.Time `json:"first_message_at"`
+		LastMessageAt  time.Time `json:"last_message_at"`
+	} `json:"spam_accounts"`
+	RepeatedMessages []struct {
+		BroadcasterID string    `json:"broadcaster_id"`
+		Sample        string    `json:"sample"`
+		Count         int64     `json:"count"`
+		FirstSeenAt   time.Time `json:"first_seen_at"`
+		LastSeenAt    time.Time `json:"last_seen_at"`
+	} `json:"repeated_messages"`
+}
+
+// FollowerSummary vagues de follows des chaînes dont les followers ont été récupérés (absente
+// sinon)
+type FollowerSummary struct {
+	Channels []struct {
+		BroadcasterID    string    `json:"broadcaster_id"`
+		BroadcasterLogin string    `json:"broadcaster_login"`
+		Total            int64     `json:"total"`
+		Fetched          int64     `json:"fetched"`
+		FetchedAt        time.Time `json:"fetched_at"`
+	} `json:"channels"`
+	Spikes []struct {
+		BroadcasterID    string    `json:"broadcaster_id"`
+		BroadcasterLogin string    `json:"broadcaster_login"`
+		Start            time.Time `json:"start"`
+		End              time.Time `json:"end"`
+		Follows          int64     `json:"follows"`
+		Expected         float64   `json:"expected"`
+		KnownAccounts    int64     `json:"known_accounts"`
+		InChatCount      int64     `json:"in_chat_count"`
+		TopCreationDays  []struct {
+			Date     string `json:"date"`
+			Count    int64  `json:"count"`
+			Chatters int64  `json:"chatters"`
+		} `json:"top_creation_days"`
+		Logins []string `json:"logins"`
+	} `json:"spikes"`
+}
+
+// twitchUser représente un utilisateur Twitch
+type twitchUser struct {
+	ID              string
+	Login           string
+	DisplayName     string
+	ProfileImageURL string
+}
+
+// twitchTokenResponse réponse OAuth de Twitch
+type twitchTokenResponse struct {
+	AccessToken  string   `json:"access_token"`
+	RefreshToken string   `json:"refresh_token"`
+	ExpiresIn    int      `json:"expires_in"`
+	Scope        []string `json:"scope"`
+	TokenType    string   `json:"token_type"`
+}
+
+// responseWriter wraps http.ResponseWriter to capture status code
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	written    bool
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.written {
+		rw.statusCode = code
+		rw.written = true
+		rw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.written {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap expose le ResponseWriter d'origine à http.ResponseController (Flush des flux SSE)
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// contextKey type pour les clés de contexte
+type contextKey string
+
+const ctxKeyUser contextKey = "currentUser"
+
+// currentUser récupère l'utilisateur depuis le contexte
+func currentUser(ctx context.Context) *CurrentUser {
+	u, _ := ctx.Value(ctxKeyUser).(*CurrentUser)
+	return u
+}
+
+// APIUser est l'utilisateur connecté, dans l'API
+type APIUser struct {
+	TwitchUserID string `json:"twitch_user_id"`
+	Login        string `json:"login"`
+	DisplayName  string `json:"display_name"`
+	Tier         string `json:"tier"`
+}
+
+// APISession est une session d'analyse, dans l'API
+type APISession struct {
+	SessionUUID string     `json:"session_uuid"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // sessions actives uniquement
+}
+
+// APIQuota est l'occupation du quota de sessions sauvegardées, dans l'API
+type APIQuota struct {
+	Tier  string `json:"tier"`
+	Limit int    `json:"limit"`
+	Used  int    `json:"used"`
+}
+
+// APIJob est l'état d'un job du worker, dans l'API
+type APIJob struct {
+	ID         int64          `json:"id"`
+	Type       string         `json:"type"`
+	Status     string         `json:"status"`
+	Progress   APIJobProgress `json:"progress"`
+	CreatedAt  time.Time      `json:"created_at"`
+	StartedAt  *time.Time     `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// APIJobProgress est l'avancement d'un job, dans l'API
+type APIJobProgress struct {
+	Done    int    `json:"done"`
+	Total   *int   `json:"total"` // null tant que le total est inconnu
+	Message string `json:"message,omitempty"`
+}
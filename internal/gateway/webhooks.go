@@ -0,0 +1,262 @@
+package gateway
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/webhooks"
+)
+
+// Webhooks : l'utilisateur abonne des URL (générique, Discord ou Slack) aux événements de
+// ses sessions ; le worker envoie les notifications signées avec le secret du webhook.
+
+// WebhookEvent décrit un événement dans le formulaire de création
+type WebhookEvent struct {
+	Name        string
+	Description string
+}
+
+var webhookEvents = []WebhookEvent{
+	{store.WebhookCaptureFinished, "Capture terminée (enregistrée et enrichie)"},
+	{store.WebhookCreationBurst, "Rafale de comptes créés le même jour, au-delà du seuil"},
+	{store.WebhookSuspiciousAccounts, "Comptes suspects (disparus, avatar par défaut, renommés), au-delà du seuil"},
+	{store.WebhookJobFailed, "Job en échec"},
+	{store.WebhookAlertTriggered, "Règle d'alerte déclenchée (voir la page Alertes)"},
+}
+
+var webhookFormats = []string{store.WebhookFormatGeneric, store.WebhookFormatDiscord, store.WebhookFormatSlack}
+
+// Nombre de livraisons affichées dans le journal
+const webhookDeliveriesShown = 20
+
+// handleWebhooks affiche les webhooks de l'utilisateur, le formulaire de création et le journal des livraisons
+func (a *App) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+	a.renderWebhooks(w, r, u, "")
+}
+
+func (a *App) renderWebhooks(w http.ResponseWriter, r *http.Request, u *CurrentUser, formError string) {
+	hooks, err := a.store.Webhooks.ListByUser(r.Context(), u.ID)
+	if err != nil {
+		log.Printf("list webhooks error: %v", err)
+		http.Error(w, "failed to load webhooks", http.StatusInternalServerError)
+		return
+	}
+	deliveries, err := a.store.Webhooks.ListDeliveries(r.Context(), u.ID, webhookDeliveriesShown)
+	if err != nil {
+		log.Printf("list webhook deliveries error: %v", err)
+		http.Error(w, "failed to load webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Title            string
+		CurrentUser      *CurrentUser
+		HasActiveSession bool
+		Webhooks         []store.Webhook
+		Deliveries       []store.WebhookDelivery
+		Events           []WebhookEvent
+		Formats          []string
+		FormError        string
+		Notice           string
+	}{
+		Title:            "Webhooks",
+		CurrentUser:      u,
+		HasActiveSession: a.hasActiveSession(r.Context(), u.ID),
+		Webhooks:         hooks,
+		Deliveries:       deliveries,
+		Events:           webhookEvents,
+		Formats:          webhookFormats,
+		FormError:        formError,
+		Notice:           r.URL.Query().Get("notice"),
+	}
+
+	if err := a.templates.ExecuteTemplate(w, "webhooks.html", data); err != nil {
+		log.Printf("template error: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// handleCreateWebhook enregistre un webhook avec un secret de signature aléatoire
+func (a *App) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(r.Form.Get("name"))
+	url := strings.TrimSpace(r.Form.Get("url"))
+	format := r.Form.Get("format")
+	var events []string
+	for _, e := range webhookEvents {
+		if slices.Contains(r.Form["events"], e.Name) {
+			events = append(events, e.Name)
+		}
+	}
+	burst, errBurst := strconv.Atoi(r.Form.Get("creation_burst_threshold"))
+	suspicious, errSuspicious := strconv.Atoi(r.Form.Get("suspicious_threshold"))
+
+	switch {
+	case name == "" || len(name) > 100:
+		a.renderWebhooks(w, r, u, "Le nom est obligatoire (100 caractères au plus).")
+		return
+	case len(url) > 2048 || webhooks.ValidateURL(url) != nil:
+		a.renderWebhooks(w, r, u, "L'URL doit être une URL http:// ou https:// (2048 caractères au plus).")
+		return
+	case !slices.Contains(webhookFormats, format):
+		a.renderWebhooks(w, r, u, "Format invalide.")
+		return
+	case len(events) == 0:
+		a.renderWebhooks(w, r, u, "Choisissez au moins un événement.")
+		return
+	case errBurst != nil || burst < 1 || errSuspicious != nil || suspicious < 1:
+		a.renderWebhooks(w, r, u, "Les seuils doivent être des entiers positifs.")
+		return
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		log.Printf("generate webhook secret error: %v", err)
+		http.Error(w, "failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+	id, err := a.store.Webhooks.Create(r.Context(), store.Webhook{
+		UserID:                 u.ID,
+		Name:                   name,
+		URL:                    url,
+		Format:                 format,
+		Secret:                 secret,
+		Events:                 events,
+		CreationBurstThreshold: burst,
+		SuspiciousThreshold:    suspicious,
+		Enabled:                true,
+		CreatedAt:              time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("create webhook error: %v", err)
+		http.Error(w, "failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+	if err := a.store.Audit.Log(r.Context(), store.AuditWebhookCreated, u.ID, 0, map[string]any{
+		"webhook_id": id, "name": name, "format": format, "events": events,
+	}); err != nil {
+		log.Printf("audit log error: %v", err)
+	}
+
+	http.Redirect(w, r, "/webhooks?notice=created", http.StatusFound)
+}
+
+// webhookFromForm retourne le webhook de l'utilisateur désigné par le champ webhook_id ;
+// en cas d'erreur, la réponse est déjà écrite
+func (a *App) webhookFromForm(w http.ResponseWriter, r *http.Request) (*CurrentUser, *store.Webhook, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, nil, false
+	}
+
+	u := currentUser(r.Context())
+	if u == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		return nil, nil, false
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	id, err := strconv.ParseInt(r.Form.Get("webhook_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid webhook_id", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	hook, err := a.store.Webhooks.Get(r.Context(), u.ID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Redirect(w, r, "/webhooks", http.StatusFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		log.Printf("get webhook error: %v", err)
+		http.Error(w, "failed to load webhook", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return u, hook, true
+}
+
+// handleDeleteWebhook supprime un webhook et son journal de livraisons
+func (a *App) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	u, hook, ok := a.webhookFromForm(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.store.Webhooks.Delete(r.Context(), u.ID, hook.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("delete webhook error: %v", err)
+		http.Error(w, "failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+	if err := a.store.Audit.Log(r.Context(), store.AuditWebhookDeleted, u.ID, 0, map[string]any{"webhook_id": hook.ID}); err != nil {
+		log.Printf("audit log error: %v", err)
+	}
+
+	http.Redirect(w, r, "/webhooks?notice=deleted", http.StatusFound)
+}
+
+// handleToggleWebhook suspend ou réactive un webhook
+func (a *App) handleToggleWebhook(w http.ResponseWriter, r *http.Request) {
+	u, hook, ok := a.webhookFromForm(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.store.Webhooks.SetEnabled(r.Context(), u.ID, hook.ID, !hook.Enabled); err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("toggle webhook error: %v", err)
+		http.Error(w, "failed to update webhook", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/webhooks", http.StatusFound)
+}
+
+// handleTestWebhook planifie l'envoi d'une notification de test
+func (a *App) handleTestWebhook(w http.ResponseWriter, r *http.Request) {
+	_, hook, ok := a.webhookFromForm(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := webhooks.Enqueue(r.Context(), a.store, *hook, webhooks.Notification{
+		Event: store.WebhookTest,
+		Title: "Test du webhook " + hook.Name,
+		Text:  "Les notifications de Twitch Chatters Analyser arriveront ici.",
+		At:    time.Now().UTC(),
+	}); err != nil {
+		log.Printf("enqueue webhook test error: %v", err)
+		http.Error(w, "failed to test webhook", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/webhooks?notice=tested", http.StatusFound)
+}
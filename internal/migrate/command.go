@@ -0,0 +1,104 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Usage décrit la sous-commande migrate des services
+const Usage = `usage: <service> migrate <command>
+
+commands:
+  up          applique toutes les migrations en attente
+  down [n]    annule les n dernières migrations (défaut : 1)
+  status      affiche l'état de chaque migration`
+
+// Run exécute la sous-commande migrate (args sans le mot "migrate") et écrit le résultat dans out
+func Run(ctx context.Context, dsn string, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", Usage)
+	}
+
+	r, err := Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := r.Up(ctx)
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		reverted, err := r.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Fprintf(out, "reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Fprintln(out, "nothing to revert")
+		}
+		return nil
+
+	case "status":
+		states, err := r.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, st := range states {
+			status, appliedAt := "pending", "-"
+			if st.AppliedAt != nil {
+				status, appliedAt = "applied", st.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+			}
+			if st.Unknown {
+				status = "unknown"
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", st.Version, st.Name, status, appliedAt)
+		}
+		return tw.Flush()
+
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], Usage)
+	}
+}
+
+// AutoMigrate applique les migrations en attente au démarrage d'un service (DB_AUTO_MIGRATE).
+// Plusieurs réplicas peuvent l'appeler en même temps : le verrou les sérialise.
+func AutoMigrate(ctx context.Context, dsn string) error {
+	r, err := Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	applied, err := r.Up(ctx)
+	for _, m := range applied {
+		log.Printf("migration %04d_%s applied", m.Version, m.Name)
+	}
+	return err
+}
@@ -0,0 +1,302 @@
+// Package migrate applique les migrations versionnées du schéma MySQL/MariaDB.
+//
+// Les migrations sont embarquées dans les binaires (répertoire migrations/) sous la forme
+// NNNN_nom.up.sql / NNNN_nom.down.sql. Les versions appliquées sont enregistrées dans la
+// table schema_migrations. Un verrou nommé (GET_LOCK) empêche plusieurs réplicas de migrer
+// la même base en même temps.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// DefaultLockTimeout est la durée d'attente maximale du verrou de migration
+const DefaultLockTimeout = 5 * time.Minute
+
+// ErrLockTimeout est retournée quand une autre instance migre la base trop longtemps
+var ErrLockTimeout = errors.New("migrate: timeout waiting for migration lock")
+
+// Migration est une version du schéma
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// State décrit l'état d'une migration dans une base
+type State struct {
+	Migration
+	AppliedAt *time.Time // nil si la migration n'est pas appliquée
+	// Unknown est vrai pour une version appliquée en base mais absente du binaire
+	// (base migrée par une version plus récente de l'application)
+	Unknown bool
+}
+
+// Load retourne les migrations embarquées, triées par version
+func Load() ([]Migration, error) {
+	return load(migrationsFS, "migrations")
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migrate: unexpected file %s", name)
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionStr, label, ok := strings.Cut(base, "_")
+		if !ok || label == "" {
+			return nil, fmt.Errorf("migrate: invalid file name %s (want NNNN_name.%s.sql)", name, direction)
+		}
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrate: invalid version in %s", name)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migrate: version %d used by %s and %s", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("migrate: version %d (%s) has no up migration", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Runner applique les migrations sur une base
+type Runner struct {
+	db          *sql.DB
+	migrations  []Migration
+	LockTimeout time.Duration
+}
+
+// Open ouvre une connexion dédiée aux migrations. Le DSN est celui des services ;
+// multiStatements y est activé car un fichier de migration contient plusieurs requêtes.
+func Open(dsn string) (*Runner, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: invalid DSN: %w", err)
+	}
+	cfg.MultiStatements = true
+	cfg.ParseTime = true
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(2)
+
+	migrations, err := Load()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Runner{db: db, migrations: migrations, LockTimeout: DefaultLockTimeout}, nil
+}
+
+// Close ferme la connexion du runner
+func (r *Runner) Close() error {
+	return r.db.Close()
+}
+
+// Up applique toutes les migrations en attente et retourne celles appliquées
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range r.migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx, m.Up); err != nil {
+				return fmt.Errorf("migrate: %04d_%s up: %w", m.Version, m.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Name, time.Now().UTC(),
+			); err != nil {
+				return err
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down annule les steps dernières migrations appliquées et retourne celles annulées
+func (r *Runner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(r.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := r.migrations[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+			if strings.TrimSpace(m.Down) != "" {
+				if _, err := conn.ExecContext(ctx, m.Down); err != nil {
+					return fmt.Errorf("migrate: %04d_%s down: %w", m.Version, m.Name, err)
+				}
+			}
+			if _, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version); err != nil {
+				return err
+			}
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status retourne l'état de chaque migration connue, ainsi que des versions appliquées inconnues.
+// Il ne prend pas le verrou : l'état peut changer si une autre instance migre en même temps.
+func (r *Runner) Status(ctx context.Context) ([]State, error) {
+	var states []State
+	err := r.withConn(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range r.migrations {
+			st := State{Migration: m}
+			if a, ok := done[m.Version]; ok {
+				at := a.appliedAt
+				st.AppliedAt = &at
+				delete(done, m.Version)
+			}
+			states = append(states, st)
+		}
+		for version, a := range done {
+			at := a.appliedAt
+			states = append(states, State{Migration: Migration{Version: version, Name: a.name}, AppliedAt: &at, Unknown: true})
+		}
+		sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+		return nil
+	})
+	return states, err
+}
+
+type appliedMigration struct {
+	name      string
+	appliedAt time.Time
+}
+
+// appliedVersions crée schema_migrations si besoin et retourne les versions appliquées
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]appliedMigration, error) {
+	if _, err := conn.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    applied_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (version)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`); err != nil {
+		return nil, fmt.Errorf("migrate: create schema_migrations: %w", err)
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var version int64
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		out[version] = a
+	}
+	return out, rows.Err()
+}
+
+func (r *Runner) withConn(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return fn(conn)
+}
+
+// withLock exécute fn sur une connexion dédiée détenant le verrou de migration de la base.
+// GET_LOCK est lié à la session MySQL : toutes les requêtes passent par la même connexion.
+func (r *Runner) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	return r.withConn(ctx, func(conn *sql.Conn) error {
+		timeout := int(r.LockTimeout / time.Second)
+		if timeout < 1 {
+			timeout = 1
+		}
+		var got sql.NullInt64
+		if err := conn.QueryRowContext(ctx,
+			`SELECT GET_LOCK(CONCAT('schema_migrations:', DATABASE()), ?)`, timeout,
+		).Scan(&got); err != nil {
+			return fmt.Errorf("migrate: acquire lock: %w", err)
+		}
+		if !got.Valid || got.Int64 != 1 {
+			return ErrLockTimeout
+		}
+		defer func() {
+			// Contexte indépendant : le verrou doit être libéré même si ctx est annulé
+			_, _ = conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(CONCAT('schema_migrations:', DATABASE()))`)
+		}()
+
+		return fn(conn)
+	})
+}
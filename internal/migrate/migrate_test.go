@@ -0,0 +1,90 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migration")
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %s: version %d, want %d (versions must be contiguous)", m.Name, m.Version, i+1)
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %04d_%s has no down file", m.Version, m.Name)
+		}
+		if strings.Contains(strings.ToUpper(m.Up+m.Down), "DELIMITER") {
+			t.Errorf("migration %04d_%s uses DELIMITER, which is a mysql client command", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  string
+	}{
+		{
+			name:  "unexpected file",
+			files: fstest.MapFS{"m/README.md": {}},
+			want:  "unexpected file",
+		},
+		{
+			name:  "missing name",
+			files: fstest.MapFS{"m/0001.up.sql": {Data: []byte("SELECT 1")}},
+			want:  "invalid file name",
+		},
+		{
+			name:  "invalid version",
+			files: fstest.MapFS{"m/abc_init.up.sql": {Data: []byte("SELECT 1")}},
+			want:  "invalid version",
+		},
+		{
+			name: "version conflict",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql":  {Data: []byte("SELECT 1")},
+				"m/0001_other.up.sql": {Data: []byte("SELECT 1")},
+			},
+			want: "used by",
+		},
+		{
+			name:  "down without up",
+			files: fstest.MapFS{"m/0001_init.down.sql": {Data: []byte("SELECT 1")}},
+			want:  "no up migration",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.files, "m")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("load error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadOrder(t *testing.T) {
+	migrations, err := load(fstest.MapFS{
+		"m/0010_ten.up.sql":   {Data: []byte("SELECT 10")},
+		"m/0002_two.up.sql":   {Data: []byte("SELECT 2")},
+		"m/0002_two.down.sql": {Data: []byte("SELECT -2")},
+	}, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 2 || migrations[1].Version != 10 {
+		t.Fatalf("unexpected order: %+v", migrations)
+	}
+	if migrations[0].Down != "SELECT -2" || migrations[1].Down != "" {
+		t.Fatalf("unexpected down files: %+v", migrations)
+	}
+}
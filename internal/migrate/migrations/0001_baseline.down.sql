@@ -0,0 +1,10 @@
+-- Supprime toutes les tables applicatives (ordre inverse des clés étrangères)
+DROP TABLE IF EXISTS audit_logs;
+DROP TABLE IF EXISTS twitch_user_names;
+DROP TABLE IF EXISTS twitch_users;
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS capture_chatters;
+DROP TABLE IF EXISTS captures;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS web_sessions;
+DROP TABLE IF EXISTS users;
@@ -1,3 +1,5 @@
+-- Schéma initial (état de dev/schema.sql avant l'introduction des migrations versionnées)
+
 -- Utilisateur de l'application (modérateur)
 CREATE TABLE IF NOT EXISTS users (
     id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
@@ -104,16 +106,18 @@ CREATE TABLE IF NOT EXISTS twitch_users (
     INDEX idx_twitch_users_created_at (created_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
--- Historique des changements de noms (login/display_name)
+-- Historique des changements de noms (login/display_name), une ligne par changement détecté
 CREATE TABLE IF NOT EXISTS twitch_user_names (
     id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
     twitch_user_id VARCHAR(64) NOT NULL,
-    login VARCHAR(128) NOT NULL,
-    display_name VARCHAR(128) NOT NULL,
-    detected_at DATETIME(6) NOT NULL,
+    old_login VARCHAR(128) NOT NULL,
+    new_login VARCHAR(128) NOT NULL,
+    old_display_name VARCHAR(128) NOT NULL,
+    new_display_name VARCHAR(128) NOT NULL,
+    changed_at DATETIME(6) NOT NULL,
     PRIMARY KEY (id),
     INDEX idx_twitch_user_names_user (twitch_user_id),
-    INDEX idx_twitch_user_names_detected (detected_at)
+    INDEX idx_twitch_user_names_changed (changed_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
 -- Table d'audit pour la traçabilité
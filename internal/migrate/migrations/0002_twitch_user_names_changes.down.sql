@@ -0,0 +1,27 @@
+-- Retour au format historique (login, display_name, detected_at) ; les anciens noms sont perdus
+
+SET @current := (
+    SELECT COUNT(*) FROM information_schema.COLUMNS
+    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'twitch_user_names' AND COLUMN_NAME = 'old_login'
+);
+
+SET @stmt := IF(@current > 0,
+    'ALTER TABLE twitch_user_names
+        DROP INDEX idx_twitch_user_names_changed,
+        DROP COLUMN old_login,
+        DROP COLUMN old_display_name,
+        CHANGE COLUMN new_login login VARCHAR(128) NOT NULL,
+        CHANGE COLUMN new_display_name display_name VARCHAR(128) NOT NULL,
+        CHANGE COLUMN changed_at detected_at DATETIME(6) NOT NULL',
+    'SELECT 1');
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Second ALTER : l'index référence la colonne renommée
+SET @stmt := IF(@current > 0,
+    'ALTER TABLE twitch_user_names ADD INDEX idx_twitch_user_names_detected (detected_at)',
+    'SELECT 1');
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
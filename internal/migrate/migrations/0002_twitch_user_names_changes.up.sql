@@ -0,0 +1,30 @@
+-- twitch_user_names enregistre des changements (ancien -> nouveau nom).
+-- Les bases créées avant cette version ont encore login, display_name et detected_at ;
+-- sur une base créée par 0001 cette migration ne fait rien.
+
+SET @legacy := (
+    SELECT COUNT(*) FROM information_schema.COLUMNS
+    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'twitch_user_names' AND COLUMN_NAME = 'detected_at'
+);
+
+SET @stmt := IF(@legacy > 0,
+    'ALTER TABLE twitch_user_names
+        DROP INDEX idx_twitch_user_names_detected,
+        CHANGE COLUMN login new_login VARCHAR(128) NOT NULL,
+        CHANGE COLUMN display_name new_display_name VARCHAR(128) NOT NULL,
+        CHANGE COLUMN detected_at changed_at DATETIME(6) NOT NULL',
+    'SELECT 1');
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Second ALTER : les nouvelles colonnes et l'index référencent les colonnes renommées
+SET @stmt := IF(@legacy > 0,
+    'ALTER TABLE twitch_user_names
+        ADD COLUMN old_login VARCHAR(128) NOT NULL DEFAULT '''' AFTER twitch_user_id,
+        ADD COLUMN old_display_name VARCHAR(128) NOT NULL DEFAULT '''' AFTER new_login,
+        ADD INDEX idx_twitch_user_names_changed (changed_at)',
+    'SELECT 1');
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
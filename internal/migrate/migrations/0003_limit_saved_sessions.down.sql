@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS after_session_saved;
+DROP PROCEDURE IF EXISTS cleanup_old_saved_sessions;
+DROP PROCEDURE IF EXISTS apply_initial_cleanup;
+
+ALTER TABLE sessions COMMENT = '';
@@ -1,23 +1,23 @@
--- Migration: Limiter le nombre de sessions sauvegardées à 10 par utilisateur
--- Date: 2026-02-09
+-- Limite le nombre de sessions sauvegardées à 10 par utilisateur
+-- (anciennement dev/migrations/001_limit_saved_sessions.sql, appliquée à la main)
 
--- Créer une procédure stockée pour nettoyer les anciennes sessions
 DROP PROCEDURE IF EXISTS cleanup_old_saved_sessions;
 
-DELIMITER $$
-
 CREATE PROCEDURE cleanup_old_saved_sessions(IN p_user_id BIGINT UNSIGNED)
 BEGIN
     DECLARE v_count INT;
-    
+    DECLARE v_excess INT;
+
     -- Compter le nombre de sessions sauvegardées pour cet utilisateur
     SELECT COUNT(*) INTO v_count
     FROM sessions
     WHERE user_id = p_user_id
       AND status = 'saved';
-    
+
     -- Si plus de 10 sessions, supprimer les plus anciennes
+    -- (LIMIT n'accepte pas d'expression, d'où v_excess)
     IF v_count > 10 THEN
+        SET v_excess = v_count - 10;
         DELETE FROM sessions
         WHERE id IN (
             SELECT id FROM (
@@ -26,68 +26,55 @@ BEGIN
                 WHERE user_id = p_user_id
                   AND status = 'saved'
                 ORDER BY updated_at ASC
-                LIMIT (v_count - 10)
+                LIMIT v_excess
             ) AS old_sessions
         );
     END IF;
-END$$
+END;
 
-DELIMITER ;
-
--- Créer un trigger qui s'exécute après chaque UPDATE de status vers 'saved'
+-- Nettoyage après chaque passage d'une session au statut 'saved'
 DROP TRIGGER IF EXISTS after_session_saved;
 
-DELIMITER $$
-
 CREATE TRIGGER after_session_saved
 AFTER UPDATE ON sessions
 FOR EACH ROW
 BEGIN
-    -- Si le status vient de passer à 'saved', nettoyer les anciennes sessions
     IF NEW.status = 'saved' AND OLD.status != 'saved' THEN
         CALL cleanup_old_saved_sessions(NEW.user_id);
     END IF;
-END$$
-
-DELIMITER ;
+END;
 
--- Appliquer immédiatement le nettoyage sur les sessions existantes
--- Pour chaque utilisateur ayant plus de 10 sessions sauvegardées
-DELIMITER $$
+-- Appliquer immédiatement le nettoyage aux utilisateurs ayant déjà plus de 10 sessions sauvegardées
+DROP PROCEDURE IF EXISTS apply_initial_cleanup;
 
 CREATE PROCEDURE apply_initial_cleanup()
 BEGIN
     DECLARE done INT DEFAULT FALSE;
     DECLARE v_user_id BIGINT UNSIGNED;
-    DECLARE user_cursor CURSOR FOR 
-        SELECT DISTINCT user_id 
-        FROM sessions 
+    DECLARE user_cursor CURSOR FOR
+        SELECT user_id
+        FROM sessions
         WHERE status = 'saved'
         GROUP BY user_id
         HAVING COUNT(*) > 10;
     DECLARE CONTINUE HANDLER FOR NOT FOUND SET done = TRUE;
 
     OPEN user_cursor;
-    
+
     read_loop: LOOP
         FETCH user_cursor INTO v_user_id;
         IF done THEN
             LEAVE read_loop;
         END IF;
-        
+
         CALL cleanup_old_saved_sessions(v_user_id);
     END LOOP;
-    
-    CLOSE user_cursor;
-END$$
 
-DELIMITER ;
+    CLOSE user_cursor;
+END;
 
--- Exécuter le nettoyage initial
 CALL apply_initial_cleanup();
 
--- Supprimer la procédure temporaire
 DROP PROCEDURE IF EXISTS apply_initial_cleanup;
 
--- Ajouter un commentaire sur la table pour documenter la limite
-ALTER TABLE sessions COMMENT = 'Sessions d\'analyse - Maximum 10 sessions sauvegardées par utilisateur';
+ALTER TABLE sessions COMMENT = 'Sessions d''analyse - Maximum 10 sessions sauvegardées par utilisateur';
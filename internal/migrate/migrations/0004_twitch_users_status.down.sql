@@ -0,0 +1,4 @@
+ALTER TABLE twitch_users
+    DROP INDEX idx_twitch_users_status,
+    DROP COLUMN disappeared_at,
+    DROP COLUMN `status`;
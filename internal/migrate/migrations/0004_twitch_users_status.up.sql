@@ -0,0 +1,6 @@
+-- Comptes disparus : absents de /helix/users lors d'un enrichissement (supprimés,
+-- suspendus ou bannis, Twitch ne fait pas la différence)
+ALTER TABLE twitch_users
+    ADD COLUMN status ENUM('active','missing') NOT NULL DEFAULT 'active' AFTER view_count,
+    ADD COLUMN disappeared_at DATETIME(6) NULL AFTER `status`,
+    ADD INDEX idx_twitch_users_status (status);
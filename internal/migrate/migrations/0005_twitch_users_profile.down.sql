@@ -0,0 +1,7 @@
+ALTER TABLE twitch_users
+    DROP INDEX idx_twitch_users_profile_image_hash,
+    DROP COLUMN description,
+    DROP COLUMN offline_image_url,
+    DROP COLUMN default_avatar,
+    DROP COLUMN profile_image_hash,
+    DROP COLUMN profile_image_url;
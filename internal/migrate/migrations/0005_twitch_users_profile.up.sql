@@ -0,0 +1,10 @@
+-- Profil Twitch : avatar, bannière hors-ligne et bio, pour repérer les profils de bots
+-- (avatar par défaut, bio vide, même image partagée par plusieurs comptes).
+-- NULL : compte enrichi avant cette migration, complété au prochain enrichissement.
+ALTER TABLE twitch_users
+    ADD COLUMN profile_image_url VARCHAR(512) NULL AFTER view_count,
+    ADD COLUMN profile_image_hash CHAR(64) NULL AFTER profile_image_url,
+    ADD COLUMN default_avatar BOOLEAN NULL AFTER profile_image_hash,
+    ADD COLUMN offline_image_url VARCHAR(512) NULL AFTER default_avatar,
+    ADD COLUMN description TEXT NULL AFTER offline_image_url,
+    ADD INDEX idx_twitch_users_profile_image_hash (profile_image_hash);
@@ -0,0 +1,47 @@
+ALTER TABLE users DROP COLUMN tier;
+
+-- Rétablit la limite de 10 sessions sauvegardées de 0003
+DROP PROCEDURE IF EXISTS cleanup_old_saved_sessions;
+
+CREATE PROCEDURE cleanup_old_saved_sessions(IN p_user_id BIGINT UNSIGNED)
+BEGIN
+    DECLARE v_count INT;
+    DECLARE v_excess INT;
+
+    -- Compter le nombre de sessions sauvegardées pour cet utilisateur
+    SELECT COUNT(*) INTO v_count
+    FROM sessions
+    WHERE user_id = p_user_id
+      AND status = 'saved';
+
+    -- Si plus de 10 sessions, supprimer les plus anciennes
+    -- (LIMIT n'accepte pas d'expression, d'où v_excess)
+    IF v_count > 10 THEN
+        SET v_excess = v_count - 10;
+        DELETE FROM sessions
+        WHERE id IN (
+            SELECT id FROM (
+                SELECT id
+                FROM sessions
+                WHERE user_id = p_user_id
+                  AND status = 'saved'
+                ORDER BY updated_at ASC
+                LIMIT v_excess
+            ) AS old_sessions
+        );
+    END IF;
+END;
+
+-- Nettoyage après chaque passage d'une session au statut 'saved'
+DROP TRIGGER IF EXISTS after_session_saved;
+
+CREATE TRIGGER after_session_saved
+AFTER UPDATE ON sessions
+FOR EACH ROW
+BEGIN
+    IF NEW.status = 'saved' AND OLD.status != 'saved' THEN
+        CALL cleanup_old_saved_sessions(NEW.user_id);
+    END IF;
+END;
+
+ALTER TABLE sessions COMMENT = 'Sessions d''analyse - Maximum 10 sessions sauvegardées par utilisateur';
@@ -0,0 +1,10 @@
+-- Cycle de vie des sessions géré par l'application (gateway) : le quota de sessions
+-- sauvegardées dépend du palier de l'utilisateur et l'éviction est confirmée par
+-- l'utilisateur, le trigger de 0003 disparaît
+DROP TRIGGER IF EXISTS after_session_saved;
+DROP PROCEDURE IF EXISTS cleanup_old_saved_sessions;
+
+ALTER TABLE sessions COMMENT = '';
+
+-- Palier de l'utilisateur (quota de sessions sauvegardées, voir SAVED_SESSIONS_QUOTAS)
+ALTER TABLE users ADD COLUMN tier VARCHAR(32) NOT NULL DEFAULT 'free' AFTER avatar_url;
@@ -0,0 +1,24 @@
+RENAME TABLE capture_chatters TO capture_chatters_compact;
+
+CREATE TABLE capture_chatters (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    capture_id BIGINT UNSIGNED NOT NULL,
+    twitch_user_id VARCHAR(64) NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_capture_chatters_capture (capture_id),
+    INDEX idx_capture_chatters_user (twitch_user_id),
+    INDEX idx_capture_chatters_capture_user (capture_id, twitch_user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT INTO capture_chatters (capture_id, twitch_user_id)
+SELECT c.capture_id, k.twitch_user_id
+FROM capture_chatters_compact c
+JOIN twitch_user_keys k ON k.user_key = c.user_key
+ORDER BY c.capture_id, c.user_key;
+
+DROP TABLE capture_chatters_compact;
+
+ALTER TABLE capture_chatters
+    ADD CONSTRAINT fk_capture_chatters_capture FOREIGN KEY (capture_id) REFERENCES captures(id) ON DELETE CASCADE;
+
+DROP TABLE twitch_user_keys;
@@ -0,0 +1,34 @@
+-- Stockage compact des chatters de capture : chaque compte Twitch reçoit une clé entière
+-- (twitch_user_keys) et capture_chatters n'est plus qu'une clé primaire (capture_id, user_key),
+-- au lieu d'un id auto-incrémenté et d'un twitch_user_id VARCHAR(64) par ligne.
+-- Les doublons (même compte deux fois dans une capture) disparaissent à la conversion.
+CREATE TABLE twitch_user_keys (
+    user_key INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    twitch_user_id VARCHAR(64) NOT NULL,
+    PRIMARY KEY (user_key),
+    UNIQUE KEY uq_twitch_user_keys_twitch_user_id (twitch_user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT INTO twitch_user_keys (twitch_user_id)
+SELECT twitch_user_id FROM capture_chatters GROUP BY twitch_user_id ORDER BY MIN(id);
+
+-- L'ancienne table est renommée puis recopiée dans la nouvelle, créée sous son nom définitif
+RENAME TABLE capture_chatters TO capture_chatters_wide;
+
+CREATE TABLE capture_chatters (
+    capture_id BIGINT UNSIGNED NOT NULL,
+    user_key INT UNSIGNED NOT NULL,
+    PRIMARY KEY (capture_id, user_key),
+    INDEX idx_capture_chatters_user_key (user_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT INTO capture_chatters (capture_id, user_key)
+SELECT DISTINCT w.capture_id, k.user_key
+FROM capture_chatters_wide w
+JOIN twitch_user_keys k ON k.twitch_user_id = w.twitch_user_id;
+
+DROP TABLE capture_chatters_wide;
+
+-- Le nom de contrainte est unique par base : recréée après la suppression de l'ancienne table
+ALTER TABLE capture_chatters
+    ADD CONSTRAINT fk_capture_chatters_capture FOREIGN KEY (capture_id) REFERENCES captures(id) ON DELETE CASCADE;
@@ -0,0 +1,21 @@
+-- Tokens d'accès personnels à l'API (/api/v1, en-tête Authorization: Bearer).
+-- Seule l'empreinte SHA-256 du token est stockée ; token_prefix permet à
+-- l'utilisateur de reconnaître ses tokens dans l'interface.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    token_prefix VARCHAR(16) NOT NULL,
+    scopes VARCHAR(255) NOT NULL, -- liste séparée par des espaces
+    created_at DATETIME(6) NOT NULL,
+    expires_at DATETIME(6) NOT NULL,
+    last_used_at DATETIME(6) NULL,
+    revoked_at DATETIME(6) NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_api_tokens_token_hash (token_hash),
+    INDEX idx_api_tokens_user (user_id),
+    CONSTRAINT fk_api_tokens_user
+        FOREIGN KEY (user_id) REFERENCES users(id)
+        ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
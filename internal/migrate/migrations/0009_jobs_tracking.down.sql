@@ -0,0 +1,12 @@
+ALTER TABLE jobs
+    DROP FOREIGN KEY fk_jobs_user,
+    DROP FOREIGN KEY fk_jobs_session;
+
+ALTER TABLE jobs
+    DROP INDEX idx_jobs_user_created,
+    DROP INDEX idx_jobs_session_created,
+    DROP COLUMN progress_message,
+    DROP COLUMN progress_total,
+    DROP COLUMN progress_done,
+    DROP COLUMN user_id,
+    DROP COLUMN session_id;
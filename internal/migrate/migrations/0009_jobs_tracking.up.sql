@@ -0,0 +1,28 @@
+-- Suivi des jobs : session et utilisateur concernés (NULL pour les jobs de maintenance)
+-- et avancement mis à jour par le worker, pour l'affichage en direct dans le gateway
+ALTER TABLE jobs
+    ADD COLUMN session_id BIGINT UNSIGNED NULL AFTER payload,
+    ADD COLUMN user_id BIGINT UNSIGNED NULL AFTER session_id,
+    ADD COLUMN progress_done INT UNSIGNED NOT NULL DEFAULT 0 AFTER `status`,
+    ADD COLUMN progress_total INT UNSIGNED NULL AFTER progress_done, -- NULL : total inconnu
+    ADD COLUMN progress_message VARCHAR(255) NULL AFTER progress_total,
+    ADD INDEX idx_jobs_session_created (session_id, created_at),
+    ADD INDEX idx_jobs_user_created (user_id, created_at);
+
+-- Jobs existants : session reprise du payload
+UPDATE jobs
+SET session_id = CAST(JSON_UNQUOTE(JSON_EXTRACT(payload, '$.session_id')) AS UNSIGNED)
+WHERE type IN ('FETCH_CHATTERS', 'FETCH_USERS_INFO');
+
+UPDATE jobs
+SET user_id = (SELECT s.user_id FROM sessions s WHERE s.id = jobs.session_id)
+WHERE session_id IS NOT NULL;
+
+-- Sessions supprimées entre-temps
+UPDATE jobs
+SET session_id = NULL
+WHERE session_id IS NOT NULL AND user_id IS NULL;
+
+ALTER TABLE jobs
+    ADD CONSTRAINT fk_jobs_session FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE SET NULL,
+    ADD CONSTRAINT fk_jobs_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,5 @@
+ALTER TABLE jobs
+    DROP COLUMN run_after;
+
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,49 @@
+-- Abonnements webhook : notifications des événements de détection d'un utilisateur
+-- (capture terminée, pic de créations de comptes, comptes suspects, job en échec) vers
+-- Discord, Slack ou un récepteur HTTP générique. Les livraisons sont signées avec secret
+-- (HMAC-SHA256), qui doit donc être conservé en clair.
+CREATE TABLE IF NOT EXISTS webhooks (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    format ENUM('generic','discord','slack') NOT NULL DEFAULT 'generic',
+    secret CHAR(64) NOT NULL,
+    events VARCHAR(255) NOT NULL, -- liste séparée par des espaces
+    creation_burst_threshold INT UNSIGNED NOT NULL DEFAULT 50, -- comptes créés le même jour
+    suspicious_threshold INT UNSIGNED NOT NULL DEFAULT 10,     -- comptes suspects d'un enrichissement
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_webhooks_user (user_id),
+    CONSTRAINT fk_webhooks_user
+        FOREIGN KEY (user_id) REFERENCES users(id)
+        ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Journal des livraisons : corps déjà mis au format du webhook, résultat de la dernière
+-- tentative. Chaque tentative est un job DELIVER_WEBHOOK.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    webhook_id BIGINT UNSIGNED NOT NULL,
+    event VARCHAR(64) NOT NULL,
+    body JSON NOT NULL,
+    status ENUM('pending','delivered','failed') NOT NULL DEFAULT 'pending',
+    attempts INT UNSIGNED NOT NULL DEFAULT 0,
+    response_status SMALLINT UNSIGNED NULL, -- statut HTTP de la dernière tentative
+    last_error VARCHAR(255) NULL,
+    created_at DATETIME(6) NOT NULL,
+    last_attempt_at DATETIME(6) NULL,
+    delivered_at DATETIME(6) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_webhook_deliveries_webhook_created (webhook_id, created_at),
+    INDEX idx_webhook_deliveries_created (created_at), -- rétention
+    CONSTRAINT fk_webhook_deliveries_webhook
+        FOREIGN KEY (webhook_id) REFERENCES webhooks(id)
+        ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Jobs différés (nouvelles tentatives de livraison) : pas exécutés avant run_after.
+-- Ajoutée en fin de table (ALTER instantané, sans reconstruction de la table des jobs).
+ALTER TABLE jobs
+    ADD COLUMN run_after DATETIME(6) NULL; -- NULL : dès que possible
@@ -0,0 +1,48 @@
+-- Règles d'alerte : seuils définis par un utilisateur sur une chaîne, évalués par le worker
+-- sur chaque capture terminée (enregistrée et enrichie) de ses sessions.
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id BIGINT UNSIGNED NOT NULL,
+    broadcaster_id VARCHAR(64) NOT NULL,
+    broadcaster_login VARCHAR(255) NOT NULL,
+    metric ENUM('recent_accounts_pct','creation_day_accounts','default_avatar_pct') NOT NULL,
+    threshold DOUBLE NOT NULL,                  -- pourcentage ou nombre de comptes selon metric
+    window_days INT UNSIGNED NOT NULL DEFAULT 7, -- recent_accounts_pct : âge maximal des comptes
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_alert_rules_user_broadcaster (user_id, broadcaster_id),
+    CONSTRAINT fk_alert_rules_user
+        FOREIGN KEY (user_id) REFERENCES users(id)
+        ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Alertes déclenchées : copie de la règle au déclenchement (elle peut être supprimée
+-- depuis) et valeur mesurée. Pas de clé étrangère vers la session ni la capture : l'alerte
+-- survit à la purge des sessions, comme le journal d'audit.
+CREATE TABLE IF NOT EXISTS alerts (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    rule_id BIGINT UNSIGNED NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    session_id BIGINT UNSIGNED NOT NULL,
+    capture_id BIGINT UNSIGNED NOT NULL,
+    broadcaster_id VARCHAR(64) NOT NULL,
+    broadcaster_login VARCHAR(255) NOT NULL,
+    metric VARCHAR(32) NOT NULL,
+    threshold DOUBLE NOT NULL,
+    window_days INT UNSIGNED NOT NULL,
+    value DOUBLE NOT NULL,
+    details JSON NULL,
+    triggered_at DATETIME(6) NOT NULL,
+    acknowledged_at DATETIME(6) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_alerts_user_triggered (user_id, triggered_at),
+    INDEX idx_alerts_rule (rule_id),
+    INDEX idx_alerts_triggered (triggered_at), -- rétention
+    CONSTRAINT fk_alerts_rule
+        FOREIGN KEY (rule_id) REFERENCES alert_rules(id)
+        ON DELETE SET NULL,
+    CONSTRAINT fk_alerts_user
+        FOREIGN KEY (user_id) REFERENCES users(id)
+        ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS eventsub_events;
+DROP TABLE IF EXISTS eventsub_subscriptions;
@@ -0,0 +1,40 @@
+-- Abonnements EventSub (transport webhook) d'un utilisateur sur une chaîne qu'il modère :
+-- chaque notification reçue déclenche des captures de chatters aux délais capture_offsets.
+-- Un même abonnement Twitch (type + condition) peut être partagé par plusieurs utilisateurs :
+-- il n'est supprimé chez Twitch qu'avec la dernière ligne qui le référence.
+CREATE TABLE IF NOT EXISTS eventsub_subscriptions (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id BIGINT UNSIGNED NOT NULL,
+    broadcaster_id VARCHAR(64) NOT NULL,
+    broadcaster_login VARCHAR(255) NOT NULL,
+    type ENUM('stream.online','channel.raid','channel.follow') NOT NULL,
+    moderator_id VARCHAR(64) NULL,              -- channel.follow : modérateur de la condition
+    capture_offsets VARCHAR(255) NOT NULL,      -- délais en secondes séparés par des espaces, vide : aucune capture
+    twitch_subscription_id VARCHAR(64) NULL,
+    status VARCHAR(64) NOT NULL,                -- statut Twitch (enabled, webhook_callback_verification_pending...)
+    created_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_eventsub_subscriptions_user_type (user_id, broadcaster_id, type),
+    INDEX idx_eventsub_subscriptions_twitch (twitch_subscription_id),
+    INDEX idx_eventsub_subscriptions_type_broadcaster (type, broadcaster_id),
+    CONSTRAINT fk_eventsub_subscriptions_user
+        FOREIGN KEY (user_id) REFERENCES users(id)
+        ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Notifications EventSub reçues. message_id est unique : Twitch renvoie un message tant
+-- que le callback n'a pas répondu, un message déjà reçu est ignoré.
+CREATE TABLE IF NOT EXISTS eventsub_events (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    message_id VARCHAR(64) NOT NULL,
+    twitch_subscription_id VARCHAR(64) NOT NULL,
+    type VARCHAR(64) NOT NULL,
+    broadcaster_id VARCHAR(64) NOT NULL,
+    event JSON NOT NULL,
+    captures INT UNSIGNED NOT NULL DEFAULT 0, -- captures planifiées, tous utilisateurs confondus
+    received_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_eventsub_events_message (message_id),
+    INDEX idx_eventsub_events_subscription_received (twitch_subscription_id, received_at),
+    INDEX idx_eventsub_events_received (received_at) -- rétention
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,2 @@
+ALTER TABLE eventsub_subscriptions
+    DROP COLUMN transport;
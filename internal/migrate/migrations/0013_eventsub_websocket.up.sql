@@ -0,0 +1,4 @@
+-- Transport des abonnements EventSub : webhook (callback du gateway) ou websocket (session
+-- ouverte par le worker eventsub-ws avec le token de l'utilisateur, jamais partagée)
+ALTER TABLE eventsub_subscriptions
+    ADD COLUMN transport ENUM('webhook','websocket') NOT NULL DEFAULT 'webhook';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS chat_fingerprints;
+DROP TABLE IF EXISTS chat_activity;
+DROP TABLE IF EXISTS chat_channels;
@@ -0,0 +1,38 @@
+-- Écoute du chat (worker chat) : chaînes capturées dont le chat est lu pendant une session
+-- active, activité de chaque compte et empreintes des messages pour repérer les doublons.
+-- Le texte des messages n'est pas conservé, sauf un exemple pour les messages répétés.
+CREATE TABLE IF NOT EXISTS chat_channels (
+    session_id BIGINT UNSIGNED NOT NULL,
+    broadcaster_id VARCHAR(64) NOT NULL,
+    broadcaster_login VARCHAR(128) NOT NULL,
+    listening_since DATETIME(6) NOT NULL,
+    PRIMARY KEY (session_id, broadcaster_id),
+    CONSTRAINT fk_chat_channels_session FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS chat_activity (
+    session_id BIGINT UNSIGNED NOT NULL,
+    broadcaster_id VARCHAR(64) NOT NULL,
+    user_key INT UNSIGNED NOT NULL,               -- twitch_user_keys.user_key
+    login VARCHAR(128) NOT NULL,                  -- login IRC du dernier message
+    message_count INT UNSIGNED NOT NULL,
+    duplicate_count INT UNSIGNED NOT NULL,        -- messages dont l'empreinte était déjà vue sur la chaîne
+    first_message_at DATETIME(6) NOT NULL,
+    last_message_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (session_id, broadcaster_id, user_key),
+    INDEX idx_chat_activity_session_user (session_id, user_key),
+    CONSTRAINT fk_chat_activity_session FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS chat_fingerprints (
+    session_id BIGINT UNSIGNED NOT NULL,
+    broadcaster_id VARCHAR(64) NOT NULL,
+    fingerprint CHAR(16) NOT NULL,                -- SHA-256 tronqué du message normalisé
+    sample VARCHAR(500) NULL,                     -- texte d'un message, renseigné dès sa répétition
+    message_count INT UNSIGNED NOT NULL,
+    first_seen_at DATETIME(6) NOT NULL,
+    last_seen_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (session_id, broadcaster_id, fingerprint),
+    INDEX idx_chat_fingerprints_session_last_seen (session_id, broadcaster_id, last_seen_at),
+    CONSTRAINT fk_chat_fingerprints_session FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
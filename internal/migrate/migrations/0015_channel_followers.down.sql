@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS channel_followers;
+DROP TABLE IF EXISTS follower_fetches;
@@ -0,0 +1,23 @@
+-- Followers des chaînes (job FETCH_FOLLOWERS) : dernière récupération de chaque chaîne d'une
+-- session et date de follow de chaque compte, pour repérer les vagues de follow-bots.
+CREATE TABLE IF NOT EXISTS follower_fetches (
+    session_id BIGINT UNSIGNED NOT NULL,
+    broadcaster_id VARCHAR(64) NOT NULL,
+    broadcaster_login VARCHAR(128) NOT NULL,
+    total INT UNSIGNED NOT NULL,                  -- followers de la chaîne selon Twitch
+    fetched INT UNSIGNED NOT NULL,                -- followers récupérés (les plus récents)
+    fetched_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (session_id, broadcaster_id),
+    CONSTRAINT fk_follower_fetches_session FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS channel_followers (
+    session_id BIGINT UNSIGNED NOT NULL,
+    broadcaster_id VARCHAR(64) NOT NULL,
+    user_key INT UNSIGNED NOT NULL,               -- twitch_user_keys.user_key
+    followed_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (session_id, broadcaster_id, user_key),
+    INDEX idx_channel_followers_followed (session_id, broadcaster_id, followed_at),
+    INDEX idx_channel_followers_user_key (user_key),
+    CONSTRAINT fk_channel_followers_session FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
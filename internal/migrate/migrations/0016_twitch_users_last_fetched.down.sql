@@ -0,0 +1,2 @@
+ALTER TABLE twitch_users
+    DROP INDEX idx_twitch_users_last_fetched;
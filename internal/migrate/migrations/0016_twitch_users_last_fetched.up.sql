@@ -0,0 +1,4 @@
+-- Réenrichissement de fond (REFRESH_USERS) : les comptes les plus anciennement enrichis sont
+-- lus dans l'ordre de l'index, sans tri de toute la table
+ALTER TABLE twitch_users
+    ADD INDEX idx_twitch_users_last_fetched (last_fetched_at);
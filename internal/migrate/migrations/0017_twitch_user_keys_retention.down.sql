@@ -0,0 +1,2 @@
+ALTER TABLE chat_activity
+    DROP INDEX idx_chat_activity_user_key;
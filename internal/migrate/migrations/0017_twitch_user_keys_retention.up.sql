@@ -0,0 +1,4 @@
+-- Rétention des clés de comptes (politique twitch_user_keys) : une clé n'est purgée que si
+-- aucune activité du chat ne la référence, recherche faite par l'index
+ALTER TABLE chat_activity
+    ADD INDEX idx_chat_activity_user_key (user_key);
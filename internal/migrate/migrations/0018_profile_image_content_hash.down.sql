@@ -0,0 +1,4 @@
+ALTER TABLE twitch_users
+    DROP INDEX idx_twitch_users_profile_image_url;
+
+UPDATE twitch_users SET profile_image_hash = SHA2(profile_image_url, 256) WHERE profile_image_url <> '';
@@ -0,0 +1,9 @@
+-- Images de profil identifiées par leur contenu : profile_image_hash devient le SHA-256 de
+-- l'image téléchargée par le worker. Twitch attribue une URL distincte à chaque image envoyée,
+-- le hash de l'URL ne regroupait donc pas les comptes ayant envoyé la même image. Les hash
+-- d'URL sont effacés et recalculés au prochain enrichissement ; l'index sur l'URL retrouve
+-- le hash d'une image déjà téléchargée.
+UPDATE twitch_users SET profile_image_hash = NULL;
+
+ALTER TABLE twitch_users
+    ADD INDEX idx_twitch_users_profile_image_url (profile_image_url);
@@ -188,6 +188,47 @@ func (c *Client) ReleaseLock(ctx context.Context, key string) error {
 	return c.Delete(ctx, "lock:"+key)
 }
 
+// --- Pub/Sub methods ---
+
+// Publish marshals message to JSON and publishes it on channel
+func (c *Client) Publish(ctx context.Context, channel string, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return c.client.Publish(ctx, channel, data).Err()
+}
+
+// Subscription is a pub/sub subscription on a dedicated connection
+type Subscription struct {
+	ps *redis.PubSub
+}
+
+// Subscribe subscribes to channels and waits for the server confirmation
+func (c *Client) Subscribe(ctx context.Context, channels ...string) (*Subscription, error) {
+	ps := c.client.Subscribe(ctx, channels...)
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return nil, fmt.Errorf("redis subscribe failed: %w", err)
+	}
+	return &Subscription{ps: ps}, nil
+}
+
+// Receive blocks until a message is received and returns its payload.
+// Closing the subscription unblocks it with an error.
+func (s *Subscription) Receive(ctx context.Context) (string, error) {
+	msg, err := s.ps.ReceiveMessage(ctx)
+	if err != nil {
+		return "", err
+	}
+	return msg.Payload, nil
+}
+
+// Close unsubscribes and closes the connection
+func (s *Subscription) Close() error {
+	return s.ps.Close()
+}
+
 // --- Utility methods ---
 
 // Ping checks Redis connection
@@ -0,0 +1,133 @@
+// Package retention applique les politiques de rétention de la base : chaque politique
+// purge, par lots bornés, les lignes d'une table plus anciennes que sa durée de conservation.
+//
+// Les sessions sauvegardées ne sont pas concernées : leur nombre est borné par le quota du
+// palier de l'utilisateur (SAVED_SESSIONS_QUOTAS, appliqué par le gateway à la sauvegarde).
+package retention
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/env"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+)
+
+// Policy est une politique de rétention
+type Policy struct {
+	Name   string        // politique du store (store.PurgeJobs...)
+	MaxAge time.Duration // durée de conservation ; 0 désactive la politique
+	Batch  int           // lignes supprimées par DELETE
+}
+
+// Defaults retourne les politiques par défaut, dans leur ordre d'application : les comptes
+// Twitch sont purgés après les sessions, dont la suppression les rend orphelins
+func Defaults() []Policy {
+	return []Policy{
+		{Name: store.PurgeWebSessions, MaxAge: 24 * time.Hour, Batch: 1000},
+		// Une session emporte ses captures et leurs chatters : petits lots
+		{Name: store.PurgeSessions, MaxAge: 7 * 24 * time.Hour, Batch: 10},
+		{Name: store.PurgeJobs, MaxAge: 7 * 24 * time.Hour, Batch: 1000},
+		{Name: store.PurgeTwitchUsers, MaxAge: 30 * 24 * time.Hour, Batch: 1000},
+		{Name: store.PurgeNameHistory, MaxAge: 30 * 24 * time.Hour, Batch: 1000},
+		{Name: store.PurgeUserKeys, MaxAge: 30 * 24 * time.Hour, Batch: 1000},
+		{Name: store.PurgeDeliveries, MaxAge: 30 * 24 * time.Hour, Batch: 1000},
+		{Name: store.PurgeAlerts, MaxAge: 90 * 24 * time.Hour, Batch: 1000},
+		{Name: store.PurgeEventSub, MaxAge: 30 * 24 * time.Hour, Batch: 1000},
+	}
+}
+
+// FromEnv retourne les politiques par défaut ajustées par RETENTION_WEB_SESSIONS,
+// RETENTION_SESSIONS, RETENTION_JOBS, RETENTION_TWITCH_USERS (historique de noms et clés inclus)
+// RETENTION_WEBHOOK_DELIVERIES, RETENTION_ALERTS et RETENTION_EVENTSUB_EVENTS
+func FromEnv() []Policy {
+	keys := map[string]string{
+		store.PurgeWebSessions: "RETENTION_WEB_SESSIONS",
+		store.PurgeSessions:    "RETENTION_SESSIONS",
+		store.PurgeJobs:        "RETENTION_JOBS",
+		store.PurgeTwitchUsers: "RETENTION_TWITCH_USERS",
+		store.PurgeNameHistory: "RETENTION_TWITCH_USERS",
+		store.PurgeUserKeys:    "RETENTION_TWITCH_USERS",
+		store.PurgeDeliveries:  "RETENTION_WEBHOOK_DELIVERIES",
+		store.PurgeAlerts:      "RETENTION_ALERTS",
+		store.PurgeEventSub:    "RETENTION_EVENTSUB_EVENTS",
+	}
+	policies := Defaults()
+	for i, p := range policies {
+		policies[i].MaxAge = env.Duration(keys[p.Name], p.MaxAge)
+	}
+	return policies
+}
+
+// Result est le bilan d'une politique : lignes supprimées, ou à supprimer en dry-run
+type Result struct {
+	Policy    string `json:"policy"`
+	MaxAge    string `json:"max_age"`
+	Rows      int64  `json:"rows"`
+	Batches   int    `json:"batches"`
+	ElapsedMs int64  `json:"elapsed_ms"`
+}
+
+// Report est le bilan d'une purge
+type Report struct {
+	DryRun  bool     `json:"dry_run"`
+	Results []Result `json:"results"`
+}
+
+// Total retourne le nombre de lignes supprimées (ou à supprimer) toutes politiques confondues
+func (r Report) Total() int64 {
+	var n int64
+	for _, res := range r.Results {
+		n += res.Rows
+	}
+	return n
+}
+
+// Run applique les politiques à la date now. maxBatches borne le nombre de lots par politique
+// (0 : sans limite) ; le reste est purgé à l'exécution suivante. En dry-run, rien n'est supprimé
+// et le bilan donne le nombre de lignes concernées. En cas d'erreur, le bilan partiel est retourné.
+func Run(ctx context.Context, st *store.Store, policies []Policy, now time.Time, maxBatches int, dryRun bool) (Report, error) {
+	report := Report{DryRun: dryRun}
+	for _, p := range policies {
+		if p.MaxAge <= 0 {
+			continue
+		}
+		res := Result{Policy: p.Name, MaxAge: p.MaxAge.String()}
+		before := now.Add(-p.MaxAge)
+		start := time.Now()
+
+		var err error
+		if dryRun {
+			res.Rows, err = st.Retention.Count(ctx, p.Name, before)
+		} else {
+			err = purge(ctx, st, p, before, maxBatches, &res)
+		}
+		res.ElapsedMs = time.Since(start).Milliseconds()
+		report.Results = append(report.Results, res)
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", p.Name, err)
+		}
+	}
+	return report, nil
+}
+
+// purge supprime les lignes de la politique par lots, jusqu'à un lot incomplet
+func purge(ctx context.Context, st *store.Store, p Policy, before time.Time, maxBatches int, res *Result) error {
+	batch := max(p.Batch, 1)
+	for maxBatches <= 0 || res.Batches < maxBatches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := st.Retention.PurgeBatch(ctx, p.Name, before, batch)
+		if err != nil {
+			return err
+		}
+		res.Rows += n
+		res.Batches++
+		if n < int64(batch) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Métriques des règles d'alerte, mesurées sur les chatters d'une capture
+const (
+	AlertRecentAccountsPct   = "recent_accounts_pct"   // % de comptes créés depuis moins de window_days jours
+	AlertCreationDayAccounts = "creation_day_accounts" // comptes créés le jour de création le plus fréquent
+	AlertDefaultAvatarPct    = "default_avatar_pct"    // % de comptes à l'avatar par défaut
+)
+
+// AlertRule est un seuil défini par un utilisateur sur une chaîne ; la règle se déclenche
+// quand la métrique d'une capture atteint le seuil
+type AlertRule struct {
+	ID               int64
+	UserID           int64
+	BroadcasterID    string
+	BroadcasterLogin string
+	Metric           string
+	Threshold        float64
+	WindowDays       int
+	Enabled          bool
+	CreatedAt        time.Time
+}
+
+// Alert est le déclenchement d'une règle sur une capture
+type Alert struct {
+	ID               int64
+	RuleID           *int64 // nil si la règle a été supprimée depuis
+	UserID           int64
+	SessionID        int64
+	SessionUUID      string // vide si la session a été purgée
+	CaptureID        int64
+	BroadcasterID    string
+	BroadcasterLogin string
+	Metric           string
+	Threshold        float64
+	WindowDays       int
+	Value            float64
+	Details          json.RawMessage
+	TriggeredAt      time.Time
+	AcknowledgedAt   *time.Time
+}
+
+// AlertRepo accède aux tables alert_rules et alerts
+type AlertRepo struct {
+	q querier
+}
+
+const alertRuleColumns = `id, user_id, broadcaster_id, broadcaster_login, metric, threshold, window_days, enabled, created_at`
+
+func scanAlertRule(row interface{ Scan(...any) error }) (*AlertRule, error) {
+	var r AlertRule
+	if err := row.Scan(&r.ID, &r.UserID, &r.BroadcasterID, &r.BroadcasterLogin, &r.Metric,
+		&r.Threshold, &r.WindowDays, &r.Enabled, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (r AlertRepo) listRules(ctx context.Context, query string, args ...any) ([]AlertRule, error) {
+	rows, err := r.q.QueryContext(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules `+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AlertRule
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *rule)
+	}
+	return out, rows.Err()
+}
+
+// CreateRule enregistre une règle et retourne son id
+func (r AlertRepo) CreateRule(ctx context.Context, rule AlertRule) (int64, error) {
+	res, err := r.q.ExecContext(ctx, `
+INSERT INTO alert_rules (user_id, broadcaster_id, broadcaster_login, metric, threshold, window_days, enabled, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`, rule.UserID, rule.BroadcasterID, rule.BroadcasterLogin, rule.Metric, rule.Threshold, rule.WindowDays,
+		rule.Enabled, rule.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListRules retourne les règles d'un utilisateur, par chaîne puis de la plus récente à la plus ancienne
+func (r AlertRepo) ListRules(ctx context.Context, userID int64) ([]AlertRule, error) {
+	return r.listRules(ctx, `WHERE user_id = ? ORDER BY broadcaster_login ASC, created_at DESC, id DESC`, userID)
+}
+
+// RulesFor retourne les règles actives d'un utilisateur sur une chaîne
+func (r AlertRepo) RulesFor(ctx context.Context, userID int64, broadcasterID string) ([]AlertRule, error) {
+	return r.listRules(ctx, `WHERE user_id = ? AND broadcaster_id = ? AND enabled ORDER BY id ASC`, userID, broadcasterID)
+}
+
+// GetRule retourne une règle de l'utilisateur
+func (r AlertRepo) GetRule(ctx context.Context, userID, id int64) (*AlertRule, error) {
+	rule, err := scanAlertRule(r.q.QueryRowContext(ctx,
+		`SELECT `+alertRuleColumns+` FROM alert_rules WHERE id = ? AND user_id = ?`, id, userID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return rule, nil
+}
+
+// DeleteRule supprime une règle de l'utilisateur ; ses alertes sont conservées
+func (r AlertRepo) DeleteRule(ctx context.Context, userID, id int64) error {
+	return inTx(ctx, r.q, func(q querier) error {
+		res, err := q.ExecContext(ctx, `DELETE FROM alert_rules WHERE id = ? AND user_id = ?`, id, userID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		// ON DELETE SET NULL, explicite pour les moteurs qui ne l'appliquent pas
+		_, err = q.ExecContext(ctx, `UPDATE alerts SET rule_id = NULL WHERE rule_id = ?`, id)
+		return err
+	})
+}
+
+// CreateAlert enregistre le déclenchement d'une règle et retourne son id
+func (r AlertRepo) CreateAlert(ctx context.Context, a Alert) (int64, error) {
+	var details any
+	if len(a.Details) > 0 {
+		details = string(a.Details)
+	}
+	res, err := r.q.ExecContext(ctx, `
+INSERT INTO alerts (rule_id, user_id, session_id, capture_id, broadcaster_id, broadcaster_login,
+                    metric, threshold, window_days, value, details, triggered_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`, a.RuleID, a.UserID, a.SessionID, a.CaptureID, a.BroadcasterID, a.BroadcasterLogin,
+		a.Metric, a.Threshold, a.WindowDays, a.Value, details, a.TriggeredAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListAlerts retourne les dernières alertes d'un utilisateur (seulement celles à acquitter
+// si unacknowledged), de la plus récente à la plus ancienne
+func (r AlertRepo) ListAlerts(ctx context.Context, userID int64, unacknowledged bool, limit int) ([]Alert, error) {
+	filter := ""
+	if unacknowledged {
+		filter = ` AND a.acknowledged_at IS NULL`
+	}
+	rows, err := r.q.QueryContext(ctx, `
+SELECT a.id, a.rule_id, a.user_id, a.session_id, COALESCE(s.session_uuid, ''), a.capture_id,
+       a.broadcaster_id, a.broadcaster_login, a.metric, a.threshold, a.window_days, a.value,
+       a.details, a.triggered_at, a.acknowledged_at
+FROM alerts a
+LEFT JOIN sessions s ON s.id = a.session_id
+WHERE a.user_id = ?`+filter+`
+ORDER BY a.triggered_at DESC, a.id DESC
+LIMIT ?
+`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Alert
+	for rows.Next() {
+		var a Alert
+		var details []byte
+		if err := rows.Scan(&a.ID, &a.RuleID, &a.UserID, &a.SessionID, &a.SessionUUID, &a.CaptureID,
+			&a.BroadcasterID, &a.BroadcasterLogin, &a.Metric, &a.Threshold, &a.WindowDays, &a.Value,
+			&details, &a.TriggeredAt, &a.AcknowledgedAt); err != nil {
+			return nil, err
+		}
+		if len(details) > 0 {
+			a.Details = details
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// Acknowledge acquitte une alerte de l'utilisateur (sans effet si elle l'est déjà)
+func (r AlertRepo) Acknowledge(ctx context.Context, userID, id int64) error {
+	var n int64
+	if err := r.q.QueryRowContext(ctx, `SELECT COUNT(*) FROM alerts WHERE id = ? AND user_id = ?`, id, userID).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	_, err := r.q.ExecContext(ctx,
+		`UPDATE alerts SET acknowledged_at = NOW(6) WHERE id = ? AND user_id = ? AND acknowledged_at IS NULL`, id, userID)
+	return err
+}
+
+// AcknowledgeAll acquitte toutes les alertes de l'utilisateur et retourne leur nombre
+func (r AlertRepo) AcknowledgeAll(ctx context.Context, userID int64) (int64, error) {
+	res, err := r.q.ExecContext(ctx,
+		`UPDATE alerts SET acknowledged_at = NOW(6) WHERE user_id = ? AND acknowledged_at IS NULL`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Unacknowledged compte les alertes à acquitter d'un utilisateur, par broadcaster_id
+func (r AlertRepo) Unacknowledged(ctx context.Context, userID int64) (map[string]int, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT broadcaster_id, COUNT(*)
+FROM alerts
+WHERE user_id = ? AND acknowledged_at IS NULL
+GROUP BY broadcaster_id
+`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]int{}
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		out[id] = n
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// APIToken est un token d'accès personnel à l'API ; seule son empreinte est stockée
+type APIToken struct {
+	ID          int64
+	UserID      int64
+	Name        string
+	TokenHash   string // SHA-256 hexadécimal du token
+	TokenPrefix string // début du token, affiché dans l'interface
+	Scopes      []string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	LastUsedAt  *time.Time
+	RevokedAt   *time.Time
+}
+
+// Active indique si le token est utilisable (ni révoqué ni expiré)
+func (t APIToken) Active() bool {
+	return t.RevokedAt == nil && t.ExpiresAt.After(time.Now())
+}
+
+// APITokenRepo accède à la table api_tokens
+type APITokenRepo struct {
+	q querier
+}
+
+// Create enregistre un token et retourne son id
+func (r APITokenRepo) Create(ctx context.Context, t APIToken) (int64, error) {
+	res, err := r.q.ExecContext(ctx, `
+INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, scopes, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+`, t.UserID, t.Name, t.TokenHash, t.TokenPrefix, strings.Join(t.Scopes, " "), t.CreatedAt, t.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListByUser retourne les tokens d'un utilisateur, révoqués et expirés compris, du plus récent au plus ancien
+func (r APITokenRepo) ListByUser(ctx context.Context, userID int64) ([]APIToken, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT id, user_id, name, token_hash, token_prefix, scopes, created_at, expires_at, last_used_at, revoked_at
+FROM api_tokens
+WHERE user_id = ?
+ORDER BY created_at DESC, id DESC
+`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+// Authenticate retourne le token actif d'empreinte tokenHash et son utilisateur,
+// et met à jour last_used_at
+func (r APITokenRepo) Authenticate(ctx context.Context, tokenHash string) (*APIToken, *User, error) {
+	var u User
+	row := r.q.QueryRowContext(ctx, `
+SELECT t.id, t.user_id, t.name, t.token_hash, t.token_prefix, t.scopes, t.created_at, t.expires_at, t.last_used_at, t.revoked_at,
+       u.id, u.twitch_user_id, u.login, u.display_name, COALESCE(u.avatar_url, ''), u.tier
+FROM api_tokens t
+JOIN users u ON t.user_id = u.id
+WHERE t.token_hash = ? AND t.revoked_at IS NULL AND t.expires_at > NOW(6)
+`, tokenHash)
+	t, err := scanAPIToken(row, &u.ID, &u.TwitchUserID, &u.Login, &u.DisplayName, &u.AvatarURL, &u.Tier)
+	if err != nil {
+		return nil, nil, notFound(err)
+	}
+
+	if _, err := r.q.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = NOW(6) WHERE id = ?`, t.ID); err != nil {
+		return nil, nil, err
+	}
+	return t, &u, nil
+}
+
+// Revoke révoque un token de l'utilisateur ; ErrNotFound s'il n'existe pas ou est déjà révoqué
+func (r APITokenRepo) Revoke(ctx context.Context, userID, id int64) error {
+	res, err := r.q.ExecContext(ctx,
+		`UPDATE api_tokens SET revoked_at = NOW(6) WHERE id = ? AND user_id = ? AND revoked_at IS NULL`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// scanAPIToken lit les colonnes de api_tokens, suivies des destinations extra
+func scanAPIToken(row interface{ Scan(...any) error }, extra ...any) (*APIToken, error) {
+	var t APIToken
+	var scopes string
+	dest := append([]any{&t.ID, &t.UserID, &t.Name, &t.TokenHash, &t.TokenPrefix, &scopes,
+		&t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Fields(scopes)
+	return &t, nil
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Types d'événements d'audit
+const (
+	AuditRetentionPurge   = "retention_purge"
+	AuditAPITokenCreated  = "api_token_created"
+	AuditAPITokenRevoked  = "api_token_revoked"
+	AuditWebhookCreated   = "webhook_created"
+	AuditWebhookDeleted   = "webhook_deleted"
+	AuditAlertRuleCreated = "alert_rule_created"
+	AuditAlertRuleDeleted = "alert_rule_deleted"
+	AuditEventSubCreated  = "eventsub_subscription_created"
+	AuditEventSubDeleted  = "eventsub_subscription_deleted"
+)
+
+// AuditRepo accède à la table audit_logs
+type AuditRepo struct {
+	q querier
+}
+
+// Log enregistre un événement ; userID et sessionID valent 0 s'ils ne s'appliquent pas,
+// details est encodé en JSON
+func (r AuditRepo) Log(ctx context.Context, eventType string, userID, sessionID int64, details any) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = r.q.ExecContext(ctx,
+		`INSERT INTO audit_logs (event_type, user_id, session_id, details, created_at) VALUES (?, NULLIF(?, 0), NULLIF(?, 0), ?, NOW(6))`,
+		eventType, userID, sessionID, string(detailsJSON),
+	)
+	return err
+}
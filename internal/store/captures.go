@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Capture est un snapshot des chatters d'une chaîne
+type Capture struct {
+	ID               int64
+	SessionID        int64
+	BroadcasterID    string
+	BroadcasterLogin string
+	CapturedAt       time.Time
+	ChattersCount    int
+}
+
+// BroadcasterCaptures compte les captures d'une chaîne dans une session
+type BroadcasterCaptures struct {
+	BroadcasterID    string
+	BroadcasterLogin string
+	CaptureCount     int64
+}
+
+// CaptureRepo accède à la table captures
+type CaptureRepo struct {
+	q querier
+}
+
+// Create enregistre une capture et ses chatters dans une même transaction et retourne son id
+func (r CaptureRepo) Create(ctx context.Context, c Capture, chatterIDs []string) (int64, error) {
+	var captureID int64
+	err := inTx(ctx, r.q, func(q querier) error {
+		res, err := q.ExecContext(ctx, `
+INSERT INTO captures (session_id, broadcaster_id, broadcaster_login, captured_at, chatters_count, new_users_count)
+VALUES (?, ?, ?, ?, ?, 0)
+`, c.SessionID, c.BroadcasterID, c.BroadcasterLogin, c.CapturedAt, len(chatterIDs))
+		if err != nil {
+			return err
+		}
+		if captureID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		return ChatterRepo{q: q}.Add(ctx, captureID, chatterIDs)
+	})
+	return captureID, err
+}
+
+// Broadcasters retourne les chaînes capturées dans une session avec leur nombre de captures
+func (r CaptureRepo) Broadcasters(ctx context.Context, sessionID int64) ([]BroadcasterCaptures, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT
+    c.broadcaster_id,
+    c.broadcaster_login,
+    COUNT(DISTINCT c.id) as capture_count
+FROM captures c
+WHERE c.session_id = ?
+GROUP BY c.broadcaster_id, c.broadcaster_login
+ORDER BY capture_count DESC, c.broadcaster_login ASC
+`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var broadcasters []BroadcasterCaptures
+	for rows.Next() {
+		var b BroadcasterCaptures
+		if err := rows.Scan(&b.BroadcasterID, &b.BroadcasterLogin, &b.CaptureCount); err != nil {
+			return nil, err
+		}
+		broadcasters = append(broadcasters, b)
+	}
+	return broadcasters, rows.Err()
+}
@@ -0,0 +1,292 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ChatChannel est une chaîne dont le chat est écouté pour une session
+type ChatChannel struct {
+	SessionID        int64
+	BroadcasterID    string
+	BroadcasterLogin string
+	ListeningSince   time.Time // zéro dans le résultat de Targets
+}
+
+// ChatActivity est l'activité d'un compte dans le chat d'une chaîne. Pour Record, les
+// compteurs sont des incréments et les dates les bornes des messages ajoutés.
+type ChatActivity struct {
+	SessionID      int64
+	BroadcasterID  string
+	TwitchUserID   string
+	Login          string
+	MessageCount   int64
+	DuplicateCount int64
+	FirstMessageAt time.Time
+	LastMessageAt  time.Time
+}
+
+// ChatFingerprint est l'empreinte d'un message vu sur une chaîne. Pour Record, MessageCount
+// est un incrément ; Sample n'est enregistré que s'il n'y en a pas encore.
+type ChatFingerprint struct {
+	SessionID     int64
+	BroadcasterID string
+	Fingerprint   string
+	Sample        string // vide tant que le message n'a pas été répété
+	MessageCount  int64
+	FirstSeenAt   time.Time
+	LastSeenAt    time.Time
+}
+
+// ChatterActivity est l'activité d'un compte dans le chat d'une session, toutes chaînes
+// écoutées (ou filtrées) confondues
+type ChatterActivity struct {
+	TwitchUserID   string
+	Login          string
+	MessageCount   int64
+	DuplicateCount int64
+	FirstMessageAt time.Time
+	LastMessageAt  time.Time
+}
+
+// ChatRepo accède aux tables chat_channels, chat_activity et chat_fingerprints
+type ChatRepo struct {
+	q querier
+}
+
+// Targets retourne les chaînes capturées dans les sessions actives non expirées : les chats
+// à écouter
+func (r ChatRepo) Targets(ctx context.Context) ([]ChatChannel, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT c.session_id, c.broadcaster_id, MAX(c.broadcaster_login)
+FROM captures c
+JOIN sessions s ON s.id = c.session_id
+WHERE s.status = 'active' AND s.expires_at > NOW(6)
+GROUP BY c.session_id, c.broadcaster_id
+ORDER BY c.session_id, c.broadcaster_id
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []ChatChannel
+	for rows.Next() {
+		var ch ChatChannel
+		if err := rows.Scan(&ch.SessionID, &ch.BroadcasterID, &ch.BroadcasterLogin); err != nil {
+			return nil, err
+		}
+		targets = append(targets, ch)
+	}
+	return targets, rows.Err()
+}
+
+// Listen enregistre le début de l'écoute d'une chaîne pour une session ; une écoute déjà
+// enregistrée garde sa date
+func (r ChatRepo) Listen(ctx context.Context, ch ChatChannel) error {
+	_, err := r.q.ExecContext(ctx,
+		`INSERT IGNORE INTO chat_channels (session_id, broadcaster_id, broadcaster_login, listening_since) VALUES (?, ?, ?, ?)`,
+		ch.SessionID, ch.BroadcasterID, ch.BroadcasterLogin, ch.ListeningSince,
+	)
+	return err
+}
+
+// Channels retourne les chaînes écoutées d'une session (éventuellement limitées à des broadcasters)
+func (r ChatRepo) Channels(ctx context.Context, sessionID int64, broadcasterIDs []string) ([]ChatChannel, error) {
+	filter, args := broadcasterFilter("broadcaster_id", broadcasterIDs)
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT session_id, broadcaster_id, broadcaster_login, listening_since FROM chat_channels WHERE session_id = ?`+filter+` ORDER BY listening_since, broadcaster_id`,
+		append([]any{sessionID}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []ChatChannel
+	for rows.Next() {
+		var ch ChatChannel
+		if err := rows.Scan(&ch.SessionID, &ch.BroadcasterID, &ch.BroadcasterLogin, &ch.ListeningSince); err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+// Record cumule des incréments d'activité et d'empreintes dans une même transaction
+func (r ChatRepo) Record(ctx context.Context, activity []ChatActivity, fingerprints []ChatFingerprint) error {
+	return inTx(ctx, r.q, func(q querier) error {
+		if len(activity) > 0 {
+			// Ids distincts : userKeys retourne alors une clé par id, dans le même ordre
+			seen := make(map[string]bool, len(activity))
+			var ids []string
+			for _, a := range activity {
+				if !seen[a.TwitchUserID] {
+					seen[a.TwitchUserID] = true
+					ids = append(ids, a.TwitchUserID)
+				}
+			}
+			keys, err := userKeys(ctx, q, ids)
+			if err != nil {
+				return err
+			}
+			keyOf := make(map[string]int64, len(keys))
+			for i, id := range ids {
+				keyOf[id] = keys[i]
+			}
+			for _, chunk := range chunks(activity) {
+				args := make([]any, 0, 8*len(chunk))
+				for _, a := range chunk {
+					args = append(args, a.SessionID, a.BroadcasterID, keyOf[a.TwitchUserID], a.Login,
+						a.MessageCount, a.DuplicateCount, a.FirstMessageAt, a.LastMessageAt)
+				}
+				if _, err := q.ExecContext(ctx, `
+INSERT INTO chat_activity (session_id, broadcaster_id, user_key, login, message_count, duplicate_count, first_message_at, last_message_at)
+VALUES `+placeholders(len(chunk), 8)+`
+ON DUPLICATE KEY UPDATE
+    login = VALUES(login),
+    message_count = message_count + VALUES(message_count),
+    duplicate_count = duplicate_count + VALUES(duplicate_count),
+    first_message_at = LEAST(first_message_at, VALUES(first_message_at)),
+    last_message_at = GREATEST(last_message_at, VALUES(last_message_at))
+`, args...); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, chunk := range chunks(fingerprints) {
+			args := make([]any, 0, 7*len(chunk))
+			for _, f := range chunk {
+				var sample sql.NullString
+				if f.Sample != "" {
+					sample = sql.NullString{String: f.Sample, Valid: true}
+				}
+				args = append(args, f.SessionID, f.BroadcasterID, f.Fingerprint, sample, f.MessageCount, f.FirstSeenAt, f.LastSeenAt)
+			}
+			if _, err := q.ExecContext(ctx, `
+INSERT INTO chat_fingerprints (session_id, broadcaster_id, fingerprint, sample, message_count, first_seen_at, last_seen_at)
+VALUES `+placeholders(len(chunk), 7)+`
+ON DUPLICATE KEY UPDATE
+    sample = COALESCE(sample, VALUES(sample)),
+    message_count = message_count + VALUES(message_count),
+    first_seen_at = LEAST(first_seen_at, VALUES(first_seen_at)),
+    last_seen_at = GREATEST(last_seen_at, VALUES(last_seen_at))
+`, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Fingerprints retourne le nombre de messages de chaque empreinte vue sur une chaîne pendant
+// une session, limité aux limit empreintes les plus récentes
+func (r ChatRepo) Fingerprints(ctx context.Context, sessionID int64, broadcasterID string, limit int) (map[string]int64, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT fingerprint, message_count
+FROM chat_fingerprints
+WHERE session_id = ? AND broadcaster_id = ?
+ORDER BY last_seen_at DESC
+LIMIT ?
+`, sessionID, broadcasterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var fp string
+		var n int64
+		if err := rows.Scan(&fp, &n); err != nil {
+			return nil, err
+		}
+		counts[fp] = n
+	}
+	return counts, rows.Err()
+}
+
+// Activity retourne l'activité de chaque compte ayant écrit dans le chat d'une session
+// (éventuellement limitée à des broadcasters), le plus bavard d'abord
+func (r ChatRepo) Activity(ctx context.Context, sessionID int64, broadcasterIDs []string) ([]ChatterActivity, error) {
+	filter, args := broadcasterFilter("a.broadcaster_id", broadcasterIDs)
+	rows, err := r.q.QueryContext(ctx, `
+SELECT
+    k.twitch_user_id,
+    MAX(a.login),
+    SUM(a.message_count) as message_count,
+    SUM(a.duplicate_count),
+    MIN(a.first_message_at),
+    MAX(a.last_message_at)
+FROM chat_activity a
+JOIN twitch_user_keys k ON k.user_key = a.user_key
+WHERE a.session_id = ?`+filter+`
+GROUP BY k.twitch_user_id
+ORDER BY message_count DESC, k.twitch_user_id ASC
+`, append([]any{sessionID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []ChatterActivity
+	for rows.Next() {
+		var a ChatterActivity
+		if err := rows.Scan(&a.TwitchUserID, &a.Login, &a.MessageCount, &a.DuplicateCount, &a.FirstMessageAt, &a.LastMessageAt); err != nil {
+			return nil, err
+		}
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
+
+// CountSilent compte les comptes capturés sur une chaîne écoutée d'une session (éventuellement
+// limitée à des broadcasters) qui n'ont écrit dans aucun de ces chats
+func (r ChatRepo) CountSilent(ctx context.Context, sessionID int64, broadcasterIDs []string) (int64, error) {
+	filter, args := broadcasterFilter("c.broadcaster_id", broadcasterIDs)
+	activityFilter, activityArgs := broadcasterFilter("a.broadcaster_id", broadcasterIDs)
+	var n int64
+	err := r.q.QueryRowContext(ctx, `
+SELECT COUNT(DISTINCT cc.user_key)
+FROM capture_chatters cc
+JOIN captures c ON cc.capture_id = c.id
+JOIN chat_channels ch ON ch.session_id = c.session_id AND ch.broadcaster_id = c.broadcaster_id
+WHERE c.session_id = ?`+filter+`
+  AND NOT EXISTS (
+    SELECT 1 FROM chat_activity a
+    WHERE a.session_id = c.session_id AND a.user_key = cc.user_key`+activityFilter+`
+  )`,
+		append(append([]any{sessionID}, args...), activityArgs...)...,
+	).Scan(&n)
+	return n, err
+}
+
+// RepeatedMessages retourne les messages envoyés au moins minCount fois sur les chaînes
+// d'une session (éventuellement limitée à des broadcasters), les plus répétés d'abord
+func (r ChatRepo) RepeatedMessages(ctx context.Context, sessionID int64, broadcasterIDs []string, minCount int64, limit int) ([]ChatFingerprint, error) {
+	filter, args := broadcasterFilter("broadcaster_id", broadcasterIDs)
+	rows, err := r.q.QueryContext(ctx, `
+SELECT session_id, broadcaster_id, fingerprint, COALESCE(sample, ''), message_count, first_seen_at, last_seen_at
+FROM chat_fingerprints
+WHERE session_id = ? AND message_count >= ?`+filter+`
+ORDER BY message_count DESC, first_seen_at ASC
+LIMIT ?
+`, append(append([]any{sessionID, minCount}, args...), limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var repeated []ChatFingerprint
+	for rows.Next() {
+		var f ChatFingerprint
+		if err := rows.Scan(&f.SessionID, &f.BroadcasterID, &f.Fingerprint, &f.Sample, &f.MessageCount, &f.FirstSeenAt, &f.LastSeenAt); err != nil {
+			return nil, err
+		}
+		repeated = append(repeated, f)
+	}
+	return repeated, rows.Err()
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ChatterStats résume la présence d'un compte dans une session (export)
+type ChatterStats struct {
+	TwitchUserID string
+	Login        string     // vide tant que le compte n'est pas enrichi
+	DisplayName  string     // vide tant que le compte n'est pas enrichi
+	CreatedAt    *time.Time // nil tant que le compte n'est pas enrichi
+	SeenCount    int64
+	FirstSeen    time.Time
+	LastSeen     time.Time
+}
+
+// ChatterRepo accède à la table capture_chatters. Un chatter y est désigné par la clé
+// entière de son compte (twitch_user_keys.user_key) plutôt que par son twitch_user_id.
+type ChatterRepo struct {
+	q querier
+}
+
+// Add lie des chatters à une capture (les doublons sont ignorés), par INSERT multi-lignes
+// de batchSize lignes ; les clés des comptes jamais vus sont créées
+func (r ChatterRepo) Add(ctx context.Context, captureID int64, twitchUserIDs []string) error {
+	if len(twitchUserIDs) == 0 {
+		return nil
+	}
+	return inTx(ctx, r.q, func(q querier) error {
+		keys, err := userKeys(ctx, q, twitchUserIDs)
+		if err != nil {
+			return err
+		}
+		for _, chunk := range chunks(keys) {
+			args := make([]any, 0, 2*len(chunk))
+			for _, key := range chunk {
+				args = append(args, captureID, key)
+			}
+			if _, err := q.ExecContext(ctx,
+				`INSERT IGNORE INTO capture_chatters (capture_id, user_key) VALUES `+placeholders(len(chunk), 2),
+				args...,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// userKeys retourne les clés distinctes des comptes twitchUserIDs, en créant les clés manquantes
+func userKeys(ctx context.Context, q querier, twitchUserIDs []string) ([]int64, error) {
+	seen := make(map[string]bool, len(twitchUserIDs))
+	var unique []string
+	for _, id := range twitchUserIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	keys := make(map[string]int64, len(unique))
+	for _, chunk := range chunks(unique) {
+		// Lecture partagée : la rétention (PurgeUserKeys) ne peut pas supprimer une clé lue ici
+		// avant que la transaction appelante ne l'ait référencée
+		if err := selectUserKeys(ctx, q, chunk, keys, " LOCK IN SHARE MODE"); err != nil {
+			return nil, err
+		}
+		var missing []string
+		for _, id := range chunk {
+			if _, ok := keys[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		// IGNORE : un autre worker a pu créer la clé entre-temps ; les clés existantes ne sont
+		// pas réinsérées pour ne pas consommer de valeurs d'auto-incrément
+		args := make([]any, len(missing))
+		for i, id := range missing {
+			args[i] = id
+		}
+		if _, err := q.ExecContext(ctx,
+			`INSERT IGNORE INTO twitch_user_keys (twitch_user_id) VALUES `+placeholders(len(missing), 1),
+			args...,
+		); err != nil {
+			return nil, err
+		}
+		// Lecture verrouillante : voit aussi les clés validées par une autre transaction
+		// depuis le début de celle-ci
+		if err := selectUserKeys(ctx, q, missing, keys, " FOR UPDATE"); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]int64, 0, len(unique))
+	for _, id := range unique {
+		key, ok := keys[id]
+		if !ok {
+			return nil, fmt.Errorf("store: no user key for %s", id)
+		}
+		out = append(out, key)
+	}
+	return out, nil
+}
+
+func selectUserKeys(ctx context.Context, q querier, twitchUserIDs []string, keys map[string]int64, lock string) error {
+	args := make([]any, len(twitchUserIDs))
+	for i, id := range twitchUserIDs {
+		args[i] = id
+	}
+	rows, err := q.QueryContext(ctx,
+		`SELECT twitch_user_id, user_key FROM twitch_user_keys WHERE twitch_user_id IN (?`+strings.Repeat(",?", len(args)-1)+`)`+lock,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var key int64
+		if err := rows.Scan(&id, &key); err != nil {
+			return err
+		}
+		keys[id] = key
+	}
+	return rows.Err()
+}
+
+// CountDistinct compte les comptes distincts vus dans une session (éventuellement limitée à des broadcasters)
+func (r ChatterRepo) CountDistinct(ctx context.Context, sessionID int64, broadcasterIDs []string) (int64, error) {
+	filter, args := broadcasterFilter("c.broadcaster_id", broadcasterIDs)
+	var total int64
+	err := r.q.QueryRowContext(ctx, `
+SELECT COUNT(DISTINCT cc.user_key)
+FROM capture_chatters cc
+JOIN captures c ON cc.capture_id = c.id
+WHERE c.session_id = ?`+filter,
+		append([]any{sessionID}, args...)...,
+	).Scan(&total)
+	return total, err
+}
+
+// SessionStats retourne chaque compte vu dans une session, le plus présent d'abord.
+// Les infos Twitch sont absentes tant que le worker n'a pas enrichi le compte.
+func (r ChatterRepo) SessionStats(ctx context.Context, sessionID int64) ([]ChatterStats, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT
+    k.twitch_user_id,
+    COALESCE(tu.login, ''),
+    COALESCE(tu.display_name, ''),
+    tu.created_at,
+    COUNT(*) as seen_count,
+    MIN(c.captured_at) as first_seen,
+    MAX(c.captured_at) as last_seen
+FROM capture_chatters cc
+JOIN captures c ON cc.capture_id = c.id
+JOIN twitch_user_keys k ON k.user_key = cc.user_key
+LEFT JOIN twitch_users tu ON tu.twitch_user_id = k.twitch_user_id
+WHERE c.session_id = ?
+GROUP BY k.twitch_user_id, tu.login, tu.display_name, tu.created_at
+ORDER BY seen_count DESC, tu.login ASC, k.twitch_user_id ASC
+`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []ChatterStats
+	for rows.Next() {
+		var s ChatterStats
+		var createdAt sql.NullTime
+		if err := rows.Scan(&s.TwitchUserID, &s.Login, &s.DisplayName, &createdAt, &s.SeenCount, &s.FirstSeen, &s.LastSeen); err != nil {
+			return nil, err
+		}
+		if createdAt.Valid {
+			s.CreatedAt = &createdAt.Time
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
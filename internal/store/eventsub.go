@@ -0,0 +1,269 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventSubSubscription est l'abonnement EventSub d'un utilisateur à un type d'événement
+// d'une chaîne, avec les délais des captures qu'il déclenche
+type EventSubSubscription struct {
+	ID                   int64
+	UserID               int64
+	BroadcasterID        string
+	BroadcasterLogin     string
+	Type                 string
+	ModeratorID          string // channel.follow uniquement
+	CaptureOffsets       []time.Duration
+	Transport            string // webhook ou websocket
+	TwitchSubscriptionID string // vide tant que Twitch n'a pas accepté l'abonnement
+	Status               string
+	CreatedAt            time.Time
+}
+
+// EventSubEvent est une notification EventSub reçue
+type EventSubEvent struct {
+	ID                   int64
+	MessageID            string
+	TwitchSubscriptionID string
+	Type                 string
+	BroadcasterID        string
+	BroadcasterLogin     string // chaîne de l'abonnement, renseignée par ListEvents
+	Event                json.RawMessage
+	Captures             int
+	ReceivedAt           time.Time
+}
+
+// EventSubRepo accède aux tables eventsub_subscriptions et eventsub_events
+type EventSubRepo struct {
+	q querier
+}
+
+const eventSubColumns = `id, user_id, broadcaster_id, broadcaster_login, type, COALESCE(moderator_id, ''),
+  capture_offsets, transport, COALESCE(twitch_subscription_id, ''), status, created_at`
+
+func scanEventSubSubscription(row interface{ Scan(...any) error }) (*EventSubSubscription, error) {
+	var s EventSubSubscription
+	var offsets string
+	if err := row.Scan(&s.ID, &s.UserID, &s.BroadcasterID, &s.BroadcasterLogin, &s.Type, &s.ModeratorID,
+		&offsets, &s.Transport, &s.TwitchSubscriptionID, &s.Status, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	for _, f := range strings.Fields(offsets) {
+		if secs, err := strconv.ParseInt(f, 10, 64); err == nil {
+			s.CaptureOffsets = append(s.CaptureOffsets, time.Duration(secs)*time.Second)
+		}
+	}
+	return &s, nil
+}
+
+// formatOffsets encode les délais en secondes séparées par des espaces
+func formatOffsets(offsets []time.Duration) string {
+	parts := make([]string, len(offsets))
+	for i, d := range offsets {
+		parts[i] = strconv.FormatInt(int64(d/time.Second), 10)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (r EventSubRepo) list(ctx context.Context, query string, args ...any) ([]EventSubSubscription, error) {
+	rows, err := r.q.QueryContext(ctx, `SELECT `+eventSubColumns+` FROM eventsub_subscriptions `+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []EventSubSubscription
+	for rows.Next() {
+		s, err := scanEventSubSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *s)
+	}
+	return out, rows.Err()
+}
+
+// Create enregistre un abonnement (transport webhook par défaut) et retourne son id
+func (r EventSubRepo) Create(ctx context.Context, s EventSubSubscription) (int64, error) {
+	if s.Transport == "" {
+		s.Transport = "webhook"
+	}
+	res, err := r.q.ExecContext(ctx, `
+INSERT INTO eventsub_subscriptions (user_id, broadcaster_id, broadcaster_login, type, moderator_id,
+                                    capture_offsets, transport, twitch_subscription_id, status, created_at)
+VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, ?, NULLIF(?, ''), ?, ?)
+`, s.UserID, s.BroadcasterID, s.BroadcasterLogin, s.Type, s.ModeratorID,
+		formatOffsets(s.CaptureOffsets), s.Transport, s.TwitchSubscriptionID, s.Status, s.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListByUser retourne les abonnements d'un utilisateur, par chaîne puis par type
+func (r EventSubRepo) ListByUser(ctx context.Context, userID int64) ([]EventSubSubscription, error) {
+	return r.list(ctx, `WHERE user_id = ? ORDER BY broadcaster_login ASC, type ASC`, userID)
+}
+
+// ListByTransport retourne les abonnements d'un transport, par utilisateur
+func (r EventSubRepo) ListByTransport(ctx context.Context, transport string) ([]EventSubSubscription, error) {
+	return r.list(ctx, `WHERE transport = ? ORDER BY user_id ASC, id ASC`, transport)
+}
+
+// CountByUser retourne le nombre d'abonnements d'un utilisateur
+func (r EventSubRepo) CountByUser(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := r.q.QueryRowContext(ctx, `SELECT COUNT(*) FROM eventsub_subscriptions WHERE user_id = ?`, userID).Scan(&n)
+	return n, err
+}
+
+// Exists indique si l'utilisateur est déjà abonné au type d'événement de la chaîne
+func (r EventSubRepo) Exists(ctx context.Context, userID int64, broadcasterID, subType string) (bool, error) {
+	var n int
+	err := r.q.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM eventsub_subscriptions WHERE user_id = ? AND broadcaster_id = ? AND type = ?`,
+		userID, broadcasterID, subType).Scan(&n)
+	return n > 0, err
+}
+
+// Get retourne un abonnement de l'utilisateur
+func (r EventSubRepo) Get(ctx context.Context, userID, id int64) (*EventSubSubscription, error) {
+	s, err := scanEventSubSubscription(r.q.QueryRowContext(ctx,
+		`SELECT `+eventSubColumns+` FROM eventsub_subscriptions WHERE id = ? AND user_id = ?`, id, userID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return s, nil
+}
+
+// ByTwitchID retourne les abonnements des utilisateurs rattachés à un abonnement Twitch
+func (r EventSubRepo) ByTwitchID(ctx context.Context, twitchSubscriptionID string) ([]EventSubSubscription, error) {
+	return r.list(ctx, `WHERE twitch_subscription_id = ? ORDER BY id ASC`, twitchSubscriptionID)
+}
+
+// Shared retourne l'abonnement Twitch webhook déjà créé pour un autre utilisateur avec le même
+// type et la même condition (ErrNotFound s'il n'y en a pas) ; les abonnements websocket
+// appartiennent à la session de leur utilisateur et ne sont jamais partagés
+func (r EventSubRepo) Shared(ctx context.Context, subType, broadcasterID, moderatorID string) (twitchSubscriptionID, status string, err error) {
+	err = r.q.QueryRowContext(ctx, `
+SELECT twitch_subscription_id, status
+FROM eventsub_subscriptions
+WHERE type = ? AND broadcaster_id = ? AND COALESCE(moderator_id, '') = ?
+  AND transport = 'webhook' AND twitch_subscription_id IS NOT NULL
+ORDER BY id ASC
+LIMIT 1
+`, subType, broadcasterID, moderatorID).Scan(&twitchSubscriptionID, &status)
+	return twitchSubscriptionID, status, notFound(err)
+}
+
+// Delete supprime un abonnement de l'utilisateur et indique si son abonnement Twitch est
+// encore référencé par d'autres utilisateurs
+func (r EventSubRepo) Delete(ctx context.Context, userID, id int64) (stillUsed bool, err error) {
+	err = inTx(ctx, r.q, func(q querier) error {
+		var twitchID sql.NullString
+		err := q.QueryRowContext(ctx,
+			`SELECT twitch_subscription_id FROM eventsub_subscriptions WHERE id = ? AND user_id = ? FOR UPDATE`,
+			id, userID).Scan(&twitchID)
+		if err != nil {
+			return notFound(err)
+		}
+		if _, err := q.ExecContext(ctx, `DELETE FROM eventsub_subscriptions WHERE id = ?`, id); err != nil {
+			return err
+		}
+		if !twitchID.Valid {
+			return nil
+		}
+		var n int
+		if err := q.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM eventsub_subscriptions WHERE twitch_subscription_id = ?`, twitchID.String).Scan(&n); err != nil {
+			return err
+		}
+		stillUsed = n > 0
+		return nil
+	})
+	return stillUsed, err
+}
+
+// SetStatus enregistre le statut d'un abonnement Twitch sur toutes les lignes qui le
+// référencent et retourne leur nombre
+func (r EventSubRepo) SetStatus(ctx context.Context, twitchSubscriptionID, status string) (int64, error) {
+	res, err := r.q.ExecContext(ctx,
+		`UPDATE eventsub_subscriptions SET status = ? WHERE twitch_subscription_id = ?`, status, twitchSubscriptionID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SetTwitchSubscription rattache un abonnement à l'abonnement Twitch twitchSubscriptionID
+// (vide : aucun) avec son statut
+func (r EventSubRepo) SetTwitchSubscription(ctx context.Context, id int64, twitchSubscriptionID, status string) error {
+	_, err := r.q.ExecContext(ctx,
+		`UPDATE eventsub_subscriptions SET twitch_subscription_id = NULLIF(?, ''), status = ? WHERE id = ?`,
+		twitchSubscriptionID, status, id)
+	return err
+}
+
+// RecordEvent enregistre une notification reçue ; false si le message a déjà été reçu
+func (r EventSubRepo) RecordEvent(ctx context.Context, e EventSubEvent) (id int64, created bool, err error) {
+	res, err := r.q.ExecContext(ctx, `
+INSERT IGNORE INTO eventsub_events (message_id, twitch_subscription_id, type, broadcaster_id, event, received_at)
+VALUES (?, ?, ?, ?, ?, ?)
+`, e.MessageID, e.TwitchSubscriptionID, e.Type, e.BroadcasterID, string(e.Event), e.ReceivedAt)
+	if err != nil {
+		return 0, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, false, nil
+	}
+	id, err = res.LastInsertId()
+	return id, err == nil, err
+}
+
+// SetEventCaptures enregistre le nombre de captures planifiées par une notification
+func (r EventSubRepo) SetEventCaptures(ctx context.Context, id int64, captures int) error {
+	_, err := r.q.ExecContext(ctx, `UPDATE eventsub_events SET captures = ? WHERE id = ?`, captures, id)
+	return err
+}
+
+// DeleteEvent efface une notification enregistrée, dont le renvoi sera alors traité
+func (r EventSubRepo) DeleteEvent(ctx context.Context, id int64) error {
+	_, err := r.q.ExecContext(ctx, `DELETE FROM eventsub_events WHERE id = ?`, id)
+	return err
+}
+
+// ListEvents retourne les dernières notifications reçues pour les abonnements d'un
+// utilisateur, de la plus récente à la plus ancienne ; le rapprochement se fait par type et
+// chaîne, l'abonnement Twitch d'une ligne websocket changeant à chaque reconnexion
+func (r EventSubRepo) ListEvents(ctx context.Context, userID int64, limit int) ([]EventSubEvent, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT e.id, e.message_id, e.twitch_subscription_id, e.type, e.broadcaster_id, s.broadcaster_login,
+       e.event, e.captures, e.received_at
+FROM eventsub_events e
+JOIN eventsub_subscriptions s ON s.type = e.type AND s.broadcaster_id = e.broadcaster_id AND s.user_id = ?
+ORDER BY e.received_at DESC, e.id DESC
+LIMIT ?
+`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []EventSubEvent
+	for rows.Next() {
+		var e EventSubEvent
+		var event []byte
+		if err := rows.Scan(&e.ID, &e.MessageID, &e.TwitchSubscriptionID, &e.Type, &e.BroadcasterID, &e.BroadcasterLogin,
+			&event, &e.Captures, &e.ReceivedAt); err != nil {
+			return nil, err
+		}
+		e.Event = event
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// FollowerFetch est la dernière récupération des followers d'une chaîne pour une session
+type FollowerFetch struct {
+	SessionID        int64
+	BroadcasterID    string
+	BroadcasterLogin string
+	Total            int64 // followers de la chaîne selon Twitch
+	Fetched          int64 // followers récupérés, les plus récents
+	FetchedAt        time.Time
+}
+
+// Follow est le follow d'une chaîne par un compte
+type Follow struct {
+	TwitchUserID string
+	FollowedAt   time.Time
+}
+
+// WindowFollower est un compte ayant suivi une chaîne dans une fenêtre de temps
+type WindowFollower struct {
+	TwitchUserID string
+	Login        string     // vide tant que le compte n'est pas enrichi
+	CreatedAt    *time.Time // nil tant que le compte n'est pas enrichi
+	FollowedAt   time.Time
+	InChat       bool // présent dans une capture de chatters de la session
+}
+
+// FollowerRepo accède aux tables follower_fetches et channel_followers
+type FollowerRepo struct {
+	q querier
+}
+
+// Store enregistre une récupération et les follows de la chaîne dans une même transaction ;
+// un compte déjà enregistré prend sa nouvelle date de follow (unfollow puis follow)
+func (r FollowerRepo) Store(ctx context.Context, fetch FollowerFetch, follows []Follow) error {
+	return inTx(ctx, r.q, func(q querier) error {
+		if _, err := q.ExecContext(ctx, `
+INSERT INTO follower_fetches (session_id, broadcaster_id, broadcaster_login, total, fetched, fetched_at)
+VALUES (?, ?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+    broadcaster_login = VALUES(broadcaster_login),
+    total = VALUES(total),
+    fetched = VALUES(fetched),
+    fetched_at = VALUES(fetched_at)
+`, fetch.SessionID, fetch.BroadcasterID, fetch.BroadcasterLogin, fetch.Total, fetch.Fetched, fetch.FetchedAt); err != nil {
+			return err
+		}
+		if len(follows) == 0 {
+			return nil
+		}
+
+		// Ids distincts : userKeys retourne alors une clé par id, dans le même ordre
+		seen := make(map[string]bool, len(follows))
+		var unique []Follow
+		var ids []string
+		for _, f := range follows {
+			if !seen[f.TwitchUserID] {
+				seen[f.TwitchUserID] = true
+				unique = append(unique, f)
+				ids = append(ids, f.TwitchUserID)
+			}
+		}
+		keys, err := userKeys(ctx, q, ids)
+		if err != nil {
+			return err
+		}
+		keyOf := make(map[string]int64, len(keys))
+		for i, id := range ids {
+			keyOf[id] = keys[i]
+		}
+		for _, chunk := range chunks(unique) {
+			args := make([]any, 0, 4*len(chunk))
+			for _, f := range chunk {
+				args = append(args, fetch.SessionID, fetch.BroadcasterID, keyOf[f.TwitchUserID], f.FollowedAt)
+			}
+			if _, err := q.ExecContext(ctx, `
+INSERT INTO channel_followers (session_id, broadcaster_id, user_key, followed_at)
+VALUES `+placeholders(len(chunk), 4)+`
+ON DUPLICATE KEY UPDATE followed_at = VALUES(followed_at)
+`, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Fetches retourne les chaînes dont les followers ont été récupérés pour une session
+// (éventuellement limitées à des broadcasters)
+func (r FollowerRepo) Fetches(ctx context.Context, sessionID int64, broadcasterIDs []string) ([]FollowerFetch, error) {
+	filter, args := broadcasterFilter("broadcaster_id", broadcasterIDs)
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT session_id, broadcaster_id, broadcaster_login, total, fetched, fetched_at FROM follower_fetches WHERE session_id = ?`+filter+` ORDER BY broadcaster_login, broadcaster_id`,
+		append([]any{sessionID}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fetches []FollowerFetch
+	for rows.Next() {
+		var f FollowerFetch
+		if err := rows.Scan(&f.SessionID, &f.BroadcasterID, &f.BroadcasterLogin, &f.Total, &f.Fetched, &f.FetchedAt); err != nil {
+			return nil, err
+		}
+		fetches = append(fetches, f)
+	}
+	return fetches, rows.Err()
+}
+
+// FollowTimes retourne les dates de follow enregistrées d'une chaîne pour une session, dans
+// l'ordre chronologique
+func (r FollowerRepo) FollowTimes(ctx context.Context, sessionID int64, broadcasterID string) ([]time.Time, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT followed_at FROM channel_followers WHERE session_id = ? AND broadcaster_id = ? ORDER BY followed_at`,
+		sessionID, broadcasterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, rows.Err()
+}
+
+// Window retourne les comptes ayant suivi une chaîne entre from (inclus) et to (exclu), avec
+// leur date de création et leur présence parmi les chatters capturés de la session
+func (r FollowerRepo) Window(ctx context.Context, sessionID int64, broadcasterID string, from, to time.Time) ([]WindowFollower, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT k.twitch_user_id, COALESCE(tu.login, ''), tu.created_at, f.followed_at,
+    EXISTS (
+        SELECT 1 FROM capture_chatters cc
+        JOIN captures c ON c.id = cc.capture_id
+        WHERE c.session_id = f.session_id AND cc.user_key = f.user_key
+    )
+FROM channel_followers f
+JOIN twitch_user_keys k ON k.user_key = f.user_key
+LEFT JOIN twitch_users tu ON tu.twitch_user_id = k.twitch_user_id
+WHERE f.session_id = ? AND f.broadcaster_id = ? AND f.followed_at >= ? AND f.followed_at < ?
+ORDER BY f.followed_at, k.twitch_user_id
+`, sessionID, broadcasterID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var followers []WindowFollower
+	for rows.Next() {
+		var f WindowFollower
+		var createdAt sql.NullTime
+		if err := rows.Scan(&f.TwitchUserID, &f.Login, &createdAt, &f.FollowedAt, &f.InChat); err != nil {
+			return nil, err
+		}
+		if createdAt.Valid {
+			f.CreatedAt = &createdAt.Time
+		}
+		followers = append(followers, f)
+	}
+	return followers, rows.Err()
+}
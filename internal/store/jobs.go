@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Types de jobs traités par le worker
+const (
+	JobFetchChatters  = "FETCH_CHATTERS"
+	JobFetchUsersInfo = "FETCH_USERS_INFO"
+	JobFetchFollowers = "FETCH_FOLLOWERS"
+	JobRefreshUsers   = "REFRESH_USERS"
+	JobPurge          = "PURGE"
+	JobDeliverWebhook = "DELIVER_WEBHOOK"
+)
+
+// Statuts d'un job
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job est une tâche de la file du worker
+type Job struct {
+	ID         int64
+	Type       string
+	Payload    json.RawMessage
+	SessionID  int64 // 0 pour les jobs de maintenance
+	UserID     int64
+	Status     string
+	Progress   JobProgress
+	CreatedAt  time.Time
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	Error      string
+}
+
+// JobProgress est l'avancement d'un job, mis à jour par le worker
+type JobProgress struct {
+	Done    int
+	Total   *int // nil tant que le total est inconnu
+	Message string
+}
+
+// jobColumns sont les colonnes lues par scanJob
+const jobColumns = `id, type, payload, COALESCE(session_id, 0), COALESCE(user_id, 0), status,
+  progress_done, progress_total, COALESCE(progress_message, ''),
+  created_at, started_at, finished_at, COALESCE(error_message, '')`
+
+func scanJob(row interface{ Scan(...any) error }) (*Job, error) {
+	var job Job
+	err := row.Scan(&job.ID, &job.Type, &job.Payload, &job.SessionID, &job.UserID, &job.Status,
+		&job.Progress.Done, &job.Progress.Total, &job.Progress.Message,
+		&job.CreatedAt, &job.StartedAt, &job.FinishedAt, &job.Error)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// JobRepo accède à la table jobs
+type JobRepo struct {
+	q querier
+}
+
+// Enqueue ajoute un job en attente ; payload est encodé en JSON
+func (r JobRepo) Enqueue(ctx context.Context, jobType string, payload any) (int64, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.q.ExecContext(ctx,
+		`INSERT INTO jobs (type, payload, status, created_at) VALUES (?, ?, 'pending', NOW(6))`,
+		jobType, string(payloadJSON),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// EnqueueAt ajoute un job en attente qui ne sera pas exécuté avant runAfter
+func (r JobRepo) EnqueueAt(ctx context.Context, jobType string, payload any, runAfter time.Time) (int64, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.q.ExecContext(ctx,
+		`INSERT INTO jobs (type, payload, status, run_after, created_at) VALUES (?, ?, 'pending', ?, NOW(6))`,
+		jobType, string(payloadJSON), runAfter.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// EnqueueForSession ajoute un job en attente portant sur une session d'analyse,
+// rattaché à la session et à son propriétaire
+func (r JobRepo) EnqueueForSession(ctx context.Context, jobType string, sessionID int64, payload any) (int64, error) {
+	return r.EnqueueForSessionAt(ctx, jobType, sessionID, payload, time.Time{})
+}
+
+// EnqueueForSessionAt est EnqueueForSession pour un job qui ne sera pas exécuté avant
+// runAfter (zéro : immédiatement)
+func (r JobRepo) EnqueueForSessionAt(ctx context.Context, jobType string, sessionID int64, payload any, runAfter time.Time) (int64, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	var after *time.Time
+	if !runAfter.IsZero() {
+		t := runAfter.UTC()
+		after = &t
+	}
+	res, err := r.q.ExecContext(ctx, `
+INSERT INTO jobs (type, payload, session_id, user_id, status, run_after, created_at)
+SELECT ?, ?, id, user_id, 'pending', ?, NOW(6) FROM sessions WHERE id = ?
+`, jobType, string(payloadJSON), after, sessionID)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, ErrNotFound
+	}
+	return res.LastInsertId()
+}
+
+// CreatedWithin indique si un job du type donné a été créé pendant la dernière durée d
+func (r JobRepo) CreatedWithin(ctx context.Context, jobType string, d time.Duration) (bool, error) {
+	var n int
+	err := r.q.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM jobs WHERE type = ? AND created_at > NOW(6) - INTERVAL ? SECOND`,
+		jobType, int64(d/time.Second),
+	).Scan(&n)
+	return n > 0, err
+}
+
+// Get retourne un job par son id
+func (r JobRepo) Get(ctx context.Context, id int64) (*Job, error) {
+	job, err := scanJob(r.q.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return job, nil
+}
+
+// ListBySession retourne les derniers jobs d'une session, du plus récent au plus ancien
+func (r JobRepo) ListBySession(ctx context.Context, sessionID int64, limit int) ([]Job, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT `+jobColumns+`
+FROM jobs
+WHERE session_id = ?
+ORDER BY created_at DESC, id DESC
+LIMIT ?
+`, sessionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *job)
+	}
+	return out, rows.Err()
+}
+
+// SetProgress enregistre l'avancement d'un job ; total vaut -1 s'il est inconnu
+func (r JobRepo) SetProgress(ctx context.Context, id int64, done, total int, message string) error {
+	_, err := r.q.ExecContext(ctx,
+		`UPDATE jobs SET progress_done = ?, progress_total = NULLIF(?, -1), progress_message = ? WHERE id = ?`,
+		done, total, message, id,
+	)
+	return err
+}
+
+// ClaimNext passe le plus ancien job en attente et exécutable (run_after échu) à 'running'
+// et le retourne (ErrNotFound si la file est vide)
+func (r JobRepo) ClaimNext(ctx context.Context) (*Job, error) {
+	var job Job
+	err := inTx(ctx, r.q, func(q querier) error {
+		// MySQL 8+: FOR UPDATE SKIP LOCKED pour éviter les conflits entre workers
+		err := q.QueryRowContext(ctx, `
+SELECT id, type, payload, COALESCE(session_id, 0), COALESCE(user_id, 0), created_at
+FROM jobs
+WHERE status = 'pending' AND (run_after IS NULL OR run_after <= NOW(6))
+ORDER BY created_at ASC
+LIMIT 1
+FOR UPDATE
+`).Scan(&job.ID, &job.Type, &job.Payload, &job.SessionID, &job.UserID, &job.CreatedAt)
+		if err != nil {
+			return notFound(err)
+		}
+
+		now := time.Now().UTC()
+		if _, err := q.ExecContext(ctx, `UPDATE jobs SET status = 'running', started_at = ? WHERE id = ?`, now, job.ID); err != nil {
+			return err
+		}
+		job.Status = JobRunning
+		job.StartedAt = &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Finish termine un job : 'done' si errMsg est vide, 'failed' sinon
+func (r JobRepo) Finish(ctx context.Context, id int64, errMsg string) error {
+	status := JobDone
+	if errMsg != "" {
+		status = JobFailed
+	}
+	_, err := r.q.ExecContext(ctx,
+		`UPDATE jobs SET status = ?, finished_at = NOW(6), error_message = ? WHERE id = ?`,
+		status, errMsg, id,
+	)
+	return err
+}
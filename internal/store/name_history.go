@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// NameChange est un changement de login et/ou de display_name d'un compte
+type NameChange struct {
+	TwitchUserID   string
+	OldLogin       string
+	NewLogin       string
+	OldDisplayName string
+	NewDisplayName string
+	ChangedAt      time.Time
+}
+
+// Renamer est un chatter d'une session et son nombre de changements de nom
+type Renamer struct {
+	TwitchUserID string
+	Login        string
+	DisplayName  string
+	RenameCount  int64
+}
+
+// NameHistoryRepo accède à la table twitch_user_names
+type NameHistoryRepo struct {
+	q querier
+}
+
+// Record enregistre des changements de nom
+func (r NameHistoryRepo) Record(ctx context.Context, changes ...NameChange) error {
+	for _, chunk := range chunks(changes) {
+		args := make([]any, 0, 6*len(chunk))
+		for _, c := range chunk {
+			args = append(args, c.TwitchUserID, c.OldLogin, c.NewLogin, c.OldDisplayName, c.NewDisplayName, c.ChangedAt)
+		}
+		if _, err := r.q.ExecContext(ctx, `
+INSERT INTO twitch_user_names (twitch_user_id, old_login, new_login, old_display_name, new_display_name, changed_at)
+VALUES `+placeholders(len(chunk), 6), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForUser retourne l'historique d'un compte, le plus récent d'abord
+func (r NameHistoryRepo) ForUser(ctx context.Context, twitchUserID string) ([]NameChange, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT changed_at, old_login, new_login, old_display_name, new_display_name
+FROM twitch_user_names
+WHERE twitch_user_id = ?
+ORDER BY changed_at DESC, id DESC
+`, twitchUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []NameChange
+	for rows.Next() {
+		c := NameChange{TwitchUserID: twitchUserID}
+		if err := rows.Scan(&c.ChangedAt, &c.OldLogin, &c.NewLogin, &c.OldDisplayName, &c.NewDisplayName); err != nil {
+			return nil, err
+		}
+		history = append(history, c)
+	}
+	return history, rows.Err()
+}
+
+// FrequentRenamers retourne les chatters d'une session ayant changé de nom au moins minRenames fois
+func (r NameHistoryRepo) FrequentRenamers(ctx context.Context, sessionID int64, broadcasterIDs []string, minRenames, limit int) ([]Renamer, error) {
+	filter, args := broadcasterFilter("c.broadcaster_id", broadcasterIDs)
+	rows, err := r.q.QueryContext(ctx, `
+SELECT
+    tu.twitch_user_id,
+    tu.login,
+    tu.display_name,
+    COUNT(DISTINCT tun.id) as rename_count
+FROM twitch_users tu
+INNER JOIN twitch_user_keys k ON k.twitch_user_id = tu.twitch_user_id
+INNER JOIN capture_chatters cc ON cc.user_key = k.user_key
+INNER JOIN captures c ON c.id = cc.capture_id
+INNER JOIN twitch_user_names tun ON tun.twitch_user_id = tu.twitch_user_id
+WHERE c.session_id = ?`+filter+`
+GROUP BY tu.twitch_user_id, tu.login, tu.display_name
+HAVING rename_count >= ?
+ORDER BY rename_count DESC, tu.login ASC
+LIMIT ?
+`, append(append([]any{sessionID}, args...), minRenames, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var renamers []Renamer
+	for rows.Next() {
+		var rn Renamer
+		if err := rows.Scan(&rn.TwitchUserID, &rn.Login, &rn.DisplayName, &rn.RenameCount); err != nil {
+			return nil, err
+		}
+		renamers = append(renamers, rn)
+	}
+	return renamers, rows.Err()
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+)
+
+// ProfileSignals compte les profils typiques de bots parmi les chatters d'une session
+type ProfileSignals struct {
+	DefaultAvatar    int64 // avatar attribué par Twitch
+	EmptyDescription int64 // bio vide
+}
+
+// AvatarCluster est un groupe de chatters partageant la même image de profil (hors avatars par défaut)
+type AvatarCluster struct {
+	Hash            string
+	ProfileImageURL string
+	Count           int64
+}
+
+// sessionChatters est la sous-requête des comptes vus dans une session (filtre broadcasters inclus) ;
+// elle attend l'id de session suivi des arguments du filtre
+func sessionChatters(broadcasterIDs []string) (string, []any) {
+	filter, args := broadcasterFilter("c.broadcaster_id", broadcasterIDs)
+	return `
+SELECT k.twitch_user_id
+FROM capture_chatters cc
+JOIN captures c ON cc.capture_id = c.id
+JOIN twitch_user_keys k ON k.user_key = cc.user_key
+WHERE c.session_id = ?` + filter, args
+}
+
+// ProfileSignals compte les chatters actifs d'une session à l'avatar par défaut ou à la bio vide.
+// Les comptes enrichis avant le stockage des profils (colonnes NULL) ne sont pas comptés.
+func (r TwitchUserRepo) ProfileSignals(ctx context.Context, sessionID int64, broadcasterIDs []string) (ProfileSignals, error) {
+	chatters, args := sessionChatters(broadcasterIDs)
+	var s ProfileSignals
+	err := r.q.QueryRowContext(ctx, `
+SELECT
+    COALESCE(SUM(tu.default_avatar = 1), 0),
+    COALESCE(SUM(tu.description = ''), 0)
+FROM twitch_users tu
+WHERE tu.status = 'active' AND tu.twitch_user_id IN (`+chatters+`)
+`, append([]any{sessionID}, args...)...).Scan(&s.DefaultAvatar, &s.EmptyDescription)
+	return s, err
+}
+
+// AvatarClusters retourne les images de profil (hors avatars par défaut) partagées par au moins
+// minSize chatters d'une session, les plus partagées d'abord
+func (r TwitchUserRepo) AvatarClusters(ctx context.Context, sessionID int64, broadcasterIDs []string, minSize, limit int) ([]AvatarCluster, error) {
+	chatters, args := sessionChatters(broadcasterIDs)
+	rows, err := r.q.QueryContext(ctx, `
+SELECT tu.profile_image_hash, MIN(tu.profile_image_url), COUNT(*) AS cnt
+FROM twitch_users tu
+WHERE tu.default_avatar = 0
+  AND tu.profile_image_hash IS NOT NULL
+  AND tu.twitch_user_id IN (`+chatters+`)
+GROUP BY tu.profile_image_hash
+HAVING cnt >= ?
+ORDER BY cnt DESC, tu.profile_image_hash ASC
+LIMIT ?
+`, append(append([]any{sessionID}, args...), minSize, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clusters []AvatarCluster
+	for rows.Next() {
+		var c AvatarCluster
+		if err := rows.Scan(&c.Hash, &c.ProfileImageURL, &c.Count); err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, rows.Err()
+}
+
+// LoginsWithAvatar retourne les logins des chatters d'une session ayant l'image de profil hash
+func (r TwitchUserRepo) LoginsWithAvatar(ctx context.Context, sessionID int64, hash string, broadcasterIDs []string) ([]string, error) {
+	chatters, args := sessionChatters(broadcasterIDs)
+	rows, err := r.q.QueryContext(ctx, `
+SELECT tu.login
+FROM twitch_users tu
+WHERE tu.profile_image_hash = ? AND tu.twitch_user_id IN (`+chatters+`)
+ORDER BY tu.login ASC
+`, append([]any{hash, sessionID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logins []string
+	for rows.Next() {
+		var login string
+		if err := rows.Scan(&login); err != nil {
+			return nil, err
+		}
+		logins = append(logins, login)
+	}
+	return logins, rows.Err()
+}
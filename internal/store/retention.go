@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Politiques de rétention : chacune purge une table
+const (
+	PurgeWebSessions = "web_sessions"       // sessions web expirées
+	PurgeSessions    = "sessions"           // sessions d'analyse non sauvegardées expirées (captures, chat et followers en cascade)
+	PurgeJobs        = "jobs"               // jobs terminés
+	PurgeTwitchUsers = "twitch_users"       // comptes qu'aucune capture ni liste de followers ne référence plus
+	PurgeNameHistory = "twitch_user_names"  // historique de noms des comptes purgés
+	PurgeUserKeys    = "twitch_user_keys"   // clés des comptes purgés que plus rien ne référence
+	PurgeDeliveries  = "webhook_deliveries" // journal des livraisons de webhooks terminées
+	PurgeAlerts      = "alerts"             // alertes acquittées
+	PurgeEventSub    = "eventsub_events"    // notifications EventSub reçues
+)
+
+// purgeRule est la table d'une politique, sa clé primaire (id par défaut), la condition
+// (paramètre : date limite) des lignes à purger et, le cas échéant, la suppression des lignes
+// qui en dépendent
+type purgeRule struct {
+	table   string
+	key     string
+	where   string
+	cascade func(ctx context.Context, q querier, id int64) error
+}
+
+var purgeRules = map[string]purgeRule{
+	PurgeWebSessions: {table: "web_sessions", where: `expires_at < ?`},
+	PurgeSessions:    {table: "sessions", where: `status <> 'saved' AND expires_at < ?`, cascade: deleteSessionData},
+	PurgeJobs:        {table: "jobs", where: `status IN ('done','failed') AND finished_at < ?`},
+	PurgeTwitchUsers: {table: "twitch_users", where: `last_fetched_at < ?
+  AND NOT EXISTS (
+    SELECT 1 FROM capture_chatters cc
+    JOIN twitch_user_keys k ON k.user_key = cc.user_key
+    WHERE k.twitch_user_id = twitch_users.twitch_user_id
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM channel_followers cf
+    JOIN twitch_user_keys k ON k.user_key = cf.user_key
+    WHERE k.twitch_user_id = twitch_users.twitch_user_id
+  )`},
+	PurgeNameHistory: {table: "twitch_user_names", where: `changed_at < ?
+  AND NOT EXISTS (SELECT 1 FROM twitch_users tu WHERE tu.twitch_user_id = twitch_user_names.twitch_user_id)`},
+	// Clés sans date : une clé est purgée quand son compte n'est plus en cache (ou est périmé)
+	// et qu'aucune capture, liste de followers ni activité du chat ne la référence
+	PurgeUserKeys: {table: "twitch_user_keys", key: "user_key", where: `NOT EXISTS (
+    SELECT 1 FROM twitch_users tu
+    WHERE tu.twitch_user_id = twitch_user_keys.twitch_user_id AND tu.last_fetched_at >= ?
+  )
+  AND NOT EXISTS (SELECT 1 FROM capture_chatters cc WHERE cc.user_key = twitch_user_keys.user_key)
+  AND NOT EXISTS (SELECT 1 FROM channel_followers cf WHERE cf.user_key = twitch_user_keys.user_key)
+  AND NOT EXISTS (SELECT 1 FROM chat_activity a WHERE a.user_key = twitch_user_keys.user_key)`},
+	PurgeDeliveries: {table: "webhook_deliveries", where: `status <> 'pending' AND created_at < ?`},
+	PurgeAlerts:     {table: "alerts", where: `acknowledged_at IS NOT NULL AND triggered_at < ?`},
+	PurgeEventSub:   {table: "eventsub_events", where: `received_at < ?`},
+}
+
+// RetentionRepo purge les lignes périmées selon les politiques de rétention
+type RetentionRepo struct {
+	q querier
+}
+
+func purgeRuleFor(policy string) (purgeRule, error) {
+	rule, ok := purgeRules[policy]
+	if !ok {
+		return purgeRule{}, fmt.Errorf("store: unknown retention policy %q", policy)
+	}
+	if rule.key == "" {
+		rule.key = "id"
+	}
+	return rule, nil
+}
+
+// Count retourne le nombre de lignes que la politique purgerait (mode dry-run)
+func (r RetentionRepo) Count(ctx context.Context, policy string, before time.Time) (int64, error) {
+	rule, err := purgeRuleFor(policy)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	err = r.q.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+rule.table+` WHERE `+rule.where, before).Scan(&n)
+	return n, err
+}
+
+// PurgeBatch supprime au plus limit lignes de la politique antérieures à before (et les lignes
+// qui en dépendent) dans une transaction, et retourne le nombre de lignes supprimées.
+// Un compte purgé alors qu'il vient d'être revu en capture est simplement réenrichi.
+func (r RetentionRepo) PurgeBatch(ctx context.Context, policy string, before time.Time, limit int) (int64, error) {
+	rule, err := purgeRuleFor(policy)
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	err = inTx(ctx, r.q, func(q querier) error {
+		rows, err := q.QueryContext(ctx,
+			`SELECT `+rule.key+` FROM `+rule.table+` WHERE `+rule.where+` ORDER BY `+rule.key+` ASC LIMIT ? FOR UPDATE`,
+			before, min(limit, batchSize),
+		)
+		if err != nil {
+			return err
+		}
+		var ids []any
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil || len(ids) == 0 {
+			return err
+		}
+
+		if rule.cascade != nil {
+			for _, id := range ids {
+				if err := rule.cascade(ctx, q, id.(int64)); err != nil {
+					return err
+				}
+			}
+		}
+
+		res, err := q.ExecContext(ctx,
+			`DELETE FROM `+rule.table+` WHERE `+rule.key+` IN (?`+strings.Repeat(",?", len(ids)-1)+`)`,
+			ids...,
+		)
+		if err != nil {
+			return err
+		}
+		deleted, err = res.RowsAffected()
+		return err
+	})
+	return deleted, err
+}
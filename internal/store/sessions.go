@@ -0,0 +1,235 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Statuts d'une session d'analyse
+const (
+	SessionActive  = "active"
+	SessionSaved   = "saved"
+	SessionExpired = "expired"
+	SessionDeleted = "deleted"
+)
+
+// Session est une session d'analyse : un ensemble de captures d'un utilisateur
+type Session struct {
+	ID        int64
+	UUID      string
+	UserID    int64
+	Status    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UpdatedAt time.Time
+}
+
+// SessionRepo accède à la table sessions
+type SessionRepo struct {
+	q querier
+}
+
+const sessionColumns = `id, session_uuid, user_id, status, created_at, expires_at, updated_at`
+
+func scanSession(row interface{ Scan(...any) error }) (*Session, error) {
+	var s Session
+	if err := row.Scan(&s.ID, &s.UUID, &s.UserID, &s.Status, &s.CreatedAt, &s.ExpiresAt, &s.UpdatedAt); err != nil {
+		return nil, notFound(err)
+	}
+	return &s, nil
+}
+
+// Create enregistre une session et retourne son id
+func (r SessionRepo) Create(ctx context.Context, s Session) (int64, error) {
+	res, err := r.q.ExecContext(ctx, `
+INSERT INTO sessions (session_uuid, user_id, status, created_at, expires_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?)
+`, s.UUID, s.UserID, s.Status, s.CreatedAt, s.ExpiresAt, s.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// Active retourne la session active non expirée la plus récente d'un utilisateur
+func (r SessionRepo) Active(ctx context.Context, userID int64) (*Session, error) {
+	return scanSession(r.q.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? AND status = 'active' AND expires_at > NOW(6) ORDER BY created_at DESC LIMIT 1`,
+		userID,
+	))
+}
+
+// HasActive indique si l'utilisateur a une session active non expirée
+func (r SessionRepo) HasActive(ctx context.Context, userID int64) (bool, error) {
+	var count int
+	err := r.q.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sessions WHERE user_id = ? AND status = 'active' AND expires_at > NOW(6)`,
+		userID,
+	).Scan(&count)
+	return count > 0, err
+}
+
+// ExpireOverdue passe en 'expired' les sessions actives d'un utilisateur dont expires_at est dépassé
+func (r SessionRepo) ExpireOverdue(ctx context.Context, userID int64) (int64, error) {
+	res, err := r.q.ExecContext(ctx,
+		`UPDATE sessions SET status = 'expired', updated_at = NOW(6) WHERE user_id = ? AND status = 'active' AND expires_at <= NOW(6)`,
+		userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ByID retourne une session quel que soit son propriétaire
+func (r SessionRepo) ByID(ctx context.Context, id int64) (*Session, error) {
+	return scanSession(r.q.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`,
+		id,
+	))
+}
+
+// ByUUID retourne une session quel que soit son propriétaire
+func (r SessionRepo) ByUUID(ctx context.Context, sessionUUID string) (*Session, error) {
+	return scanSession(r.q.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE session_uuid = ? LIMIT 1`,
+		sessionUUID,
+	))
+}
+
+// Saved retourne une session sauvegardée appartenant à l'utilisateur
+func (r SessionRepo) Saved(ctx context.Context, userID int64, sessionUUID string) (*Session, error) {
+	return scanSession(r.q.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? AND session_uuid = ? AND status = 'saved' LIMIT 1`,
+		userID, sessionUUID,
+	))
+}
+
+// ListSaved retourne les sessions sauvegardées d'un utilisateur, les plus récentes d'abord
+func (r SessionRepo) ListSaved(ctx context.Context, userID int64) ([]Session, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? AND status = 'saved' ORDER BY updated_at DESC, id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
+}
+
+// SetStatus change le statut d'une session
+func (r SessionRepo) SetStatus(ctx context.Context, id int64, status string) error {
+	_, err := r.q.ExecContext(ctx, `UPDATE sessions SET status = ?, updated_at = NOW(6) WHERE id = ?`, status, id)
+	return err
+}
+
+// Save passe la session active id en 'saved' si l'utilisateur a moins de quota sessions
+// sauvegardées. Sinon, avec evict, les plus anciennes (par updated_at) sont supprimées pour
+// faire de la place et retournées ; sans evict, ErrQuotaExceeded est retournée.
+func (r SessionRepo) Save(ctx context.Context, id, userID int64, quota int, evict bool) ([]Session, error) {
+	var evicted []Session
+	err := inTx(ctx, r.q, func(q querier) error {
+		// Verrouille les sessions sauvegardées : deux sauvegardes simultanées ne dépassent pas le quota
+		rows, err := q.QueryContext(ctx,
+			`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? AND status = 'saved' ORDER BY updated_at ASC, id ASC FOR UPDATE`,
+			userID,
+		)
+		if err != nil {
+			return err
+		}
+		var saved []Session
+		for rows.Next() {
+			s, err := scanSession(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			saved = append(saved, *s)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if excess := len(saved) - quota + 1; excess > 0 {
+			if !evict {
+				return ErrQuotaExceeded
+			}
+			evicted = saved[:min(excess, len(saved))]
+			for _, s := range evicted {
+				if err := (SessionRepo{q: q}).Delete(ctx, s.ID); err != nil {
+					return err
+				}
+			}
+		}
+
+		res, err := q.ExecContext(ctx,
+			`UPDATE sessions SET status = 'saved', updated_at = NOW(6) WHERE id = ? AND user_id = ? AND status = 'active'`,
+			id, userID,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return evicted, nil
+}
+
+// Purge supprime les captures, l'activité du chat et les followers d'une session et la marque 'deleted'
+func (r SessionRepo) Purge(ctx context.Context, id int64) error {
+	return inTx(ctx, r.q, func(q querier) error {
+		if err := deleteSessionData(ctx, q, id); err != nil {
+			return err
+		}
+		return SessionRepo{q: q}.SetStatus(ctx, id, SessionDeleted)
+	})
+}
+
+// Delete supprime une session, toutes ses captures, l'activité de son chat et ses followers
+func (r SessionRepo) Delete(ctx context.Context, id int64) error {
+	return inTx(ctx, r.q, func(q querier) error {
+		if err := deleteSessionData(ctx, q, id); err != nil {
+			return err
+		}
+		_, err := q.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, id)
+		return err
+	})
+}
+
+// deleteSessionData supprime l'activité du chat, les followers, capture_chatters puis captures d'une session
+func deleteSessionData(ctx context.Context, q querier, sessionID int64) error {
+	for _, table := range []string{"chat_fingerprints", "chat_activity", "chat_channels", "channel_followers", "follower_fetches"} {
+		if _, err := q.ExecContext(ctx, `DELETE FROM `+table+` WHERE session_id = ?`, sessionID); err != nil {
+			return err
+		}
+	}
+	if _, err := q.ExecContext(ctx, `
+DELETE cc FROM capture_chatters cc
+JOIN captures c ON cc.capture_id = c.id
+WHERE c.session_id = ?
+`, sessionID); err != nil {
+		return err
+	}
+	_, err := q.ExecContext(ctx, `DELETE FROM captures WHERE session_id = ?`, sessionID)
+	return err
+}
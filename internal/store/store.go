@@ -0,0 +1,224 @@
+// Package store regroupe l'accès à la base MySQL/MariaDB partagé par les services.
+//
+// Chaque table (ou groupe de tables) a son dépôt typé : Sessions, Captures, Chatters,
+// TwitchUsers, NameHistory, Jobs, WebSessions, Users, APITokens, Webhooks, Alerts, EventSub,
+// Chat, Followers, Retention et Audit.
+// Le SQL du schéma ne doit apparaître qu'ici ; le schéma lui-même est défini par internal/migrate.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/env"
+)
+
+// ErrNotFound est retournée quand la ligne demandée n'existe pas
+var ErrNotFound = errors.New("store: not found")
+
+// ErrQuotaExceeded est retournée quand l'utilisateur a atteint son quota de sessions sauvegardées
+var ErrQuotaExceeded = errors.New("store: saved sessions quota exceeded")
+
+// Config décrit la connexion à la base
+type Config struct {
+	User     string
+	Password string
+	Host     string
+	Port     string
+	Name     string
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// ConfigFromEnv lit la configuration depuis DB_USER, DB_PASSWORD, DB_HOST, DB_PORT, DB_NAME,
+// DB_MAX_OPEN_CONNS et DB_MAX_IDLE_CONNS
+func ConfigFromEnv() Config {
+	return Config{
+		User:            env.Get("DB_USER", "twitch"),
+		Password:        env.Get("DB_PASSWORD", "twitchpass"),
+		Host:            env.Get("DB_HOST", "db"),
+		Port:            env.Get("DB_PORT", "3306"),
+		Name:            env.Get("DB_NAME", "twitch_chatters"),
+		MaxOpenConns:    env.Int("DB_MAX_OPEN_CONNS", 10),
+		MaxIdleConns:    env.Int("DB_MAX_IDLE_CONNS", 5),
+		ConnMaxLifetime: 30 * time.Minute,
+	}
+}
+
+// DSN retourne le DSN go-sql-driver/mysql de la configuration
+func (c Config) DSN() string {
+	cfg := mysql.NewConfig()
+	cfg.User = c.User
+	cfg.Passwd = c.Password
+	cfg.Net = "tcp"
+	cfg.Addr = c.Host + ":" + c.Port
+	cfg.DBName = c.Name
+	cfg.ParseTime = true
+	cfg.Collation = "utf8mb4_unicode_ci"
+	cfg.Params = map[string]string{"charset": "utf8mb4"}
+	return cfg.FormatDSN()
+}
+
+// batchSize borne le nombre de lignes d'un INSERT multi-lignes (et d'une liste IN) :
+// reste loin de la limite de 65535 placeholders et de max_allowed_packet
+const batchSize = 1000
+
+// querier est implémenté par *sql.DB et *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// Store donne accès aux dépôts
+type Store struct {
+	db *sql.DB
+	q  querier // db, ou la transaction d'InTx
+
+	Sessions    SessionRepo
+	Captures    CaptureRepo
+	Chatters    ChatterRepo
+	TwitchUsers TwitchUserRepo
+	NameHistory NameHistoryRepo
+	Jobs        JobRepo
+	WebSessions WebSessionRepo
+	Users       UserRepo
+	APITokens   APITokenRepo
+	Webhooks    WebhookRepo
+	Alerts      AlertRepo
+	EventSub    EventSubRepo
+	Chat        ChatRepo
+	Followers   FollowerRepo
+	Retention   RetentionRepo
+	Audit       AuditRepo
+}
+
+// Open ouvre la base décrite par cfg et vérifie la connexion
+func Open(ctx context.Context, cfg Config) (*Store, error) {
+	db, err := sql.Open("mysql", cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return New(db), nil
+}
+
+// New construit un Store autour d'une connexion existante
+func New(db *sql.DB) *Store {
+	return newStore(db, db)
+}
+
+// newStore construit les dépôts autour de q (la connexion ou une transaction)
+func newStore(db *sql.DB, q querier) *Store {
+	s := &Store{db: db, q: q}
+	s.Sessions = SessionRepo{q: q}
+	s.Captures = CaptureRepo{q: q}
+	s.Chatters = ChatterRepo{q: q}
+	s.TwitchUsers = TwitchUserRepo{q: q}
+	s.NameHistory = NameHistoryRepo{q: q}
+	s.Jobs = JobRepo{q: q}
+	s.WebSessions = WebSessionRepo{q: q}
+	s.Users = UserRepo{q: q}
+	s.APITokens = APITokenRepo{q: q}
+	s.Webhooks = WebhookRepo{q: q}
+	s.Alerts = AlertRepo{q: q}
+	s.EventSub = EventSubRepo{q: q}
+	s.Chat = ChatRepo{q: q}
+	s.Followers = FollowerRepo{q: q}
+	s.Retention = RetentionRepo{q: q}
+	s.Audit = AuditRepo{q: q}
+	return s
+}
+
+// InTx exécute fn avec un Store dont tous les dépôts partagent une même transaction, validée
+// si fn ne retourne pas d'erreur et annulée sinon (dans une transaction : fn l'utilise)
+func (s *Store) InTx(ctx context.Context, fn func(tx *Store) error) error {
+	return inTx(ctx, s.q, func(q querier) error {
+		return fn(newStore(s.db, q))
+	})
+}
+
+// DB retourne la connexion sous-jacente
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// Ping vérifie la connexion (healthz)
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close ferme la connexion
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// inTx exécute fn dans une transaction, ou directement si q en est déjà une
+func inTx(ctx context.Context, q querier, fn func(q querier) error) error {
+	db, ok := q.(*sql.DB)
+	if !ok {
+		return fn(q)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// broadcasterFilter retourne la condition SQL (vide sans filtre) et ses arguments
+// pour limiter une requête aux captures des broadcasters donnés
+func broadcasterFilter(column string, broadcasterIDs []string) (string, []any) {
+	if len(broadcasterIDs) == 0 {
+		return "", nil
+	}
+	args := make([]any, 0, len(broadcasterIDs))
+	for _, id := range broadcasterIDs {
+		args = append(args, strings.TrimSpace(id))
+	}
+	return fmt.Sprintf(" AND %s IN (?%s)", column, strings.Repeat(",?", len(broadcasterIDs)-1)), args
+}
+
+// placeholders retourne "(?,?),(?,?)..." pour rows lignes de cols colonnes
+func placeholders(rows, cols int) string {
+	row := "(?" + strings.Repeat(",?", cols-1) + ")"
+	return row + strings.Repeat(","+row, rows-1)
+}
+
+// chunks découpe items en tranches d'au plus batchSize éléments
+func chunks[T any](items []T) [][]T {
+	var out [][]T
+	for start := 0; start < len(items); start += batchSize {
+		out = append(out, items[start:min(start+batchSize, len(items))])
+	}
+	return out
+}
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
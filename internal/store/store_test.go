@@ -0,0 +1,1456 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/migrate"
+)
+
+func TestConfigDSN(t *testing.T) {
+	cfg := Config{User: "twitch", Password: "p@ss", Host: "db", Port: "3306", Name: "twitch_chatters"}
+	parsed, err := mysql.ParseDSN(cfg.DSN())
+	if err != nil {
+		t.Fatalf("ParseDSN(%q): %v", cfg.DSN(), err)
+	}
+	if parsed.User != "twitch" || parsed.Passwd != "p@ss" || parsed.Addr != "db:3306" || parsed.DBName != "twitch_chatters" {
+		t.Fatalf("unexpected DSN config: %+v", parsed)
+	}
+	if !parsed.ParseTime || parsed.Collation != "utf8mb4_unicode_ci" {
+		t.Fatalf("parseTime/collation not set: %+v", parsed)
+	}
+}
+
+// openTestStore crée une base jetable migrée. Ignoré sans TCA_TEST_MYSQL_DSN
+// (voir test/integration pour le format).
+func openTestStore(t testing.TB) *Store {
+	t.Helper()
+
+	dsn := os.Getenv("TCA_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TCA_TEST_MYSQL_DSN not set")
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("invalid TCA_TEST_MYSQL_DSN: %v", err)
+	}
+	cfg.ParseTime = true
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	name := "tca_store_" + hex.EncodeToString(suffix)
+
+	cfg.DBName = ""
+	admin, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+	if _, err := admin.Exec("CREATE DATABASE " + name + " CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci"); err != nil {
+		t.Fatalf("cannot create database: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP DATABASE " + name); err != nil {
+			t.Logf("cannot drop database %s: %v", name, err)
+		}
+	})
+
+	cfg.DBName = name
+	r, err := migrate.Open(cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return New(db)
+}
+
+// seedSession crée un utilisateur, une session web et une session d'analyse active
+func seedSession(t testing.TB, st *Store) (userID int64, session *Session) {
+	t.Helper()
+	ctx := context.Background()
+
+	userID, err := st.Users.Upsert(ctx, User{TwitchUserID: "2000", Login: "mod", DisplayName: "Mod"})
+	if err != nil {
+		t.Fatalf("Users.Upsert: %v", err)
+	}
+	now := time.Now().UTC()
+	if err := st.WebSessions.Create(ctx, WebSession{
+		SessionID: "web-1", UserID: userID, AccessToken: "token-1", Scopes: []string{"a", "b"},
+		CreatedAt: now, LastActivityAt: now, ExpiresAt: now.Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("WebSessions.Create: %v", err)
+	}
+	id, err := st.Sessions.Create(ctx, Session{
+		UUID: "sess-1", UserID: userID, Status: SessionActive,
+		CreatedAt: now, ExpiresAt: now.Add(24 * time.Hour), UpdatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("Sessions.Create: %v", err)
+	}
+	session, err = st.Sessions.ByUUID(ctx, "sess-1")
+	if err != nil || session.ID != id {
+		t.Fatalf("Sessions.ByUUID: %v (%+v)", err, session)
+	}
+	return userID, session
+}
+
+func TestUsersAndWebSessions(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	userID, session := seedSession(t, st)
+
+	// Un second upsert du même compte garde l'id interne
+	again, err := st.Users.Upsert(ctx, User{TwitchUserID: "2000", Login: "mod2", DisplayName: "Mod2"})
+	if err != nil || again != userID {
+		t.Fatalf("second Upsert = %d, %v; want %d", again, err, userID)
+	}
+
+	u, err := st.Users.ByWebSession(ctx, "web-1")
+	if err != nil || u.ID != userID || u.Login != "mod2" {
+		t.Fatalf("ByWebSession = %+v, %v", u, err)
+	}
+	ws, err := st.WebSessions.Get(ctx, "web-1")
+	if err != nil || ws.AccessToken != "token-1" || len(ws.Scopes) != 2 {
+		t.Fatalf("WebSessions.Get = %+v, %v", ws, err)
+	}
+	if ws, err := st.WebSessions.ForAnalysisSession(ctx, session.ID); err != nil || ws.SessionID != "web-1" || ws.AccessToken != "token-1" {
+		t.Fatalf("ForAnalysisSession = %+v, %v", ws, err)
+	}
+	if err := st.WebSessions.UpdateTokens(ctx, "web-1", "token-2", "refresh-2"); err != nil {
+		t.Fatal(err)
+	}
+	if ws, err := st.WebSessions.Latest(ctx, userID); err != nil || ws.AccessToken != "token-2" || ws.RefreshToken != "refresh-2" {
+		t.Fatalf("Latest after UpdateTokens = %+v, %v", ws, err)
+	}
+
+	if err := st.WebSessions.Delete(ctx, "web-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.WebSessions.Get(ctx, "web-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete: %v, want ErrNotFound", err)
+	}
+	if _, err := st.Users.ByWebSession(ctx, "web-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ByWebSession after Delete: %v, want ErrNotFound", err)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	userID, _ := seedSession(t, st)
+
+	now := time.Now().UTC()
+	tok := APIToken{UserID: userID, Name: "bot", TokenHash: strings.Repeat("a", 64), TokenPrefix: "tca_aaaa",
+		Scopes: []string{"analysis:read", "capture"}, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	id, err := st.APITokens.Create(ctx, tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := tok
+	expired.TokenHash, expired.ExpiresAt = strings.Repeat("b", 64), now.Add(-time.Hour)
+	if _, err := st.APITokens.Create(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+
+	got, u, err := st.APITokens.Authenticate(ctx, tok.TokenHash)
+	if err != nil || got.ID != id || u.ID != userID || len(got.Scopes) != 2 {
+		t.Fatalf("Authenticate = %+v, %+v, %v", got, u, err)
+	}
+	if _, _, err := st.APITokens.Authenticate(ctx, expired.TokenHash); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Authenticate(expired) = %v, want ErrNotFound", err)
+	}
+
+	tokens, err := st.APITokens.ListByUser(ctx, userID)
+	if err != nil || len(tokens) != 2 {
+		t.Fatalf("ListByUser = %d tokens, %v", len(tokens), err)
+	}
+	for _, tk := range tokens {
+		if tk.ID == id && (tk.LastUsedAt == nil || !tk.Active()) {
+			t.Errorf("used token = %+v, want active with last_used_at", tk)
+		}
+		if tk.ID != id && tk.Active() {
+			t.Errorf("expired token reported active")
+		}
+	}
+
+	if err := st.APITokens.Revoke(ctx, userID+1, id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Revoke by another user = %v, want ErrNotFound", err)
+	}
+	if err := st.APITokens.Revoke(ctx, userID, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := st.APITokens.Authenticate(ctx, tok.TokenHash); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Authenticate(revoked) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	userID, _ := seedSession(t, st)
+
+	hook := Webhook{UserID: userID, Name: "discord", URL: "https://example.com/hook", Format: WebhookFormatDiscord,
+		Secret: strings.Repeat("a", 64), Events: []string{WebhookCaptureFinished, WebhookJobFailed},
+		CreationBurstThreshold: 50, SuspiciousThreshold: 10, Enabled: true, CreatedAt: time.Now().UTC()}
+	id, err := st.Webhooks.Create(ctx, hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if subs, err := st.Webhooks.Subscribers(ctx, userID, WebhookJobFailed); err != nil || len(subs) != 1 || subs[0].ID != id {
+		t.Fatalf("Subscribers(job_failed) = %+v, %v", subs, err)
+	}
+	if subs, _ := st.Webhooks.Subscribers(ctx, userID, WebhookCreationBurst); len(subs) != 0 {
+		t.Errorf("Subscribers(creation_burst) = %+v, want none", subs)
+	}
+	if err := st.Webhooks.SetEnabled(ctx, userID+1, id, false); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("SetEnabled by another user = %v, want ErrNotFound", err)
+	}
+	if err := st.Webhooks.SetEnabled(ctx, userID, id, false); err != nil {
+		t.Fatal(err)
+	}
+	if subs, _ := st.Webhooks.Subscribers(ctx, userID, WebhookTest); len(subs) != 0 {
+		t.Errorf("disabled webhook still subscribed: %+v", subs)
+	}
+
+	// Livraison : créée avec le job de sa première tentative
+	deliveryID, err := st.Webhooks.CreateDelivery(ctx, id, WebhookTest, []byte(`{"content":"test"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := st.Jobs.ClaimNext(ctx)
+	if err != nil || job.Type != JobDeliverWebhook {
+		t.Fatalf("ClaimNext = %+v, %v", job, err)
+	}
+	var payload DeliverWebhookPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil || payload.DeliveryID != deliveryID {
+		t.Fatalf("job payload = %s, %v", job.Payload, err)
+	}
+
+	// Nouvelle tentative planifiée : pas encore réclamable
+	if err := st.Webhooks.RecordAttempt(ctx, deliveryID, DeliveryPending, 500, "webhook responded with status 500"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Jobs.EnqueueAt(ctx, JobDeliverWebhook, payload, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Jobs.ClaimNext(ctx); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ClaimNext before run_after = %v, want ErrNotFound", err)
+	}
+
+	if err := st.Webhooks.RecordAttempt(ctx, deliveryID, DeliveryDelivered, 204, ""); err != nil {
+		t.Fatal(err)
+	}
+	d, w, err := st.Webhooks.Delivery(ctx, deliveryID)
+	if err != nil || w.ID != id || d.Status != DeliveryDelivered || d.Attempts != 2 || d.ResponseStatus == nil ||
+		*d.ResponseStatus != 204 || d.LastError != "" || d.DeliveredAt == nil {
+		t.Fatalf("Delivery = %+v, %+v, %v", d, w, err)
+	}
+	if list, err := st.Webhooks.ListDeliveries(ctx, userID, 10); err != nil || len(list) != 1 || list[0].WebhookName != "discord" {
+		t.Fatalf("ListDeliveries = %+v, %v", list, err)
+	}
+
+	if err := st.Webhooks.Delete(ctx, userID+1, id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Delete by another user = %v, want ErrNotFound", err)
+	}
+	if err := st.Webhooks.Delete(ctx, userID, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := st.Webhooks.Delivery(ctx, deliveryID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Delivery after Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	userID, session := seedSession(t, st)
+
+	// 4 chatters dont 3 enrichis : 2 comptes récents créés le même jour, 1 avatar par défaut
+	captureID, err := st.Captures.Create(ctx, Capture{SessionID: session.ID, BroadcasterID: "1000", BroadcasterLogin: "streamer", CapturedAt: time.Now().UTC()}, []string{"1", "2", "3", "4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent := time.Now().UTC().AddDate(0, 0, -2).Truncate(24 * time.Hour).Add(12 * time.Hour)
+	old := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := st.TwitchUsers.Upsert(ctx, []TwitchUser{
+		{TwitchUserID: "1", Login: "alpha", DisplayName: "Alpha", CreatedAt: &recent},
+		{TwitchUserID: "2", Login: "bravo", DisplayName: "Bravo", CreatedAt: &recent, DefaultAvatar: true},
+		{TwitchUserID: "3", Login: "charlie", DisplayName: "Charlie", CreatedAt: &old},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := st.TwitchUsers.CaptureStats(ctx, captureID)
+	if err != nil || stats.Chatters != 4 || stats.Known != 3 || stats.DefaultAvatars != 1 ||
+		stats.TopDay == nil || !stats.TopDay.Equal(recent.Truncate(24*time.Hour)) || stats.TopDayAccounts != 2 {
+		t.Fatalf("CaptureStats = %+v, %v", stats, err)
+	}
+	if n, err := st.TwitchUsers.CaptureRecentAccounts(ctx, captureID, time.Now().AddDate(0, 0, -7)); err != nil || n != 2 {
+		t.Fatalf("CaptureRecentAccounts = %d, %v, want 2", n, err)
+	}
+
+	ruleID, err := st.Alerts.CreateRule(ctx, AlertRule{UserID: userID, BroadcasterID: "1000", BroadcasterLogin: "streamer",
+		Metric: AlertRecentAccountsPct, Threshold: 15, WindowDays: 7, Enabled: true, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules, err := st.Alerts.RulesFor(ctx, userID, "1000"); err != nil || len(rules) != 1 || rules[0].Threshold != 15 {
+		t.Fatalf("RulesFor = %+v, %v", rules, err)
+	}
+	if rules, _ := st.Alerts.RulesFor(ctx, userID, "other"); len(rules) != 0 {
+		t.Errorf("RulesFor(other) = %+v, want none", rules)
+	}
+
+	alertID, err := st.Alerts.CreateAlert(ctx, Alert{RuleID: &ruleID, UserID: userID, SessionID: session.ID, CaptureID: captureID,
+		BroadcasterID: "1000", BroadcasterLogin: "streamer", Metric: AlertRecentAccountsPct, Threshold: 15, WindowDays: 7,
+		Value: 66.6, Details: json.RawMessage(`{"recent_accounts":2}`), TriggeredAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts, err := st.Alerts.Unacknowledged(ctx, userID); err != nil || counts["1000"] != 1 {
+		t.Fatalf("Unacknowledged = %v, %v", counts, err)
+	}
+
+	// Suppression de la règle : l'alerte est conservée, détachée
+	if err := st.Alerts.DeleteRule(ctx, userID+1, ruleID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("DeleteRule by another user = %v, want ErrNotFound", err)
+	}
+	if err := st.Alerts.DeleteRule(ctx, userID, ruleID); err != nil {
+		t.Fatal(err)
+	}
+	alerts, err := st.Alerts.ListAlerts(ctx, userID, true, 10)
+	if err != nil || len(alerts) != 1 || alerts[0].ID != alertID || alerts[0].RuleID != nil || alerts[0].SessionUUID != "sess-1" {
+		t.Fatalf("ListAlerts = %+v, %v", alerts, err)
+	}
+	var details struct {
+		RecentAccounts int `json:"recent_accounts"`
+	}
+	if err := json.Unmarshal(alerts[0].Details, &details); err != nil || details.RecentAccounts != 2 {
+		t.Errorf("alert details = %s, %v", alerts[0].Details, err)
+	}
+
+	if err := st.Alerts.Acknowledge(ctx, userID+1, alertID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Acknowledge by another user = %v, want ErrNotFound", err)
+	}
+	if err := st.Alerts.Acknowledge(ctx, userID, alertID); err != nil {
+		t.Fatal(err)
+	}
+	if alerts, _ := st.Alerts.ListAlerts(ctx, userID, true, 10); len(alerts) != 0 {
+		t.Errorf("unacknowledged alerts after Acknowledge = %+v", alerts)
+	}
+	if alerts, _ := st.Alerts.ListAlerts(ctx, userID, false, 10); len(alerts) != 1 || alerts[0].AcknowledgedAt == nil {
+		t.Errorf("ListAlerts after Acknowledge = %+v", alerts)
+	}
+}
+
+func TestEventSub(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	userID, session := seedSession(t, st)
+	otherID, err := st.Users.Upsert(ctx, User{TwitchUserID: "3000", Login: "other", DisplayName: "Other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, err := st.Users.ByID(ctx, userID); err != nil || u.TwitchUserID != "2000" {
+		t.Fatalf("Users.ByID = %+v, %v", u, err)
+	}
+
+	// Deux utilisateurs partagent l'abonnement Twitch du raid
+	sub := EventSubSubscription{UserID: userID, BroadcasterID: "1000", BroadcasterLogin: "streamer", Type: "channel.raid",
+		CaptureOffsets: []time.Duration{0, 2 * time.Minute}, TwitchSubscriptionID: "tw-1",
+		Status: "webhook_callback_verification_pending", CreatedAt: time.Now().UTC()}
+	id, err := st.EventSub.Create(ctx, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if twitchID, status, err := st.EventSub.Shared(ctx, "channel.raid", "1000", ""); err != nil || twitchID != "tw-1" || status != sub.Status {
+		t.Fatalf("Shared = %q, %q, %v", twitchID, status, err)
+	}
+	if _, _, err := st.EventSub.Shared(ctx, "stream.online", "1000", ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Shared(stream.online) = %v, want ErrNotFound", err)
+	}
+	sub.UserID, sub.CaptureOffsets = otherID, nil
+	otherSubID, err := st.EventSub.Create(ctx, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := st.EventSub.Exists(ctx, userID, "1000", "channel.raid"); err != nil || !exists {
+		t.Fatalf("Exists = %v, %v", exists, err)
+	}
+	if n, err := st.EventSub.SetStatus(ctx, "tw-1", "enabled"); err != nil || n != 2 {
+		t.Fatalf("SetStatus = %d, %v, want 2 rows", n, err)
+	}
+	subs, err := st.EventSub.ByTwitchID(ctx, "tw-1")
+	if err != nil || len(subs) != 2 || subs[0].ID != id || subs[0].Status != "enabled" ||
+		len(subs[0].CaptureOffsets) != 2 || subs[0].CaptureOffsets[1] != 2*time.Minute || len(subs[1].CaptureOffsets) != 0 {
+		t.Fatalf("ByTwitchID = %+v, %v", subs, err)
+	}
+
+	// Une notification n'est enregistrée qu'une fois par message
+	event := EventSubEvent{MessageID: "msg-1", TwitchSubscriptionID: "tw-1", Type: "channel.raid", BroadcasterID: "1000",
+		Event: json.RawMessage(`{"viewers":42}`), ReceivedAt: time.Now().UTC()}
+	eventID, created, err := st.EventSub.RecordEvent(ctx, event)
+	if err != nil || !created {
+		t.Fatalf("RecordEvent = %v, %v", created, err)
+	}
+	if _, created, err := st.EventSub.RecordEvent(ctx, event); err != nil || created {
+		t.Fatalf("RecordEvent(replay) = %v, %v, want not created", created, err)
+	}
+	if err := st.EventSub.SetEventCaptures(ctx, eventID, 2); err != nil {
+		t.Fatal(err)
+	}
+	events, err := st.EventSub.ListEvents(ctx, userID, 10)
+	if err != nil || len(events) != 1 || events[0].Captures != 2 || events[0].BroadcasterLogin != "streamer" {
+		t.Fatalf("ListEvents = %+v, %v", events, err)
+	}
+
+	// Transaction annulée : rien n'est conservé ; notification effacée : son renvoi est traité
+	errSchedule := errors.New("schedule failed")
+	retried := EventSubEvent{MessageID: "msg-2", TwitchSubscriptionID: "tw-1", Type: "channel.raid", BroadcasterID: "1000",
+		Event: json.RawMessage(`{"viewers":7}`), ReceivedAt: time.Now().UTC()}
+	retriedID, created, err := st.EventSub.RecordEvent(ctx, retried)
+	if err != nil || !created {
+		t.Fatalf("RecordEvent(msg-2) = %v, %v", created, err)
+	}
+	err = st.InTx(ctx, func(tx *Store) error {
+		if err := tx.EventSub.SetEventCaptures(ctx, retriedID, 3); err != nil {
+			t.Fatalf("SetEventCaptures in transaction: %v", err)
+		}
+		return errSchedule
+	})
+	if !errors.Is(err, errSchedule) {
+		t.Fatalf("InTx = %v, want %v", err, errSchedule)
+	}
+	events, err = st.EventSub.ListEvents(ctx, userID, 10)
+	if err != nil || len(events) != 2 || !slices.ContainsFunc(events, func(e EventSubEvent) bool { return e.ID == retriedID && e.Captures == 0 }) {
+		t.Fatalf("ListEvents(after rollback) = %+v, %v", events, err)
+	}
+	if err := st.EventSub.DeleteEvent(ctx, retriedID); err != nil {
+		t.Fatalf("DeleteEvent: %v", err)
+	}
+	if _, created, err := st.EventSub.RecordEvent(ctx, retried); err != nil || !created {
+		t.Fatalf("RecordEvent(after delete) = %v, %v, want created", created, err)
+	}
+
+	// Capture différée rattachée à la session
+	runAfter := time.Now().UTC().Add(time.Hour)
+	if _, err := st.Jobs.EnqueueForSessionAt(ctx, JobFetchChatters, session.ID, map[string]any{"session_id": session.ID}, runAfter); err != nil {
+		t.Fatal(err)
+	}
+	if job, err := st.Jobs.ClaimNext(ctx); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ClaimNext = %+v, %v, want no runnable job", job, err)
+	}
+
+	// Abonnement websocket : créé sans abonnement Twitch, jamais partagé
+	wsID, err := st.EventSub.Create(ctx, EventSubSubscription{UserID: userID, BroadcasterID: "1000", BroadcasterLogin: "streamer",
+		Type: "stream.online", Transport: "websocket", Status: "pending", CreatedAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.EventSub.SetTwitchSubscription(ctx, wsID, "tw-ws", "enabled"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := st.EventSub.Shared(ctx, "stream.online", "1000", ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Shared(websocket) = %v, want ErrNotFound", err)
+	}
+	wsSubs, err := st.EventSub.ListByTransport(ctx, "websocket")
+	if err != nil || len(wsSubs) != 1 || wsSubs[0].ID != wsID || wsSubs[0].TwitchSubscriptionID != "tw-ws" || wsSubs[0].Status != "enabled" {
+		t.Fatalf("ListByTransport(websocket) = %+v, %v", wsSubs, err)
+	}
+	if webhookSubs, err := st.EventSub.ListByTransport(ctx, "webhook"); err != nil || len(webhookSubs) != 2 || webhookSubs[0].Transport != "webhook" {
+		t.Fatalf("ListByTransport(webhook) = %+v, %v", webhookSubs, err)
+	}
+
+	// L'abonnement Twitch reste utilisé jusqu'à la suppression du dernier utilisateur
+	if _, err := st.EventSub.Delete(ctx, otherID, id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Delete by another user = %v, want ErrNotFound", err)
+	}
+	if stillUsed, err := st.EventSub.Delete(ctx, userID, id); err != nil || !stillUsed {
+		t.Fatalf("Delete = %v, %v, want still used", stillUsed, err)
+	}
+	if stillUsed, err := st.EventSub.Delete(ctx, otherID, otherSubID); err != nil || stillUsed {
+		t.Fatalf("Delete(last) = %v, %v, want unused", stillUsed, err)
+	}
+}
+
+func TestChatActivity(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	_, session := seedSession(t, st)
+
+	t0 := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		broadcaster string
+		chatters    []string
+	}{
+		{"1000", []string{"1", "2", "3", "4"}},
+		{"1001", []string{"5", "6"}},
+	} {
+		if _, err := st.Captures.Create(ctx, Capture{
+			SessionID: session.ID, BroadcasterID: c.broadcaster, BroadcasterLogin: "b" + c.broadcaster, CapturedAt: t0,
+		}, c.chatters); err != nil {
+			t.Fatal(err)
+		}
+	}
+	targets, err := st.Chat.Targets(ctx)
+	if err != nil || len(targets) != 2 || targets[0].BroadcasterID != "1000" || targets[1].BroadcasterLogin != "b1001" {
+		t.Fatalf("Targets = %+v, %v", targets, err)
+	}
+
+	// Seul le chat de 1000 est écouté ; une deuxième écoute garde la première date
+	ch := ChatChannel{SessionID: session.ID, BroadcasterID: "1000", BroadcasterLogin: "b1000", ListeningSince: t0}
+	if err := st.Chat.Listen(ctx, ch); err != nil {
+		t.Fatal(err)
+	}
+	ch.ListeningSince = t0.Add(time.Hour)
+	if err := st.Chat.Listen(ctx, ch); err != nil {
+		t.Fatal(err)
+	}
+	if channels, err := st.Chat.Channels(ctx, session.ID, nil); err != nil || len(channels) != 1 || !channels[0].ListeningSince.Equal(t0) {
+		t.Fatalf("Channels = %+v, %v", channels, err)
+	}
+
+	// Deux enregistrements successifs s'additionnent ; "7" n'a pas été capturé
+	activity := func(user string, messages, duplicates int64, first, last time.Duration) ChatActivity {
+		return ChatActivity{SessionID: session.ID, BroadcasterID: "1000", TwitchUserID: user, Login: "u" + user,
+			MessageCount: messages, DuplicateCount: duplicates, FirstMessageAt: t0.Add(first), LastMessageAt: t0.Add(last)}
+	}
+	fp := ChatFingerprint{SessionID: session.ID, BroadcasterID: "1000", Fingerprint: "00112233aabbccdd",
+		MessageCount: 1, FirstSeenAt: t0.Add(time.Minute), LastSeenAt: t0.Add(time.Minute)}
+	if err := st.Chat.Record(ctx, []ChatActivity{
+		activity("1", 2, 0, time.Minute, 2*time.Minute),
+		activity("2", 1, 0, time.Minute, time.Minute),
+	}, []ChatFingerprint{fp}); err != nil {
+		t.Fatal(err)
+	}
+	fp.Sample, fp.MessageCount, fp.FirstSeenAt, fp.LastSeenAt = "spam!", 3, t0.Add(2*time.Minute), t0.Add(5*time.Minute)
+	if err := st.Chat.Record(ctx, []ChatActivity{
+		activity("1", 3, 3, 3*time.Minute, 5*time.Minute),
+		activity("7", 1, 0, 4*time.Minute, 4*time.Minute),
+	}, []ChatFingerprint{fp}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := st.Chat.Activity(ctx, session.ID, nil)
+	if err != nil || len(got) != 3 {
+		t.Fatalf("Activity = %+v, %v", got, err)
+	}
+	if a := got[0]; a.TwitchUserID != "1" || a.Login != "u1" || a.MessageCount != 5 || a.DuplicateCount != 3 ||
+		!a.FirstMessageAt.Equal(t0.Add(time.Minute)) || !a.LastMessageAt.Equal(t0.Add(5*time.Minute)) {
+		t.Errorf("Activity[0] = %+v", a)
+	}
+	if got, _ := st.Chat.Activity(ctx, session.ID, []string{"1001"}); len(got) != 0 {
+		t.Errorf("Activity(1001) = %+v", got)
+	}
+	// 3 et 4 capturés sur 1000 sans message ; 5 et 6 sont sur une chaîne non écoutée
+	if n, err := st.Chat.CountSilent(ctx, session.ID, nil); err != nil || n != 2 {
+		t.Errorf("CountSilent = %d, %v, want 2", n, err)
+	}
+	if n, err := st.Chat.CountSilent(ctx, session.ID, []string{"1001"}); err != nil || n != 0 {
+		t.Errorf("CountSilent(1001) = %d, %v, want 0", n, err)
+	}
+
+	counts, err := st.Chat.Fingerprints(ctx, session.ID, "1000", 100)
+	if err != nil || len(counts) != 1 || counts[fp.Fingerprint] != 4 {
+		t.Errorf("Fingerprints = %v, %v", counts, err)
+	}
+	repeated, err := st.Chat.RepeatedMessages(ctx, session.ID, nil, 2, 10)
+	if err != nil || len(repeated) != 1 || repeated[0].Sample != "spam!" || repeated[0].MessageCount != 4 ||
+		!repeated[0].FirstSeenAt.Equal(t0.Add(time.Minute)) || !repeated[0].LastSeenAt.Equal(t0.Add(5*time.Minute)) {
+		t.Errorf("RepeatedMessages = %+v, %v", repeated, err)
+	}
+
+	// La purge de la session emporte l'activité du chat
+	if err := st.Sessions.Purge(ctx, session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := st.Chat.Activity(ctx, session.ID, nil); len(got) != 0 {
+		t.Errorf("Activity after purge = %+v", got)
+	}
+	if channels, _ := st.Chat.Channels(ctx, session.ID, nil); len(channels) != 0 {
+		t.Errorf("Channels after purge = %+v", channels)
+	}
+	if targets, _ := st.Chat.Targets(ctx); len(targets) != 0 {
+		t.Errorf("Targets after purge = %+v", targets)
+	}
+}
+
+func TestFollowers(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	_, session := seedSession(t, st)
+
+	t0 := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	if _, err := st.Captures.Create(ctx, Capture{SessionID: session.ID, BroadcasterID: "1000", BroadcasterLogin: "b1000", CapturedAt: t0},
+		[]string{"1", "2", "9"}); err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, 1, 9, 8, 0, 0, 0, time.UTC)
+	old := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := st.TwitchUsers.Upsert(ctx, []TwitchUser{
+		{TwitchUserID: "1", Login: "alpha", CreatedAt: &day},
+		{TwitchUserID: "3", Login: "charlie", CreatedAt: &day},
+		{TwitchUserID: "9", Login: "india", CreatedAt: &day},
+		{TwitchUserID: "4", Login: "delta", CreatedAt: &old},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fetch := FollowerFetch{SessionID: session.ID, BroadcasterID: "1000", BroadcasterLogin: "b1000", Total: 10, Fetched: 4, FetchedAt: t0}
+	follows := []Follow{
+		{TwitchUserID: "1", FollowedAt: t0.Add(-time.Minute)},
+		{TwitchUserID: "3", FollowedAt: t0.Add(-2 * time.Minute)},
+		{TwitchUserID: "5", FollowedAt: t0.Add(-3 * time.Minute)},
+		{TwitchUserID: "4", FollowedAt: t0.Add(-48 * time.Hour)},
+	}
+	if err := st.Followers.Store(ctx, fetch, follows); err != nil {
+		t.Fatal(err)
+	}
+	// Nouvelle récupération : les compteurs sont remplacés, un refollow prend sa nouvelle date
+	fetch.Total, fetch.Fetched, fetch.FetchedAt = 11, 1, t0.Add(time.Hour)
+	if err := st.Followers.Store(ctx, fetch, []Follow{{TwitchUserID: "4", FollowedAt: t0.Add(-30 * time.Minute)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	fetches, err := st.Followers.Fetches(ctx, session.ID, nil)
+	if err != nil || len(fetches) != 1 || fetches[0].Total != 11 || fetches[0].Fetched != 1 || !fetches[0].FetchedAt.Equal(t0.Add(time.Hour)) {
+		t.Fatalf("Fetches = %+v, %v", fetches, err)
+	}
+	if fetches, _ := st.Followers.Fetches(ctx, session.ID, []string{"1001"}); len(fetches) != 0 {
+		t.Errorf("Fetches(1001) = %+v", fetches)
+	}
+	times, err := st.Followers.FollowTimes(ctx, session.ID, "1000")
+	if err != nil || len(times) != 4 || !times[0].Equal(t0.Add(-30*time.Minute)) || !times[3].Equal(t0.Add(-time.Minute)) {
+		t.Fatalf("FollowTimes = %v, %v", times, err)
+	}
+
+	window, err := st.Followers.Window(ctx, session.ID, "1000", t0.Add(-5*time.Minute), t0)
+	if err != nil || len(window) != 3 {
+		t.Fatalf("Window = %+v, %v", window, err)
+	}
+	// 5 n'est pas enrichi, 1 est aussi un chatter de la session
+	if f := window[0]; f.TwitchUserID != "5" || f.Login != "" || f.CreatedAt != nil || f.InChat {
+		t.Errorf("Window[0] = %+v", f)
+	}
+	if f := window[2]; f.TwitchUserID != "1" || f.Login != "alpha" || f.CreatedAt == nil || !f.CreatedAt.Equal(day) || !f.InChat {
+		t.Errorf("Window[2] = %+v", f)
+	}
+	if f := window[1]; f.TwitchUserID != "3" || f.InChat {
+		t.Errorf("Window[1] = %+v", f)
+	}
+
+	// Chatters créés le même jour que les followers de la fenêtre : 1 et 9
+	counts, err := st.TwitchUsers.CountCreatedOn(ctx, session.ID, []time.Time{day, old}, nil)
+	if err != nil || counts["2026-01-09"] != 2 || counts["2015-03-01"] != 0 {
+		t.Errorf("CountCreatedOn = %v, %v", counts, err)
+	}
+
+	// La purge de la session emporte les followers
+	if err := st.Sessions.Purge(ctx, session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if fetches, _ := st.Followers.Fetches(ctx, session.ID, nil); len(fetches) != 0 {
+		t.Errorf("Fetches after purge = %+v", fetches)
+	}
+	if times, _ := st.Followers.FollowTimes(ctx, session.ID, "1000"); len(times) != 0 {
+		t.Errorf("FollowTimes after purge = %v", times)
+	}
+}
+
+func TestSessionsLifecycle(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	userID, session := seedSession(t, st)
+
+	if active, err := st.Sessions.HasActive(ctx, userID); err != nil || !active {
+		t.Fatalf("HasActive = %v, %v", active, err)
+	}
+	if _, err := st.Captures.Create(ctx, Capture{SessionID: session.ID, BroadcasterID: "1000", BroadcasterLogin: "streamer", CapturedAt: time.Now().UTC()}, []string{"1", "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Sessions.SetStatus(ctx, session.ID, SessionSaved); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Sessions.Active(ctx, userID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Active after save: %v, want ErrNotFound", err)
+	}
+	saved, err := st.Sessions.ListSaved(ctx, userID)
+	if err != nil || len(saved) != 1 || saved[0].UUID != "sess-1" {
+		t.Fatalf("ListSaved = %+v, %v", saved, err)
+	}
+	if _, err := st.Sessions.Saved(ctx, userID+1, "sess-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Saved for another user: %v, want ErrNotFound", err)
+	}
+
+	if err := st.Sessions.Delete(ctx, session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Sessions.ByUUID(ctx, "sess-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ByUUID after Delete: %v, want ErrNotFound", err)
+	}
+	if n, err := st.Chatters.CountDistinct(ctx, session.ID, nil); err != nil || n != 0 {
+		t.Fatalf("chatters left after Delete: %d, %v", n, err)
+	}
+}
+
+func TestCapturesAndAnalysis(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	_, session := seedSession(t, st)
+
+	t0 := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	for i, c := range []struct {
+		broadcaster string
+		chatters    []string
+	}{
+		{"1000", []string{"1", "2", "3"}},
+		{"1000", []string{"2", "3", "4"}},
+		{"1001", []string{"4", "5"}},
+	} {
+		if _, err := st.Captures.Create(ctx, Capture{
+			SessionID: session.ID, BroadcasterID: c.broadcaster, BroadcasterLogin: "b" + c.broadcaster,
+			CapturedAt: t0.Add(time.Duration(i) * time.Minute),
+		}, c.chatters); err != nil {
+			t.Fatalf("Captures.Create: %v", err)
+		}
+	}
+
+	if n, _ := st.Chatters.CountDistinct(ctx, session.ID, nil); n != 5 {
+		t.Errorf("CountDistinct = %d, want 5", n)
+	}
+	if n, _ := st.Chatters.CountDistinct(ctx, session.ID, []string{"1001"}); n != 2 {
+		t.Errorf("CountDistinct(1001) = %d, want 2", n)
+	}
+	broadcasters, err := st.Captures.Broadcasters(ctx, session.ID)
+	if err != nil || len(broadcasters) != 2 || broadcasters[0].BroadcasterID != "1000" || broadcasters[0].CaptureCount != 2 {
+		t.Fatalf("Broadcasters = %+v, %v", broadcasters, err)
+	}
+
+	// Comptes non enrichis : présents dans l'export, sans infos Twitch
+	stats, err := st.Chatters.SessionStats(ctx, session.ID)
+	if err != nil || len(stats) != 5 {
+		t.Fatalf("SessionStats = %+v, %v", stats, err)
+	}
+	if stats[0].SeenCount != 2 || stats[0].Login != "" || stats[0].CreatedAt != nil {
+		t.Errorf("unexpected first stat: %+v", stats[0])
+	}
+
+	day := time.Date(2025, 12, 1, 8, 0, 0, 0, time.UTC)
+	other := day.AddDate(0, 0, 3)
+	users := []TwitchUser{
+		{TwitchUserID: "1", Login: "one", DisplayName: "One", CreatedAt: &day},
+		{TwitchUserID: "2", Login: "two", DisplayName: "Two", CreatedAt: &day},
+		{TwitchUserID: "3", Login: "three", DisplayName: "Three", CreatedAt: &day},
+		{TwitchUserID: "4", Login: "four", DisplayName: "Four", CreatedAt: &other},
+		{TwitchUserID: "5", Login: "five", DisplayName: "Five"},
+	}
+	if changes, err := st.TwitchUsers.Upsert(ctx, users); err != nil || len(changes) != 0 {
+		t.Fatalf("first Upsert = %+v, %v", changes, err)
+	}
+
+	days, err := st.TwitchUsers.CreationDays(ctx, session.ID, nil, 10)
+	if err != nil || len(days) != 2 || days[0].Count != 3 || !days[0].Date.Equal(time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("CreationDays = %+v, %v", days, err)
+	}
+	logins, err := st.TwitchUsers.LoginsCreatedOn(ctx, session.ID, days[0].Date, []string{"1000"})
+	if err != nil || len(logins) != 3 || logins[0] != "one" {
+		t.Fatalf("LoginsCreatedOn = %v, %v", logins, err)
+	}
+
+	stats, _ = st.Chatters.SessionStats(ctx, session.ID)
+	for _, s := range stats {
+		if s.Login == "" {
+			t.Errorf("account %s not enriched in SessionStats", s.TwitchUserID)
+		}
+	}
+
+	// Clés entières : réutilisées d'une capture à l'autre, doublons d'une capture ignorés
+	if _, err := st.Captures.Create(ctx, Capture{
+		SessionID: session.ID, BroadcasterID: "1001", BroadcasterLogin: "b1001", CapturedAt: t0.Add(time.Hour),
+	}, []string{"5", "6", "5"}); err != nil {
+		t.Fatalf("Captures.Create with duplicates: %v", err)
+	}
+	var keys, rows int
+	if err := st.DB().QueryRow(`SELECT COUNT(*) FROM twitch_user_keys`).Scan(&keys); err != nil || keys != 6 {
+		t.Errorf("twitch_user_keys = %d (%v), want 6", keys, err)
+	}
+	if err := st.DB().QueryRow(`SELECT COUNT(*) FROM capture_chatters`).Scan(&rows); err != nil || rows != 10 {
+		t.Errorf("capture_chatters = %d (%v), want 10", rows, err)
+	}
+	if n, _ := st.Chatters.CountDistinct(ctx, session.ID, []string{"1001"}); n != 3 {
+		t.Errorf("CountDistinct(1001) = %d, want 3", n)
+	}
+}
+
+func TestTwitchUsersRenames(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	_, session := seedSession(t, st)
+
+	if _, err := st.Captures.Create(ctx, Capture{SessionID: session.ID, BroadcasterID: "1000", BroadcasterLogin: "streamer", CapturedAt: time.Now().UTC()}, []string{"42"}); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"alpha", "beta", "gamma", "delta"}
+	for i, name := range names {
+		changes, err := st.TwitchUsers.Upsert(ctx, []TwitchUser{{
+			TwitchUserID: "42", Login: name, DisplayName: name,
+			LastFetchedAt: time.Date(2026, 1, 1, i, 0, 0, 0, time.UTC),
+		}})
+		if err != nil {
+			t.Fatalf("Upsert %s: %v", name, err)
+		}
+		if want := min(i, 1); len(changes) != want {
+			t.Fatalf("Upsert %s: %d changes, want %d", name, len(changes), want)
+		}
+	}
+
+	u, err := st.TwitchUsers.Get(ctx, "42")
+	if err != nil || u.Login != "delta" {
+		t.Fatalf("Get = %+v, %v", u, err)
+	}
+	history, err := st.NameHistory.ForUser(ctx, "42")
+	if err != nil || len(history) != 3 {
+		t.Fatalf("ForUser = %+v, %v", history, err)
+	}
+	if history[0].OldLogin != "gamma" || history[0].NewLogin != "delta" {
+		t.Errorf("latest change = %+v, want gamma -> delta", history[0])
+	}
+
+	renamers, err := st.NameHistory.FrequentRenamers(ctx, session.ID, nil, 3, 50)
+	if err != nil || len(renamers) != 1 || renamers[0].RenameCount != 3 {
+		t.Fatalf("FrequentRenamers = %+v, %v", renamers, err)
+	}
+	if renamers, _ := st.NameHistory.FrequentRenamers(ctx, session.ID, []string{"999"}, 3, 50); len(renamers) != 0 {
+		t.Errorf("FrequentRenamers(999) = %+v, want none", renamers)
+	}
+}
+
+func TestJobsQueue(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+
+	if _, err := st.Jobs.ClaimNext(ctx); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ClaimNext on empty queue: %v, want ErrNotFound", err)
+	}
+
+	first, err := st.Jobs.Enqueue(ctx, JobFetchChatters, map[string]int{"session_id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Jobs.Enqueue(ctx, JobFetchUsersInfo, map[string]int{"session_id": 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := st.Jobs.ClaimNext(ctx)
+	if err != nil || job.ID != first || job.Type != JobFetchChatters || job.Status != JobRunning {
+		t.Fatalf("ClaimNext = %+v, %v", job, err)
+	}
+	if string(job.Payload) != `{"session_id": 1}` && string(job.Payload) != `{"session_id":1}` {
+		t.Errorf("payload = %s", job.Payload)
+	}
+	if err := st.Jobs.Finish(ctx, job.ID, "boom"); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := st.Jobs.ClaimNext(ctx)
+	if err != nil || second.Type != JobFetchUsersInfo {
+		t.Fatalf("second ClaimNext = %+v, %v", second, err)
+	}
+	if err := st.Jobs.Finish(ctx, second.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Jobs.ClaimNext(ctx); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ClaimNext after draining: %v, want ErrNotFound", err)
+	}
+
+	var status, msg string
+	if err := st.DB().QueryRow(`SELECT status, error_message FROM jobs WHERE id = ?`, first).Scan(&status, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if status != JobFailed || msg != "boom" {
+		t.Errorf("failed job = %s/%q", status, msg)
+	}
+}
+
+func TestSessionJobs(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	userID, session := seedSession(t, st)
+
+	if _, err := st.Jobs.EnqueueForSession(ctx, JobFetchChatters, session.ID+100, nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("EnqueueForSession(unknown session) = %v, want ErrNotFound", err)
+	}
+	capture, err := st.Jobs.EnqueueForSession(ctx, JobFetchChatters, session.ID, map[string]int64{"session_id": session.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Jobs.Enqueue(ctx, JobPurge, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := st.Jobs.ClaimNext(ctx)
+	if err != nil || job.ID != capture || job.SessionID != session.ID || job.UserID != userID {
+		t.Fatalf("ClaimNext = %+v, %v", job, err)
+	}
+	if err := st.Jobs.SetProgress(ctx, job.ID, 1000, -1, "page 1"); err != nil {
+		t.Fatal(err)
+	}
+	job, err = st.Jobs.Get(ctx, capture)
+	if err != nil || job.Progress.Done != 1000 || job.Progress.Total != nil || job.Progress.Message != "page 1" {
+		t.Fatalf("Get after SetProgress(total unknown) = %+v, %v", job, err)
+	}
+	if err := st.Jobs.SetProgress(ctx, job.ID, 2000, 2500, "page 2/3"); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := st.Jobs.ListBySession(ctx, session.ID, 10)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("ListBySession = %+v, %v; want the capture job only", jobs, err)
+	}
+	if p := jobs[0].Progress; p.Done != 2000 || p.Total == nil || *p.Total != 2500 {
+		t.Errorf("progress = %+v, want 2000/2500", p)
+	}
+}
+
+func TestBulkInsertAcrossBatches(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	_, session := seedSession(t, st)
+
+	const n = 2*batchSize + 17
+	ids := make([]string, n)
+	users := make([]TwitchUser, n)
+	for i := range ids {
+		ids[i] = fmt.Sprint(100000 + i)
+		users[i] = TwitchUser{TwitchUserID: ids[i], Login: fmt.Sprintf("user%d", i), DisplayName: fmt.Sprintf("User%d", i)}
+	}
+	if _, err := st.Captures.Create(ctx, Capture{SessionID: session.ID, BroadcasterID: "1000", BroadcasterLogin: "streamer", CapturedAt: time.Now().UTC()}, ids); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := st.Chatters.CountDistinct(ctx, session.ID, nil); got != n {
+		t.Fatalf("CountDistinct = %d, want %d", got, n)
+	}
+	if changes, err := st.TwitchUsers.Upsert(ctx, users); err != nil || len(changes) != 0 {
+		t.Fatalf("first Upsert: %d changes, %v", len(changes), err)
+	}
+
+	// Un compte sur 100 change de nom ; le dernier doublon l'emporte
+	renamed := 0
+	for i := range users {
+		if i%100 == 0 {
+			users[i].Login += "_new"
+			renamed++
+		}
+	}
+	users = append(users, TwitchUser{TwitchUserID: ids[1], Login: "dup", DisplayName: "Dup"})
+	changes, err := st.TwitchUsers.Upsert(ctx, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != renamed+1 {
+		t.Fatalf("second Upsert: %d changes, want %d", len(changes), renamed+1)
+	}
+	if u, _ := st.TwitchUsers.Get(ctx, ids[1]); u == nil || u.Login != "dup" {
+		t.Errorf("duplicate not resolved to last occurrence: %+v", u)
+	}
+	if u, _ := st.TwitchUsers.Get(ctx, ids[n-1]); u == nil || u.Login != fmt.Sprintf("user%d", n-1) {
+		t.Errorf("last batch not written: %+v", u)
+	}
+}
+
+// BenchmarkCaptureAndEnrich mesure le stockage d'une capture de 50k chatters puis
+// l'enrichissement de ces comptes (dont 1 % renommés).
+func BenchmarkCaptureAndEnrich(b *testing.B) {
+	st := openTestStore(b)
+	ctx := context.Background()
+	_, session := seedSession(b, st)
+
+	const n = 50000
+	ids := make([]string, n)
+	users := make([]TwitchUser, n)
+	for i := range ids {
+		ids[i] = fmt.Sprint(1000000 + i)
+		users[i] = TwitchUser{TwitchUserID: ids[i], Login: fmt.Sprintf("user%d", i), DisplayName: fmt.Sprintf("User%d", i)}
+	}
+
+	b.ResetTimer()
+	for iter := 0; b.Loop(); iter++ {
+		if _, err := st.Captures.Create(ctx, Capture{SessionID: session.ID, BroadcasterID: "1000", BroadcasterLogin: "streamer", CapturedAt: time.Now().UTC()}, ids); err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < n; i += 100 {
+			users[i].Login = fmt.Sprintf("user%d_%d", i, iter)
+		}
+		if _, err := st.TwitchUsers.Upsert(ctx, users); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSessionAnalysis mesure les requêtes d'analyse d'une session de 20 captures de
+// 5k chatters (10k comptes distincts, dont 1 % renommés) : c'est le volume qui a motivé
+// le stockage compact de capture_chatters (migration 0007).
+func BenchmarkSessionAnalysis(b *testing.B) {
+	st := openTestStore(b)
+	ctx := context.Background()
+	_, session := seedSession(b, st)
+
+	const (
+		accounts = 10000
+		captures = 20
+		perCap   = 5000
+	)
+	users := make([]TwitchUser, accounts)
+	ids := make([]string, accounts)
+	for i := range users {
+		ids[i] = fmt.Sprint(1000000 + i)
+		createdAt := time.Date(2024, 1, 1+i%28, 0, 0, 0, 0, time.UTC)
+		users[i] = TwitchUser{TwitchUserID: ids[i], Login: fmt.Sprintf("user%d", i), DisplayName: fmt.Sprintf("User%d", i), CreatedAt: &createdAt}
+	}
+	// Fenêtre glissante : chaque capture voit 5k comptes, décalés de 500 d'une capture à l'autre
+	chatters := make([]string, perCap)
+	for c := 0; c < captures; c++ {
+		for j := range chatters {
+			chatters[j] = ids[(c*500+j)%accounts]
+		}
+		if _, err := st.Captures.Create(ctx, Capture{SessionID: session.ID, BroadcasterID: "1000", BroadcasterLogin: "streamer", CapturedAt: time.Now().UTC()}, chatters); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for rename := 0; rename < 3; rename++ {
+		for i := 0; i < accounts; i += 100 {
+			users[i].Login = fmt.Sprintf("user%d_%d", i, rename)
+		}
+		if _, err := st.TwitchUsers.Upsert(ctx, users); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	queries := []struct {
+		name string
+		run  func() error
+	}{
+		{"CountDistinct", func() error { _, err := st.Chatters.CountDistinct(ctx, session.ID, nil); return err }},
+		{"SessionStats", func() error { _, err := st.Chatters.SessionStats(ctx, session.ID); return err }},
+		{"CreationDays", func() error { _, err := st.TwitchUsers.CreationDays(ctx, session.ID, nil, 10); return err }},
+		{"CountMissing", func() error { _, err := st.TwitchUsers.CountMissing(ctx, session.ID, nil); return err }},
+		{"FrequentRenamers", func() error {
+			_, err := st.NameHistory.FrequentRenamers(ctx, session.ID, nil, 3, 50)
+			return err
+		}},
+		{"ProfileSignals", func() error { _, err := st.TwitchUsers.ProfileSignals(ctx, session.ID, nil); return err }},
+	}
+	for _, q := range queries {
+		b.Run(q.name, func(b *testing.B) {
+			for b.Loop() {
+				if err := q.run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestStaleUsers(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	if _, err := st.TwitchUsers.Upsert(ctx, []TwitchUser{
+		{TwitchUserID: "1", Login: "fresh", DisplayName: "Fresh", LastFetchedAt: now.Add(-time.Hour)},
+		{TwitchUserID: "2", Login: "old", DisplayName: "Old", LastFetchedAt: now.Add(-48 * time.Hour)},
+		{TwitchUserID: "3", Login: "renamer", DisplayName: "Renamer", LastFetchedAt: now.Add(-2 * time.Hour)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Le renommage est récent mais le compte reste à surveiller
+	if _, err := st.TwitchUsers.Upsert(ctx, []TwitchUser{{TwitchUserID: "3", Login: "renamer2", DisplayName: "Renamer2", LastFetchedAt: now.Add(-time.Hour)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := st.TwitchUsers.Stale(ctx, []string{"4", "1", "2", "3", "4"}, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(stale); got != "[4 2 3]" {
+		t.Errorf("Stale = %s, want [4 2 3]", got)
+	}
+	if all, _ := st.TwitchUsers.Stale(ctx, []string{"1", "2"}, 0); len(all) != 2 {
+		t.Errorf("Stale with no window = %v, want every account", all)
+	}
+}
+
+func TestRefreshCandidates(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	_, session := seedSession(t, st)
+
+	now := time.Now().UTC()
+	if _, err := st.TwitchUsers.Upsert(ctx, []TwitchUser{
+		{TwitchUserID: "1", Login: "oldest", DisplayName: "Oldest", LastFetchedAt: now.Add(-96 * time.Hour)},
+		{TwitchUserID: "2", Login: "saved", DisplayName: "Saved", LastFetchedAt: now.Add(-48 * time.Hour)},
+		{TwitchUserID: "3", Login: "renamer", DisplayName: "Renamer", LastFetchedAt: now.Add(-72 * time.Hour)},
+		{TwitchUserID: "4", Login: "fresh", DisplayName: "Fresh", LastFetchedAt: now},
+		{TwitchUserID: "5", Login: "both", DisplayName: "Both", LastFetchedAt: now.Add(-40 * time.Hour)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.TwitchUsers.Upsert(ctx, []TwitchUser{
+		{TwitchUserID: "3", Login: "renamer2", DisplayName: "Renamer2", LastFetchedAt: now.Add(-30 * time.Hour)},
+		{TwitchUserID: "5", Login: "both2", DisplayName: "Both2", LastFetchedAt: now.Add(-40 * time.Hour)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Captures.Create(ctx, Capture{SessionID: session.ID, BroadcasterID: "1000", BroadcasterLogin: "streamer", CapturedAt: now}, []string{"2", "5"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Sessions.SetStatus(ctx, session.ID, SessionSaved); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := st.TwitchUsers.RefreshCandidates(ctx, now.Add(-24*time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Renommé et sauvegardé d'abord, puis renommé ou sauvegardé, puis le plus ancien
+	if got := fmt.Sprint(ids); got != "[5 2 3 1]" {
+		t.Errorf("RefreshCandidates = %s, want [5 2 3 1]", got)
+	}
+	if ids, _ := st.TwitchUsers.RefreshCandidates(ctx, now.Add(-24*time.Hour), 1); len(ids) != 1 {
+		t.Errorf("limit not applied: %v", ids)
+	}
+
+	if err := st.TwitchUsers.MarkMissing(ctx, []string{"1", "2", "3", "5"}, now); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := st.TwitchUsers.RefreshCandidates(ctx, now.Add(-24*time.Hour), 10); len(ids) != 0 {
+		t.Errorf("RefreshCandidates after MarkMissing = %v, want none", ids)
+	}
+
+	if recent, err := st.Jobs.CreatedWithin(ctx, JobRefreshUsers, time.Hour); err != nil || recent {
+		t.Fatalf("CreatedWithin on empty queue = %v, %v", recent, err)
+	}
+	if _, err := st.Jobs.Enqueue(ctx, JobRefreshUsers, map[string]int{"limit": 100}); err != nil {
+		t.Fatal(err)
+	}
+	if recent, err := st.Jobs.CreatedWithin(ctx, JobRefreshUsers, time.Hour); err != nil || !recent {
+		t.Fatalf("CreatedWithin after Enqueue = %v, %v", recent, err)
+	}
+}
+
+func TestMissingUsers(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	_, session := seedSession(t, st)
+
+	if _, err := st.Captures.Create(ctx, Capture{SessionID: session.ID, BroadcasterID: "1000", BroadcasterLogin: "streamer", CapturedAt: time.Now().UTC()}, []string{"1", "2", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.TwitchUsers.Upsert(ctx, []TwitchUser{{TwitchUserID: "1", Login: "one", DisplayName: "One"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	first := time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)
+	if err := st.TwitchUsers.MarkMissing(ctx, []string{"1", "2"}, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.TwitchUsers.MarkMissing(ctx, []string{"1"}, first.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := st.TwitchUsers.Get(ctx, "1")
+	if err != nil || u.Status != TwitchUserMissing || u.Login != "one" || u.DisappearedAt == nil || !u.DisappearedAt.Equal(first) {
+		t.Fatalf("known account after MarkMissing = %+v, %v", u, err)
+	}
+	if u, err := st.TwitchUsers.Get(ctx, "2"); err != nil || u.Status != TwitchUserMissing || u.Login != "" {
+		t.Fatalf("unknown account after MarkMissing = %+v, %v", u, err)
+	}
+	if n, err := st.TwitchUsers.CountMissing(ctx, session.ID, nil); err != nil || n != 2 {
+		t.Fatalf("CountMissing = %d, %v; want 2", n, err)
+	}
+
+	// Réapparition : le compte redevient actif, sans renommage fictif depuis un nom vide
+	changes, err := st.TwitchUsers.Upsert(ctx, []TwitchUser{
+		{TwitchUserID: "1", Login: "one", DisplayName: "One"},
+		{TwitchUserID: "2", Login: "two", DisplayName: "Two"},
+	})
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("Upsert after reappearance = %+v, %v", changes, err)
+	}
+	if u, _ := st.TwitchUsers.Get(ctx, "2"); u == nil || u.Status != TwitchUserActive || u.DisappearedAt != nil {
+		t.Errorf("reappeared account = %+v, want active", u)
+	}
+	if n, _ := st.TwitchUsers.CountMissing(ctx, session.ID, nil); n != 0 {
+		t.Errorf("CountMissing after reappearance = %d, want 0", n)
+	}
+}
+
+func TestProfileSignals(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	_, session := seedSession(t, st)
+
+	if _, err := st.Captures.Create(ctx, Capture{SessionID: session.ID, BroadcasterID: "1000", BroadcasterLogin: "streamer", CapturedAt: time.Now().UTC()}, []string{"1", "2", "3", "4", "5"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Même image envoyée par trois comptes : une URL par envoi, un même hash de contenu
+	const sharedHash = "5a0c2f0e3d9b7c1a8e6f4d2b0a9c8e7f6d5c4b3a2918070605040302010f0e0d"
+	image := func(login string) string {
+		return "https://static-cdn.jtvnw.net/jtv_user_pictures/" + login + "-profile_image-300x300.png"
+	}
+	users := []TwitchUser{
+		{TwitchUserID: "1", Login: "alpha", DisplayName: "Alpha", ProfileImageURL: image("alpha"), ProfileImageHash: sharedHash, Description: ""},
+		{TwitchUserID: "2", Login: "bravo", DisplayName: "Bravo", ProfileImageURL: image("bravo"), ProfileImageHash: sharedHash, Description: "bonjour"},
+		{TwitchUserID: "3", Login: "charlie", DisplayName: "Charlie", ProfileImageURL: image("charlie"), ProfileImageHash: sharedHash, Description: ""},
+		{TwitchUserID: "4", Login: "delta", DisplayName: "Delta", ProfileImageURL: "https://static-cdn.jtvnw.net/user-default-pictures-uv/default-profile_image-300x300.png", DefaultAvatar: true},
+		{TwitchUserID: "5", Login: "echo", DisplayName: "Echo", ProfileImageURL: image("echo"), Description: "streamer", OfflineImageURL: "https://static-cdn.jtvnw.net/offline.png"},
+	}
+	if _, err := st.TwitchUsers.Upsert(ctx, users); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := st.TwitchUsers.Get(ctx, "5")
+	if err != nil || u.ProfileImageURL != users[4].ProfileImageURL || u.Description != "streamer" || u.OfflineImageURL != users[4].OfflineImageURL || u.DefaultAvatar {
+		t.Fatalf("Get = %+v, %v", u, err)
+	}
+
+	signals, err := st.TwitchUsers.ProfileSignals(ctx, session.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signals.DefaultAvatar != 1 || signals.EmptyDescription != 3 {
+		t.Errorf("ProfileSignals = %+v, want 1 default avatar and 3 empty descriptions", signals)
+	}
+
+	clusters, err := st.TwitchUsers.AvatarClusters(ctx, session.ID, nil, 3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 1 || clusters[0].Count != 3 || clusters[0].Hash != sharedHash || clusters[0].ProfileImageURL != image("alpha") {
+		t.Fatalf("AvatarClusters = %+v, want one cluster of 3", clusters)
+	}
+
+	logins, err := st.TwitchUsers.LoginsWithAvatar(ctx, session.ID, clusters[0].Hash, nil)
+	if err != nil || strings.Join(logins, ",") != "alpha,bravo,charlie" {
+		t.Errorf("LoginsWithAvatar = %v, %v", logins, err)
+	}
+
+	if clusters, _ := st.TwitchUsers.AvatarClusters(ctx, session.ID, []string{"other"}, 3, 10); len(clusters) != 0 {
+		t.Errorf("AvatarClusters with other broadcaster = %+v, want none", clusters)
+	}
+
+	// Hash connus : seule l'image d'echo (jamais téléchargée) reste à calculer
+	hashes, err := st.TwitchUsers.ProfileImageHashes(ctx, []string{image("alpha"), image("bravo"), image("echo")})
+	if err != nil || len(hashes) != 2 || hashes[image("alpha")] != sharedHash || hashes[image("bravo")] != sharedHash {
+		t.Errorf("ProfileImageHashes = %v, %v", hashes, err)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	userID, fresh := seedSession(t, st)
+
+	now := time.Now().UTC()
+	old := now.Add(-30 * 24 * time.Hour)
+	before := now.Add(-7 * 24 * time.Hour)
+
+	if err := st.WebSessions.Create(ctx, WebSession{
+		SessionID: "web-old", UserID: userID, AccessToken: "token-old",
+		CreatedAt: old, LastActivityAt: old, ExpiresAt: old.Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sessionIDs := map[string]int64{}
+	for _, s := range []Session{
+		{UUID: "sess-expired", Status: SessionActive},
+		{UUID: "sess-saved", Status: SessionSaved},
+	} {
+		s.UserID, s.CreatedAt, s.ExpiresAt, s.UpdatedAt = userID, old, old.Add(24*time.Hour), old
+		id, err := st.Sessions.Create(ctx, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessionIDs[s.UUID] = id
+	}
+
+	// "1" n'est vu que dans la session expirée, "2" aussi dans la session active
+	if _, err := st.Captures.Create(ctx, Capture{SessionID: sessionIDs["sess-expired"], BroadcasterID: "1000", BroadcasterLogin: "streamer", CapturedAt: old}, []string{"1", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Captures.Create(ctx, Capture{SessionID: fresh.ID, BroadcasterID: "1000", BroadcasterLogin: "streamer", CapturedAt: now}, []string{"2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.TwitchUsers.Upsert(ctx, []TwitchUser{
+		{TwitchUserID: "1", Login: "gone", DisplayName: "Gone", LastFetchedAt: old},
+		{TwitchUserID: "2", Login: "kept", DisplayName: "Kept", LastFetchedAt: old},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.NameHistory.Record(ctx,
+		NameChange{TwitchUserID: "1", OldLogin: "gone0", NewLogin: "gone", OldDisplayName: "Gone0", NewDisplayName: "Gone", ChangedAt: old},
+		NameChange{TwitchUserID: "2", OldLogin: "kept0", NewLogin: "kept", OldDisplayName: "Kept0", NewDisplayName: "Kept", ChangedAt: old},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deux jobs terminés : l'ancien seul est purgé
+	for i := 0; i < 2; i++ {
+		if _, err := st.Jobs.Enqueue(ctx, JobRefreshUsers, map[string]int{"limit": 1}); err != nil {
+			t.Fatal(err)
+		}
+		job, err := st.Jobs.ClaimNext(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Jobs.Finish(ctx, job.ID, ""); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if _, err := st.DB().ExecContext(ctx, `UPDATE jobs SET finished_at = ? WHERE id = ?`, old, job.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Tant que la session expirée existe, aucun compte n'est orphelin
+	want := map[string]int64{PurgeWebSessions: 1, PurgeSessions: 1, PurgeJobs: 1, PurgeTwitchUsers: 0, PurgeNameHistory: 0, PurgeUserKeys: 0}
+	for _, policy := range []string{PurgeWebSessions, PurgeSessions, PurgeJobs, PurgeTwitchUsers, PurgeNameHistory, PurgeUserKeys} {
+		if n, err := st.Retention.Count(ctx, policy, before); err != nil || n != want[policy] {
+			t.Errorf("Count(%s) = %d, %v; want %d", policy, n, err, want[policy])
+		}
+	}
+
+	for _, policy := range []string{PurgeWebSessions, PurgeSessions, PurgeJobs, PurgeTwitchUsers, PurgeNameHistory, PurgeUserKeys} {
+		n, err := st.Retention.PurgeBatch(ctx, policy, before, 100)
+		if err != nil || n != 1 {
+			t.Errorf("PurgeBatch(%s) = %d, %v; want 1", policy, n, err)
+		}
+	}
+
+	if _, err := st.Sessions.ByUUID(ctx, "sess-expired"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired session still present: %v", err)
+	}
+	if _, err := st.Sessions.ByUUID(ctx, "sess-saved"); err != nil {
+		t.Errorf("saved session purged: %v", err)
+	}
+	if u, err := st.TwitchUsers.Get(ctx, "1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("orphan account still present: %+v, %v", u, err)
+	}
+	if u, err := st.TwitchUsers.Get(ctx, "2"); err != nil || u.Login != "kept" {
+		t.Errorf("referenced account = %+v, %v", u, err)
+	}
+	if h, err := st.NameHistory.ForUser(ctx, "2"); err != nil || len(h) != 1 {
+		t.Errorf("name history of kept account = %+v, %v", h, err)
+	}
+	var keyed string
+	if err := st.DB().QueryRowContext(ctx, `SELECT GROUP_CONCAT(twitch_user_id) FROM twitch_user_keys`).Scan(&keyed); err != nil || keyed != "2" {
+		t.Errorf("twitch_user_keys = %q, %v; want key of the referenced account only", keyed, err)
+	}
+	if _, err := st.WebSessions.Get(ctx, "web-1"); err != nil {
+		t.Errorf("valid web session purged: %v", err)
+	}
+	for _, policy := range []string{PurgeWebSessions, PurgeSessions, PurgeJobs, PurgeTwitchUsers, PurgeNameHistory, PurgeUserKeys} {
+		if n, err := st.Retention.PurgeBatch(ctx, policy, before, 100); err != nil || n != 0 {
+			t.Errorf("second PurgeBatch(%s) = %d, %v; want 0", policy, n, err)
+		}
+	}
+
+	if _, err := st.Retention.Count(ctx, "unknown", before); err == nil {
+		t.Error("Count with unknown policy should fail")
+	}
+	if err := st.Audit.Log(ctx, AuditRetentionPurge, 0, 0, map[string]int{"rows": 5}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionExpiryAndQuota(t *testing.T) {
+	st := openTestStore(t)
+	ctx := context.Background()
+	userID, session := seedSession(t, st)
+
+	u, err := st.Users.ByWebSession(ctx, "web-1")
+	if err != nil || u.Tier != TierFree {
+		t.Fatalf("ByWebSession = %+v, %v; want tier %s", u, err, TierFree)
+	}
+
+	// Session active arrivée à expiration : invisible, puis marquée 'expired'
+	if _, err := st.DB().ExecContext(ctx, `UPDATE sessions SET expires_at = ? WHERE id = ?`, time.Now().UTC().Add(-time.Minute), session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if active, err := st.Sessions.HasActive(ctx, userID); err != nil || active {
+		t.Fatalf("HasActive with an overdue session = %v, %v", active, err)
+	}
+	if n, err := st.Sessions.ExpireOverdue(ctx, userID); err != nil || n != 1 {
+		t.Fatalf("ExpireOverdue = %d, %v; want 1", n, err)
+	}
+	if s, _ := st.Sessions.ByUUID(ctx, "sess-1"); s == nil || s.Status != SessionExpired {
+		t.Fatalf("overdue session = %+v, want expired", s)
+	}
+
+	// Quota de 2 sessions sauvegardées
+	now := time.Now().UTC()
+	ids := make([]int64, 4)
+	for i := range ids {
+		id, err := st.Sessions.Create(ctx, Session{
+			UUID: fmt.Sprintf("quota-%d", i), UserID: userID, Status: SessionActive,
+			CreatedAt: now, ExpiresAt: now.Add(time.Hour), UpdatedAt: now,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	for _, id := range ids[:2] {
+		if evicted, err := st.Sessions.Save(ctx, id, userID, 2, false); err != nil || len(evicted) != 0 {
+			t.Fatalf("Save under quota = %+v, %v", evicted, err)
+		}
+	}
+	if _, err := st.Sessions.Save(ctx, ids[2], userID, 2, false); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Save over quota without evict: %v, want ErrQuotaExceeded", err)
+	}
+	if s, _ := st.Sessions.ByUUID(ctx, "quota-2"); s == nil || s.Status != SessionActive {
+		t.Fatalf("refused session = %+v, want still active", s)
+	}
+	evicted, err := st.Sessions.Save(ctx, ids[2], userID, 2, true)
+	if err != nil || len(evicted) != 1 || evicted[0].UUID != "quota-0" {
+		t.Fatalf("Save with evict = %+v, %v; want quota-0 evicted", evicted, err)
+	}
+	saved, err := st.Sessions.ListSaved(ctx, userID)
+	if err != nil || len(saved) != 2 || saved[0].UUID != "quota-2" || saved[1].UUID != "quota-1" {
+		t.Fatalf("ListSaved after eviction = %+v, %v", saved, err)
+	}
+
+	// Quota abaissé (changement de palier) : toutes les sessions en trop partent
+	evicted, err = st.Sessions.Save(ctx, ids[3], userID, 1, true)
+	if err != nil || len(evicted) != 2 {
+		t.Fatalf("Save with lowered quota = %+v, %v; want 2 evicted", evicted, err)
+	}
+	if _, err := st.Sessions.Save(ctx, ids[0], userID, 10, false); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Save of a deleted session: %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,572 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Statuts d'un compte Twitch
+const (
+	TwitchUserActive  = "active"
+	TwitchUserMissing = "missing" // absent de /helix/users : supprimé, suspendu ou banni
+)
+
+// TwitchUser est un compte Twitch enrichi par le worker
+type TwitchUser struct {
+	TwitchUserID    string
+	Login           string // vide si le compte a disparu avant son premier enrichissement
+	DisplayName     string
+	CreatedAt       *time.Time
+	BroadcasterType string
+	Type            string
+	ViewCount       int
+	ProfileImageURL string
+	// SHA-256 du contenu de l'image de profil (internal/avatars) ; vide si elle n'a pas pu être
+	// téléchargée ou si c'est un avatar par défaut
+	ProfileImageHash string
+	DefaultAvatar    bool // avatar attribué par Twitch (voir twitch.IsDefaultAvatar)
+	OfflineImageURL  string
+	Description      string
+	Status           string
+	DisappearedAt    *time.Time // première disparition constatée (statut missing)
+	LastFetchedAt    time.Time
+}
+
+// CreationDay compte les comptes d'une session créés un même jour
+type CreationDay struct {
+	Date  time.Time
+	Count int64
+}
+
+// TwitchUserRepo accède à la table twitch_users
+type TwitchUserRepo struct {
+	q querier
+}
+
+// Get retourne un compte enrichi
+func (r TwitchUserRepo) Get(ctx context.Context, twitchUserID string) (*TwitchUser, error) {
+	u := TwitchUser{TwitchUserID: twitchUserID}
+	var createdAt, disappearedAt sql.NullTime
+	var broadcasterType, userType, profileImageURL, offlineImageURL, description sql.NullString
+	var viewCount sql.NullInt64
+	var defaultAvatar sql.NullBool
+	err := r.q.QueryRowContext(ctx, `
+SELECT login, display_name, created_at, broadcaster_type, type, view_count,
+       profile_image_url, default_avatar, offline_image_url, description,
+       status, disappeared_at, last_fetched_at
+FROM twitch_users
+WHERE twitch_user_id = ?
+LIMIT 1
+`, twitchUserID).Scan(&u.Login, &u.DisplayName, &createdAt, &broadcasterType, &userType, &viewCount,
+		&profileImageURL, &defaultAvatar, &offlineImageURL, &description,
+		&u.Status, &disappearedAt, &u.LastFetchedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if createdAt.Valid {
+		u.CreatedAt = &createdAt.Time
+	}
+	if disappearedAt.Valid {
+		u.DisappearedAt = &disappearedAt.Time
+	}
+	u.BroadcasterType = broadcasterType.String
+	u.Type = userType.String
+	u.ViewCount = int(viewCount.Int64)
+	u.ProfileImageURL = profileImageURL.String
+	u.DefaultAvatar = defaultAvatar.Bool
+	u.OfflineImageURL = offlineImageURL.String
+	u.Description = description.String
+	return &u, nil
+}
+
+// Upsert crée ou met à jour des comptes retournés par Twitch (statut active) dans une
+// même transaction, par tranches de batchSize lignes. Un changement de login ou de display_name d'un compte connu est
+// enregistré dans l'historique des noms ; les changements détectés sont retournés.
+// LastFetchedAt vaut maintenant s'il est vide. Si un compte apparaît plusieurs fois,
+// la dernière occurrence l'emporte.
+func (r TwitchUserRepo) Upsert(ctx context.Context, users []TwitchUser) ([]NameChange, error) {
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now().UTC()
+	latest := make(map[string]int, len(users))
+	unique := make([]TwitchUser, 0, len(users))
+	for _, u := range users {
+		if u.LastFetchedAt.IsZero() {
+			u.LastFetchedAt = now
+		}
+		if i, ok := latest[u.TwitchUserID]; ok {
+			unique[i] = u
+			continue
+		}
+		latest[u.TwitchUserID] = len(unique)
+		unique = append(unique, u)
+	}
+
+	var changes []NameChange
+	err := inTx(ctx, r.q, func(q querier) error {
+		for _, chunk := range chunks(unique) {
+			known, err := names(ctx, q, chunk)
+			if err != nil {
+				return err
+			}
+			var chunkChanges []NameChange
+			for _, u := range chunk {
+				old, ok := known[u.TwitchUserID]
+				// Un compte disparu avant son premier enrichissement n'a pas de nom à historiser
+				if !ok || old.login == "" || (old.login == u.Login && old.displayName == u.DisplayName) {
+					continue
+				}
+				chunkChanges = append(chunkChanges, NameChange{
+					TwitchUserID:   u.TwitchUserID,
+					OldLogin:       old.login,
+					NewLogin:       u.Login,
+					OldDisplayName: old.displayName,
+					NewDisplayName: u.DisplayName,
+					ChangedAt:      u.LastFetchedAt,
+				})
+			}
+			if err := (NameHistoryRepo{q: q}).Record(ctx, chunkChanges...); err != nil {
+				return err
+			}
+			if err := upsertTwitchUsers(ctx, q, chunk); err != nil {
+				return err
+			}
+			changes = append(changes, chunkChanges...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+type knownName struct {
+	login       string
+	displayName string
+}
+
+// names retourne les noms actuels des comptes déjà connus parmi users
+func names(ctx context.Context, q querier, users []TwitchUser) (map[string]knownName, error) {
+	args := make([]any, 0, len(users))
+	for _, u := range users {
+		args = append(args, u.TwitchUserID)
+	}
+	rows, err := q.QueryContext(ctx,
+		`SELECT twitch_user_id, login, display_name FROM twitch_users WHERE twitch_user_id IN (?`+strings.Repeat(",?", len(args)-1)+`)`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := make(map[string]knownName, len(users))
+	for rows.Next() {
+		var id string
+		var n knownName
+		if err := rows.Scan(&id, &n.login, &n.displayName); err != nil {
+			return nil, err
+		}
+		known[id] = n
+	}
+	return known, rows.Err()
+}
+
+// upsertTwitchUsers écrit une tranche de comptes en un seul INSERT ... ON DUPLICATE KEY UPDATE
+func upsertTwitchUsers(ctx context.Context, q querier, users []TwitchUser) error {
+	args := make([]any, 0, 13*len(users))
+	for _, u := range users {
+		var createdAt, imageHash any
+		if u.CreatedAt != nil {
+			createdAt = *u.CreatedAt
+		}
+		if u.ProfileImageHash != "" {
+			imageHash = u.ProfileImageHash
+		}
+		args = append(args, u.TwitchUserID, u.Login, u.DisplayName, createdAt, u.BroadcasterType, u.Type, u.ViewCount,
+			u.ProfileImageURL, imageHash, u.DefaultAvatar, u.OfflineImageURL, u.Description,
+			u.LastFetchedAt)
+	}
+	_, err := q.ExecContext(ctx, `
+INSERT INTO twitch_users (
+    twitch_user_id,
+    login,
+    display_name,
+    created_at,
+    broadcaster_type,
+    type,
+    view_count,
+    profile_image_url,
+    profile_image_hash,
+    default_avatar,
+    offline_image_url,
+    description,
+    last_fetched_at
+)
+VALUES `+placeholders(len(users), 13)+`
+ON DUPLICATE KEY UPDATE
+    login = VALUES(login),
+    display_name = VALUES(display_name),
+    created_at = COALESCE(VALUES(created_at), created_at),
+    broadcaster_type = VALUES(broadcaster_type),
+    type = VALUES(type),
+    view_count = VALUES(view_count),
+    profile_image_url = VALUES(profile_image_url),
+    profile_image_hash = VALUES(profile_image_hash),
+    default_avatar = VALUES(default_avatar),
+    offline_image_url = VALUES(offline_image_url),
+    description = VALUES(description),
+    status = 'active',
+    disappeared_at = NULL,
+    last_fetched_at = VALUES(last_fetched_at)
+`, args...)
+	return err
+}
+
+// ProfileImageHashes retourne les hash déjà calculés des images de profil urls (une URL
+// désigne toujours la même image) : seules les images absentes sont à télécharger
+func (r TwitchUserRepo) ProfileImageHashes(ctx context.Context, urls []string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	for _, chunk := range chunks(urls) {
+		args := make([]any, len(chunk))
+		for i, u := range chunk {
+			args[i] = u
+		}
+		rows, err := r.q.QueryContext(ctx, `
+SELECT profile_image_url, MIN(profile_image_hash)
+FROM twitch_users
+WHERE profile_image_url IN (?`+strings.Repeat(",?", len(chunk)-1)+`)
+  AND profile_image_hash IS NOT NULL
+GROUP BY profile_image_url
+`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var u, hash string
+			if err := rows.Scan(&u, &hash); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			hashes[u] = hash
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
+
+// Stale retourne, dans l'ordre et sans doublon, les comptes de ids à (ré)enrichir :
+// inconnus, enrichis avant maintenant - freshFor, ou ayant déjà changé de nom (à
+// surveiller de près). freshFor <= 0 retourne tous les comptes.
+func (r TwitchUserRepo) Stale(ctx context.Context, ids []string, freshFor time.Duration) ([]string, error) {
+	unique := make([]string, 0, len(ids))
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			unique = append(unique, id)
+		}
+	}
+	if freshFor <= 0 || len(unique) == 0 {
+		return unique, nil
+	}
+
+	cutoff := time.Now().UTC().Add(-freshFor)
+	fresh := make(map[string]struct{})
+	for _, chunk := range chunks(unique) {
+		args := make([]any, 0, len(chunk)+1)
+		for _, id := range chunk {
+			args = append(args, id)
+		}
+		args = append(args, cutoff)
+		rows, err := r.q.QueryContext(ctx, `
+SELECT tu.twitch_user_id
+FROM twitch_users tu
+WHERE tu.twitch_user_id IN (?`+strings.Repeat(",?", len(chunk)-1)+`)
+  AND tu.last_fetched_at >= ?
+  AND NOT EXISTS (SELECT 1 FROM twitch_user_names tun WHERE tun.twitch_user_id = tu.twitch_user_id)
+`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			fresh[id] = struct{}{}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	stale := make([]string, 0, len(unique)-len(fresh))
+	for _, id := range unique {
+		if _, ok := fresh[id]; !ok {
+			stale = append(stale, id)
+		}
+	}
+	return stale, nil
+}
+
+// RefreshCandidates retourne au plus limit comptes enrichis avant fetchedBefore, à
+// réenrichir en tâche de fond : d'abord ceux ayant déjà changé de nom ou présents dans
+// une session sauvegardée, puis les plus anciennement enrichis. Chaque ensemble (renommés,
+// sessions sauvegardées, autres) est lu par index et borné à limit avant d'être classé.
+func (r TwitchUserRepo) RefreshCandidates(ctx context.Context, fetchedBefore time.Time, limit int) ([]string, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT cand.twitch_user_id
+FROM (
+    (
+        SELECT tu.twitch_user_id, tu.last_fetched_at, 1 AS renamed, 0 AS saved
+        FROM (SELECT DISTINCT twitch_user_id FROM twitch_user_names) tun
+        JOIN twitch_users tu ON tu.twitch_user_id = tun.twitch_user_id
+        WHERE tu.last_fetched_at < ?
+        ORDER BY tu.last_fetched_at
+        LIMIT ?
+    )
+    UNION ALL
+    (
+        SELECT tu.twitch_user_id, tu.last_fetched_at, 0 AS renamed, 1 AS saved
+        FROM (
+            SELECT DISTINCT cc.user_key
+            FROM sessions s
+            JOIN captures c ON c.session_id = s.id
+            JOIN capture_chatters cc ON cc.capture_id = c.id
+            WHERE s.status = 'saved'
+        ) sk
+        JOIN twitch_user_keys k ON k.user_key = sk.user_key
+        JOIN twitch_users tu ON tu.twitch_user_id = k.twitch_user_id
+        WHERE tu.last_fetched_at < ?
+        ORDER BY tu.last_fetched_at
+        LIMIT ?
+    )
+    UNION ALL
+    (
+        SELECT tu.twitch_user_id, tu.last_fetched_at, 0 AS renamed, 0 AS saved
+        FROM twitch_users tu
+        WHERE tu.last_fetched_at < ?
+        ORDER BY tu.last_fetched_at
+        LIMIT ?
+    )
+) cand
+GROUP BY cand.twitch_user_id, cand.last_fetched_at
+ORDER BY MAX(cand.renamed) + MAX(cand.saved) DESC, cand.last_fetched_at ASC
+LIMIT ?
+`, fetchedBefore, limit, fetchedBefore, limit, fetchedBefore, limit, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MarkMissing enregistre des comptes absents de la réponse Twitch (statut missing).
+// disappeared_at garde la première disparition constatée ; last_fetched_at vaut at, pour
+// que ces comptes ne soient pas redemandés en boucle. Un compte encore inconnu est créé
+// sans nom.
+func (r TwitchUserRepo) MarkMissing(ctx context.Context, ids []string, at time.Time) error {
+	for _, chunk := range chunks(ids) {
+		args := make([]any, 0, 3*len(chunk))
+		for _, id := range chunk {
+			args = append(args, id, at, at)
+		}
+		if _, err := r.q.ExecContext(ctx, `
+INSERT INTO twitch_users (twitch_user_id, login, display_name, status, disappeared_at, last_fetched_at)
+VALUES `+strings.Repeat("(?, '', '', 'missing', ?, ?),", len(chunk)-1)+`(?, '', '', 'missing', ?, ?)
+ON DUPLICATE KEY UPDATE
+    status = 'missing',
+    disappeared_at = COALESCE(disappeared_at, VALUES(disappeared_at)),
+    last_fetched_at = VALUES(last_fetched_at)
+`, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountMissing compte les chatters d'une session (éventuellement limitée à des broadcasters)
+// dont le compte a disparu depuis
+func (r TwitchUserRepo) CountMissing(ctx context.Context, sessionID int64, broadcasterIDs []string) (int64, error) {
+	filter, args := broadcasterFilter("c.broadcaster_id", broadcasterIDs)
+	var n int64
+	err := r.q.QueryRowContext(ctx, `
+SELECT COUNT(DISTINCT cc.user_key)
+FROM capture_chatters cc
+JOIN captures c ON cc.capture_id = c.id
+JOIN twitch_user_keys k ON k.user_key = cc.user_key
+JOIN twitch_users tu ON tu.twitch_user_id = k.twitch_user_id
+WHERE c.session_id = ?`+filter+` AND tu.status = 'missing'`,
+		append([]any{sessionID}, args...)...,
+	).Scan(&n)
+	return n, err
+}
+
+// CreationDays retourne les jours de création de compte les plus fréquents parmi les chatters d'une session
+func (r TwitchUserRepo) CreationDays(ctx context.Context, sessionID int64, broadcasterIDs []string, limit int) ([]CreationDay, error) {
+	filter, args := broadcasterFilter("c.broadcaster_id", broadcasterIDs)
+	rows, err := r.q.QueryContext(ctx, `
+SELECT DATE(tu.created_at) AS d, COUNT(DISTINCT cc.user_key) AS cnt
+FROM capture_chatters cc
+JOIN captures c ON cc.capture_id = c.id
+JOIN twitch_user_keys k ON k.user_key = cc.user_key
+JOIN twitch_users tu ON tu.twitch_user_id = k.twitch_user_id
+WHERE c.session_id = ?`+filter+` AND tu.created_at IS NOT NULL
+GROUP BY d
+ORDER BY cnt DESC
+LIMIT ?
+`, append(append([]any{sessionID}, args...), limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []CreationDay
+	for rows.Next() {
+		var d CreationDay
+		if err := rows.Scan(&d.Date, &d.Count); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// LoginsCreatedOn retourne les logins des chatters d'une session dont le compte a été créé le jour donné
+func (r TwitchUserRepo) LoginsCreatedOn(ctx context.Context, sessionID int64, day time.Time, broadcasterIDs []string) ([]string, error) {
+	filter, args := broadcasterFilter("c.broadcaster_id", broadcasterIDs)
+	rows, err := r.q.QueryContext(ctx, `
+SELECT DISTINCT tu.login
+FROM capture_chatters cc
+JOIN captures c ON cc.capture_id = c.id
+JOIN twitch_user_keys k ON k.user_key = cc.user_key
+JOIN twitch_users tu ON tu.twitch_user_id = k.twitch_user_id
+WHERE c.session_id = ?`+filter+` AND DATE(tu.created_at) = DATE(?)
+ORDER BY tu.login ASC
+`, append(append([]any{sessionID}, args...), day)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logins []string
+	for rows.Next() {
+		var login string
+		if err := rows.Scan(&login); err != nil {
+			return nil, err
+		}
+		logins = append(logins, login)
+	}
+	return logins, rows.Err()
+}
+
+// CountCreatedOn compte, pour chacun des jours donnés (clé YYYY-MM-DD), les chatters d'une
+// session dont le compte a été créé ce jour-là
+func (r TwitchUserRepo) CountCreatedOn(ctx context.Context, sessionID int64, days []time.Time, broadcasterIDs []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(days))
+	if len(days) == 0 {
+		return counts, nil
+	}
+	dayArgs := make([]any, len(days))
+	for i, d := range days {
+		dayArgs[i] = d.Format("2006-01-02")
+	}
+	filter, args := broadcasterFilter("c.broadcaster_id", broadcasterIDs)
+	rows, err := r.q.QueryContext(ctx, `
+SELECT DATE(tu.created_at) AS d, COUNT(DISTINCT cc.user_key)
+FROM capture_chatters cc
+JOIN captures c ON cc.capture_id = c.id
+JOIN twitch_user_keys k ON k.user_key = cc.user_key
+JOIN twitch_users tu ON tu.twitch_user_id = k.twitch_user_id
+WHERE c.session_id = ?`+filter+` AND DATE(tu.created_at) IN `+placeholders(1, len(days))+`
+GROUP BY d
+`, append(append([]any{sessionID}, args...), dayArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d time.Time
+		var n int64
+		if err := rows.Scan(&d, &n); err != nil {
+			return nil, err
+		}
+		counts[d.Format("2006-01-02")] = n
+	}
+	return counts, rows.Err()
+}
+
+// CaptureStats résume les comptes des chatters d'une capture
+type CaptureStats struct {
+	Chatters       int64      // chatters de la capture
+	Known          int64      // chatters dont la date de création est connue (enrichis)
+	DefaultAvatars int64      // chatters à l'avatar par défaut
+	TopDay         *time.Time // jour de création le plus fréquent, nil sans compte enrichi
+	TopDayAccounts int64      // comptes créés ce jour-là
+}
+
+// CaptureStats retourne le résumé des comptes des chatters d'une capture
+func (r TwitchUserRepo) CaptureStats(ctx context.Context, captureID int64) (*CaptureStats, error) {
+	var s CaptureStats
+	err := r.q.QueryRowContext(ctx, `
+SELECT COUNT(*), COUNT(tu.created_at), COALESCE(SUM(CASE WHEN tu.default_avatar THEN 1 ELSE 0 END), 0)
+FROM capture_chatters cc
+LEFT JOIN twitch_user_keys k ON k.user_key = cc.user_key
+LEFT JOIN twitch_users tu ON tu.twitch_user_id = k.twitch_user_id
+WHERE cc.capture_id = ?`, captureID).Scan(&s.Chatters, &s.Known, &s.DefaultAvatars)
+	if err != nil {
+		return nil, err
+	}
+
+	var day time.Time
+	err = r.q.QueryRowContext(ctx, `
+SELECT DATE(tu.created_at) AS d, COUNT(*) AS cnt
+FROM capture_chatters cc
+JOIN twitch_user_keys k ON k.user_key = cc.user_key
+JOIN twitch_users tu ON tu.twitch_user_id = k.twitch_user_id
+WHERE cc.capture_id = ? AND tu.created_at IS NOT NULL
+GROUP BY d
+ORDER BY cnt DESC
+LIMIT 1`, captureID).Scan(&day, &s.TopDayAccounts)
+	switch {
+	case err == nil:
+		s.TopDay = &day
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+	return &s, nil
+}
+
+// CaptureRecentAccounts compte les chatters d'une capture dont le compte a été créé depuis since
+func (r TwitchUserRepo) CaptureRecentAccounts(ctx context.Context, captureID int64, since time.Time) (int64, error) {
+	var n int64
+	err := r.q.QueryRowContext(ctx, `
+SELECT COUNT(*)
+FROM capture_chatters cc
+JOIN twitch_user_keys k ON k.user_key = cc.user_key
+JOIN twitch_users tu ON tu.twitch_user_id = k.twitch_user_id
+WHERE cc.capture_id = ? AND tu.created_at >= ?`, captureID, since).Scan(&n)
+	return n, err
+}
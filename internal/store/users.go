@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// TierFree est le palier par défaut des utilisateurs
+const TierFree = "free"
+
+// User est un utilisateur de l'application (modérateur connecté via Twitch)
+type User struct {
+	ID           int64
+	TwitchUserID string
+	Login        string
+	DisplayName  string
+	AvatarURL    string
+	Tier         string // palier (quota de sessions sauvegardées), modifié hors application
+}
+
+// UserRepo accède à la table users
+type UserRepo struct {
+	q querier
+}
+
+// Upsert crée ou met à jour un utilisateur et retourne son id interne
+func (r UserRepo) Upsert(ctx context.Context, u User) (int64, error) {
+	res, err := r.q.ExecContext(ctx, `
+INSERT INTO users (twitch_user_id, login, display_name, avatar_url, created_at, updated_at)
+VALUES (?, ?, ?, ?, NOW(6), NOW(6))
+ON DUPLICATE KEY UPDATE
+  login = VALUES(login),
+  display_name = VALUES(display_name),
+  avatar_url = VALUES(avatar_url),
+  updated_at = NOW(6)
+`, u.TwitchUserID, u.Login, u.DisplayName, u.AvatarURL)
+	if err != nil {
+		return 0, err
+	}
+
+	// Si user existait déjà, il faut le relire pour connaître son id interne
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 1 {
+		if lastID, err := res.LastInsertId(); err == nil && lastID > 0 {
+			return lastID, nil
+		}
+	}
+
+	var id int64
+	if err := r.q.QueryRowContext(ctx, `SELECT id FROM users WHERE twitch_user_id = ?`, u.TwitchUserID).Scan(&id); err != nil {
+		return 0, notFound(err)
+	}
+	return id, nil
+}
+
+// ByWebSession retourne l'utilisateur d'une session web non expirée
+func (r UserRepo) ByWebSession(ctx context.Context, sessionID string) (*User, error) {
+	var u User
+	err := r.q.QueryRowContext(ctx, `
+SELECT u.id, u.twitch_user_id, u.login, u.display_name, COALESCE(u.avatar_url, ''), u.tier
+FROM web_sessions s
+JOIN users u ON s.user_id = u.id
+WHERE s.session_id = ? AND s.expires_at > NOW(6)
+LIMIT 1
+`, sessionID).Scan(&u.ID, &u.TwitchUserID, &u.Login, &u.DisplayName, &u.AvatarURL, &u.Tier)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &u, nil
+}
+
+// ByID retourne un utilisateur par son id interne
+func (r UserRepo) ByID(ctx context.Context, id int64) (*User, error) {
+	var u User
+	err := r.q.QueryRowContext(ctx, `
+SELECT id, twitch_user_id, login, display_name, COALESCE(avatar_url, ''), tier
+FROM users
+WHERE id = ?
+`, id).Scan(&u.ID, &u.TwitchUserID, &u.Login, &u.DisplayName, &u.AvatarURL, &u.Tier)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &u, nil
+}
+
+// WebSession est une session navigateur ; les tokens Twitch y sont stockés
+type WebSession struct {
+	SessionID      string
+	UserID         int64
+	AccessToken    string
+	RefreshToken   string
+	Scopes         []string
+	CreatedAt      time.Time
+	LastActivityAt time.Time
+	ExpiresAt      time.Time
+}
+
+// WebSessionRepo accède à la table web_sessions
+type WebSessionRepo struct {
+	q querier
+}
+
+// Create enregistre une session web
+func (r WebSessionRepo) Create(ctx context.Context, ws WebSession) error {
+	scopes, err := json.Marshal(ws.Scopes)
+	if err != nil {
+		return err
+	}
+	_, err = r.q.ExecContext(ctx, `
+INSERT INTO web_sessions (session_id, user_id, access_token, refresh_token, scopes, created_at, last_activity_at, expires_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`, ws.SessionID, ws.UserID, ws.AccessToken, ws.RefreshToken, string(scopes), ws.CreatedAt, ws.LastActivityAt, ws.ExpiresAt)
+	return err
+}
+
+// webSessionColumns sont les colonnes lues par scanWebSession
+const webSessionColumns = `ws.session_id, ws.user_id, ws.access_token, ws.refresh_token, ws.scopes,
+ws.created_at, ws.last_activity_at, ws.expires_at`
+
+func scanWebSession(row *sql.Row) (*WebSession, error) {
+	var ws WebSession
+	var refreshToken, scopes *string
+	err := row.Scan(&ws.SessionID, &ws.UserID, &ws.AccessToken, &refreshToken, &scopes, &ws.CreatedAt, &ws.LastActivityAt, &ws.ExpiresAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if refreshToken != nil {
+		ws.RefreshToken = *refreshToken
+	}
+	if scopes != nil {
+		_ = json.Unmarshal([]byte(*scopes), &ws.Scopes)
+	}
+	return &ws, nil
+}
+
+// Get retourne une session web non expirée
+func (r WebSessionRepo) Get(ctx context.Context, sessionID string) (*WebSession, error) {
+	return scanWebSession(r.q.QueryRowContext(ctx, `
+SELECT `+webSessionColumns+`
+FROM web_sessions ws
+WHERE ws.session_id = ? AND ws.expires_at > NOW(6)
+`, sessionID))
+}
+
+// Touch met à jour last_activity_at
+func (r WebSessionRepo) Touch(ctx context.Context, sessionID string) error {
+	_, err := r.q.ExecContext(ctx, `UPDATE web_sessions SET last_activity_at = NOW(6) WHERE session_id = ?`, sessionID)
+	return err
+}
+
+// Delete supprime une session web
+func (r WebSessionRepo) Delete(ctx context.Context, sessionID string) error {
+	_, err := r.q.ExecContext(ctx, `DELETE FROM web_sessions WHERE session_id = ?`, sessionID)
+	return err
+}
+
+// ForAnalysisSession retourne la session web la plus récemment active du propriétaire d'une
+// session d'analyse (le worker appelle Twitch avec son token)
+func (r WebSessionRepo) ForAnalysisSession(ctx context.Context, analysisSessionID int64) (*WebSession, error) {
+	return scanWebSession(r.q.QueryRowContext(ctx, `
+SELECT `+webSessionColumns+`
+FROM web_sessions ws
+JOIN sessions s ON s.user_id = ws.user_id
+WHERE s.id = ? AND ws.expires_at > NOW(6)
+ORDER BY ws.last_activity_at DESC
+LIMIT 1
+`, analysisSessionID))
+}
+
+// Latest retourne la session web non expirée la plus récemment active d'un utilisateur
+// (requêtes authentifiées par un token d'API, listener EventSub)
+func (r WebSessionRepo) Latest(ctx context.Context, userID int64) (*WebSession, error) {
+	return scanWebSession(r.q.QueryRowContext(ctx, `
+SELECT `+webSessionColumns+`
+FROM web_sessions ws
+WHERE ws.user_id = ? AND ws.expires_at > NOW(6)
+ORDER BY ws.last_activity_at DESC
+LIMIT 1
+`, userID))
+}
+
+// UpdateTokens remplace les tokens Twitch d'une session web après leur renouvellement
+func (r WebSessionRepo) UpdateTokens(ctx context.Context, sessionID, accessToken, refreshToken string) error {
+	_, err := r.q.ExecContext(ctx, `UPDATE web_sessions SET access_token = ?, refresh_token = ? WHERE session_id = ?`,
+		accessToken, refreshToken, sessionID)
+	return err
+}
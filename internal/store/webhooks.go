@@ -0,0 +1,265 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Événements notifiés par webhook
+const (
+	WebhookCaptureFinished    = "capture_finished"    // capture enregistrée et enrichie
+	WebhookCreationBurst      = "creation_burst"      // comptes créés le même jour au-delà du seuil
+	WebhookSuspiciousAccounts = "suspicious_accounts" // comptes suspects d'un enrichissement au-delà du seuil
+	WebhookJobFailed          = "job_failed"          // job d'une session en échec
+	WebhookAlertTriggered     = "alert_triggered"     // règle d'alerte déclenchée par une capture
+	WebhookTest               = "test"                // envoi de test depuis le gateway (sans abonnement)
+)
+
+// Formats du corps des livraisons
+const (
+	WebhookFormatGeneric = "generic"
+	WebhookFormatDiscord = "discord"
+	WebhookFormatSlack   = "slack"
+)
+
+// Statuts des livraisons
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook est un abonnement d'un utilisateur aux notifications
+type Webhook struct {
+	ID                     int64
+	UserID                 int64
+	Name                   string
+	URL                    string
+	Format                 string
+	Secret                 string // clé HMAC-SHA256 des signatures
+	Events                 []string
+	CreationBurstThreshold int
+	SuspiciousThreshold    int
+	Enabled                bool
+	CreatedAt              time.Time
+}
+
+// Subscribed indique si le webhook est abonné à l'événement (le test est toujours envoyé)
+func (w Webhook) Subscribed(event string) bool {
+	return event == WebhookTest || slices.Contains(w.Events, event)
+}
+
+// WebhookDelivery est une livraison du journal
+type WebhookDelivery struct {
+	ID             int64
+	WebhookID      int64
+	WebhookName    string
+	Event          string
+	Body           json.RawMessage
+	Status         string
+	Attempts       int
+	ResponseStatus *int // statut HTTP de la dernière tentative, nil sans réponse
+	LastError      string
+	CreatedAt      time.Time
+	LastAttemptAt  *time.Time
+	DeliveredAt    *time.Time
+}
+
+// WebhookRepo accède aux tables webhooks et webhook_deliveries
+type WebhookRepo struct {
+	q querier
+}
+
+const webhookColumns = `w.id, w.user_id, w.name, w.url, w.format, w.secret, w.events,
+  w.creation_burst_threshold, w.suspicious_threshold, w.enabled, w.created_at`
+
+func scanWebhook(row interface{ Scan(...any) error }, extra ...any) (*Webhook, error) {
+	var w Webhook
+	var events string
+	dest := append([]any{&w.ID, &w.UserID, &w.Name, &w.URL, &w.Format, &w.Secret, &events,
+		&w.CreationBurstThreshold, &w.SuspiciousThreshold, &w.Enabled, &w.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	w.Events = strings.Fields(events)
+	return &w, nil
+}
+
+// Create enregistre un webhook et retourne son id
+func (r WebhookRepo) Create(ctx context.Context, w Webhook) (int64, error) {
+	res, err := r.q.ExecContext(ctx, `
+INSERT INTO webhooks (user_id, name, url, format, secret, events, creation_burst_threshold, suspicious_threshold, enabled, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`, w.UserID, w.Name, w.URL, w.Format, w.Secret, strings.Join(w.Events, " "),
+		w.CreationBurstThreshold, w.SuspiciousThreshold, w.Enabled, w.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListByUser retourne les webhooks d'un utilisateur, du plus récent au plus ancien
+func (r WebhookRepo) ListByUser(ctx context.Context, userID int64) ([]Webhook, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT `+webhookColumns+`
+FROM webhooks w
+WHERE w.user_id = ?
+ORDER BY w.created_at DESC, w.id DESC
+`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *w)
+	}
+	return out, rows.Err()
+}
+
+// Subscribers retourne les webhooks actifs d'un utilisateur abonnés à l'événement
+func (r WebhookRepo) Subscribers(ctx context.Context, userID int64, event string) ([]Webhook, error) {
+	all, err := r.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var out []Webhook
+	for _, w := range all {
+		if w.Enabled && w.Subscribed(event) {
+			out = append(out, w)
+		}
+	}
+	return out, nil
+}
+
+// Get retourne un webhook de l'utilisateur
+func (r WebhookRepo) Get(ctx context.Context, userID, id int64) (*Webhook, error) {
+	w, err := scanWebhook(r.q.QueryRowContext(ctx,
+		`SELECT `+webhookColumns+` FROM webhooks w WHERE w.id = ? AND w.user_id = ?`, id, userID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return w, nil
+}
+
+// SetEnabled active ou suspend un webhook de l'utilisateur
+func (r WebhookRepo) SetEnabled(ctx context.Context, userID, id int64, enabled bool) error {
+	if _, err := r.Get(ctx, userID, id); err != nil {
+		return err
+	}
+	_, err := r.q.ExecContext(ctx, `UPDATE webhooks SET enabled = ? WHERE id = ? AND user_id = ?`, enabled, id, userID)
+	return err
+}
+
+// Delete supprime un webhook de l'utilisateur et son journal de livraisons
+func (r WebhookRepo) Delete(ctx context.Context, userID, id int64) error {
+	return inTx(ctx, r.q, func(q querier) error {
+		res, err := q.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ? AND user_id = ?`, id, userID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		// ON DELETE CASCADE, explicite pour les moteurs qui ne l'appliquent pas
+		_, err = q.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id)
+		return err
+	})
+}
+
+// DeliverWebhookPayload est le payload des jobs DELIVER_WEBHOOK (une tentative de livraison)
+type DeliverWebhookPayload struct {
+	DeliveryID int64 `json:"delivery_id"`
+}
+
+// CreateDelivery ajoute une livraison en attente au journal, avec le job DELIVER_WEBHOOK
+// de sa première tentative, et retourne son id
+func (r WebhookRepo) CreateDelivery(ctx context.Context, webhookID int64, event string, body []byte) (int64, error) {
+	var id int64
+	err := inTx(ctx, r.q, func(q querier) error {
+		res, err := q.ExecContext(ctx,
+			`INSERT INTO webhook_deliveries (webhook_id, event, body, status, created_at) VALUES (?, ?, ?, 'pending', NOW(6))`,
+			webhookID, event, string(body),
+		)
+		if err != nil {
+			return err
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		_, err = JobRepo{q: q}.Enqueue(ctx, JobDeliverWebhook, DeliverWebhookPayload{DeliveryID: id})
+		return err
+	})
+	return id, err
+}
+
+// Delivery retourne une livraison et son webhook
+func (r WebhookRepo) Delivery(ctx context.Context, id int64) (*WebhookDelivery, *Webhook, error) {
+	var d WebhookDelivery
+	w, err := scanWebhook(r.q.QueryRowContext(ctx, `
+SELECT `+webhookColumns+`,
+       d.id, d.webhook_id, d.event, d.body, d.status, d.attempts, d.response_status,
+       COALESCE(d.last_error, ''), d.created_at, d.last_attempt_at, d.delivered_at
+FROM webhook_deliveries d
+JOIN webhooks w ON w.id = d.webhook_id
+WHERE d.id = ?
+`, id), &d.ID, &d.WebhookID, &d.Event, &d.Body, &d.Status, &d.Attempts, &d.ResponseStatus,
+		&d.LastError, &d.CreatedAt, &d.LastAttemptAt, &d.DeliveredAt)
+	if err != nil {
+		return nil, nil, notFound(err)
+	}
+	d.WebhookName = w.Name
+	return &d, w, nil
+}
+
+// RecordAttempt enregistre le résultat d'une tentative : status vaut DeliveryDelivered,
+// DeliveryPending (nouvelle tentative prévue) ou DeliveryFailed (abandon) ; responseStatus
+// vaut 0 sans réponse HTTP
+func (r WebhookRepo) RecordAttempt(ctx context.Context, id int64, status string, responseStatus int, errMsg string) error {
+	if len(errMsg) > 255 {
+		errMsg = errMsg[:255]
+	}
+	_, err := r.q.ExecContext(ctx, `
+UPDATE webhook_deliveries
+SET status = ?, attempts = attempts + 1, response_status = NULLIF(?, 0), last_error = NULLIF(?, ''),
+    last_attempt_at = NOW(6), delivered_at = IF(? = 'delivered', NOW(6), NULL)
+WHERE id = ?
+`, status, responseStatus, errMsg, status, id)
+	return err
+}
+
+// ListDeliveries retourne les dernières livraisons des webhooks d'un utilisateur
+func (r WebhookRepo) ListDeliveries(ctx context.Context, userID int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := r.q.QueryContext(ctx, `
+SELECT d.id, d.webhook_id, w.name, d.event, d.body, d.status, d.attempts, d.response_status,
+       COALESCE(d.last_error, ''), d.created_at, d.last_attempt_at, d.delivered_at
+FROM webhook_deliveries d
+JOIN webhooks w ON w.id = d.webhook_id
+WHERE w.user_id = ?
+ORDER BY d.created_at DESC, d.id DESC
+LIMIT ?
+`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.WebhookName, &d.Event, &d.Body, &d.Status, &d.Attempts,
+			&d.ResponseStatus, &d.LastError, &d.CreatedAt, &d.LastAttemptAt, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,415 @@
+// Package twitch fournit un client typé pour le proxy twitch-api.
+//
+// Tous les appels Helix des services (gateway, worker) passent par ce client,
+// et donc par le rate limiter et le cache du proxy.
+package twitch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/eventsub"
+)
+
+// MaxUsersPerRequest est le nombre maximal d'IDs acceptés par /helix/users
+const MaxUsersPerRequest = 100
+
+// Erreurs typées, à tester avec errors.Is
+var (
+	ErrUnauthorized = errors.New("twitch: unauthorized")
+	ErrForbidden    = errors.New("twitch: forbidden")
+	ErrRateLimited  = errors.New("twitch: rate limited")
+	ErrNotFound     = errors.New("twitch: not found")
+	ErrConflict     = errors.New("twitch: conflict")
+)
+
+// APIError décrit une réponse non-2xx du proxy (ou de Twitch via le proxy)
+type APIError struct {
+	Endpoint   string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("twitch-api %s returned %d: %s", e.Endpoint, e.StatusCode, e.Body)
+}
+
+// Unwrap associe le code HTTP à l'erreur typée correspondante
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	}
+	return nil
+}
+
+// User représente un compte Twitch tel que retourné par /helix/users
+type User struct {
+	ID              string `json:"id"`
+	Login           string `json:"login"`
+	DisplayName     string `json:"display_name"`
+	Type            string `json:"type"`
+	BroadcasterType string `json:"broadcaster_type"`
+	ViewCount       int    `json:"view_count"`
+	CreatedAt       string `json:"created_at"`
+	Description     string `json:"description"`
+	ProfileImageURL string `json:"profile_image_url"`
+	OfflineImageURL string `json:"offline_image_url"`
+}
+
+// IsDefaultAvatar indique si l'image de profil est un des avatars attribués par Twitch
+// aux comptes qui n'en ont pas choisi (static-cdn.jtvnw.net/user-default-pictures*)
+func IsDefaultAvatar(profileImageURL string) bool {
+	return profileImageURL == "" || strings.Contains(profileImageURL, "/user-default-pictures")
+}
+
+// Chatter représente un utilisateur connecté au chat d'une chaîne
+type Chatter struct {
+	UserID    string `json:"user_id"`
+	UserLogin string `json:"user_login"`
+	UserName  string `json:"user_name"`
+}
+
+// ChattersPage est une page de /chatters
+type ChattersPage struct {
+	Chatters []Chatter
+	Cursor   string // vide sur la dernière page
+	Total    int    // nombre total de chatters de la chaîne
+}
+
+// Follower représente un compte qui suit une chaîne
+type Follower struct {
+	UserID     string    `json:"user_id"`
+	UserLogin  string    `json:"user_login"`
+	UserName   string    `json:"user_name"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// FollowersPage est une page de /channels/followers, les follows les plus récents d'abord
+type FollowersPage struct {
+	Followers []Follower
+	Cursor    string // vide sur la dernière page
+	Total     int    // nombre total de followers de la chaîne
+}
+
+// MaxFollowersPerRequest est la taille maximale d'une page de /channels/followers
+const MaxFollowersPerRequest = 100
+
+// ModeratedChannel représente une chaîne modérée par l'utilisateur
+type ModeratedChannel struct {
+	BroadcasterID    string `json:"broadcaster_id"`
+	BroadcasterLogin string `json:"broadcaster_login"`
+	BroadcasterName  string `json:"broadcaster_name"`
+}
+
+type pagination struct {
+	Cursor string `json:"cursor"`
+}
+
+// Client appelle le proxy twitch-api
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient crée un client pour le proxy accessible à baseURL (ex: http://twitch-api:8081)
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// GetCurrentUser retourne le compte associé au token
+func (c *Client) GetCurrentUser(ctx context.Context, accessToken string) (*User, error) {
+	var resp struct {
+		Data []User `json:"data"`
+	}
+	if err := c.get(ctx, "/users", nil, accessToken, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no user data in response: %w", ErrNotFound)
+	}
+	return &resp.Data[0], nil
+}
+
+// GetUsers récupère les comptes correspondant aux IDs (MaxUsersPerRequest au maximum).
+// Les comptes inconnus de Twitch sont simplement absents du résultat.
+// Avec un accessToken vide, le proxy utilise l'app token de l'application.
+func (c *Client) GetUsers(ctx context.Context, accessToken string, ids []string) ([]User, error) {
+	if len(ids) > MaxUsersPerRequest {
+		return nil, fmt.Errorf("too many ids: %d > %d", len(ids), MaxUsersPerRequest)
+	}
+	params := url.Values{}
+	for _, id := range ids {
+		params.Add("id", id)
+	}
+	var resp struct {
+		Data []User `json:"data"`
+	}
+	if err := c.get(ctx, "/users", params, accessToken, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// GetUser récupère un compte par son ID
+func (c *Client) GetUser(ctx context.Context, accessToken, id string) (*User, error) {
+	users, err := c.GetUsers(ctx, accessToken, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("user %s: %w", id, ErrNotFound)
+	}
+	return &users[0], nil
+}
+
+// GetChatters récupère une page de chatters
+func (c *Client) GetChatters(ctx context.Context, accessToken, broadcasterID, moderatorID string, first int, after string) (*ChattersPage, error) {
+	params := url.Values{}
+	params.Set("broadcaster_id", broadcasterID)
+	params.Set("moderator_id", moderatorID)
+	if first > 0 {
+		params.Set("first", strconv.Itoa(first))
+	}
+	if after != "" {
+		params.Set("after", after)
+	}
+	var resp struct {
+		Data       []Chatter  `json:"data"`
+		Pagination pagination `json:"pagination"`
+		Total      int        `json:"total"`
+	}
+	if err := c.get(ctx, "/chatters", params, accessToken, &resp); err != nil {
+		return nil, err
+	}
+	return &ChattersPage{Chatters: resp.Data, Cursor: resp.Pagination.Cursor, Total: resp.Total}, nil
+}
+
+// GetFollowers récupère une page de followers d'une chaîne. Sans l'autorisation
+// moderator:read:followers d'un modérateur de la chaîne, la page est vide et seul Total est
+// renseigné.
+func (c *Client) GetFollowers(ctx context.Context, accessToken, broadcasterID string, first int, after string) (*FollowersPage, error) {
+	params := url.Values{}
+	params.Set("broadcaster_id", broadcasterID)
+	if first > 0 {
+		params.Set("first", strconv.Itoa(first))
+	}
+	if after != "" {
+		params.Set("after", after)
+	}
+	var resp struct {
+		Data       []Follower `json:"data"`
+		Pagination pagination `json:"pagination"`
+		Total      int        `json:"total"`
+	}
+	if err := c.get(ctx, "/followers", params, accessToken, &resp); err != nil {
+		return nil, err
+	}
+	return &FollowersPage{Followers: resp.Data, Cursor: resp.Pagination.Cursor, Total: resp.Total}, nil
+}
+
+// maxPages borne les boucles de pagination côté client
+const maxPages = 100
+
+// GetModeratedChannels récupère toutes les chaînes modérées par userID, en suivant
+// les curseurs de pagination (100 par page).
+func (c *Client) GetModeratedChannels(ctx context.Context, accessToken, userID string) ([]ModeratedChannel, error) {
+	var all []ModeratedChannel
+	cursor := ""
+	for page := 0; page < maxPages; page++ {
+		params := url.Values{}
+		params.Set("user_id", userID)
+		params.Set("first", "100")
+		if cursor != "" {
+			params.Set("after", cursor)
+		}
+		var resp struct {
+			Data       []ModeratedChannel `json:"data"`
+			Pagination pagination         `json:"pagination"`
+		}
+		if err := c.get(ctx, "/moderated-channels", params, accessToken, &resp); err != nil {
+			return nil, err
+		}
+		all = append(all, resp.Data...)
+
+		cursor = resp.Pagination.Cursor
+		if cursor == "" || len(resp.Data) == 0 {
+			break
+		}
+	}
+	return all, nil
+}
+
+type noCacheKey struct{}
+
+// NoCache retourne un contexte demandant au proxy d'ignorer son cache
+// (header Cache-Control: no-cache) pour les appels effectués avec ce contexte.
+func NoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// CreateEventSubSubscription crée un abonnement EventSub (transport webhook, app token du
+// proxy) ; Twitch le vérifie ensuite en envoyant un challenge au callback.
+// ErrConflict : l'abonnement existe déjà.
+func (c *Client) CreateEventSubSubscription(ctx context.Context, subType string, condition map[string]string, callback, secret string) (*eventsub.Subscription, error) {
+	return c.createEventSubSubscription(ctx, "", subType, condition,
+		eventsub.Transport{Method: eventsub.TransportWebhook, Callback: callback, Secret: secret})
+}
+
+// CreateEventSubWebSocketSubscription crée un abonnement EventSub rattaché à la session
+// WebSocket sessionID ; Twitch exige le token de l'utilisateur (celui de la condition, ou le
+// modérateur pour channel.follow). L'abonnement disparaît avec la session.
+func (c *Client) CreateEventSubWebSocketSubscription(ctx context.Context, accessToken, subType string, condition map[string]string, sessionID string) (*eventsub.Subscription, error) {
+	return c.createEventSubSubscription(ctx, accessToken, subType, condition,
+		eventsub.Transport{Method: eventsub.TransportWebSocket, SessionID: sessionID})
+}
+
+func (c *Client) createEventSubSubscription(ctx context.Context, accessToken, subType string, condition map[string]string, transport eventsub.Transport) (*eventsub.Subscription, error) {
+	body, err := json.Marshal(map[string]any{
+		"type":      subType,
+		"version":   eventsub.Version(subType),
+		"condition": condition,
+		"transport": transport,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data []eventsub.Subscription `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/eventsub/subscriptions", nil, body, accessToken, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no subscription in response: %w", ErrNotFound)
+	}
+	return &resp.Data[0], nil
+}
+
+// EventSubSubscriptions retourne tous les abonnements EventSub de l'application
+func (c *Client) EventSubSubscriptions(ctx context.Context) ([]eventsub.Subscription, error) {
+	var all []eventsub.Subscription
+	cursor := ""
+	for page := 0; page < maxPages; page++ {
+		params := url.Values{}
+		if cursor != "" {
+			params.Set("after", cursor)
+		}
+		var resp struct {
+			Data       []eventsub.Subscription `json:"data"`
+			Pagination pagination              `json:"pagination"`
+		}
+		if err := c.get(ctx, "/eventsub/subscriptions", params, "", &resp); err != nil {
+			return nil, err
+		}
+		all = append(all, resp.Data...)
+
+		cursor = resp.Pagination.Cursor
+		if cursor == "" || len(resp.Data) == 0 {
+			break
+		}
+	}
+	return all, nil
+}
+
+// DeleteEventSubSubscription supprime un abonnement EventSub (ErrNotFound s'il n'existe plus),
+// avec le token qui l'a créé : vide pour l'app token (webhook), celui de l'utilisateur pour
+// un abonnement websocket
+func (c *Client) DeleteEventSubSubscription(ctx context.Context, accessToken, id string) error {
+	return c.do(ctx, http.MethodDelete, "/eventsub/subscriptions", url.Values{"id": {id}}, nil, accessToken, nil)
+}
+
+// Token est un token utilisateur renouvelé
+type Token struct {
+	AccessToken  string   `json:"access_token"`
+	RefreshToken string   `json:"refresh_token"`
+	ExpiresIn    int      `json:"expires_in"`
+	Scope        []string `json:"scope"`
+}
+
+// RefreshToken renouvelle un token utilisateur (grant refresh_token, via le proxy qui détient
+// le secret de l'application). ErrUnauthorized : refresh token refusé, reconnexion nécessaire.
+func (c *Client) RefreshToken(ctx context.Context, refreshToken string) (*Token, error) {
+	body, err := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	if err != nil {
+		return nil, err
+	}
+	var tok Token
+	if err := c.do(ctx, http.MethodPost, "/oauth/refresh", nil, body, "", &tok); err != nil {
+		return nil, err
+	}
+	if tok.AccessToken == "" {
+		return nil, fmt.Errorf("no access_token in refresh response")
+	}
+	return &tok, nil
+}
+
+// get effectue un GET sur le proxy et décode la réponse JSON dans dest
+func (c *Client) get(ctx context.Context, endpoint string, params url.Values, accessToken string, dest interface{}) error {
+	return c.do(ctx, http.MethodGet, endpoint, params, nil, accessToken, dest)
+}
+
+// do effectue une requête sur le proxy, avec un corps JSON s'il est non nil, et décode
+// la réponse JSON dans dest s'il est non nil
+func (c *Client) do(ctx context.Context, method, endpoint string, params url.Values, body []byte, accessToken string, dest interface{}) error {
+	u := c.baseURL + endpoint
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	if noCache, _ := ctx.Value(noCacheKey{}).(bool); noCache {
+		req.Header.Set("Cache-Control", "no-cache")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{Endpoint: endpoint, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	if dest == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+		return fmt.Errorf("decode %s response: %w", endpoint, err)
+	}
+	return nil
+}
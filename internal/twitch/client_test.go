@@ -0,0 +1,16 @@
+package twitch
+
+import "testing"
+
+func TestIsDefaultAvatar(t *testing.T) {
+	for url, want := range map[string]bool{
+		"": true,
+		"https://static-cdn.jtvnw.net/user-default-pictures-uv/998f01ae-def8-11e9-b95c-784f43822e80-profile_image-300x300.png": true,
+		"https://static-cdn.jtvnw.net/user-default-pictures/0ecbb6c3-fecb-4016-8115-aa467b7c36ed-profile_image-300x300.jpg":    true,
+		"https://static-cdn.jtvnw.net/jtv_user_pictures/a1b2c3-profile_image-300x300.png":                                      false,
+	} {
+		if got := IsDefaultAvatar(url); got != want {
+			t.Errorf("IsDefaultAvatar(%q) = %v, want %v", url, got, want)
+		}
+	}
+}
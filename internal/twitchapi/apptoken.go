@@ -0,0 +1,82 @@
+package twitchapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// appTokenMargin : un app token est renouvelé un peu avant son expiration
+const appTokenMargin = time.Minute
+
+// appToken est l'app access token (grant client_credentials) utilisé pour les appels
+// sans token utilisateur, comme l'enrichissement de fond du worker
+type appToken struct {
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// appAccessToken retourne l'en-tête Authorization de l'app token, demandé à Twitch
+// s'il est absent ou sur le point d'expirer
+func (a *App) appAccessToken(ctx context.Context) (string, error) {
+	a.app.mu.Lock()
+	defer a.app.mu.Unlock()
+
+	if a.app.token != "" && time.Until(a.app.expiresAt) > appTokenMargin {
+		return "Bearer " + a.app.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("client_id", a.twitchClientID)
+	form.Set("client_secret", a.twitchClientSecret)
+	form.Set("grant_type", "client_credentials")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.authBaseURL+"/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("app token request returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("decode app token: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return "", fmt.Errorf("app token response without access_token")
+	}
+
+	a.app.token = tok.AccessToken
+	a.app.expiresAt = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return "Bearer " + a.app.token, nil
+}
+
+// invalidateAppToken oublie l'app token (rejeté par Twitch) pour forcer un renouvellement
+func (a *App) invalidateAppToken(authorization string) {
+	a.app.mu.Lock()
+	defer a.app.mu.Unlock()
+
+	if "Bearer "+a.app.token == authorization {
+		a.app.token = ""
+	}
+}
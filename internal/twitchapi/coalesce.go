@@ -0,0 +1,130 @@
+package twitchapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// upstreamTimeout borne la durée d'un appel partagé : il ne dépend plus du
+// contexte du premier appelant, qui peut être annulé alors que d'autres attendent.
+const upstreamTimeout = 30 * time.Second
+
+// testHookFlight est appelé (si défini) quand un appelant a lancé ou rejoint un appel partagé
+var testHookFlight func(flightKey string)
+
+// upstreamResult est le résultat d'un appel Twitch partagé entre plusieurs appelants
+type upstreamResult struct {
+	body       []byte
+	statusCode int
+}
+
+// upstreamFunc effectue l'appel (ou la suite d'appels) vers Twitch pour un groupe d'appelants
+type upstreamFunc func(ctx context.Context) ([]byte, int, error)
+
+// fetchCoalesced exécute fetch, ou rejoint un appel identique (même flightKey) déjà en cours.
+// Tous les appelants concurrents partageant la même clé reçoivent la même réponse,
+// ce qui évite de consommer plusieurs fois le quota Twitch pour une même requête.
+// Si cacheKey est non vide, une réponse 200 est mise en cache pendant cacheTTL.
+// Le booléen retourné indique si la réponse provient d'un appel partagé.
+func (a *App) fetchCoalesced(ctx context.Context, flightKey, cacheKey string, cacheTTL time.Duration, fetch upstreamFunc) ([]byte, int, bool, error) {
+	body, statusCode, shared, _, err := a.coalesce(ctx, flightKey, cacheKey, cacheTTL, fetch)
+	return body, statusCode, shared, err
+}
+
+// fetchSharedOK est fetchCoalesced pour une clé commune à des tokens différents : seule une
+// réponse 200 est partagée. Un appelant ayant rejoint l'appel en échec d'un autre (token
+// expiré, 429, 5xx) refait l'appel seul, avec son propre token.
+func (a *App) fetchSharedOK(ctx context.Context, flightKey, cacheKey string, cacheTTL time.Duration, fetch upstreamFunc) ([]byte, int, bool, error) {
+	body, statusCode, shared, own, err := a.coalesce(ctx, flightKey, cacheKey, cacheTTL, fetch)
+	if own || ctx.Err() != nil || (err == nil && statusCode == http.StatusOK) {
+		return body, statusCode, shared, err
+	}
+	body, statusCode, err = fetch(ctx)
+	if err == nil && cacheKey != "" && statusCode == http.StatusOK {
+		a.setCache(cacheKey, body, cacheTTL)
+	}
+	return body, statusCode, false, err
+}
+
+// coalesce implémente fetchCoalesced ; own indique que fetch est celui de cet appelant
+func (a *App) coalesce(ctx context.Context, flightKey, cacheKey string, cacheTTL time.Duration, fetch upstreamFunc) (body []byte, statusCode int, shared, own bool, err error) {
+	// ran n'est lu qu'après la réception du résultat, envoyé une fois la fonction terminée
+	var ran bool
+	ch := a.flights.DoChan(flightKey, func() (interface{}, error) {
+		ran = true
+		upstreamCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), upstreamTimeout)
+		defer cancel()
+
+		body, statusCode, err := fetch(upstreamCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		if cacheKey != "" && statusCode == http.StatusOK {
+			a.setCache(cacheKey, body, cacheTTL)
+		}
+		return upstreamResult{body: body, statusCode: statusCode}, nil
+	})
+	if testHookFlight != nil {
+		testHookFlight(flightKey)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, 0, false, false, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, 0, res.Shared, ran, res.Err
+		}
+		r := res.Val.(upstreamResult)
+		return r.body, r.statusCode, res.Shared, ran, nil
+	}
+}
+
+// singleRequest retourne un upstreamFunc effectuant un unique GET vers twitchURL,
+// après avoir attendu le rate limiter (une seule fois pour tout le groupe).
+func (a *App) singleRequest(twitchURL, accessToken string) upstreamFunc {
+	return func(ctx context.Context) ([]byte, int, error) {
+		if err := a.limiter.Wait(ctx); err != nil {
+			return nil, 0, err
+		}
+		return a.proxyTwitchRequest(ctx, twitchURL, accessToken)
+	}
+}
+
+// normalizeParams trie et déduplique les valeurs de chaque paramètre afin que
+// ?id=2&id=1&id=2 et ?id=1&id=2 produisent la même clé de cache et d'appel.
+// Les logins Twitch étant insensibles à la casse, ils sont passés en minuscules.
+func normalizeParams(params url.Values) url.Values {
+	out := make(url.Values, len(params))
+	for key, values := range params {
+		seen := make(map[string]struct{}, len(values))
+		norm := make([]string, 0, len(values))
+		for _, v := range values {
+			if key == "login" {
+				v = strings.ToLower(v)
+			}
+			if _, ok := seen[v]; ok {
+				continue
+			}
+			seen[v] = struct{}{}
+			norm = append(norm, v)
+		}
+		sort.Strings(norm)
+		out[key] = norm
+	}
+	return out
+}
+
+// tokenKey dérive un identifiant court et non réversible du token,
+// utilisé dans les clés des appels dont le résultat dépend de l'utilisateur.
+func tokenKey(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,61 @@
+package twitchapi
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFetchSharedOKRetriesFailedSharedCall(t *testing.T) {
+	a := &App{cache: make(map[string]cacheEntry)}
+	release := make(chan struct{})
+
+	// Appels partagés lancés ou rejoints, sur la clé du test
+	inFlight := make(chan struct{}, 2)
+	testHookFlight = func(flightKey string) { inFlight <- struct{}{} }
+	defer func() { testHookFlight = nil }()
+
+	// Premier appelant : son token est refusé, une fois le second appelant arrivé
+	var firstCalls, secondCalls atomic.Int32
+	first := make(chan int, 1)
+	go func() {
+		_, status, _, _ := a.fetchSharedOK(context.Background(), "users:id=1", "", 0, func(context.Context) ([]byte, int, error) {
+			firstCalls.Add(1)
+			<-release
+			return []byte(`{"message":"invalid token"}`), http.StatusUnauthorized, nil
+		})
+		first <- status
+	}()
+	<-inFlight
+
+	// Second appelant : rejoint l'appel en cours, puis le refait avec son propre token
+	second := make(chan []byte, 1)
+	go func() {
+		body, status, _, err := a.fetchSharedOK(context.Background(), "users:id=1", "", 0, func(context.Context) ([]byte, int, error) {
+			secondCalls.Add(1)
+			return []byte(`{"data":[]}`), http.StatusOK, nil
+		})
+		if err != nil || status != http.StatusOK {
+			t.Errorf("second caller = %d, %v", status, err)
+		}
+		second <- body
+	}()
+	<-inFlight
+
+	// Le premier appel étant toujours bloqué, le second appelant l'a forcément rejoint
+	if n := secondCalls.Load(); n != 0 {
+		t.Fatalf("second caller upstream calls before release = %d, want 0", n)
+	}
+	close(release)
+
+	if status := <-first; status != http.StatusUnauthorized {
+		t.Errorf("first caller status = %d, want 401", status)
+	}
+	if body := <-second; string(body) != `{"data":[]}` {
+		t.Errorf("second caller body = %s", body)
+	}
+	if firstCalls.Load() != 1 || secondCalls.Load() != 1 {
+		t.Errorf("upstream calls = %d/%d, want 1/1", firstCalls.Load(), secondCalls.Load())
+	}
+}
@@ -0,0 +1,117 @@
+package twitchapi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// maxEventSubBody borne le corps d'une création d'abonnement
+const maxEventSubBody = 64 << 10
+
+// handleEventSubSubscriptions proxy vers https://api.twitch.tv/helix/eventsub/subscriptions :
+// GET (liste, paramètres status, type, after), POST (création, corps JSON de Twitch) et
+// DELETE (?id=). Sans en-tête Authorization, la requête utilise l'app token (abonnements
+// webhook) ; avec, le token de l'utilisateur est transmis tel quel (abonnements websocket).
+// Ni cache ni regroupement : chaque appel modifie ou lit l'état courant.
+func (a *App) handleEventSubSubscriptions(w http.ResponseWriter, r *http.Request) {
+	params := url.Values{}
+	var body []byte
+	switch r.Method {
+	case http.MethodGet:
+		for _, key := range []string{"status", "type", "after"} {
+			if v := r.URL.Query().Get(key); v != "" {
+				params.Set(key, v)
+			}
+		}
+	case http.MethodPost:
+		var err error
+		if body, err = io.ReadAll(io.LimitReader(r.Body, maxEventSubBody)); err != nil || len(body) == 0 {
+			http.Error(w, "missing subscription body", http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "missing id", http.StatusBadRequest)
+			return
+		}
+		params.Set("id", id)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	accessToken := r.Header.Get("Authorization")
+	appToken := accessToken == ""
+	if appToken {
+		var err error
+		if accessToken, err = a.appAccessToken(r.Context()); err != nil {
+			log.Printf("app token error: %v", err)
+			http.Error(w, "failed to get app access token", http.StatusBadGateway)
+			return
+		}
+	}
+	if err := a.limiter.Wait(r.Context()); err != nil {
+		http.Error(w, "rate limit context error", http.StatusServiceUnavailable)
+		return
+	}
+
+	twitchURL := a.helixBaseURL + "/eventsub/subscriptions"
+	if len(params) > 0 {
+		twitchURL += "?" + params.Encode()
+	}
+	respBody, statusCode, err := a.sendTwitchRequest(r.Context(), r.Method, twitchURL, accessToken, body)
+	if err != nil {
+		log.Printf("proxy eventsub subscriptions error: %v", err)
+		http.Error(w, "failed to call Twitch EventSub", http.StatusBadGateway)
+		return
+	}
+	if appToken && statusCode == http.StatusUnauthorized {
+		a.invalidateAppToken(accessToken)
+	}
+
+	if len(respBody) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(respBody)
+}
+
+// sendTwitchRequest envoie une requête à Twitch, avec un corps JSON s'il est non nil
+func (a *App) sendTwitchRequest(ctx context.Context, method, twitchURL, accessToken string, body []byte) ([]byte, int, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, twitchURL, reqBody)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req.Header.Set("Client-ID", a.twitchClientID)
+	req.Header.Set("Authorization", accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("twitch API error: %s - %s", resp.Status, string(respBody))
+	}
+
+	return respBody, resp.StatusCode, nil
+}
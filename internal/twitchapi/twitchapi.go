@@ -0,0 +1,464 @@
+// Package twitchapi est le service twitch-api : proxy des appels Helix des autres services,
+// qui détient les identifiants de l'application (app token, renouvellement des tokens
+// utilisateur) et applique le rate limiting global, le cache et le regroupement des appels
+// identiques. Le binaire cmd/twitch-api le sert sur APP_PORT ; les tests d'intégration le
+// démarrent en mémoire avec New et Handler.
+package twitchapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/env"
+)
+
+// Config est la configuration du service
+type Config struct {
+	TwitchClientID     string
+	TwitchClientSecret string
+	// URL de base de l'API Helix (surchargée pour pointer vers twitch-mock)
+	HelixBaseURL string
+	// URL de base OAuth (app token, renouvellement des tokens utilisateur)
+	AuthBaseURL string
+	// Requêtes Twitch par seconde, en rafale de 2 secondes
+	RatePerSecond int
+}
+
+// ConfigFromEnv lit la configuration dans les variables d'environnement
+func ConfigFromEnv() Config {
+	return Config{
+		TwitchClientID:     env.Get("TWITCH_CLIENT_ID", ""),
+		TwitchClientSecret: env.Get("TWITCH_CLIENT_SECRET", ""),
+		HelixBaseURL:       env.Get("TWITCH_HELIX_BASE_URL", "https://api.twitch.tv/helix"),
+		AuthBaseURL:        env.Get("TWITCH_AUTH_BASE_URL", "https://id.twitch.tv/oauth2"),
+		// Twitch limite à 800 req/min pour les app tokens
+		// On prend une marge : 600 req/min = 10 req/sec
+		RatePerSecond: env.Int("RATE_LIMIT_REQUESTS_PER_SECOND", 10),
+	}
+}
+
+// App est le service twitch-api
+type App struct {
+	twitchClientID     string
+	twitchClientSecret string
+
+	// URL de base de l'API Helix (surchargée pour pointer vers twitch-mock)
+	helixBaseURL string
+	// URL de base OAuth (app token pour les appels sans token utilisateur, renouvellement
+	// des tokens utilisateur)
+	authBaseURL string
+	app         appToken
+
+	// Rate limiter global pour respecter les limites Twitch (800 req/min)
+	limiter *rate.Limiter
+
+	// Cache simple pour les réponses (optionnel)
+	cacheMu sync.RWMutex
+	cache   map[string]cacheEntry
+
+	// Regroupement des appels identiques en cours (clé : endpoint + paramètres normalisés)
+	flights singleflight.Group
+}
+
+// maxModeratedChannelsPages borne la pagination de /moderation/channels (100 chaînes par page)
+const maxModeratedChannelsPages = 50
+
+type cacheEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// New crée le service ; les identifiants de l'application sont obligatoires
+func New(cfg Config) (*App, error) {
+	if cfg.TwitchClientID == "" || cfg.TwitchClientSecret == "" {
+		return nil, errors.New("TWITCH_CLIENT_ID and TWITCH_CLIENT_SECRET are required")
+	}
+	burst := cfg.RatePerSecond * 2 // Burst de 2 secondes
+	a := &App{
+		twitchClientID:     cfg.TwitchClientID,
+		twitchClientSecret: cfg.TwitchClientSecret,
+		helixBaseURL:       strings.TrimRight(cfg.HelixBaseURL, "/"),
+		authBaseURL:        strings.TrimRight(cfg.AuthBaseURL, "/"),
+		limiter:            rate.NewLimiter(rate.Limit(cfg.RatePerSecond), burst),
+		cache:              make(map[string]cacheEntry),
+	}
+	log.Printf("twitch-api: helix %s, rate: %d req/s, burst: %d", a.helixBaseURL, cfg.RatePerSecond, burst)
+	return a, nil
+}
+
+// Handler retourne le routeur HTTP du service
+func (a *App) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", a.handleHealth)
+	mux.HandleFunc("/chatters", a.handleChatters)
+	mux.HandleFunc("/followers", a.handleFollowers)
+	mux.HandleFunc("/users", a.handleUsers)
+	mux.HandleFunc("/moderated-channels", a.handleModeratedChannels)
+	mux.HandleFunc("/eventsub/subscriptions", a.handleEventSubSubscriptions)
+	mux.HandleFunc("/oauth/refresh", a.handleRefreshToken)
+	return loggingMiddleware(mux)
+}
+
+func (a *App) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// handleChatters proxy vers GET https://api.twitch.tv/helix/chat/chatters
+func (a *App) handleChatters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	broadcasterID := r.URL.Query().Get("broadcaster_id")
+	moderatorID := r.URL.Query().Get("moderator_id")
+	accessToken := r.Header.Get("Authorization") // Format: "Bearer {token}"
+
+	if broadcasterID == "" || moderatorID == "" {
+		http.Error(w, "missing broadcaster_id or moderator_id", http.StatusBadRequest)
+		return
+	}
+
+	if accessToken == "" {
+		http.Error(w, "missing Authorization header", http.StatusUnauthorized)
+		return
+	}
+
+	// Construire l'URL Twitch
+	params := url.Values{}
+	params.Set("broadcaster_id", broadcasterID)
+	params.Set("moderator_id", moderatorID)
+	if first := r.URL.Query().Get("first"); first != "" {
+		params.Set("first", first)
+	}
+	if after := r.URL.Query().Get("after"); after != "" {
+		params.Set("after", after)
+	}
+
+	twitchURL := a.helixBaseURL + "/chat/chatters?" + params.Encode()
+
+	// Proxy la requête (la liste dépend des droits du modérateur : le token fait partie de la clé)
+	flightKey := "chatters:" + tokenKey(accessToken) + ":" + params.Encode()
+	body, statusCode, shared, err := a.fetchCoalesced(r.Context(), flightKey, "", 0, a.singleRequest(twitchURL, accessToken))
+	if err != nil {
+		log.Printf("proxy chatters error: %v", err)
+		http.Error(w, "failed to fetch chatters from Twitch", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setCoalescedHeader(w, shared)
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(body)
+}
+
+// handleFollowers proxy vers GET https://api.twitch.tv/helix/channels/followers ; sans
+// l'autorisation moderator:read:followers d'un modérateur, Twitch ne retourne que le total
+func (a *App) handleFollowers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	broadcasterID := r.URL.Query().Get("broadcaster_id")
+	accessToken := r.Header.Get("Authorization")
+
+	if broadcasterID == "" {
+		http.Error(w, "missing broadcaster_id", http.StatusBadRequest)
+		return
+	}
+
+	if accessToken == "" {
+		http.Error(w, "missing Authorization header", http.StatusUnauthorized)
+		return
+	}
+
+	params := url.Values{}
+	params.Set("broadcaster_id", broadcasterID)
+	for _, key := range []string{"user_id", "first", "after"} {
+		if v := r.URL.Query().Get(key); v != "" {
+			params.Set(key, v)
+		}
+	}
+
+	twitchURL := a.helixBaseURL + "/channels/followers?" + params.Encode()
+
+	// Comme /chatters, la réponse dépend des droits du token : il fait partie de la clé
+	flightKey := "followers:" + tokenKey(accessToken) + ":" + params.Encode()
+	body, statusCode, shared, err := a.fetchCoalesced(r.Context(), flightKey, "", 0, a.singleRequest(twitchURL, accessToken))
+	if err != nil {
+		log.Printf("proxy followers error: %v", err)
+		http.Error(w, "failed to fetch followers from Twitch", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setCoalescedHeader(w, shared)
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(body)
+}
+
+// handleUsers proxy vers GET https://api.twitch.tv/helix/users
+func (a *App) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	accessToken := r.Header.Get("Authorization")
+
+	// Construire la requête avec tous les paramètres id= ou login=
+	params := url.Values{}
+	for key, values := range r.URL.Query() {
+		if key == "id" || key == "login" {
+			for _, v := range values {
+				params.Add(key, v)
+			}
+		}
+	}
+
+	if len(params) == 0 {
+		// Sans paramètre, Twitch retourne le compte associé au token :
+		// pas de cache, et appel partagé uniquement entre requêtes du même token
+		if accessToken == "" {
+			http.Error(w, "missing Authorization header", http.StatusUnauthorized)
+			return
+		}
+		body, statusCode, shared, err := a.fetchCoalesced(r.Context(), "users:me:"+tokenKey(accessToken), "", 0,
+			a.singleRequest(a.helixBaseURL+"/users", accessToken))
+		if err != nil {
+			log.Printf("proxy users error: %v", err)
+			http.Error(w, "failed to fetch users from Twitch", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		setCoalescedHeader(w, shared)
+		w.WriteHeader(statusCode)
+		_, _ = w.Write(body)
+		return
+	}
+	params = normalizeParams(params)
+
+	// Vérifier le cache, sauf demande explicite de données fraîches (Cache-Control: no-cache)
+	cacheKey := "users:" + params.Encode()
+	if r.Header.Get("Cache-Control") == "no-cache" {
+		a.deleteCache(cacheKey)
+	} else if cached := a.getCache(cacheKey); cached != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Cache", "HIT")
+		_, _ = w.Write(cached)
+		return
+	}
+
+	twitchURL := a.helixBaseURL + "/users?" + params.Encode()
+
+	// Sans token utilisateur (jobs de fond du worker), on utilise l'app token
+	useAppToken := accessToken == ""
+	if useAppToken {
+		var err error
+		if accessToken, err = a.appAccessToken(r.Context()); err != nil {
+			log.Printf("app token error: %v", err)
+			http.Error(w, "failed to get app access token", http.StatusBadGateway)
+			return
+		}
+	}
+
+	// Les profils sont publics : les appels identiques sont partagés quel que soit le token,
+	// sauf en cas d'échec, propre au token de l'appel. Cache les infos utilisateurs pour 5 minutes.
+	body, statusCode, shared, err := a.fetchSharedOK(r.Context(), cacheKey, cacheKey, 5*time.Minute, a.singleRequest(twitchURL, accessToken))
+	if err != nil {
+		log.Printf("proxy users error: %v", err)
+		http.Error(w, "failed to fetch users from Twitch", http.StatusBadGateway)
+		return
+	}
+	if useAppToken && statusCode == http.StatusUnauthorized {
+		a.invalidateAppToken(accessToken)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	setCoalescedHeader(w, shared)
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(body)
+}
+
+// handleModeratedChannels proxy vers GET https://api.twitch.tv/helix/moderation/channels
+func (a *App) handleModeratedChannels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	accessToken := r.Header.Get("Authorization")
+
+	if userID == "" {
+		http.Error(w, "missing user_id", http.StatusBadRequest)
+		return
+	}
+
+	if accessToken == "" {
+		http.Error(w, "missing Authorization header", http.StatusUnauthorized)
+		return
+	}
+
+	// Vérifier le cache (1 minute pour les channels modérées), sauf si le client
+	// demande explicitement des données fraîches (Cache-Control: no-cache)
+	cacheKey := "moderated:" + userID
+	if r.Header.Get("Cache-Control") == "no-cache" {
+		a.deleteCache(cacheKey)
+	} else if cached := a.getCache(cacheKey); cached != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Cache", "HIT")
+		_, _ = w.Write(cached)
+		return
+	}
+
+	// Cache pour 1 minute ; l'appel en cours n'est partagé qu'entre requêtes du même token
+	flightKey := "moderated:" + tokenKey(accessToken) + ":" + userID
+	body, statusCode, shared, err := a.fetchCoalesced(r.Context(), flightKey, cacheKey, 1*time.Minute,
+		a.allModeratedChannels(userID, accessToken))
+	if err != nil {
+		log.Printf("proxy moderated-channels error: %v", err)
+		http.Error(w, "failed to fetch moderated channels from Twitch", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	setCoalescedHeader(w, shared)
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(body)
+}
+
+// allModeratedChannels suit les curseurs de /helix/moderation/channels (100 par page)
+// et retourne la liste complète dans une seule réponse Helix (pagination vide).
+// Si une page échoue, sa réponse Twitch est retournée telle quelle.
+func (a *App) allModeratedChannels(userID, accessToken string) upstreamFunc {
+	return func(ctx context.Context) ([]byte, int, error) {
+		var all []json.RawMessage
+		cursor := ""
+		for page := 0; page < maxModeratedChannelsPages; page++ {
+			params := url.Values{}
+			params.Set("user_id", userID)
+			params.Set("first", "100")
+			if cursor != "" {
+				params.Set("after", cursor)
+			}
+
+			body, statusCode, err := a.singleRequest(a.helixBaseURL+"/moderation/channels?"+params.Encode(), accessToken)(ctx)
+			if err != nil || statusCode != http.StatusOK {
+				return body, statusCode, err
+			}
+
+			var resp struct {
+				Data       []json.RawMessage `json:"data"`
+				Pagination struct {
+					Cursor string `json:"cursor"`
+				} `json:"pagination"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				return nil, 0, err
+			}
+			all = append(all, resp.Data...)
+
+			cursor = resp.Pagination.Cursor
+			if cursor == "" || len(resp.Data) == 0 {
+				break
+			}
+		}
+
+		if all == nil {
+			all = []json.RawMessage{}
+		}
+		out, err := json.Marshal(map[string]interface{}{
+			"data":       all,
+			"pagination": map[string]string{},
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		return out, http.StatusOK, nil
+	}
+}
+
+func (a *App) proxyTwitchRequest(ctx context.Context, twitchURL, accessToken string) ([]byte, int, error) {
+	return a.sendTwitchRequest(ctx, http.MethodGet, twitchURL, accessToken, nil)
+}
+
+// setCoalescedHeader signale au client que la réponse a été partagée avec d'autres requêtes
+func setCoalescedHeader(w http.ResponseWriter, shared bool) {
+	if shared {
+		w.Header().Set("X-Coalesced", "true")
+	}
+}
+
+// Cache management
+func (a *App) getCache(key string) []byte {
+	a.cacheMu.RLock()
+	defer a.cacheMu.RUnlock()
+
+	entry, ok := a.cache[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil
+	}
+	return entry.data
+}
+
+func (a *App) setCache(key string, data []byte, ttl time.Duration) {
+	a.cacheMu.Lock()
+	defer a.cacheMu.Unlock()
+
+	a.cache[key] = cacheEntry{
+		data:      data,
+		expiresAt: time.Now().Add(ttl),
+	}
+}
+
+func (a *App) deleteCache(key string) {
+	a.cacheMu.Lock()
+	defer a.cacheMu.Unlock()
+
+	delete(a.cache, key)
+}
+
+// CleanCache supprime les réponses expirées du cache toutes les interval, jusqu'à l'annulation de ctx
+func (a *App) CleanCache(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		a.cacheMu.Lock()
+		now := time.Now()
+		for key, entry := range a.cache {
+			if now.After(entry.expiresAt) {
+				delete(a.cache, key)
+			}
+		}
+		a.cacheMu.Unlock()
+	}
+}
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		log.Printf("%s %s from %s in %s", r.Method, r.URL.Path, r.RemoteAddr, time.Since(start))
+	})
+}
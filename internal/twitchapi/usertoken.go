@@ -0,0 +1,67 @@
+package twitchapi
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// handleRefreshToken renouvelle un token utilisateur (grant refresh_token) pour les services,
+// qui n'ont pas le secret de l'application. Corps JSON {"refresh_token": "..."} ; réponse de
+// Twitch telle quelle (access_token, refresh_token, expires_in, scope). Un refresh token
+// refusé par Twitch (400 ou 401) donne un 401 : l'utilisateur doit se reconnecter.
+func (a *App) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var in struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&in); err != nil || in.RefreshToken == "" {
+		http.Error(w, "missing refresh_token", http.StatusBadRequest)
+		return
+	}
+
+	form := url.Values{}
+	form.Set("client_id", a.twitchClientID)
+	form.Set("client_secret", a.twitchClientSecret)
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", in.RefreshToken)
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, a.authBaseURL+"/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		http.Error(w, "failed to build token request", http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("refresh token error: %v", err)
+		http.Error(w, "failed to call Twitch OAuth", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		http.Error(w, "failed to read Twitch OAuth response", http.StatusBadGateway)
+		return
+	}
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized:
+		http.Error(w, "refresh token rejected by Twitch", http.StatusUnauthorized)
+		return
+	case resp.StatusCode != http.StatusOK:
+		log.Printf("refresh token request returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		http.Error(w, "failed to refresh token", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
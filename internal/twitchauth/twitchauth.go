@@ -0,0 +1,102 @@
+// Package twitchauth fournit le token Twitch d'une session web aux appels du gateway et du
+// worker : un token refusé par Twitch (expiré) est renouvelé avec le refresh token de la
+// session, les nouveaux tokens sont enregistrés et l'appel est rejoué une fois.
+package twitchauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitch"
+)
+
+// Token est le token Twitch d'une session web ; il peut être partagé entre goroutines. Un
+// Token nil désigne l'app token du proxy (token vide, jamais renouvelé ici).
+type Token struct {
+	st *store.Store
+	tc *twitch.Client
+
+	mu sync.Mutex
+	ws store.WebSession
+}
+
+// New retourne le token de la session web ws
+func New(st *store.Store, tc *twitch.Client, ws store.WebSession) *Token {
+	return &Token{st: st, tc: tc, ws: ws}
+}
+
+// ForAnalysisSession retourne le token de la session web la plus récemment active du
+// propriétaire d'une session d'analyse (store.ErrNotFound : aucune)
+func ForAnalysisSession(ctx context.Context, st *store.Store, tc *twitch.Client, analysisSessionID int64) (*Token, error) {
+	ws, err := st.WebSessions.ForAnalysisSession(ctx, analysisSessionID)
+	if err != nil {
+		return nil, err
+	}
+	return New(st, tc, *ws), nil
+}
+
+// Latest retourne le token de la session web la plus récemment active d'un utilisateur
+// (store.ErrNotFound : aucune)
+func Latest(ctx context.Context, st *store.Store, tc *twitch.Client, userID int64) (*Token, error) {
+	ws, err := st.WebSessions.Latest(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return New(st, tc, *ws), nil
+}
+
+// AccessToken retourne le token d'accès courant
+func (t *Token) AccessToken() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ws.AccessToken
+}
+
+// Do appelle fn avec le token d'accès ; si Twitch le refuse (twitch.ErrUnauthorized), il est
+// renouvelé et fn est rappelée une fois avec le nouveau token
+func (t *Token) Do(ctx context.Context, fn func(accessToken string) error) error {
+	accessToken := t.AccessToken()
+	err := fn(accessToken)
+	if t == nil || !errors.Is(err, twitch.ErrUnauthorized) {
+		return err
+	}
+	renewed, rerr := t.refresh(ctx, accessToken)
+	if rerr != nil {
+		return fmt.Errorf("%w (refresh token: %v)", err, rerr)
+	}
+	return fn(renewed)
+}
+
+// refresh renouvelle le token s'il vaut toujours rejected : un appel concurrent refusé avec
+// le même token réutilise le renouvellement déjà fait
+func (t *Token) refresh(ctx context.Context, rejected string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.ws.AccessToken != rejected {
+		return t.ws.AccessToken, nil
+	}
+	if t.ws.RefreshToken == "" {
+		return "", errors.New("no refresh token")
+	}
+	tok, err := t.tc.RefreshToken(ctx, t.ws.RefreshToken)
+	if err != nil {
+		return "", err
+	}
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = t.ws.RefreshToken
+	}
+	if err := t.st.WebSessions.UpdateTokens(ctx, t.ws.SessionID, tok.AccessToken, tok.RefreshToken); err != nil {
+		return "", fmt.Errorf("store refreshed token: %w", err)
+	}
+	t.ws.AccessToken, t.ws.RefreshToken = tok.AccessToken, tok.RefreshToken
+	log.Printf("twitch token of user %d refreshed", t.ws.UserID)
+	return tok.AccessToken, nil
+}
@@ -0,0 +1,350 @@
+package twitchmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/eventsub"
+)
+
+// verificationDelay : comme Twitch, le mock vérifie le callback après avoir répondu à la
+// création de l'abonnement
+const verificationDelay = 100 * time.Millisecond
+
+// callbackClient envoie les messages EventSub aux callbacks
+var callbackClient = &http.Client{Timeout: 10 * time.Second}
+
+// EventSubSubscriptions retourne une copie des abonnements EventSub, sans leur secret
+func (s *Server) EventSubSubscriptions() []eventsub.Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]eventsub.Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.sortedSubscriptionsLocked() {
+		cp := *sub
+		cp.Transport.Secret = ""
+		out = append(out, cp)
+	}
+	return out
+}
+
+// RevokeEventSubSubscription supprime un abonnement et envoie un message de révocation
+// (status : authorization_revoked, user_removed...) à son callback
+func (s *Server) RevokeEventSubSubscription(id, status string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return false
+	}
+	delete(s.subscriptions, id)
+	revoked := *sub
+	revoked.Status = status
+	s.sendLocked(&revoked, eventsub.MessageRevocation, eventsub.Message{Subscription: publicSubscription(&revoked)})
+	return true
+}
+
+func (s *Server) sortedSubscriptionsLocked() []*eventsub.Subscription {
+	list := make([]*eventsub.Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		list = append(list, sub)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// handleEventSubSubscriptions émule /helix/eventsub/subscriptions. Comme chez Twitch, les
+// abonnements webhook se gèrent avec l'app token et les abonnements websocket avec un token
+// utilisateur : chaque token ne voit que les abonnements de son transport.
+func (s *Server) handleEventSubSubscriptions(w http.ResponseWriter, r *http.Request, tok *token) {
+	transport := eventsub.TransportWebhook
+	if tok.userID != "" {
+		transport = eventsub.TransportWebSocket
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.listSubscriptions(w, r, transport)
+	case http.MethodPost:
+		s.createSubscription(w, r, tok)
+	case http.MethodDelete:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		id := r.URL.Query().Get("id")
+		if sub, ok := s.subscriptions[id]; !ok || sub.Transport.Method != transport {
+			writeError(w, http.StatusNotFound, "subscription not found")
+			return
+		}
+		delete(s.subscriptions, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) listSubscriptions(w http.ResponseWriter, r *http.Request, transport string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+	data := []eventsub.Subscription{}
+	for _, sub := range s.sortedSubscriptionsLocked() {
+		if sub.Transport.Method != transport {
+			continue
+		}
+		if (q.Get("type") != "" && sub.Type != q.Get("type")) || (q.Get("status") != "" && sub.Status != q.Get("status")) {
+			continue
+		}
+		data = append(data, publicSubscription(sub))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":           data,
+		"total":          len(data),
+		"total_cost":     len(data),
+		"max_total_cost": 10000,
+		"pagination":     map[string]string{},
+	})
+}
+
+func (s *Server) createSubscription(w http.ResponseWriter, r *http.Request, tok *token) {
+	var req struct {
+		Type      string             `json:"type"`
+		Version   string             `json:"version"`
+		Condition map[string]string  `json:"condition"`
+		Transport eventsub.Transport `json:"transport"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	switch req.Type {
+	case eventsub.StreamOnline, eventsub.ChannelRaid, eventsub.ChannelFollow:
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported subscription type "+req.Type)
+		return
+	}
+	if req.Version != eventsub.Version(req.Type) {
+		writeError(w, http.StatusBadRequest, "unsupported version "+req.Version)
+		return
+	}
+	switch req.Transport.Method {
+	case eventsub.TransportWebhook:
+		if tok.userID != "" {
+			writeError(w, http.StatusBadRequest, "An app access token is required for webhook subscriptions")
+			return
+		}
+		if req.Transport.Callback == "" {
+			writeError(w, http.StatusBadRequest, "transport must be a webhook with a callback")
+			return
+		}
+		if len(req.Transport.Secret) < 10 || len(req.Transport.Secret) > 100 {
+			writeError(w, http.StatusBadRequest, "secret must be between 10 and 100 characters")
+			return
+		}
+	case eventsub.TransportWebSocket:
+		if tok.userID == "" {
+			writeError(w, http.StatusBadRequest, "A user access token is required for websocket subscriptions")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported transport method "+req.Transport.Method)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	websocketTransport := req.Transport.Method == eventsub.TransportWebSocket
+	if _, ok := s.wsSessions[req.Transport.SessionID]; websocketTransport && !ok {
+		writeError(w, http.StatusBadRequest, "websocket transport session does not exist or has already disconnected")
+		return
+	}
+
+	broadcaster := eventsub.Broadcaster(req.Condition)
+	if _, ok := s.users[broadcaster]; !ok {
+		writeError(w, http.StatusBadRequest, "invalid condition")
+		return
+	}
+	if req.Type == eventsub.ChannelFollow {
+		moderator := req.Condition["moderator_user_id"]
+		if moderator != broadcaster && !contains(s.moderated[moderator], broadcaster) {
+			writeError(w, http.StatusForbidden, "subscription missing proper authorization")
+			return
+		}
+		// En websocket, l'autorisation est celle du token de la requête
+		if websocketTransport && (moderator != tok.userID || !contains(tok.scopes, "moderator:read:followers")) {
+			writeError(w, http.StatusForbidden, "subscription missing proper authorization")
+			return
+		}
+	}
+	for _, sub := range s.subscriptions {
+		if sub.Type == req.Type && sub.Transport.Method == req.Transport.Method && sub.Transport.Callback == req.Transport.Callback &&
+			sub.Transport.SessionID == req.Transport.SessionID && sameCondition(sub.Condition, req.Condition) {
+			writeError(w, http.StatusConflict, "subscription already exists")
+			return
+		}
+	}
+
+	sub := &eventsub.Subscription{
+		ID:        s.randomUUIDLocked(),
+		Status:    eventsub.StatusVerificationPending,
+		Type:      req.Type,
+		Version:   req.Version,
+		Condition: req.Condition,
+		Transport: req.Transport,
+		CreatedAt: time.Now().UTC(),
+		Cost:      1,
+	}
+	if websocketTransport {
+		// Pas de vérification : la session est déjà établie
+		sub.Status = eventsub.StatusEnabled
+	}
+	s.subscriptions[sub.ID] = sub
+	if !websocketTransport {
+		go s.verifyCallback(sub.ID, s.randomString(32))
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data":           []eventsub.Subscription{publicSubscription(sub)},
+		"total":          len(s.subscriptions),
+		"total_cost":     len(s.subscriptions),
+		"max_total_cost": 10000,
+	})
+}
+
+// verifyCallback envoie le challenge de vérification : l'abonnement est activé si le callback
+// le renvoie tel quel avec un statut 200
+func (s *Server) verifyCallback(id, challenge string) {
+	time.Sleep(verificationDelay)
+
+	s.mu.Lock()
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	pending := *sub
+	msg := s.messageLocked(&pending, eventsub.MessageVerification,
+		eventsub.Message{Subscription: publicSubscription(&pending), Challenge: challenge})
+	s.mu.Unlock()
+
+	status, body, err := msg.send()
+	verified := err == nil && status == http.StatusOK && body == challenge
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sub, ok := s.subscriptions[id]; ok {
+		sub.Status = eventsub.StatusEnabled
+		if !verified {
+			sub.Status = eventsub.StatusVerificationFailed
+		}
+	}
+}
+
+// notifyLocked envoie une notification aux abonnements actifs du type sur broadcaster
+func (s *Server) notifyLocked(subType, broadcaster string, event any) {
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	for _, sub := range s.sortedSubscriptionsLocked() {
+		if sub.Type != subType || sub.Status != eventsub.StatusEnabled || eventsub.Broadcaster(sub.Condition) != broadcaster {
+			continue
+		}
+		s.sendLocked(sub, eventsub.MessageNotification, eventsub.Message{Subscription: publicSubscription(sub), Event: raw})
+	}
+}
+
+// sendLocked envoie un message au callback ou à la session WebSocket d'un abonnement, en
+// arrière-plan
+func (s *Server) sendLocked(sub *eventsub.Subscription, messageType string, m eventsub.Message) {
+	if sub.Transport.Method == eventsub.TransportWebSocket {
+		if sess, ok := s.wsSessions[sub.Transport.SessionID]; ok {
+			s.sendWSLocked(sess, messageType, eventsub.WSPayload{Subscription: &m.Subscription, Event: m.Event})
+		}
+		return
+	}
+	msg := s.messageLocked(sub, messageType, m)
+	go func() {
+		if status, _, err := msg.send(); err != nil || status >= 300 {
+			log.Printf("eventsub %s to %s: status %d: %v", messageType, msg.callback, status, err)
+		}
+	}()
+}
+
+// callbackMessage est un message signé, prêt à être envoyé hors verrou
+type callbackMessage struct {
+	callback string
+	header   http.Header
+	body     []byte
+}
+
+func (s *Server) messageLocked(sub *eventsub.Subscription, messageType string, m eventsub.Message) callbackMessage {
+	body, _ := json.Marshal(m)
+	id := s.randomUUIDLocked()
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	h.Set(eventsub.HeaderMessageID, id)
+	h.Set(eventsub.HeaderMessageTimestamp, timestamp)
+	h.Set(eventsub.HeaderMessageSignature, eventsub.Sign(sub.Transport.Secret, id, timestamp, body))
+	h.Set(eventsub.HeaderMessageType, messageType)
+	h.Set(eventsub.HeaderMessageRetry, "0")
+	h.Set(eventsub.HeaderSubscriptionType, sub.Type)
+	s.eventsubSent++
+	return callbackMessage{callback: sub.Transport.Callback, header: h, body: body}
+}
+
+func (m callbackMessage) send() (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, m.callback, bytes.NewReader(m.body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header = m.header
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return resp.StatusCode, strings.TrimSpace(string(body)), err
+}
+
+// publicSubscription retourne l'abonnement tel que Twitch le décrit (sans le secret)
+func publicSubscription(sub *eventsub.Subscription) eventsub.Subscription {
+	cp := *sub
+	cp.Transport.Secret = ""
+	return cp
+}
+
+func sameCondition(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// randomUUIDLocked retourne un identifiant au format UUID (ids d'abonnements et de messages)
+func (s *Server) randomUUIDLocked() string {
+	const hexdigits = "0123456789abcdef"
+	b := make([]byte, 36)
+	for i := range b {
+		switch i {
+		case 8, 13, 18, 23:
+			b[i] = '-'
+		default:
+			b[i] = hexdigits[s.rng.Intn(16)]
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,194 @@
+package twitchmock
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/eventsub"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/websocket"
+)
+
+// defaultEventSubKeepalive est le délai entre deux messages session_keepalive (10 s chez Twitch)
+const defaultEventSubKeepalive = 10 * time.Second
+
+// wsSession est une session EventSub WebSocket ouverte sur /eventsub/ws
+type wsSession struct {
+	id          string
+	conn        *websocket.Conn
+	connectedAt time.Time
+	// reconnectURL est l'adresse de base des URL de reconnexion (ws://<hôte>/eventsub/ws)
+	reconnectURL string
+	done         chan struct{}
+}
+
+// handleEventSubWS émule wss://eventsub.wss.twitch.tv/ws : message session_welcome, puis
+// session_keepalive à intervalle régulier et les notifications des abonnements de la session.
+// Avec ?reconnect=<session>, la nouvelle session reprend les abonnements de l'ancienne, qui
+// est fermée après le session_welcome (suite d'un session_reconnect).
+func (s *Server) handleEventSubWS(w http.ResponseWriter, r *http.Request) {
+	keepalive := s.cfg.EventSubKeepalive
+	if v := r.URL.Query().Get("keepalive_timeout_seconds"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 10 || secs > 600 {
+			http.Error(w, "keepalive_timeout_seconds must be between 10 and 600", http.StatusBadRequest)
+			return
+		}
+		keepalive = time.Duration(secs) * time.Second
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	sess := &wsSession{
+		id:           s.randomUUIDLocked(),
+		conn:         conn,
+		connectedAt:  time.Now().UTC(),
+		reconnectURL: "ws://" + r.Host + r.URL.Path,
+		done:         make(chan struct{}),
+	}
+	s.wsSessions[sess.id] = sess
+	welcome := s.wsMessageLocked(eventsub.MessageSessionWelcome, eventsub.WSPayload{Session: &eventsub.WSSession{
+		ID:                      sess.id,
+		Status:                  "connected",
+		KeepaliveTimeoutSeconds: int(keepalive / time.Second),
+		ConnectedAt:             sess.connectedAt,
+	}})
+	var previous *wsSession
+	if old, ok := s.wsSessions[r.URL.Query().Get("reconnect")]; ok && old != sess {
+		previous = old
+		for _, sub := range s.subscriptions {
+			if sub.Transport.Method == eventsub.TransportWebSocket && sub.Transport.SessionID == old.id {
+				sub.Transport.SessionID = sess.id
+			}
+		}
+		delete(s.wsSessions, old.id)
+	}
+	s.mu.Unlock()
+
+	if err := conn.WriteMessage(websocket.OpText, welcome); err != nil {
+		s.closeWSSession(sess)
+		return
+	}
+	if previous != nil {
+		previous.conn.Close(4004, "reconnected")
+	}
+
+	go s.keepaliveWSSession(sess, keepalive)
+	// Le client n'envoie rien (Twitch ferme la connexion s'il le fait) : la lecture ne sert
+	// qu'à détecter la déconnexion et à répondre aux pings
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	s.closeWSSession(sess)
+}
+
+// keepaliveWSSession envoie un session_keepalive à chaque intervalle
+func (s *Server) keepaliveWSSession(sess *wsSession, keepalive time.Duration) {
+	ticker := time.NewTicker(keepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sess.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			msg := s.wsMessageLocked(eventsub.MessageSessionKeepalive, eventsub.WSPayload{})
+			s.mu.Unlock()
+			if err := sess.conn.WriteMessage(websocket.OpText, msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// closeWSSession supprime une session fermée et, comme Twitch, ses abonnements
+func (s *Server) closeWSSession(sess *wsSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-sess.done:
+		return
+	default:
+		close(sess.done)
+	}
+	sess.conn.CloseNow()
+	if s.wsSessions[sess.id] == sess {
+		delete(s.wsSessions, sess.id)
+	}
+	for id, sub := range s.subscriptions {
+		if sub.Transport.Method == eventsub.TransportWebSocket && sub.Transport.SessionID == sess.id {
+			delete(s.subscriptions, id)
+		}
+	}
+}
+
+// reconnectEventSubSessionsLocked envoie session_reconnect à toutes les sessions : les
+// abonnements suivent le client sur l'URL de reconnexion
+func (s *Server) reconnectEventSubSessionsLocked() {
+	for _, sess := range s.wsSessions {
+		reconnectURL := sess.reconnectURL + "?" + url.Values{"reconnect": {sess.id}}.Encode()
+		s.sendWSLocked(sess, eventsub.MessageSessionReconnect, eventsub.WSPayload{Session: &eventsub.WSSession{
+			ID:           sess.id,
+			Status:       "reconnecting",
+			ReconnectURL: reconnectURL,
+			ConnectedAt:  sess.connectedAt,
+		}})
+	}
+}
+
+// dropEventSubSessionsLocked coupe toutes les sessions sans message de fermeture (panne
+// réseau) ; leurs abonnements sont supprimés
+func (s *Server) dropEventSubSessionsLocked() {
+	for id, sess := range s.wsSessions {
+		select {
+		case <-sess.done:
+		default:
+			close(sess.done)
+		}
+		sess.conn.CloseNow()
+		delete(s.wsSessions, id)
+		for subID, sub := range s.subscriptions {
+			if sub.Transport.Method == eventsub.TransportWebSocket && sub.Transport.SessionID == id {
+				delete(s.subscriptions, subID)
+			}
+		}
+	}
+}
+
+// wsMessageLocked encode un message WebSocket ; les champs Subscription* des métadonnées
+// sont repris de l'abonnement éventuel
+func (s *Server) wsMessageLocked(messageType string, payload eventsub.WSPayload) []byte {
+	meta := eventsub.WSMetadata{
+		MessageID:        s.randomUUIDLocked(),
+		MessageType:      messageType,
+		MessageTimestamp: time.Now().UTC(),
+	}
+	if payload.Subscription != nil {
+		meta.SubscriptionType = payload.Subscription.Type
+		meta.SubscriptionVersion = payload.Subscription.Version
+	}
+	data, _ := json.Marshal(eventsub.WSMessage{Metadata: meta, Payload: payload})
+	return data
+}
+
+// sendWSLocked envoie un message à une session, en arrière-plan
+func (s *Server) sendWSLocked(sess *wsSession, messageType string, payload eventsub.WSPayload) {
+	msg := s.wsMessageLocked(messageType, payload)
+	if messageType != eventsub.MessageSessionKeepalive {
+		s.eventsubSent++
+	}
+	go func() {
+		if err := sess.conn.WriteMessage(websocket.OpText, msg); err != nil {
+			log.Printf("eventsub %s to websocket session %s: %v", messageType, sess.id, err)
+		}
+	}()
+}
@@ -0,0 +1,53 @@
+package twitchmock
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+)
+
+// Images de profil : chaque compte reçoit une URL propre, comme sur Twitch. Avec
+// Config.ImageBaseURL, le mock sert les images sous /jtv_user_pictures/ ; deux comptes ayant
+// envoyé la même image (bot_wave avec shared_avatar) ont des URL distinctes mais les mêmes octets.
+
+const staticCDN = "https://static-cdn.jtvnw.net"
+
+// setProfileImageLocked donne à u l'image de profil identifiée par content, sous une URL propre au compte
+func (s *Server) setProfileImageLocked(u *User, content string) {
+	path := "/jtv_user_pictures/" + u.Login + "-profile_image-300x300.png"
+	base := s.cfg.ImageBaseURL
+	if base == "" {
+		base = staticCDN
+	}
+	u.ProfileImageURL = base + path
+	s.images[path] = content
+}
+
+// handleImage sert une image de profil : un PNG uni dont la couleur dépend de son contenu
+func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	content, ok := s.images[r.URL.Path]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(content))
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			img.Set(x, y, color.RGBA{R: sum[0], G: sum[1], B: sum[2], A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	_, _ = w.Write(buf.Bytes())
+}
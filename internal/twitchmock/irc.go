@@ -0,0 +1,218 @@
+package twitchmock
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/chat"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/websocket"
+)
+
+// ircQueueSize borne les messages en attente d'envoi sur une connexion IRC ; au-delà, ils
+// sont perdus (client trop lent)
+const ircQueueSize = 4096
+
+// ircConn est une connexion au chat simulé (/irc)
+type ircConn struct {
+	conn     *websocket.Conn
+	nick     string
+	pass     string
+	tags     bool            // capacité twitch.tv/tags demandée
+	channels map[string]bool // logins des chaînes rejointes
+	out      chan string
+	done     chan struct{}
+}
+
+// handleIRC émule wss://irc-ws.chat.twitch.tv : CAP REQ, PASS et NICK (anonyme avec un pseudo
+// justinfan<nombre>, sinon PASS oauth:<token utilisateur>), JOIN, PART et PING. Les étapes de
+// scénario chat et chat_spam envoient les PRIVMSG aux connexions qui ont rejoint la chaîne.
+func (s *Server) handleIRC(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	c := &ircConn{conn: conn, channels: map[string]bool{}, out: make(chan string, ircQueueSize), done: make(chan struct{})}
+	go c.writeLoop()
+
+	s.mu.Lock()
+	s.ircConns[c] = true
+	s.mu.Unlock()
+	defer s.closeIRC(c)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(data), "\r\n") {
+			msg, err := chat.ParseMessage(line)
+			if err != nil {
+				continue
+			}
+			s.mu.Lock()
+			ok := s.handleIRCMessageLocked(c, msg)
+			s.mu.Unlock()
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// handleIRCMessageLocked traite une commande du client ; false ferme la connexion
+func (s *Server) handleIRCMessageLocked(c *ircConn, msg chat.Message) bool {
+	switch msg.Command {
+	case "CAP":
+		if msg.Param(0) == "REQ" {
+			c.tags = c.tags || strings.Contains(msg.Param(1), "twitch.tv/tags")
+			c.send(":tmi.twitch.tv CAP * ACK :" + msg.Param(1))
+		}
+
+	case "PASS":
+		c.pass = msg.Param(0)
+
+	case "NICK":
+		nick := strings.ToLower(msg.Param(0))
+		if !strings.HasPrefix(nick, "justinfan") {
+			tok, ok := s.tokens[strings.TrimPrefix(c.pass, "oauth:")]
+			if !ok || tok.userID == "" || time.Now().After(tok.expiresAt) {
+				c.send(":tmi.twitch.tv NOTICE * :Login authentication failed")
+				return false
+			}
+		}
+		c.nick = nick
+		for _, line := range []string{
+			"001 %s :Welcome, GLHF!", "002 %s :Your host is tmi.twitch.tv", "003 %s :This server is rather new",
+			"004 %s :-", "375 %s :-", "372 %s :You are in a maze of twisty passages, all alike.", "376 %s :>",
+		} {
+			c.send(":tmi.twitch.tv " + fmt.Sprintf(line, nick))
+		}
+
+	case "JOIN":
+		if c.nick == "" {
+			return true
+		}
+		for _, name := range strings.Split(msg.Param(0), ",") {
+			login := strings.ToLower(strings.TrimPrefix(name, "#"))
+			c.channels[login] = true
+			c.send(fmt.Sprintf(":%[1]s!%[1]s@%[1]s.tmi.twitch.tv JOIN #%[2]s", c.nick, login))
+			if c.tags {
+				if u := s.userByLoginLocked(login); u != nil {
+					c.send(fmt.Sprintf("@emote-only=0;followers-only=-1;r9k=0;room-id=%s;slow=0;subs-only=0 :tmi.twitch.tv ROOMSTATE #%s", u.ID, login))
+				}
+			}
+			c.send(fmt.Sprintf(":%[1]s.tmi.twitch.tv 353 %[1]s = #%[2]s :%[1]s", c.nick, login))
+			c.send(fmt.Sprintf(":%[1]s.tmi.twitch.tv 366 %[1]s #%[2]s :End of /NAMES list", c.nick, login))
+		}
+
+	case "PART":
+		for _, name := range strings.Split(msg.Param(0), ",") {
+			login := strings.ToLower(strings.TrimPrefix(name, "#"))
+			delete(c.channels, login)
+			c.send(fmt.Sprintf(":%[1]s!%[1]s@%[1]s.tmi.twitch.tv PART #%[2]s", c.nick, login))
+		}
+
+	case "PING":
+		c.send(":tmi.twitch.tv PONG tmi.twitch.tv :" + msg.Param(0))
+	}
+	return true
+}
+
+// send met un message en file d'envoi, sans bloquer
+func (c *ircConn) send(line string) {
+	select {
+	case c.out <- line:
+	default:
+		log.Printf("irc: queue of %s full, message dropped", c.nick)
+	}
+}
+
+// writeLoop envoie les messages en file, un par trame
+func (c *ircConn) writeLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case line := <-c.out:
+			if err := c.conn.WriteMessage(websocket.OpText, []byte(line+"\r\n")); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// closeIRC ferme une connexion et l'oublie
+func (s *Server) closeIRC(c *ircConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ircConns[c] {
+		return
+	}
+	delete(s.ircConns, c)
+	close(c.done)
+	c.conn.CloseNow()
+}
+
+// IRCChannels retourne les logins des chaînes rejointes par au moins une connexion IRC
+func (s *Server) IRCChannels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ircChannelsLocked()
+}
+
+func (s *Server) ircChannelsLocked() []string {
+	seen := map[string]bool{}
+	var logins []string
+	for c := range s.ircConns {
+		for login := range c.channels {
+			if !seen[login] {
+				seen[login] = true
+				logins = append(logins, login)
+			}
+		}
+	}
+	sort.Strings(logins)
+	return logins
+}
+
+// privmsgLocked envoie le message d'un compte aux connexions qui ont rejoint la chaîne
+func (s *Server) privmsgLocked(broadcaster *User, author *User, text string) {
+	login := strings.ToLower(broadcaster.Login)
+	now := time.Now()
+	for c := range s.ircConns {
+		if !c.channels[login] {
+			continue
+		}
+		line := fmt.Sprintf(":%[1]s!%[1]s@%[1]s.tmi.twitch.tv PRIVMSG #%[2]s :%[3]s", author.Login, login, text)
+		if c.tags {
+			line = fmt.Sprintf("@badge-info=;badges=;color=;display-name=%s;emotes=;first-msg=0;flags=;id=%s;mod=0;returning-chatter=0;room-id=%s;subscriber=0;tmi-sent-ts=%d;turbo=0;user-id=%s;user-type= ",
+				strings.ReplaceAll(author.DisplayName, " ", `\s`), s.randomUUIDLocked(), broadcaster.ID, now.UnixMilli(), author.ID) + line
+		}
+		c.send(line)
+	}
+	s.chatSent++
+}
+
+// reconnectIRCLocked envoie RECONNECT à toutes les connexions, comme Twitch avant une
+// maintenance ; elles ne reçoivent plus les messages des chaînes, à rejoindre sur une nouvelle
+// connexion
+func (s *Server) reconnectIRCLocked() {
+	for c := range s.ircConns {
+		c.send(":tmi.twitch.tv RECONNECT")
+		clear(c.channels)
+	}
+}
+
+// userByLoginLocked retourne le compte d'un login, ou nil
+func (s *Server) userByLoginLocked(login string) *User {
+	for _, u := range s.users {
+		if strings.EqualFold(u.Login, login) {
+			return u
+		}
+	}
+	return nil
+}
@@ -0,0 +1,854 @@
+// Package twitchmock émule les endpoints Twitch Helix et OAuth utilisés par
+// l'application, pour développer et tester sans identifiants Twitch réels.
+//
+// Endpoints émulés :
+//   - GET  /helix/chat/chatters
+//   - GET  /helix/channels/followers
+//   - GET  /helix/users
+//   - GET  /helix/moderation/channels
+//   - GET, POST, DELETE /helix/eventsub/subscriptions (transport webhook : vérification du
+//     callback puis notifications signées ; transport websocket : notifications sur la
+//     session ; notifications déclenchées par les scénarios)
+//   - GET  /eventsub/ws (serveur EventSub WebSocket : welcome, keepalive, reconnect)
+//   - GET  /irc (chat IRC sur WebSocket : JOIN, PART, PING ; messages déclenchés par les scénarios)
+//   - GET  /jtv_user_pictures/... (images de profil, avec Config.ImageBaseURL)
+//   - GET  /oauth2/authorize (redirige immédiatement vers redirect_uri avec un code)
+//   - POST /oauth2/token (authorization_code, refresh_token, client_credentials)
+//   - GET  /oauth2/validate
+//   - POST /oauth2/revoke
+//
+// Les endpoints /mock/... permettent d'inspecter l'état et de déclencher des scénarios.
+package twitchmock
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/eventsub"
+)
+
+// DefaultAvatarURL est l'avatar attribué par Twitch aux comptes sans image de profil
+const DefaultAvatarURL = "https://static-cdn.jtvnw.net/user-default-pictures-uv/998f01ae-def8-11e9-b95c-784f43822e80-profile_image-300x300.png"
+
+// User est un compte Twitch simulé
+type User struct {
+	ID              string    `json:"id"`
+	Login           string    `json:"login"`
+	DisplayName     string    `json:"display_name"`
+	Type            string    `json:"type"`
+	BroadcasterType string    `json:"broadcaster_type"`
+	Description     string    `json:"description"`
+	ProfileImageURL string    `json:"profile_image_url"`
+	OfflineImageURL string    `json:"offline_image_url"`
+	ViewCount       int       `json:"view_count"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Config décrit le monde simulé au démarrage
+type Config struct {
+	// Identifiants attendus pour /oauth2/token (vides : tout est accepté)
+	ClientID     string
+	ClientSecret string
+
+	// Nombre de chatters générés sur la chaîne du streamer
+	Chatters int
+	// Nombre de chaînes (en plus de la sienne) modérées par le modérateur
+	ModeratedChannels int
+
+	// Quota de requêtes Helix par minute (headers Ratelimit-*), 0 = 800
+	RateLimitPerMinute int
+
+	// Graine du générateur pseudo-aléatoire (données reproductibles)
+	Seed int64
+
+	// Délai entre deux session_keepalive EventSub WebSocket, 0 = 10 s
+	EventSubKeepalive time.Duration
+
+	// URL de base des images de profil, servies par le mock (ex : http://localhost:8089) ;
+	// vide : URL de static-cdn.jtvnw.net, non servies
+	ImageBaseURL string
+}
+
+// Identifiants fixes du monde simulé
+const (
+	StreamerID     = "1000"
+	StreamerLogin  = "mockstreamer"
+	ModeratorID    = "2000"
+	ModeratorLogin = "mockmod"
+)
+
+type token struct {
+	userID    string // vide pour un app token
+	scopes    []string
+	expiresAt time.Time
+}
+
+// Server est un serveur Twitch simulé ; ses méthodes sont sûres en concurrence
+type Server struct {
+	cfg Config
+
+	mu        sync.Mutex
+	rng       *rand.Rand
+	nextID    int
+	users     map[string]*User
+	chatters  map[string][]string // broadcaster_id -> user ids
+	followers map[string][]follow // broadcaster_id -> follows, du plus ancien au plus récent
+	moderated map[string][]string // user_id -> broadcaster ids
+	tokens    map[string]*token
+	codes     map[string]string // code OAuth -> user_id
+	refresh   map[string]string // refresh token -> user_id
+	images    map[string]string // chemin d'une image de profil -> contenu
+
+	// Rate limiting (fenêtre fixe d'une minute)
+	rateLimit   int
+	windowStart time.Time
+	windowCount int
+	// Nombre de réponses 429 forcées restantes (scénario "429 storm")
+	forced429 int
+
+	// Étapes de scénario différées, déclenchées au n-ième appel Helix
+	helixRequests int
+	pending       []Step
+
+	// Abonnements EventSub (id -> abonnement, secret inclus), messages envoyés aux callbacks
+	// et aux sessions WebSocket, sessions WebSocket ouvertes (id -> session)
+	subscriptions map[string]*eventsub.Subscription
+	eventsubSent  int
+	wsSessions    map[string]*wsSession
+
+	// Connexions au chat IRC et messages (PRIVMSG) envoyés
+	ircConns map[*ircConn]bool
+	chatSent int
+}
+
+// New crée un serveur simulé peuplé selon cfg
+func New(cfg Config) *Server {
+	if cfg.Chatters <= 0 {
+		cfg.Chatters = 250
+	}
+	if cfg.ModeratedChannels < 0 {
+		cfg.ModeratedChannels = 0
+	}
+	if cfg.RateLimitPerMinute <= 0 {
+		cfg.RateLimitPerMinute = 800
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = 42
+	}
+	if cfg.EventSubKeepalive <= 0 {
+		cfg.EventSubKeepalive = defaultEventSubKeepalive
+	}
+
+	s := &Server{
+		cfg:       cfg,
+		rng:       rand.New(rand.NewSource(cfg.Seed)),
+		nextID:    100000,
+		users:     make(map[string]*User),
+		chatters:  make(map[string][]string),
+		followers: make(map[string][]follow),
+		moderated: make(map[string][]string),
+		tokens:    make(map[string]*token),
+		codes:     make(map[string]string),
+		refresh:   make(map[string]string),
+		images:    make(map[string]string),
+		rateLimit: cfg.RateLimitPerMinute,
+
+		subscriptions: make(map[string]*eventsub.Subscription),
+		wsSessions:    make(map[string]*wsSession),
+		ircConns:      make(map[*ircConn]bool),
+	}
+
+	for _, u := range []*User{
+		{ID: StreamerID, Login: StreamerLogin, DisplayName: "MockStreamer", BroadcasterType: "partner",
+			CreatedAt: time.Date(2015, 3, 14, 12, 0, 0, 0, time.UTC)},
+		{ID: ModeratorID, Login: ModeratorLogin, DisplayName: "MockMod",
+			CreatedAt: time.Date(2018, 6, 1, 9, 30, 0, 0, time.UTC)},
+	} {
+		s.setProfileImageLocked(u, u.Login)
+		s.addUser(u)
+	}
+
+	// Chaînes modérées par le modérateur : celle du streamer + cfg.ModeratedChannels autres
+	s.moderated[ModeratorID] = []string{StreamerID}
+	for i := 0; i < cfg.ModeratedChannels; i++ {
+		u := s.newUser(fmt.Sprintf("channel%03d", i+1), s.randomCreatedAt())
+		u.BroadcasterType = "affiliate"
+		s.moderated[ModeratorID] = append(s.moderated[ModeratorID], u.ID)
+	}
+
+	// Chatters "organiques" du streamer : dates de création étalées sur 10 ans
+	ids := make([]string, 0, cfg.Chatters+1)
+	ids = append(ids, ModeratorID)
+	for i := 0; i < cfg.Chatters; i++ {
+		u := s.newUser(fmt.Sprintf("viewer%05d", i+1), s.randomCreatedAt())
+		ids = append(ids, u.ID)
+	}
+	s.chatters[StreamerID] = ids
+
+	// Les viewers organiques suivent le streamer, un follow toutes les 17 heures (dates fixes :
+	// la graine du générateur donne les mêmes données qu'avant l'ajout des followers)
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := len(ids) - 1; i >= 1; i-- {
+		at := now.Add(-time.Duration(i) * 17 * time.Hour)
+		if created := s.users[ids[i]].CreatedAt.Add(time.Hour); at.Before(created) {
+			at = created
+		}
+		s.followLocked(StreamerID, ids[i], at)
+	}
+	sort.SliceStable(s.followers[StreamerID], func(i, j int) bool {
+		return s.followers[StreamerID][i].followedAt.Before(s.followers[StreamerID][j].followedAt)
+	})
+
+	return s
+}
+
+// follow est le follow d'une chaîne par un compte
+type follow struct {
+	userID     string
+	followedAt time.Time
+}
+
+// followLocked enregistre le follow d'une chaîne par un compte (un nouveau follow remplace le
+// précédent)
+func (s *Server) followLocked(broadcasterID, userID string, at time.Time) {
+	list := s.followers[broadcasterID]
+	for i, f := range list {
+		if f.userID == userID {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	s.followers[broadcasterID] = append(list, follow{userID: userID, followedAt: at})
+}
+
+// randomCreatedAt retourne une date de création aléatoire sur les 10 dernières années
+func (s *Server) randomCreatedAt() time.Time {
+	days := s.rng.Intn(3650) + 1
+	return time.Now().UTC().Truncate(time.Second).AddDate(0, 0, -days)
+}
+
+func (s *Server) addUser(u *User) {
+	if u.DisplayName == "" {
+		u.DisplayName = u.Login
+	}
+	s.users[u.ID] = u
+}
+
+// newUser crée un compte avec un ID séquentiel ; environ un compte sur cinq garde l'avatar par défaut
+func (s *Server) newUser(login string, createdAt time.Time) *User {
+	s.nextID++
+	u := &User{
+		ID:          strconv.Itoa(s.nextID),
+		Login:       login,
+		DisplayName: strings.ToUpper(login[:1]) + login[1:],
+		CreatedAt:   createdAt,
+		ViewCount:   s.rng.Intn(5000),
+	}
+	if s.rng.Intn(5) == 0 {
+		u.ProfileImageURL = DefaultAvatarURL
+	} else {
+		s.setProfileImageLocked(u, login)
+		u.Description = "Hello, I am " + login
+	}
+	s.addUser(u)
+	return u
+}
+
+// Handler retourne le routeur HTTP du serveur simulé
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) })
+
+	mux.HandleFunc("/helix/chat/chatters", s.helix(s.handleChatters))
+	mux.HandleFunc("/helix/channels/followers", s.helix(s.handleFollowers))
+	mux.HandleFunc("/helix/users", s.helix(s.handleUsers))
+	mux.HandleFunc("/helix/moderation/channels", s.helix(s.handleModeratedChannels))
+	mux.HandleFunc("/helix/eventsub/subscriptions", s.helix(s.handleEventSubSubscriptions,
+		http.MethodGet, http.MethodPost, http.MethodDelete))
+	mux.HandleFunc("/eventsub/ws", s.handleEventSubWS)
+	mux.HandleFunc("/irc", s.handleIRC)
+	mux.HandleFunc("/jtv_user_pictures/", s.handleImage)
+
+	mux.HandleFunc("/oauth2/authorize", s.handleAuthorize)
+	mux.HandleFunc("/oauth2/token", s.handleToken)
+	mux.HandleFunc("/oauth2/validate", s.handleValidate)
+	mux.HandleFunc("/oauth2/revoke", s.handleRevoke)
+
+	mux.HandleFunc("/mock/scenario", s.handleScenario)
+	mux.HandleFunc("/mock/state", s.handleState)
+	return mux
+}
+
+// IssueToken crée directement un token utilisateur (utile dans les tests)
+func (s *Server) IssueToken(userID string, scopes ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issueTokenLocked(userID, scopes)
+}
+
+func (s *Server) issueTokenLocked(userID string, scopes []string) string {
+	tok := s.randomString(30)
+	s.tokens[tok] = &token{userID: userID, scopes: scopes, expiresAt: time.Now().Add(4 * time.Hour)}
+	return tok
+}
+
+func (s *Server) randomString(n int) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[s.rng.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+// Chatters retourne une copie des IDs connectés au chat d'un broadcaster
+func (s *Server) Chatters(broadcasterID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.chatters[broadcasterID]...)
+}
+
+// User retourne une copie du compte, ou nil s'il n'existe pas (ou plus)
+func (s *Server) User(id string) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return nil
+	}
+	cp := *u
+	return &cp
+}
+
+// --- Helix ---
+
+type helixHandler func(w http.ResponseWriter, r *http.Request, tok *token)
+
+// helix applique les contrôles communs aux endpoints Helix : méthode (GET par défaut),
+// Client-Id, token Bearer, rate limit (headers Ratelimit-*) et étapes de scénario différées.
+func (s *Server) helix(next helixHandler, methods ...string) http.HandlerFunc {
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !contains(methods, r.Method) {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		s.mu.Lock()
+		s.helixRequests++
+		s.applyDueStepsLocked()
+
+		now := time.Now()
+		if now.Sub(s.windowStart) >= time.Minute {
+			s.windowStart = now
+			s.windowCount = 0
+		}
+		s.windowCount++
+		remaining := s.rateLimit - s.windowCount
+		if remaining < 0 {
+			remaining = 0
+		}
+		limited := s.windowCount > s.rateLimit
+		if s.forced429 > 0 {
+			s.forced429--
+			limited = true
+			remaining = 0
+		}
+		w.Header().Set("Ratelimit-Limit", strconv.Itoa(s.rateLimit))
+		w.Header().Set("Ratelimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("Ratelimit-Reset", strconv.FormatInt(s.windowStart.Add(time.Minute).Unix(), 10))
+
+		if r.Header.Get("Client-Id") == "" {
+			s.mu.Unlock()
+			writeError(w, http.StatusUnauthorized, "Client-Id header required")
+			return
+		}
+		tok, ok := s.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		if !ok || time.Now().After(tok.expiresAt) {
+			s.mu.Unlock()
+			writeError(w, http.StatusUnauthorized, "Invalid OAuth token")
+			return
+		}
+		s.mu.Unlock()
+
+		if limited {
+			writeError(w, http.StatusTooManyRequests, "Too Many Requests")
+			return
+		}
+		next(w, r, tok)
+	}
+}
+
+func (s *Server) handleChatters(w http.ResponseWriter, r *http.Request, tok *token) {
+	q := r.URL.Query()
+	broadcasterID := q.Get("broadcaster_id")
+	moderatorID := q.Get("moderator_id")
+	if broadcasterID == "" || moderatorID == "" {
+		writeError(w, http.StatusBadRequest, "Missing required parameter")
+		return
+	}
+	if tok.userID == "" || tok.userID != moderatorID {
+		writeError(w, http.StatusUnauthorized, "The ID in moderator_id must match the user ID in the user access token")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if broadcasterID != moderatorID && !contains(s.moderated[moderatorID], broadcasterID) {
+		writeError(w, http.StatusForbidden, "The user in moderator_id is not one of the broadcaster's moderators")
+		return
+	}
+
+	ids := s.chatters[broadcasterID]
+	first := clampInt(q.Get("first"), 100, 1, 1000)
+	offset := decodeCursor(q.Get("after"))
+	if offset > len(ids) {
+		offset = len(ids)
+	}
+	end := offset + first
+	if end > len(ids) {
+		end = len(ids)
+	}
+
+	type chatter struct {
+		UserID    string `json:"user_id"`
+		UserLogin string `json:"user_login"`
+		UserName  string `json:"user_name"`
+	}
+	data := make([]chatter, 0, end-offset)
+	for _, id := range ids[offset:end] {
+		c := chatter{UserID: id}
+		if u, ok := s.users[id]; ok {
+			c.UserLogin, c.UserName = u.Login, u.DisplayName
+		}
+		data = append(data, c)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":       data,
+		"pagination": paginationFor(end, len(ids)),
+		"total":      len(ids),
+	})
+}
+
+// handleFollowers émule /helix/channels/followers : les plus récents d'abord. Comme Twitch,
+// sans token du broadcaster ou d'un de ses modérateurs avec moderator:read:followers, seul le
+// total est retourné.
+func (s *Server) handleFollowers(w http.ResponseWriter, r *http.Request, tok *token) {
+	q := r.URL.Query()
+	broadcasterID := q.Get("broadcaster_id")
+	if broadcasterID == "" {
+		writeError(w, http.StatusBadRequest, "Missing required parameter \"broadcaster_id\"")
+		return
+	}
+	if tok.userID == "" {
+		writeError(w, http.StatusUnauthorized, "User access token required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := s.followers[broadcasterID]
+	allowed := contains(tok.scopes, "moderator:read:followers") &&
+		(tok.userID == broadcasterID || contains(s.moderated[tok.userID], broadcasterID))
+	if !allowed {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"data":       []interface{}{},
+			"pagination": map[string]string{},
+			"total":      len(all),
+		})
+		return
+	}
+
+	// Du plus récent au plus ancien, éventuellement limité à un compte
+	var list []follow
+	for i := len(all) - 1; i >= 0; i-- {
+		if userID := q.Get("user_id"); userID == "" || all[i].userID == userID {
+			list = append(list, all[i])
+		}
+	}
+	first := clampInt(q.Get("first"), 20, 1, 100)
+	offset := min(decodeCursor(q.Get("after")), len(list))
+	end := min(offset+first, len(list))
+
+	type follower struct {
+		UserID     string    `json:"user_id"`
+		UserLogin  string    `json:"user_login"`
+		UserName   string    `json:"user_name"`
+		FollowedAt time.Time `json:"followed_at"`
+	}
+	data := make([]follower, 0, end-offset)
+	for _, f := range list[offset:end] {
+		fo := follower{UserID: f.userID, FollowedAt: f.followedAt}
+		if u, ok := s.users[f.userID]; ok {
+			fo.UserLogin, fo.UserName = u.Login, u.DisplayName
+		}
+		data = append(data, fo)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":       data,
+		"pagination": paginationFor(end, len(list)),
+		"total":      len(list),
+	})
+}
+
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request, tok *token) {
+	q := r.URL.Query()
+	ids := q["id"]
+	logins := q["login"]
+	if len(ids)+len(logins) > 100 {
+		writeError(w, http.StatusBadRequest, "The maximum number of id and login parameters is 100")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []User
+	if len(ids)+len(logins) == 0 {
+		// Sans paramètre : le compte associé au token
+		if tok.userID == "" {
+			writeError(w, http.StatusBadRequest, "Missing user_id or login parameter")
+			return
+		}
+		if u, ok := s.users[tok.userID]; ok {
+			out = append(out, *u)
+		}
+	}
+	for _, id := range ids {
+		if u, ok := s.users[id]; ok {
+			out = append(out, *u)
+		}
+	}
+	for _, login := range logins {
+		for _, u := range s.users {
+			if strings.EqualFold(u.Login, login) {
+				out = append(out, *u)
+				break
+			}
+		}
+	}
+	if out == nil {
+		out = []User{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": out})
+}
+
+func (s *Server) handleModeratedChannels(w http.ResponseWriter, r *http.Request, tok *token) {
+	q := r.URL.Query()
+	userID := q.Get("user_id")
+	if userID == "" {
+		writeError(w, http.StatusBadRequest, "Missing required parameter user_id")
+		return
+	}
+	if tok.userID != userID {
+		writeError(w, http.StatusUnauthorized, "The user_id must match the user ID in the access token")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// La propre chaîne de l'utilisateur n'apparaît pas dans /moderation/channels
+	var channels []string
+	for _, id := range s.moderated[userID] {
+		if id != userID {
+			channels = append(channels, id)
+		}
+	}
+
+	first := clampInt(q.Get("first"), 20, 1, 100)
+	offset := decodeCursor(q.Get("after"))
+	if offset > len(channels) {
+		offset = len(channels)
+	}
+	end := offset + first
+	if end > len(channels) {
+		end = len(channels)
+	}
+
+	type channel struct {
+		BroadcasterID    string `json:"broadcaster_id"`
+		BroadcasterLogin string `json:"broadcaster_login"`
+		BroadcasterName  string `json:"broadcaster_name"`
+	}
+	data := make([]channel, 0, end-offset)
+	for _, id := range channels[offset:end] {
+		c := channel{BroadcasterID: id}
+		if u, ok := s.users[id]; ok {
+			c.BroadcasterLogin, c.BroadcasterName = u.Login, u.DisplayName
+		}
+		data = append(data, c)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":       data,
+		"pagination": paginationFor(end, len(channels)),
+	})
+}
+
+// --- OAuth ---
+
+// handleAuthorize simule l'écran de consentement : l'utilisateur ModeratorID (ou login=...)
+// accepte immédiatement et est redirigé vers redirect_uri avec un code.
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	if redirectURI == "" {
+		writeError(w, http.StatusBadRequest, "missing redirect_uri")
+		return
+	}
+
+	s.mu.Lock()
+	userID := ModeratorID
+	if login := q.Get("login"); login != "" {
+		for _, u := range s.users {
+			if strings.EqualFold(u.Login, login) {
+				userID = u.ID
+			}
+		}
+	}
+	code := s.codeForLocked(userID)
+	s.mu.Unlock()
+
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid redirect_uri")
+		return
+	}
+	params := u.Query()
+	params.Set("code", code)
+	params.Set("scope", q.Get("scope"))
+	params.Set("state", q.Get("state"))
+	u.RawQuery = params.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// CodeFor crée un code d'autorisation OAuth pour userID (utile dans les tests)
+func (s *Server) CodeFor(userID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.codeForLocked(userID)
+}
+
+func (s *Server) codeForLocked(userID string) string {
+	code := s.randomString(30)
+	s.codes[code] = userID
+	return code
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+	if s.cfg.ClientID != "" && (r.Form.Get("client_id") != s.cfg.ClientID || r.Form.Get("client_secret") != s.cfg.ClientSecret) {
+		writeError(w, http.StatusForbidden, "invalid client")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var userID string
+	scopes := []string{"user:read:moderated_channels", "moderator:read:chatters", "moderator:read:followers"}
+	switch r.Form.Get("grant_type") {
+	case "authorization_code":
+		id, ok := s.codes[r.Form.Get("code")]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Invalid authorization code")
+			return
+		}
+		delete(s.codes, r.Form.Get("code"))
+		userID = id
+	case "refresh_token":
+		id, ok := s.refresh[r.Form.Get("refresh_token")]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Invalid refresh token")
+			return
+		}
+		userID = id
+	case "client_credentials":
+		tok := s.issueTokenLocked("", nil)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": tok,
+			"expires_in":   int(time.Until(s.tokens[tok].expiresAt).Seconds()),
+			"token_type":   "bearer",
+		})
+		return
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported grant_type")
+		return
+	}
+
+	tok := s.issueTokenLocked(userID, scopes)
+	refreshToken := s.randomString(40)
+	s.refresh[refreshToken] = userID
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  tok,
+		"refresh_token": refreshToken,
+		"expires_in":    int(time.Until(s.tokens[tok].expiresAt).Seconds()),
+		"scope":         scopes,
+		"token_type":    "bearer",
+	})
+}
+
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	raw := strings.TrimPrefix(strings.TrimPrefix(auth, "OAuth "), "Bearer ")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tok, ok := s.tokens[raw]
+	if !ok || time.Now().After(tok.expiresAt) {
+		writeError(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+	resp := map[string]interface{}{
+		"client_id":  s.cfg.ClientID,
+		"scopes":     tok.scopes,
+		"expires_in": int(time.Until(tok.expiresAt).Seconds()),
+	}
+	if tok.userID != "" {
+		resp["user_id"] = tok.userID
+		if u, ok := s.users[tok.userID]; ok {
+			resp["login"] = u.Login
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[r.Form.Get("token")]; !ok {
+		writeError(w, http.StatusBadRequest, "Invalid token")
+		return
+	}
+	delete(s.tokens, r.Form.Get("token"))
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleState expose un résumé de l'état simulé (debug)
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int, len(s.chatters))
+	for id, ids := range s.chatters {
+		counts[id] = len(ids)
+	}
+	followers := make(map[string]int, len(s.followers))
+	for id, list := range s.followers {
+		followers[id] = len(list)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"users":          len(s.users),
+		"chatters":       counts,
+		"followers":      followers,
+		"helix_requests": s.helixRequests,
+		"pending_steps":  len(s.pending),
+		"forced_429":     s.forced429,
+		"eventsub": map[string]int{
+			"subscriptions":      len(s.subscriptions),
+			"messages_sent":      s.eventsubSent,
+			"websocket_sessions": len(s.wsSessions),
+		},
+		"chat": map[string]interface{}{
+			"connections":   len(s.ircConns),
+			"channels":      s.ircChannelsLocked(),
+			"messages_sent": s.chatSent,
+		},
+	})
+}
+
+// --- Helpers ---
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError répond avec le format d'erreur de Twitch
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error":   http.StatusText(status),
+		"status":  status,
+		"message": message,
+	})
+}
+
+func paginationFor(next, total int) map[string]string {
+	if next >= total {
+		return map[string]string{}
+	}
+	return map[string]string{"cursor": base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(next)))}
+}
+
+func decodeCursor(cursor string) int {
+	if cursor == "" {
+		return 0
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(string(b))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+func clampInt(v string, def, min, max int) int {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
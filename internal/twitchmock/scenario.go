@@ -0,0 +1,439 @@
+package twitchmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/eventsub"
+)
+
+// Types d'étapes de scénario
+const (
+	StepBotWave           = "bot_wave"           // Count comptes créés le même jour rejoignent le chat (et suivent la chaîne si Follow)
+	StepRename            = "rename"             // des comptes changent de login/display_name
+	StepRateLimitStorm    = "rate_limit_storm"   // les Requests prochains appels Helix reçoivent un 429
+	StepRemoveUsers       = "remove_users"       // des comptes disparaissent de /users (suspendus/supprimés)
+	StepLeave             = "leave"              // des chatters quittent le chat
+	StepStreamOnline      = "stream_online"      // le stream démarre (notification EventSub stream.online)
+	StepRaid              = "raid"               // un raid de Count spectateurs arrive dans le chat (channel.raid)
+	StepFollow            = "follow"             // Count comptes récents suivent la chaîne (channel.follow)
+	StepEventSubReconnect = "eventsub_reconnect" // les sessions EventSub WebSocket reçoivent session_reconnect
+	StepEventSubDrop      = "eventsub_drop"      // les sessions EventSub WebSocket sont coupées sans fermeture
+	StepChat              = "chat"               // Count chatters écrivent chacun Messages messages différents
+	StepChatSpam          = "chat_spam"          // des chatters répètent chacun Messages fois le même Text
+	StepChatReconnect     = "chat_reconnect"     // les connexions IRC reçoivent RECONNECT
+)
+
+// Step est une étape de scénario. Les champs utilisés dépendent de Kind.
+type Step struct {
+	Kind string `json:"kind"`
+
+	// Déclenchement : immédiat si 0, sinon au AtRequest-ième appel Helix (compteur global)
+	AtRequest int `json:"at_request,omitempty"`
+
+	// Chaîne ciblée (défaut : StreamerID)
+	Broadcaster string `json:"broadcaster,omitempty"`
+
+	// Nombre de comptes concernés (bot_wave, rename, remove_users, leave, raid, follow, chat, chat_spam)
+	Count int `json:"count,omitempty"`
+	// Comptes explicitement ciblés (rename, remove_users, chat_spam), prioritaires sur Count
+	UserIDs []string `json:"user_ids,omitempty"`
+
+	// bot_wave, follow : préfixe des logins ; bot_wave : date de création commune (YYYY-MM-DD, défaut : il y a 3 jours)
+	Prefix    string `json:"prefix,omitempty"`
+	CreatedOn string `json:"created_on,omitempty"`
+	// bot_wave : image de profil commune non par défaut, désignée par un nom et envoyée par
+	// chaque compte sous sa propre URL (sinon avatar par défaut)
+	SharedAvatar string `json:"shared_avatar,omitempty"`
+	// bot_wave : les comptes suivent aussi la chaîne (sans notification EventSub)
+	Follow bool `json:"follow,omitempty"`
+
+	// rate_limit_storm : nombre de réponses 429 consécutives
+	Requests int `json:"requests,omitempty"`
+
+	// chat, chat_spam : messages par compte (défaut : 1 pour chat, 3 pour chat_spam) ;
+	// chat_spam : texte répété (défaut : une publicité pour des viewers)
+	Messages int    `json:"messages,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+// Scenario est une suite d'étapes nommée
+type Scenario struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Steps       []Step `json:"steps"`
+}
+
+// Presets sont les scénarios prédéfinis, sélectionnables par leur nom
+var Presets = map[string]Scenario{
+	"bot-wave": {
+		Name:        "bot-wave",
+		Description: "300 comptes créés le même jour rejoignent le chat du streamer",
+		Steps:       []Step{{Kind: StepBotWave, Count: 300}},
+	},
+	"renames": {
+		Name:        "renames",
+		Description: "20 chatters changent de nom après les 5 premiers appels Helix, puis encore après 15",
+		Steps: []Step{
+			{Kind: StepRename, Count: 20, AtRequest: 5},
+			{Kind: StepRename, Count: 20, AtRequest: 15},
+		},
+	},
+	"429-storm": {
+		Name:        "429-storm",
+		Description: "10 réponses 429 consécutives à partir du 3e appel Helix",
+		Steps:       []Step{{Kind: StepRateLimitStorm, Requests: 10, AtRequest: 3}},
+	},
+	"raid": {
+		Name:        "raid",
+		Description: "un raid de 150 spectateurs arrive sur la chaîne du streamer (notification EventSub channel.raid)",
+		Steps:       []Step{{Kind: StepRaid, Count: 150}},
+	},
+	"chat-spam": {
+		Name:        "chat-spam",
+		Description: "40 viewers discutent, puis 30 comptes d'une vague de bots répètent la même publicité dans le chat",
+		Steps: []Step{
+			{Kind: StepChat, Count: 40, Messages: 2},
+			{Kind: StepBotWave, Count: 30, Prefix: "spambot"},
+			{Kind: StepChatSpam, Count: 30},
+		},
+	},
+	"follow-bots": {
+		Name:        "follow-bots",
+		Description: "une vague de 60 bots créés le même jour suit la chaîne du streamer, dont 40 rejoignent aussi le chat",
+		Steps: []Step{
+			{Kind: StepBotWave, Count: 40, Prefix: "followbot", Follow: true},
+			{Kind: StepFollow, Count: 20, Prefix: "followbot"},
+		},
+	},
+	"suspensions": {
+		Name:        "suspensions",
+		Description: "25 chatters sont suspendus entre la capture et l'enrichissement",
+		Steps:       []Step{{Kind: StepRemoveUsers, Count: 25, AtRequest: 2}},
+	},
+}
+
+// LoadScenarioFile lit un scénario JSON depuis le disque
+func LoadScenarioFile(path string) (Scenario, error) {
+	var sc Scenario
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sc, err
+	}
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return sc, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+	return sc, nil
+}
+
+// Run applique un scénario : les étapes immédiates tout de suite, les autres au
+// moment de leur AtRequest.
+func (s *Server) Run(sc Scenario) error {
+	for _, st := range sc.Steps {
+		if err := validateStep(st); err != nil {
+			return fmt.Errorf("scenario %s: %w", sc.Name, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, st := range sc.Steps {
+		if st.AtRequest > 0 && st.AtRequest > s.helixRequests {
+			s.pending = append(s.pending, st)
+			continue
+		}
+		s.applyStepLocked(st)
+	}
+	sort.SliceStable(s.pending, func(i, j int) bool { return s.pending[i].AtRequest < s.pending[j].AtRequest })
+	return nil
+}
+
+func validateStep(st Step) error {
+	switch st.Kind {
+	case StepBotWave, StepRename, StepRemoveUsers, StepLeave, StepChatSpam:
+		if st.Count <= 0 && len(st.UserIDs) == 0 {
+			return fmt.Errorf("step %s needs count or user_ids", st.Kind)
+		}
+	case StepRaid, StepFollow, StepChat:
+		if st.Count <= 0 {
+			return fmt.Errorf("step %s needs count", st.Kind)
+		}
+	case StepRateLimitStorm:
+		if st.Requests <= 0 {
+			return fmt.Errorf("step %s needs requests", st.Kind)
+		}
+	case StepStreamOnline, StepEventSubReconnect, StepEventSubDrop, StepChatReconnect:
+		// pas de paramètre
+	default:
+		return fmt.Errorf("unknown step kind %q", st.Kind)
+	}
+	if st.Messages < 0 {
+		return fmt.Errorf("step %s: messages must be positive", st.Kind)
+	}
+	if st.CreatedOn != "" {
+		if _, err := time.Parse("2006-01-02", st.CreatedOn); err != nil {
+			return fmt.Errorf("invalid created_on %q", st.CreatedOn)
+		}
+	}
+	return nil
+}
+
+// applyDueStepsLocked applique les étapes différées dont le seuil est atteint
+func (s *Server) applyDueStepsLocked() {
+	for len(s.pending) > 0 && s.pending[0].AtRequest <= s.helixRequests {
+		st := s.pending[0]
+		s.pending = s.pending[1:]
+		s.applyStepLocked(st)
+	}
+}
+
+func (s *Server) applyStepLocked(st Step) {
+	broadcaster := st.Broadcaster
+	if broadcaster == "" {
+		broadcaster = StreamerID
+	}
+
+	switch st.Kind {
+	case StepBotWave:
+		prefix := st.Prefix
+		if prefix == "" {
+			prefix = "wavebot"
+		}
+		day := time.Now().UTC().AddDate(0, 0, -3).Truncate(24 * time.Hour)
+		if st.CreatedOn != "" {
+			day, _ = time.Parse("2006-01-02", st.CreatedOn)
+		}
+		for i := 0; i < st.Count; i++ {
+			createdAt := day.Add(time.Duration(s.rng.Intn(86400)) * time.Second)
+			u := s.newUser(fmt.Sprintf("%s%s%04d", prefix, s.randomString(4), i), createdAt)
+			u.Description = ""
+			u.ProfileImageURL = DefaultAvatarURL
+			if st.SharedAvatar != "" {
+				s.setProfileImageLocked(u, st.SharedAvatar)
+			}
+			s.chatters[broadcaster] = append(s.chatters[broadcaster], u.ID)
+			if st.Follow {
+				s.followLocked(broadcaster, u.ID, time.Now().UTC())
+			}
+		}
+
+	case StepRename:
+		for _, id := range s.targetsLocked(st, broadcaster) {
+			if u, ok := s.users[id]; ok {
+				u.Login = fmt.Sprintf("%s_%s", trimSuffix(u.Login), s.randomString(3))
+				u.DisplayName = u.Login
+			}
+		}
+
+	case StepRemoveUsers:
+		for _, id := range s.targetsLocked(st, broadcaster) {
+			delete(s.users, id)
+		}
+
+	case StepLeave:
+		targets := make(map[string]bool)
+		for _, id := range s.targetsLocked(st, broadcaster) {
+			targets[id] = true
+		}
+		kept := s.chatters[broadcaster][:0]
+		for _, id := range s.chatters[broadcaster] {
+			if !targets[id] {
+				kept = append(kept, id)
+			}
+		}
+		s.chatters[broadcaster] = kept
+
+	case StepRateLimitStorm:
+		s.forced429 += st.Requests
+
+	case StepStreamOnline:
+		u := s.users[broadcaster]
+		if u == nil {
+			return
+		}
+		s.notifyLocked(eventsub.StreamOnline, broadcaster, eventsub.StreamOnlineEvent{
+			ID:                s.randomString(12),
+			BroadcasterUserID: u.ID, BroadcasterUserLogin: u.Login, BroadcasterUserName: u.DisplayName,
+			Type:      "live",
+			StartedAt: time.Now().UTC(),
+		})
+
+	case StepEventSubReconnect:
+		s.reconnectEventSubSessionsLocked()
+
+	case StepEventSubDrop:
+		s.dropEventSubSessionsLocked()
+
+	case StepChat:
+		// Les premiers chatters (viewers organiques) écrivent des messages tous différents
+		u := s.users[broadcaster]
+		if u == nil {
+			return
+		}
+		messages := max(st.Messages, 1)
+		authors := 0
+		for _, id := range s.chatters[broadcaster] {
+			author := s.users[id]
+			if authors == st.Count {
+				break
+			}
+			if id == StreamerID || id == ModeratorID || author == nil {
+				continue
+			}
+			authors++
+			for i := 0; i < messages; i++ {
+				phrase := chatPhrases[s.rng.Intn(len(chatPhrases))]
+				s.privmsgLocked(u, author, phrase+" "+s.randomString(5))
+			}
+		}
+
+	case StepChatSpam:
+		// Les derniers chatters (une vague de bots, par exemple) répètent le même texte ; une
+		// répétition sur deux porte le caractère invisible ajouté par certains clients pour
+		// contourner le filtre anti-doublon de Twitch
+		u := s.users[broadcaster]
+		if u == nil {
+			return
+		}
+		text := st.Text
+		if text == "" {
+			text = "Cheap viewers and followers on example.com"
+		}
+		messages := st.Messages
+		if messages == 0 {
+			messages = 3
+		}
+		for _, id := range s.targetsLocked(st, broadcaster) {
+			author := s.users[id]
+			if author == nil {
+				continue
+			}
+			for i := 0; i < messages; i++ {
+				if i%2 == 1 {
+					s.privmsgLocked(u, author, text+" \U000E0000")
+				} else {
+					s.privmsgLocked(u, author, text)
+				}
+			}
+		}
+
+	case StepChatReconnect:
+		s.reconnectIRCLocked()
+
+	case StepRaid:
+		// Les spectateurs du raid, comptes organiques, rejoignent le chat avant la notification
+		u := s.users[broadcaster]
+		if u == nil {
+			return
+		}
+		raider := s.newUser("raider"+s.randomString(6), s.randomCreatedAt())
+		for i := 0; i < st.Count; i++ {
+			viewer := s.newUser(fmt.Sprintf("%sviewer%04d", raider.Login, i), s.randomCreatedAt())
+			s.chatters[broadcaster] = append(s.chatters[broadcaster], viewer.ID)
+		}
+		s.notifyLocked(eventsub.ChannelRaid, broadcaster, eventsub.RaidEvent{
+			FromBroadcasterUserID: raider.ID, FromBroadcasterUserLogin: raider.Login, FromBroadcasterUserName: raider.DisplayName,
+			ToBroadcasterUserID: u.ID, ToBroadcasterUserLogin: u.Login, ToBroadcasterUserName: u.DisplayName,
+			Viewers: st.Count,
+		})
+
+	case StepFollow:
+		// Comptes créés le jour même, comme une vague de follow-bots
+		u := s.users[broadcaster]
+		if u == nil {
+			return
+		}
+		prefix := st.Prefix
+		if prefix == "" {
+			prefix = "follower"
+		}
+		for i := 0; i < st.Count; i++ {
+			f := s.newUser(fmt.Sprintf("%s%s%04d", prefix, s.randomString(4), i), time.Now().UTC().Truncate(time.Second))
+			s.followLocked(broadcaster, f.ID, time.Now().UTC())
+			s.notifyLocked(eventsub.ChannelFollow, broadcaster, eventsub.FollowEvent{
+				UserID: f.ID, UserLogin: f.Login, UserName: f.DisplayName,
+				BroadcasterUserID: u.ID, BroadcasterUserLogin: u.Login, BroadcasterUserName: u.DisplayName,
+				FollowedAt: time.Now().UTC(),
+			})
+		}
+	}
+}
+
+// chatPhrases sont les messages des viewers organiques (step chat), suivis d'un suffixe aléatoire
+var chatPhrases = []string{
+	"salut tout le monde", "gg", "trop bien ce stream", "c'est quoi le jeu ?", "bien joué",
+	"première fois ici", "on est combien ?", "bonne soirée", "let's go", "quel clutch",
+}
+
+// targetsLocked retourne les comptes visés par une étape : UserIDs, ou les Count
+// derniers chatters du broadcaster (hors streamer et modérateur)
+func (s *Server) targetsLocked(st Step, broadcaster string) []string {
+	if len(st.UserIDs) > 0 {
+		return st.UserIDs
+	}
+	var out []string
+	ids := s.chatters[broadcaster]
+	for i := len(ids) - 1; i >= 0 && len(out) < st.Count; i-- {
+		if ids[i] == StreamerID || ids[i] == ModeratorID {
+			continue
+		}
+		out = append(out, ids[i])
+	}
+	return out
+}
+
+// trimSuffix retire le suffixe aléatoire ajouté par un renommage précédent
+func trimSuffix(login string) string {
+	for i := len(login) - 1; i >= 0; i-- {
+		if login[i] == '_' {
+			return login[:i]
+		}
+	}
+	return login
+}
+
+// handleScenario liste les scénarios prédéfinis (GET) ou en exécute un (POST).
+// Corps POST : {"name": "bot-wave"} pour un preset, ou un Scenario complet.
+func (s *Server) handleScenario(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		names := make([]string, 0, len(Presets))
+		for name := range Presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := make([]Scenario, 0, len(names))
+		for _, name := range names {
+			list = append(list, Presets[name])
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": list})
+
+	case http.MethodPost:
+		var sc Scenario
+		if err := json.NewDecoder(r.Body).Decode(&sc); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid scenario JSON")
+			return
+		}
+		if len(sc.Steps) == 0 {
+			preset, ok := Presets[sc.Name]
+			if !ok {
+				writeError(w, http.StatusNotFound, "unknown scenario "+sc.Name)
+				return
+			}
+			sc = preset
+		}
+		if err := s.Run(sc); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"applied": sc.Name, "steps": len(sc.Steps)})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,237 @@
+// Package webhooks met en forme et envoie les notifications des webhooks des utilisateurs
+// (capture terminée, rafale de créations de comptes, comptes suspects, job en échec,
+// alerte déclenchée).
+//
+// Chaque notification est enregistrée dans le journal des livraisons (webhook_deliveries)
+// avec le job DELIVER_WEBHOOK de sa première tentative ; le worker l'envoie, signée en
+// HMAC-SHA256, et replanifie les tentatives en échec. Le corps est au format générique
+// (JSON de Notification), Discord (embed) ou Slack (blocks).
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+)
+
+// En-têtes des livraisons
+const (
+	HeaderSignature = "X-TCA-Signature" // sha256=<hex HMAC-SHA256 de "<timestamp>.<corps>">
+	HeaderTimestamp = "X-TCA-Timestamp" // secondes Unix de l'envoi
+	HeaderEvent     = "X-TCA-Event"
+	HeaderDelivery  = "X-TCA-Delivery" // id de la livraison, identique d'une tentative à l'autre
+)
+
+const userAgent = "twitch-chatters-analyser-webhooks/1"
+
+// ErrPrivateAddress est retournée quand l'URL d'un webhook résout vers une adresse interne
+var ErrPrivateAddress = errors.New("webhook URL resolves to a private address")
+
+// Notification est le contenu d'une notification, indépendant du format
+type Notification struct {
+	Event       string    `json:"event"`
+	Title       string    `json:"title"`
+	Text        string    `json:"text"`
+	SessionUUID string    `json:"session_uuid,omitempty"`
+	At          time.Time `json:"at"`
+	Data        any       `json:"data,omitempty"`
+}
+
+// Couleurs des embeds Discord par événement
+var discordColors = map[string]int{
+	store.WebhookCaptureFinished:    0x2ecc71,
+	store.WebhookCreationBurst:      0xe67e22,
+	store.WebhookSuspiciousAccounts: 0xf1c40f,
+	store.WebhookJobFailed:          0xe74c3c,
+	store.WebhookAlertTriggered:     0xe91e63,
+	store.WebhookTest:               0x9146ff,
+}
+
+// Render retourne le corps d'une notification au format du webhook
+func Render(format string, n Notification) ([]byte, error) {
+	switch format {
+	case store.WebhookFormatGeneric:
+		return json.Marshal(n)
+	case store.WebhookFormatDiscord:
+		embed := map[string]any{
+			"title":       n.Title,
+			"description": n.Text,
+			"color":       discordColors[n.Event],
+			"timestamp":   n.At.UTC().Format(time.RFC3339),
+		}
+		if n.SessionUUID != "" {
+			embed["footer"] = map[string]string{"text": "Session " + n.SessionUUID}
+		}
+		return json.Marshal(map[string]any{
+			"username":         "Twitch Chatters Analyser",
+			"allowed_mentions": map[string]any{"parse": []string{}}, // pas de @everyone venu d'un login
+			"embeds":           []any{embed},
+		})
+	case store.WebhookFormatSlack:
+		text := "*" + slackEscape(n.Title) + "*\n" + slackEscape(n.Text)
+		if n.SessionUUID != "" {
+			text += "\n_Session " + n.SessionUUID + "_"
+		}
+		return json.Marshal(map[string]any{
+			"text": slackEscape(n.Title), // repli des notifications
+			"blocks": []any{map[string]any{
+				"type": "section",
+				"text": map[string]string{"type": "mrkdwn", "text": text},
+			}},
+		})
+	default:
+		return nil, fmt.Errorf("unknown webhook format %q", format)
+	}
+}
+
+// slackEscape échappe les caractères de contrôle du mrkdwn Slack
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// Sign retourne la signature d'un corps : sha256=<hex HMAC-SHA256 de "<timestamp>.<corps>">.
+// Le timestamp signé permet au destinataire de rejeter les rejeux.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateURL vérifie qu'une URL de webhook est une URL http(s) absolue
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q", raw)
+	}
+	return nil
+}
+
+// NewHTTPClient retourne le client des livraisons : sans proxy ni redirection, et, sauf
+// allowPrivate, refusant de se connecter aux adresses internes (boucle locale, réseaux
+// privés, lien local, plages réservées), vérifiées après résolution DNS
+func NewHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || isPrivate(ap.Addr()) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// privatePrefixes sont les plages refusées aux livraisons : adresses non routables sur
+// Internet ou réservées (RFC 6890 et suivantes)
+var privatePrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // « ce réseau »
+	netip.MustParsePrefix("10.0.0.0/8"),      // privé
+	netip.MustParsePrefix("100.64.0.0/10"),   // NAT des opérateurs (CGNAT)
+	netip.MustParsePrefix("127.0.0.0/8"),     // boucle locale
+	netip.MustParsePrefix("169.254.0.0/16"),  // lien local (métadonnées des clouds)
+	netip.MustParsePrefix("172.16.0.0/12"),   // privé
+	netip.MustParsePrefix("192.0.0.0/24"),    // affectations de l'IETF
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.168.0.0/16"),  // privé
+	netip.MustParsePrefix("198.18.0.0/15"),   // bancs de test
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // réservé, diffusion
+	netip.MustParsePrefix("::/96"),           // non spécifiée, boucle locale, IPv4 compatibles
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // NAT64 local
+	netip.MustParsePrefix("100::/64"),        // rejet
+	netip.MustParsePrefix("2001::/32"),       // Teredo (IPv4 embarquée)
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4 (IPv4 embarquée)
+	netip.MustParsePrefix("fc00::/7"),        // unique local
+	netip.MustParsePrefix("fe80::/10"),       // lien local
+	netip.MustParsePrefix("fec0::/10"),       // site local
+	netip.MustParsePrefix("ff00::/8"),        // multicast
+}
+
+// nat64Prefix est le préfixe NAT64 public : l'adresse IPv4 embarquée est vérifiée
+var nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// isPrivate indique si addr est interne ; les formes IPv4 dans IPv6 (::ffff:a.b.c.d,
+// NAT64) sont ramenées à leur adresse IPv4
+func isPrivate(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+	if nat64Prefix.Contains(addr) {
+		b := addr.As16()
+		addr = netip.AddrFrom4([4]byte(b[12:]))
+	}
+	for _, p := range privatePrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Send envoie une livraison signée et retourne le statut HTTP (0 sans réponse) ; une
+// réponse hors 2xx est une erreur
+func Send(ctx context.Context, client *http.Client, w *store.Webhook, d *store.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return 0, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderSignature, Sign(w.Secret, ts, d.Body))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Enqueue met en forme une notification pour un webhook et planifie sa livraison
+func Enqueue(ctx context.Context, st *store.Store, w store.Webhook, n Notification) (int64, error) {
+	body, err := Render(w.Format, n)
+	if err != nil {
+		return 0, err
+	}
+	return st.Webhooks.CreateDelivery(ctx, w.ID, n.Event, body)
+}
@@ -0,0 +1,121 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got := Sign("secret", 1700000000, []byte("{}")); got != want {
+		t.Errorf("Sign = %q, want %q", got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	n := Notification{
+		Event: store.WebhookSuspiciousAccounts, Title: "Comptes suspects", Text: "3 avatars <par défaut> & co",
+		SessionUUID: "abc", At: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	var discord struct {
+		AllowedMentions struct {
+			Parse []string `json:"parse"`
+		} `json:"allowed_mentions"`
+		Embeds []struct {
+			Title     string `json:"title"`
+			Color     int    `json:"color"`
+			Timestamp string `json:"timestamp"`
+		} `json:"embeds"`
+	}
+	body, err := Render(store.WebhookFormatDiscord, n)
+	if err != nil || json.Unmarshal(body, &discord) != nil {
+		t.Fatalf("Render(discord) = %s, %v", body, err)
+	}
+	if len(discord.Embeds) != 1 || discord.Embeds[0].Title != n.Title || discord.Embeds[0].Color == 0 ||
+		discord.Embeds[0].Timestamp != "2026-01-02T03:04:05Z" || discord.AllowedMentions.Parse == nil {
+		t.Errorf("discord body = %s", body)
+	}
+
+	var slack struct {
+		Blocks []struct {
+			Text struct {
+				Text string `json:"text"`
+			} `json:"text"`
+		} `json:"blocks"`
+	}
+	body, err = Render(store.WebhookFormatSlack, n)
+	if err != nil || json.Unmarshal(body, &slack) != nil || len(slack.Blocks) != 1 {
+		t.Fatalf("Render(slack) = %s, %v", body, err)
+	}
+	if !strings.Contains(slack.Blocks[0].Text.Text, "&lt;par défaut&gt; &amp; co") {
+		t.Errorf("slack text not escaped: %q", slack.Blocks[0].Text.Text)
+	}
+
+	if _, err := Render("xml", n); err == nil {
+		t.Error("Render accepted an unknown format")
+	}
+}
+
+func TestPrivateAddressGuard(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	w := &store.Webhook{URL: srv.URL, Secret: "s"}
+	d := &store.WebhookDelivery{ID: 1, Event: store.WebhookTest, Body: []byte("{}")}
+	if _, err := Send(context.Background(), NewHTTPClient(time.Second, false), w, d); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Send to loopback = %v, want ErrPrivateAddress", err)
+	}
+	if status, err := Send(context.Background(), NewHTTPClient(time.Second, true), w, d); err != nil || status != http.StatusOK {
+		t.Errorf("Send with private addresses allowed = %d, %v", status, err)
+	}
+}
+
+func TestIsPrivate(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1":            true,
+		"10.1.2.3":             true,
+		"172.31.255.255":       true,
+		"192.168.1.1":          true,
+		"169.254.169.254":      true,
+		"100.64.0.1":           true,
+		"100.127.255.254":      true,
+		"192.0.0.8":            true,
+		"198.18.0.1":           true,
+		"198.19.255.255":       true,
+		"240.0.0.1":            true,
+		"255.255.255.255":      true,
+		"0.0.0.0":              true,
+		"224.0.0.251":          true,
+		"::":                   true,
+		"::1":                  true,
+		"::ffff:127.0.0.1":     true,
+		"::ffff:10.0.0.1":      true,
+		"64:ff9b::a9fe:a9fe":   true, // NAT64 de 169.254.169.254
+		"64:ff9b::7f00:1":      true, // NAT64 de 127.0.0.1
+		"fd00::1":              true,
+		"fe80::1%eth0":         true,
+		"ff02::1":              true,
+		"2002:7f00:1::1":       true,
+		"8.8.8.8":              false,
+		"100.128.0.1":          false,
+		"198.20.0.1":           false,
+		"::ffff:8.8.8.8":       false,
+		"64:ff9b::808:808":     false, // NAT64 de 8.8.8.8
+		"2606:4700:4700::1111": false,
+	} {
+		if got := isPrivate(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPrivate(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package websocket adapte github.com/coder/websocket aux besoins des listeners (EventSub,
+// chat IRC) et du mock Twitch : messages lus un par un avec une échéance, écritures
+// concurrentes, fermeture avec ou sans poignée de main.
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// Types de messages
+const (
+	OpText   = int(websocket.MessageText)
+	OpBinary = int(websocket.MessageBinary)
+)
+
+// Codes de fermeture usuels
+const (
+	CloseNormal        = int(websocket.StatusNormalClosure)
+	CloseGoingAway     = int(websocket.StatusGoingAway)
+	CloseProtocolError = int(websocket.StatusProtocolError)
+	CloseTooBig        = int(websocket.StatusMessageTooBig)
+)
+
+// MaxMessageSize borne la taille d'un message reçu
+const MaxMessageSize = 1 << 20
+
+// CloseError est retournée par ReadMessage quand le pair ferme la connexion
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed with code %d %s", e.Code, e.Reason)
+}
+
+// Conn est une connexion WebSocket. ReadMessage doit être appelé par une seule goroutine ;
+// les écritures peuvent être concurrentes.
+type Conn struct {
+	c *websocket.Conn
+
+	mu           sync.Mutex
+	readDeadline time.Time
+}
+
+func newConn(c *websocket.Conn) *Conn {
+	c.SetReadLimit(MaxMessageSize)
+	return &Conn{c: c}
+}
+
+// Dial ouvre une connexion WebSocket vers rawURL (ws:// ou wss://) ; ctx ne borne que la
+// poignée de main
+func Dial(ctx context.Context, rawURL string, header http.Header) (*Conn, error) {
+	c, _, err := websocket.Dial(ctx, rawURL, &websocket.DialOptions{HTTPHeader: header})
+	if err != nil {
+		return nil, err
+	}
+	return newConn(c), nil
+}
+
+// Upgrade accepte une demande de connexion WebSocket reçue par un serveur HTTP ; une
+// requête invalide reçoit une réponse d'erreur
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	c, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(c), nil
+}
+
+// SetReadDeadline borne l'attente du prochain message (zéro : pas de limite) ; une
+// échéance dépassée ferme la connexion
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+// ReadMessage retourne le prochain message texte ou binaire ; une fermeture par le pair
+// est retournée en *CloseError
+func (c *Conn) ReadMessage() (opcode int, data []byte, err error) {
+	c.mu.Lock()
+	deadline := c.readDeadline
+	c.mu.Unlock()
+
+	ctx := context.Background()
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	typ, data, err := c.c.Read(ctx)
+	if err != nil {
+		var ce websocket.CloseError
+		if errors.As(err, &ce) {
+			return 0, nil, &CloseError{Code: int(ce.Code), Reason: ce.Reason}
+		}
+		return 0, nil, err
+	}
+	return int(typ), data, nil
+}
+
+// WriteMessage envoie un message texte ou binaire
+func (c *Conn) WriteMessage(opcode int, data []byte) error {
+	return c.c.Write(context.Background(), websocket.MessageType(opcode), data)
+}
+
+// Close ferme la connexion avec une trame de fermeture, en attendant brièvement celle du pair
+func (c *Conn) Close(code int, reason string) error {
+	return c.c.Close(websocket.StatusCode(code), reason)
+}
+
+// CloseNow ferme la connexion sans trame de fermeture (coupure réseau simulée)
+func (c *Conn) CloseNow() error {
+	return c.c.CloseNow()
+}
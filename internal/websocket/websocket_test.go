@@ -0,0 +1,106 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEcho(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+		for {
+			op, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(data) == "bye" {
+				c.Close(CloseNormal, "done")
+				return
+			}
+			if err := c.WriteMessage(op, data); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.CloseNow()
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// Messages au-delà de la limite par défaut de la bibliothèque (32 Kio)
+	for _, size := range []int{5, 300, 70000} {
+		msg := strings.Repeat("x", size)
+		if err := c.WriteMessage(OpText, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		op, data, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op != OpText || string(data) != msg {
+			t.Errorf("echo of %d bytes: opcode %d, %d bytes", size, op, len(data))
+		}
+	}
+
+	if err := c.WriteMessage(OpText, []byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = c.ReadMessage()
+	var ce *CloseError
+	if !errors.As(err, &ce) || ce.Code != CloseNormal || ce.Reason != "done" {
+		t.Errorf("close: %v", err)
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+		_, _, _ = c.ReadMessage()
+	}))
+	defer srv.Close()
+
+	c, err := Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.CloseNow()
+	_ = c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, _, err := c.ReadMessage(); err == nil {
+		t.Fatal("ReadMessage without message returned no error")
+	}
+}
+
+func TestUpgradeRejectsPlainRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = Upgrade(w, r)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("status = %d, want 426", resp.StatusCode)
+	}
+}
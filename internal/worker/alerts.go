@@ -0,0 +1,159 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/events"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/webhooks"
+)
+
+// Règles d'alerte : évaluées sur chaque capture terminée (enregistrée et enrichie, les
+// dates de création des comptes n'étant connues qu'après l'enrichissement) avec les règles
+// du propriétaire de la session sur la chaîne capturée. Chaque règle atteinte enregistre
+// une alerte, publiée en direct et notifiée aux webhooks abonnés à alert_triggered.
+
+// alertMetricLabels décrit les métriques dans les notifications
+var alertMetricLabels = map[string]string{
+	store.AlertRecentAccountsPct:   "comptes récents",
+	store.AlertCreationDayAccounts: "comptes créés le même jour",
+	store.AlertDefaultAvatarPct:    "avatars par défaut",
+}
+
+// evaluateAlertRules évalue les règles d'alerte sur une capture terminée ; une erreur est
+// journalisée sans interrompre le job
+func evaluateAlertRules(ctx context.Context, st *store.Store, sessionID int64, data CaptureFinishedData) {
+	if data.CaptureID == 0 || data.BroadcasterID == "" {
+		// job planifié par une version antérieure, sans la capture
+		return
+	}
+	if err := triggerAlerts(ctx, st, sessionID, data); err != nil {
+		log.Printf("cannot evaluate alert rules of capture %d: %v", data.CaptureID, err)
+	}
+}
+
+func triggerAlerts(ctx context.Context, st *store.Store, sessionID int64, data CaptureFinishedData) error {
+	session, err := st.Sessions.ByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	rules, err := st.Alerts.RulesFor(ctx, session.UserID, data.BroadcasterID)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	stats, err := st.TwitchUsers.CaptureStats(ctx, data.CaptureID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, rule := range rules {
+		value, details, ok, err := measureAlertMetric(ctx, st, rule, data.CaptureID, stats, now)
+		if err != nil {
+			return err
+		}
+		if !ok || value < rule.Threshold {
+			continue
+		}
+
+		detailsJSON, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		ruleID := rule.ID
+		alertID, err := st.Alerts.CreateAlert(ctx, store.Alert{
+			RuleID:           &ruleID,
+			UserID:           session.UserID,
+			SessionID:        sessionID,
+			CaptureID:        data.CaptureID,
+			BroadcasterID:    data.BroadcasterID,
+			BroadcasterLogin: data.BroadcasterLogin,
+			Metric:           rule.Metric,
+			Threshold:        rule.Threshold,
+			WindowDays:       rule.WindowDays,
+			Value:            value,
+			Details:          detailsJSON,
+			TriggeredAt:      now,
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("[ALERT] rule %d (%s >= %g) triggered on capture %d of %s: %g",
+			rule.ID, rule.Metric, rule.Threshold, data.CaptureID, data.BroadcasterLogin, value)
+
+		triggered := events.AlertTriggeredData{
+			AlertID:          alertID,
+			RuleID:           rule.ID,
+			CaptureID:        data.CaptureID,
+			BroadcasterID:    data.BroadcasterID,
+			BroadcasterLogin: data.BroadcasterLogin,
+			Metric:           rule.Metric,
+			Threshold:        rule.Threshold,
+			WindowDays:       rule.WindowDays,
+			Value:            value,
+		}
+		publishEvent(events.AlertTriggered, sessionID, 0, triggered)
+		notifyWebhooks(st, sessionID, webhooks.Notification{
+			Event: store.WebhookAlertTriggered,
+			Title: "Alerte sur " + data.BroadcasterLogin + " : " + alertMetricLabels[rule.Metric],
+			Text:  alertText(rule, value),
+			Data:  triggered,
+		}, nil)
+	}
+	return nil
+}
+
+// measureAlertMetric mesure la métrique d'une règle sur une capture ; ok vaut false si
+// elle n'est pas mesurable (aucun compte enrichi)
+func measureAlertMetric(ctx context.Context, st *store.Store, rule store.AlertRule, captureID int64,
+	stats *store.CaptureStats, now time.Time) (value float64, details map[string]any, ok bool, err error) {
+	if stats.Known == 0 {
+		return 0, nil, false, nil
+	}
+	switch rule.Metric {
+	case store.AlertRecentAccountsPct:
+		since := now.AddDate(0, 0, -rule.WindowDays)
+		recent, err := st.TwitchUsers.CaptureRecentAccounts(ctx, captureID, since)
+		if err != nil {
+			return 0, nil, false, err
+		}
+		return percent(recent, stats.Known), map[string]any{
+			"recent_accounts": recent, "known_accounts": stats.Known, "since": since.Format("2006-01-02"),
+		}, true, nil
+	case store.AlertCreationDayAccounts:
+		if stats.TopDay == nil {
+			return 0, nil, false, nil
+		}
+		return float64(stats.TopDayAccounts), map[string]any{
+			"date": stats.TopDay.Format("2006-01-02"), "accounts": stats.TopDayAccounts,
+		}, true, nil
+	case store.AlertDefaultAvatarPct:
+		return percent(stats.DefaultAvatars, stats.Known), map[string]any{
+			"default_avatars": stats.DefaultAvatars, "known_accounts": stats.Known,
+		}, true, nil
+	default:
+		return 0, nil, false, fmt.Errorf("unknown alert metric %q", rule.Metric)
+	}
+}
+
+// percent retourne n/total en pourcentage, arrondi au dixième
+func percent(n, total int64) float64 {
+	return float64(n*1000/total) / 10
+}
+
+// alertText décrit le déclenchement d'une règle
+func alertText(rule store.AlertRule, value float64) string {
+	switch rule.Metric {
+	case store.AlertRecentAccountsPct:
+		return fmt.Sprintf("%.1f %% des chatters ont créé leur compte depuis moins de %d jours (seuil : %g %%)",
+			value, rule.WindowDays, rule.Threshold)
+	case store.AlertCreationDayAccounts:
+		return fmt.Sprintf("%.0f chatters ont créé leur compte le même jour (seuil : %g)", value, rule.Threshold)
+	default:
+		return fmt.Sprintf("%.1f %% des chatters ont l'avatar par défaut (seuil : %g %%)", value, rule.Threshold)
+	}
+}
@@ -0,0 +1,439 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/time/rate"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/chat"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/websocket"
+)
+
+// worker chat : lit le chat des chaînes capturées dans les sessions actives, par une connexion
+// IRC anonyme (lecture seule, sans token). Pour chaque session, l'activité de chaque compte
+// (messages, messages en double, premier et dernier message) et les empreintes des messages
+// sont cumulées en mémoire puis écrites toutes les chatFlushInterval. Un message est en
+// double si son empreinte a déjà été vue sur la chaîne pendant la session.
+// Une seule instance doit tourner (sinon chaque message est compté deux fois).
+
+// Configuration du listener (CHAT_IRC_URL, CHAT_SYNC_INTERVAL, CHAT_FLUSH_INTERVAL)
+var (
+	chatIRCURL        = chat.IRCURL
+	chatSyncInterval  = 30 * time.Second
+	chatFlushInterval = 10 * time.Second
+)
+
+const (
+	chatWelcomeTimeout  = 10 * time.Second       // attente du message 001 après NICK
+	chatPingInterval    = time.Minute            // PING envoyé au serveur, dont le PONG prouve la connexion
+	chatMaxBackoff      = time.Minute            // attente maximale entre deux reconnexions
+	chatCallTimeout     = 30 * time.Second       // appels à la base de données
+	chatJoinInterval    = 500 * time.Millisecond // Twitch : 20 JOIN par 10 secondes
+	chatJoinBurst       = 20
+	chatMaxFingerprints = 50000 // empreintes gardées en mémoire par session et chaîne
+	chatSampleLength    = 200   // longueur maximale (en caractères) de l'exemple d'un message répété
+)
+
+// chatListener suit les chaînes à écouter et cumule l'activité entre deux écritures
+type chatListener struct {
+	st *store.Store
+	// channels : login de la chaîne -> sessions qui l'écoutent
+	channels map[string]*chatChannel
+	batch    chatBatch
+}
+
+// chatChannel est une chaîne écoutée
+type chatChannel struct {
+	broadcasterID string
+	// sessions : id de session -> empreintes vues (nombre de messages)
+	sessions map[int64]map[string]int64
+}
+
+type chatActivityKey struct {
+	sessionID     int64
+	broadcasterID string
+	userID        string
+}
+
+type chatFingerprintKey struct {
+	sessionID     int64
+	broadcasterID string
+	fingerprint   string
+}
+
+// chatBatch cumule les incréments à écrire
+type chatBatch struct {
+	activity     map[chatActivityKey]*store.ChatActivity
+	fingerprints map[chatFingerprintKey]*store.ChatFingerprint
+}
+
+// runChatListener maintient la connexion IRC ouverte, avec un délai croissant entre deux
+// échecs, jusqu'à l'annulation de ctx
+func runChatListener(ctx context.Context, st *store.Store) {
+	l := &chatListener{st: st, channels: map[string]*chatChannel{}}
+	l.batch.reset()
+	log.Printf("chat listener started, url=%s, sync interval=%s, flush interval=%s", chatIRCURL, chatSyncInterval, chatFlushInterval)
+
+	backoff := time.Second
+	for {
+		connected, err := l.connection(ctx)
+		l.flush()
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("chat connection: %v; reconnecting in %s", err, backoff)
+		if connected {
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, chatMaxBackoff)
+	}
+}
+
+// ircRead est un message lu sur la connexion, ou l'erreur qui l'a interrompue
+type ircRead struct {
+	msg chat.Message
+	err error
+}
+
+// connection ouvre une connexion, rejoint les chaînes à écouter et traite les messages jusqu'à
+// une erreur ; connected indique que la connexion a été établie (message 001 reçu)
+func (l *chatListener) connection(ctx context.Context) (connected bool, err error) {
+	conn, err := dialChat(ctx, chatIRCURL)
+	if err != nil {
+		return false, err
+	}
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		conn.Close(websocket.CloseNormal, "")
+	}()
+	lines := make(chan ircRead)
+	go readChat(conn, lines, done)
+
+	// Chaînes rejointes sur cette connexion
+	joined := map[string]bool{}
+	joins := rate.NewLimiter(rate.Every(chatJoinInterval), chatJoinBurst)
+	if err := l.sync(ctx, conn, joined, joins); err != nil {
+		return true, err
+	}
+
+	syncTicker := time.NewTicker(chatSyncInterval)
+	defer syncTicker.Stop()
+	flushTicker := time.NewTicker(chatFlushInterval)
+	defer flushTicker.Stop()
+	pingTicker := time.NewTicker(chatPingInterval)
+	defer pingTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+
+		case <-syncTicker.C:
+			if err := l.sync(ctx, conn, joined, joins); err != nil {
+				return true, err
+			}
+
+		case <-flushTicker.C:
+			l.flush()
+
+		case <-pingTicker.C:
+			if err := writeIRC(conn, "PING :tmi.twitch.tv"); err != nil {
+				return true, err
+			}
+
+		case r := <-lines:
+			if r.err != nil {
+				return true, r.err
+			}
+			switch r.msg.Command {
+			case "PING":
+				if err := writeIRC(conn, "PONG :"+r.msg.Param(0)); err != nil {
+					return true, err
+				}
+			case "RECONNECT":
+				// Maintenance du serveur : Twitch demande de rouvrir la connexion
+				return true, errors.New("server requested reconnect")
+			case "NOTICE":
+				log.Printf("chat notice on %s: %s", r.msg.Param(0), r.msg.Param(1))
+			case "PRIVMSG":
+				l.record(r.msg)
+			}
+		}
+	}
+}
+
+// sync met à jour les chaînes à écouter d'après les sessions actives, rejoint les nouvelles
+// et quitte celles qu'aucune session n'écoute plus. Seule une erreur d'écriture sur la
+// connexion est retournée.
+func (l *chatListener) sync(ctx context.Context, conn *websocket.Conn, joined map[string]bool, joins *rate.Limiter) error {
+	queryCtx, cancel := context.WithTimeout(ctx, chatCallTimeout)
+	defer cancel()
+	targets, err := l.st.Chat.Targets(queryCtx)
+	if err != nil {
+		log.Printf("chat sync error: %v", err)
+		return nil
+	}
+
+	wanted := map[string]map[int64]bool{}
+	for _, t := range targets {
+		login := strings.ToLower(t.BroadcasterLogin)
+		if wanted[login] == nil {
+			wanted[login] = map[int64]bool{}
+		}
+		ch := l.channels[login]
+		if ch == nil {
+			ch = &chatChannel{broadcasterID: t.BroadcasterID, sessions: map[int64]map[string]int64{}}
+			l.channels[login] = ch
+		}
+		if _, ok := ch.sessions[t.SessionID]; !ok {
+			// Empreintes déjà enregistrées (redémarrage) : les doublons restent détectés
+			fingerprints, err := l.st.Chat.Fingerprints(queryCtx, t.SessionID, t.BroadcasterID, chatMaxFingerprints)
+			if err == nil {
+				t.ListeningSince = time.Now().UTC()
+				err = l.st.Chat.Listen(queryCtx, t)
+			}
+			if err != nil {
+				log.Printf("cannot listen to %s for session %d: %v", login, t.SessionID, err)
+				continue
+			}
+			ch.sessions[t.SessionID] = fingerprints
+		}
+		wanted[login][t.SessionID] = true
+	}
+	for login, ch := range l.channels {
+		for sessionID := range ch.sessions {
+			if !wanted[login][sessionID] {
+				delete(ch.sessions, sessionID)
+			}
+		}
+		if len(ch.sessions) == 0 {
+			delete(l.channels, login)
+		}
+	}
+
+	for login := range l.channels {
+		if joined[login] {
+			continue
+		}
+		if err := joins.Wait(ctx); err != nil {
+			return err
+		}
+		if err := writeIRC(conn, "JOIN #"+login); err != nil {
+			return err
+		}
+		joined[login] = true
+		log.Printf("chat: joined #%s", login)
+	}
+	for login := range joined {
+		if _, ok := l.channels[login]; ok {
+			continue
+		}
+		if err := writeIRC(conn, "PART #"+login); err != nil {
+			return err
+		}
+		delete(joined, login)
+		log.Printf("chat: left #%s", login)
+	}
+	return nil
+}
+
+// record compte un message pour chaque session qui écoute sa chaîne
+func (l *chatListener) record(msg chat.Message) {
+	ch := l.channels[strings.TrimPrefix(msg.Param(0), "#")]
+	userID := msg.Tags["user-id"]
+	if ch == nil || userID == "" {
+		return
+	}
+	at := time.Now().UTC()
+	if ms, err := strconv.ParseInt(msg.Tags["tmi-sent-ts"], 10, 64); err == nil {
+		at = time.UnixMilli(ms).UTC()
+	}
+	text := msg.Text()
+	fp := chat.Fingerprint(text)
+
+	for sessionID, fingerprints := range ch.sessions {
+		duplicate := false
+		if fp != "" {
+			seen := fingerprints[fp]
+			duplicate = seen > 0
+			if seen == 0 && len(fingerprints) >= chatMaxFingerprints {
+				// Mémoire bornée : les empreintes les plus anciennes sont oubliées en bloc
+				clear(fingerprints)
+			}
+			fingerprints[fp] = seen + 1
+			sample := ""
+			if duplicate {
+				sample = truncate(strings.TrimSpace(text), chatSampleLength)
+			}
+			l.batch.addFingerprint(chatFingerprintKey{sessionID, ch.broadcasterID, fp}, sample, at)
+		}
+		l.batch.addActivity(chatActivityKey{sessionID, ch.broadcasterID, userID}, msg.Nick(), duplicate, at)
+	}
+}
+
+// flush écrit l'activité cumulée ; en cas d'échec, elle est conservée pour l'écriture suivante
+func (l *chatListener) flush() {
+	if len(l.batch.activity) == 0 && len(l.batch.fingerprints) == 0 {
+		return
+	}
+	activity := make([]store.ChatActivity, 0, len(l.batch.activity))
+	for _, a := range l.batch.activity {
+		activity = append(activity, *a)
+	}
+	fingerprints := make([]store.ChatFingerprint, 0, len(l.batch.fingerprints))
+	for _, f := range l.batch.fingerprints {
+		fingerprints = append(fingerprints, *f)
+	}
+
+	// Contexte indépendant : l'activité cumulée est écrite même à l'arrêt du listener
+	ctx, cancel := context.WithTimeout(context.Background(), chatCallTimeout)
+	defer cancel()
+	if err := l.st.Chat.Record(ctx, activity, fingerprints); err != nil {
+		log.Printf("chat flush error (%d accounts kept for next flush): %v", len(activity), err)
+		return
+	}
+	l.batch.reset()
+}
+
+func (b *chatBatch) reset() {
+	b.activity = map[chatActivityKey]*store.ChatActivity{}
+	b.fingerprints = map[chatFingerprintKey]*store.ChatFingerprint{}
+}
+
+func (b *chatBatch) addActivity(k chatActivityKey, login string, duplicate bool, at time.Time) {
+	a := b.activity[k]
+	if a == nil {
+		a = &store.ChatActivity{SessionID: k.sessionID, BroadcasterID: k.broadcasterID, TwitchUserID: k.userID,
+			FirstMessageAt: at, LastMessageAt: at}
+		b.activity[k] = a
+	}
+	a.Login = login
+	a.MessageCount++
+	if duplicate {
+		a.DuplicateCount++
+	}
+	a.FirstMessageAt = minTime(a.FirstMessageAt, at)
+	a.LastMessageAt = maxTime(a.LastMessageAt, at)
+}
+
+func (b *chatBatch) addFingerprint(k chatFingerprintKey, sample string, at time.Time) {
+	f := b.fingerprints[k]
+	if f == nil {
+		f = &store.ChatFingerprint{SessionID: k.sessionID, BroadcasterID: k.broadcasterID, Fingerprint: k.fingerprint,
+			FirstSeenAt: at, LastSeenAt: at}
+		b.fingerprints[k] = f
+	}
+	if f.Sample == "" {
+		f.Sample = sample
+	}
+	f.MessageCount++
+	f.FirstSeenAt = minTime(f.FirstSeenAt, at)
+	f.LastSeenAt = maxTime(f.LastSeenAt, at)
+}
+
+// dialChat ouvre une connexion IRC anonyme et attend le message de bienvenue (001)
+func dialChat(ctx context.Context, url string) (*websocket.Conn, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, chatWelcomeTimeout)
+	defer cancel()
+	conn, err := websocket.Dial(dialCtx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Pseudo anonyme justinfan<nombre> : lecture seule, sans PASS
+	nick := fmt.Sprintf("justinfan%d", 10000+rand.IntN(90000))
+	err = writeIRC(conn, "CAP REQ :"+chat.Capabilities, "NICK "+nick)
+
+	_ = conn.SetReadDeadline(time.Now().Add(chatWelcomeTimeout))
+	for err == nil {
+		var data []byte
+		if _, data, err = conn.ReadMessage(); err != nil {
+			break
+		}
+		for _, line := range strings.Split(string(data), "\r\n") {
+			msg, perr := chat.ParseMessage(line)
+			switch {
+			case perr != nil:
+			case msg.Command == "001":
+				return conn, nil
+			case msg.Command == "NOTICE":
+				err = fmt.Errorf("login refused: %s", msg.Param(1))
+			}
+		}
+	}
+	conn.CloseNow()
+	return nil, err
+}
+
+// readChat lit les messages IRC jusqu'à une erreur ou la fermeture de done ; un silence plus
+// long que l'intervalle de PING (plus le délai de réponse) est une erreur
+func readChat(conn *websocket.Conn, out chan<- ircRead, done <-chan struct{}) {
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(chatPingInterval + chatWelcomeTimeout))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case out <- ircRead{err: err}:
+			case <-done:
+			}
+			return
+		}
+		// Une trame peut porter plusieurs messages séparés par CRLF
+		for _, line := range strings.Split(string(data), "\r\n") {
+			msg, err := chat.ParseMessage(line)
+			if err != nil {
+				continue
+			}
+			select {
+			case out <- ircRead{msg: msg}:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// writeIRC envoie des messages IRC, un par trame
+func writeIRC(conn *websocket.Conn, lines ...string) error {
+	for _, line := range lines {
+		if err := conn.WriteMessage(websocket.OpText, []byte(line+"\r\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate coupe s à n caractères
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,378 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/autocapture"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/eventsub"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitch"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchauth"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/websocket"
+)
+
+// worker eventsub-ws : écoute EventSub en transport WebSocket, sans callback public.
+// Twitch rattache un abonnement websocket à une session ouverte avec le token de son
+// utilisateur : le listener ouvre une connexion par utilisateur ayant des abonnements
+// websocket, y crée ses abonnements et transmet les notifications à autocapture. Les
+// abonnements disparaissent chez Twitch avec la connexion : ils sont recréés à chaque
+// reconnexion, sauf sur session_reconnect où Twitch les transfère à la nouvelle connexion.
+// Une seule instance doit tourner (sinon chaque notification arrive en double).
+
+// Configuration du listener (EVENTSUB_WS_URL, EVENTSUB_WS_SYNC_INTERVAL)
+var (
+	eventSubWSURL          = eventsub.WebSocketURL
+	eventSubWSSyncInterval = 30 * time.Second
+)
+
+const (
+	eventSubWSWelcomeTimeout = 10 * time.Second // attente du message session_welcome
+	eventSubWSKeepaliveGrace = 5 * time.Second  // marge ajoutée au délai de keepalive annoncé
+	eventSubWSMaxBackoff     = time.Minute      // attente maximale entre deux reconnexions
+	eventSubWSCallTimeout    = 30 * time.Second // appels Twitch et base de données
+)
+
+// eventSubListener maintient une connexion par utilisateur ayant des abonnements websocket
+type eventSubListener struct {
+	st       *store.Store
+	tc       *twitch.Client
+	captures *autocapture.Scheduler
+	clients  map[int64]*eventSubClient
+}
+
+// runEventSubListener synchronise les connexions avec la table eventsub_subscriptions
+// toutes les eventSubWSSyncInterval, jusqu'à l'annulation de ctx
+func runEventSubListener(ctx context.Context, st *store.Store, tc *twitch.Client, captures *autocapture.Scheduler) {
+	l := &eventSubListener{st: st, tc: tc, captures: captures, clients: map[int64]*eventSubClient{}}
+	log.Printf("eventsub websocket listener started, url=%s, sync interval=%s", eventSubWSURL, eventSubWSSyncInterval)
+
+	ticker := time.NewTicker(eventSubWSSyncInterval)
+	defer ticker.Stop()
+	for {
+		if err := l.sync(ctx); err != nil {
+			log.Printf("eventsub websocket sync error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			for _, c := range l.clients {
+				c.cancel()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync démarre une connexion par nouvel utilisateur, transmet à chaque connexion ses
+// abonnements courants et arrête celles des utilisateurs qui n'en ont plus
+func (l *eventSubListener) sync(ctx context.Context) error {
+	queryCtx, cancel := context.WithTimeout(ctx, eventSubWSCallTimeout)
+	defer cancel()
+	subs, err := l.st.EventSub.ListByTransport(queryCtx, eventsub.TransportWebSocket)
+	if err != nil {
+		return err
+	}
+
+	byUser := map[int64][]store.EventSubSubscription{}
+	for _, s := range subs {
+		byUser[s.UserID] = append(byUser[s.UserID], s)
+	}
+	for userID, userSubs := range byUser {
+		c, ok := l.clients[userID]
+		if !ok {
+			c = newEventSubClient(ctx, l, userID)
+			l.clients[userID] = c
+		}
+		c.update(userSubs)
+	}
+	for userID, c := range l.clients {
+		if _, ok := byUser[userID]; !ok {
+			c.cancel()
+			delete(l.clients, userID)
+		}
+	}
+	return nil
+}
+
+// eventSubClient est la connexion EventSub d'un utilisateur
+type eventSubClient struct {
+	l      *eventSubListener
+	userID int64
+	cancel context.CancelFunc
+	// wanted reçoit la dernière liste d'abonnements de l'utilisateur (une seule en attente)
+	wanted chan []store.EventSubSubscription
+	subs   []store.EventSubSubscription
+}
+
+func newEventSubClient(ctx context.Context, l *eventSubListener, userID int64) *eventSubClient {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &eventSubClient{l: l, userID: userID, cancel: cancel, wanted: make(chan []store.EventSubSubscription, 1)}
+	go c.run(ctx)
+	return c
+}
+
+// update remplace la liste d'abonnements en attente de prise en compte
+func (c *eventSubClient) update(subs []store.EventSubSubscription) {
+	select {
+	case <-c.wanted:
+	default:
+	}
+	c.wanted <- subs
+}
+
+// run maintient la connexion ouverte, avec un délai croissant entre deux échecs
+func (c *eventSubClient) run(ctx context.Context) {
+	select {
+	case c.subs = <-c.wanted:
+	case <-ctx.Done():
+		return
+	}
+
+	backoff := time.Second
+	for {
+		connected, err := c.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("eventsub websocket of user %d: %v; reconnecting in %s", c.userID, err, backoff)
+		if connected {
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case c.subs = <-c.wanted:
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, eventSubWSMaxBackoff)
+	}
+}
+
+// wsRead est un message lu sur une connexion, ou l'erreur qui l'a interrompue
+type wsRead struct {
+	msg eventsub.WSMessage
+	err error
+}
+
+// session ouvre une connexion, y crée les abonnements et traite ses messages jusqu'à une
+// erreur ; connected indique que la connexion a été établie (session_welcome reçu)
+func (c *eventSubClient) session(ctx context.Context) (connected bool, err error) {
+	if _, err := c.token(ctx); err != nil {
+		return false, err
+	}
+	conn, welcome, err := dialEventSub(ctx, eventSubWSURL)
+	if err != nil {
+		return false, err
+	}
+	keepalive := time.Duration(welcome.KeepaliveTimeoutSeconds) * time.Second
+	log.Printf("eventsub websocket of user %d: session %s opened", c.userID, welcome.ID)
+
+	// Abonnements créés sur cette session : id de ligne -> id Twitch
+	active := map[int64]string{}
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		conn.Close(websocket.CloseNormal, "")
+		for _, twitchID := range active {
+			c.setStatus(twitchID, eventsub.StatusWebSocketDisconnected)
+		}
+	}()
+	msgs := make(chan wsRead)
+	go readEventSub(conn, keepalive, msgs, done)
+
+	c.reconcile(ctx, welcome.ID, active)
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+
+		case c.subs = <-c.wanted:
+			c.reconcile(ctx, welcome.ID, active)
+
+		case r := <-msgs:
+			if r.err != nil {
+				return true, r.err
+			}
+			switch r.msg.Metadata.MessageType {
+			case eventsub.MessageNotification:
+				c.notify(ctx, r.msg)
+
+			case eventsub.MessageRevocation:
+				if sub := r.msg.Payload.Subscription; sub != nil {
+					log.Printf("eventsub subscription %s (%s) revoked: %s", sub.ID, sub.Type, sub.Status)
+					c.setStatus(sub.ID, sub.Status)
+					for id, twitchID := range active {
+						if twitchID == sub.ID {
+							delete(active, id)
+						}
+					}
+				}
+
+			case eventsub.MessageSessionReconnect:
+				// Twitch transfère les abonnements à la nouvelle connexion une fois son
+				// session_welcome reçu ; l'ancienne est fermée ensuite
+				if r.msg.Payload.Session == nil || r.msg.Payload.Session.ReconnectURL == "" {
+					return true, errors.New("session_reconnect without reconnect_url")
+				}
+				newConn, newWelcome, err := dialEventSub(ctx, r.msg.Payload.Session.ReconnectURL)
+				if err != nil {
+					return true, fmt.Errorf("reconnect: %w", err)
+				}
+				log.Printf("eventsub websocket of user %d: session %s moved to %s", c.userID, welcome.ID, newWelcome.ID)
+				close(done)
+				conn.Close(websocket.CloseNormal, "")
+				conn, welcome, done = newConn, newWelcome, make(chan struct{})
+				keepalive = time.Duration(welcome.KeepaliveTimeoutSeconds) * time.Second
+				msgs = make(chan wsRead)
+				go readEventSub(conn, keepalive, msgs, done)
+			}
+		}
+	}
+}
+
+// dialEventSub ouvre une connexion et attend son message session_welcome
+func dialEventSub(ctx context.Context, url string) (*websocket.Conn, *eventsub.WSSession, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, eventSubWSWelcomeTimeout)
+	defer cancel()
+	conn, err := websocket.Dial(dialCtx, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(eventSubWSWelcomeTimeout))
+	var msg eventsub.WSMessage
+	_, data, err := conn.ReadMessage()
+	if err == nil {
+		err = json.Unmarshal(data, &msg)
+	}
+	if err == nil && (msg.Metadata.MessageType != eventsub.MessageSessionWelcome || msg.Payload.Session == nil) {
+		err = fmt.Errorf("unexpected %q message, want session_welcome", msg.Metadata.MessageType)
+	}
+	if err != nil {
+		conn.CloseNow()
+		return nil, nil, err
+	}
+	return conn, msg.Payload.Session, nil
+}
+
+// readEventSub lit les messages d'une connexion jusqu'à une erreur ou la fermeture de done ;
+// un silence plus long que le keepalive annoncé (plus une marge) est une erreur
+func readEventSub(conn *websocket.Conn, keepalive time.Duration, out chan<- wsRead, done <-chan struct{}) {
+	for {
+		if keepalive > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(keepalive + eventSubWSKeepaliveGrace))
+		} else {
+			_ = conn.SetReadDeadline(time.Time{})
+		}
+		var r wsRead
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			r.err = err
+		} else if err := json.Unmarshal(data, &r.msg); err != nil {
+			r.err = fmt.Errorf("invalid message: %w", err)
+		}
+		select {
+		case out <- r:
+		case <-done:
+			return
+		}
+		if r.err != nil {
+			return
+		}
+	}
+}
+
+// token retourne le token Twitch de la dernière session web de l'utilisateur
+func (c *eventSubClient) token(ctx context.Context) (*twitchauth.Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, eventSubWSCallTimeout)
+	defer cancel()
+	token, err := twitchauth.Latest(ctx, c.l.st, c.l.tc, c.userID)
+	if err != nil {
+		return nil, fmt.Errorf("no Twitch token for user %d: %w", c.userID, err)
+	}
+	return token, nil
+}
+
+// reconcile crée sur la session les abonnements manquants et supprime chez Twitch ceux dont
+// la ligne a disparu ; un échec est retenté à la synchronisation suivante
+func (c *eventSubClient) reconcile(ctx context.Context, sessionID string, active map[int64]string) {
+	token, err := c.token(ctx)
+	if err != nil {
+		log.Printf("eventsub websocket: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, eventSubWSCallTimeout)
+	defer cancel()
+
+	wanted := make(map[int64]bool, len(c.subs))
+	for _, s := range c.subs {
+		wanted[s.ID] = true
+		if _, ok := active[s.ID]; ok {
+			continue
+		}
+		condition := eventsub.Condition(s.Type, s.BroadcasterID, s.ModeratorID)
+		var sub *eventsub.Subscription
+		err := token.Do(ctx, func(accessToken string) (err error) {
+			sub, err = c.l.tc.CreateEventSubWebSocketSubscription(ctx, accessToken, s.Type, condition, sessionID)
+			return err
+		})
+		if err != nil {
+			log.Printf("create eventsub websocket subscription %d (%s on %s): %v", s.ID, s.Type, s.BroadcasterLogin, err)
+			if errors.Is(err, twitch.ErrUnauthorized) || errors.Is(err, twitch.ErrForbidden) {
+				if err := c.l.st.EventSub.SetTwitchSubscription(ctx, s.ID, "", eventsub.StatusAuthorizationRevoked); err != nil {
+					log.Printf("set eventsub status error: %v", err)
+				}
+			}
+			continue
+		}
+		active[s.ID] = sub.ID
+		if err := c.l.st.EventSub.SetTwitchSubscription(ctx, s.ID, sub.ID, sub.Status); err != nil {
+			log.Printf("set eventsub subscription error: %v", err)
+		}
+	}
+
+	for id, twitchID := range active {
+		if wanted[id] {
+			continue
+		}
+		err := token.Do(ctx, func(accessToken string) error {
+			return c.l.tc.DeleteEventSubSubscription(ctx, accessToken, twitchID)
+		})
+		if err != nil && !errors.Is(err, twitch.ErrNotFound) {
+			log.Printf("delete eventsub websocket subscription %s: %v", twitchID, err)
+			continue
+		}
+		delete(active, id)
+	}
+}
+
+// notify transmet une notification à autocapture
+func (c *eventSubClient) notify(ctx context.Context, msg eventsub.WSMessage) {
+	if msg.Payload.Subscription == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, eventSubWSCallTimeout)
+	defer cancel()
+	if _, err := c.l.captures.Handle(ctx, autocapture.Notification{
+		MessageID:    msg.Metadata.MessageID,
+		Subscription: *msg.Payload.Subscription,
+		Event:        msg.Payload.Event,
+		ReceivedAt:   time.Now().UTC(),
+	}); err != nil {
+		log.Printf("eventsub notification error: %v", err)
+	}
+}
+
+// setStatus enregistre le statut d'un abonnement Twitch (contexte indépendant : appelé
+// aussi à la fermeture de la connexion)
+func (c *eventSubClient) setStatus(twitchID, status string) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventSubWSCallTimeout)
+	defer cancel()
+	if _, err := c.l.st.EventSub.SetStatus(ctx, twitchID, status); err != nil {
+		log.Printf("set eventsub status error: %v", err)
+	}
+}
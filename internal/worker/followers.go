@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitch"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchauth"
+)
+
+// followersFetchLimit borne les followers récupérés par chaîne, les plus récents d'abord
+// (FOLLOWERS_FETCH_LIMIT) : une vague de follow-bots est récente, et un job doit tenir dans
+// son délai
+var followersFetchLimit = 2000
+
+// errFollowersForbidden : Twitch ne donne que le total, sans la liste des followers
+var errFollowersForbidden = errors.New("followers not returned by Twitch: moderator:read:followers is missing or the user is not a moderator of the channel, log in again to grant it")
+
+type FetchFollowersPayload struct {
+	SessionID        int64  `json:"session_id"`
+	TwitchUserID     string `json:"twitch_user_id"`
+	BroadcasterID    string `json:"broadcaster_id"`
+	BroadcasterLogin string `json:"broadcaster_login"`
+}
+
+func handleFetchFollowers(ctx context.Context, st *store.Store, tc *twitch.Client, job *store.Job) error {
+	var payload FetchFollowersPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	token, err := twitchauth.ForAnalysisSession(ctx, st, tc, payload.SessionID)
+	if err != nil {
+		return fmt.Errorf("cannot get access token for session %d: %w", payload.SessionID, err)
+	}
+
+	follows, total, err := fetchFollowers(ctx, st, tc, job.ID, token, payload.BroadcasterID, followersFetchLimit)
+	if err != nil {
+		return fmt.Errorf("fetchFollowers: %w", err)
+	}
+
+	log.Printf("[FETCH_FOLLOWERS] session_id=%d broadcaster=%s login=%s total=%d fetched=%d",
+		payload.SessionID, payload.BroadcasterID, payload.BroadcasterLogin, total, len(follows))
+
+	err = st.Followers.Store(ctx, store.FollowerFetch{
+		SessionID:        payload.SessionID,
+		BroadcasterID:    payload.BroadcasterID,
+		BroadcasterLogin: payload.BroadcasterLogin,
+		Total:            int64(total),
+		Fetched:          int64(len(follows)),
+		FetchedAt:        time.Now().UTC(),
+	}, follows)
+	if err != nil {
+		return fmt.Errorf("store followers: %w", err)
+	}
+
+	// Dates de création des followers : enrichissement des comptes inconnus ou périmés
+	ids := make([]string, len(follows))
+	for i, f := range follows {
+		ids[i] = f.TwitchUserID
+	}
+	stale, err := st.TwitchUsers.Stale(ctx, ids, usersFreshness)
+	if err != nil {
+		return err
+	}
+	log.Printf("[FETCH_FOLLOWERS] session_id=%d users_to_enrich=%d fresh=%d", payload.SessionID, len(stale), len(ids)-len(stale))
+	if len(stale) == 0 {
+		return nil
+	}
+	_, err = st.Jobs.EnqueueForSession(ctx, store.JobFetchUsersInfo, payload.SessionID, FetchUsersInfoPayload{
+		SessionID: payload.SessionID,
+		UserIDs:   stale,
+		Followers: true,
+	})
+	return err
+}
+
+// fetchFollowers récupère les limit followers les plus récents d'une chaîne et son nombre
+// total de followers
+func fetchFollowers(ctx context.Context, st *store.Store, tc *twitch.Client, jobID int64, token *twitchauth.Token, broadcasterID string, limit int) ([]store.Follow, int, error) {
+	var follows []store.Follow
+	cursor := ""
+	total := 0
+
+	for pageNum := 1; len(follows) < limit; pageNum++ {
+		var page *twitch.FollowersPage
+		err := token.Do(ctx, func(accessToken string) (err error) {
+			page, err = tc.GetFollowers(ctx, accessToken, broadcasterID, min(twitch.MaxFollowersPerRequest, limit-len(follows)), cursor)
+			return err
+		})
+		if errors.Is(err, twitch.ErrRateLimited) {
+			log.Printf("rate limited from twitch-api proxy on /followers, sleeping 5s")
+			pageNum--
+			if err := wait(ctx, 5*time.Second); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		total = page.Total
+		if pageNum == 1 && len(page.Followers) == 0 && page.Total > 0 {
+			return nil, 0, errFollowersForbidden
+		}
+
+		for _, f := range page.Followers {
+			follows = append(follows, store.Follow{TwitchUserID: f.UserID, FollowedAt: f.FollowedAt})
+		}
+		cursor = page.Cursor
+
+		wanted := min(total, limit)
+		setProgress(ctx, st, jobID, len(follows), max(wanted, len(follows)),
+			fmt.Sprintf("page %d/%d des followers", pageNum, max((wanted+twitch.MaxFollowersPerRequest-1)/twitch.MaxFollowersPerRequest, pageNum)))
+
+		if cursor == "" {
+			break
+		}
+		if err := wait(ctx, 200*time.Millisecond); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return follows, total, nil
+}
@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/retention"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+)
+
+// Purge des données périmées : un job PURGE est planifié toutes les purgeInterval
+// (PURGE_INTERVAL) et applique les politiques de rétention (RETENTION_*), au plus
+// purgeMaxBatches lots par politique (PURGE_MAX_BATCHES). Avec PURGE_DRY_RUN=true,
+// le job compte les lignes concernées sans rien supprimer.
+var (
+	purgeInterval     = time.Hour
+	purgeMaxBatches   = 20
+	purgeDryRun       = false
+	retentionPolicies = retention.Defaults()
+)
+
+type PurgePayload struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// schedulePurge crée un job PURGE, sauf si un autre worker l'a déjà fait pendant l'intervalle courant
+func schedulePurge(st *store.Store) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	recent, err := st.Jobs.CreatedWithin(ctx, store.JobPurge, purgeInterval-purgeInterval/10)
+	if err != nil || recent {
+		return err
+	}
+	_, err = st.Jobs.Enqueue(ctx, store.JobPurge, PurgePayload{DryRun: purgeDryRun})
+	return err
+}
+
+func handlePurge(ctx context.Context, st *store.Store, job *store.Job) error {
+	var payload PurgePayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	report, err := runPurge(ctx, st, purgeMaxBatches, payload.DryRun)
+	log.Printf("[PURGE] job %d dry_run=%t rows=%d", job.ID, report.DryRun, report.Total())
+	return err
+}
+
+// runPurge applique les politiques de rétention, journalise le bilan de chaque politique
+// et l'enregistre dans audit_logs, y compris en cas d'échec partiel
+func runPurge(ctx context.Context, st *store.Store, maxBatches int, dryRun bool) (retention.Report, error) {
+	report, err := retention.Run(ctx, st, retentionPolicies, time.Now().UTC(), maxBatches, dryRun)
+	for _, res := range report.Results {
+		log.Printf("[PURGE] policy=%s max_age=%s rows=%d batches=%d elapsed=%dms dry_run=%t",
+			res.Policy, res.MaxAge, res.Rows, res.Batches, res.ElapsedMs, dryRun)
+	}
+
+	// Contexte indépendant : le bilan doit être enregistré même si la purge a épuisé son délai
+	auditCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if errAudit := st.Audit.Log(auditCtx, store.AuditRetentionPurge, 0, 0, report); errAudit != nil {
+		log.Printf("cannot record purge report: %v", errAudit)
+	}
+	return report, err
+}
+
+// purgeCommand implémente `worker purge [-dry-run] [-max-batches n]` : purge immédiate,
+// sans délai, et bilan JSON sur out
+func purgeCommand(st *store.Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "compter les lignes à purger sans rien supprimer")
+	maxBatches := fs.Int("max-batches", 0, "lots par politique (0 : jusqu'à épuisement)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := runPurge(context.Background(), st, *maxBatches, *dryRun)
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if errEnc := enc.Encode(report); errEnc != nil && err == nil {
+		err = errEnc
+	}
+	return err
+}
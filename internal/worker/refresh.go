@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitch"
+)
+
+// Réenrichissement de fond : détecte les renommages des comptes qui ne sont plus
+// revus en capture. Un job REFRESH_USERS est planifié toutes les refreshInterval
+// (REFRESH_USERS_INTERVAL) et consomme au plus refreshBudget appels /users par
+// heure (REFRESH_USERS_BUDGET), avec l'app token du proxy.
+var (
+	refreshInterval = 5 * time.Minute
+	refreshBudget   = 600
+)
+
+type RefreshUsersPayload struct {
+	Limit int `json:"limit"`
+}
+
+// refreshLimit retourne le nombre de comptes à réenrichir par job pour respecter le budget horaire
+func refreshLimit(interval time.Duration, budgetPerHour int) int {
+	calls := int(int64(budgetPerHour) * int64(interval) / int64(time.Hour))
+	return max(calls, 1) * twitch.MaxUsersPerRequest
+}
+
+// scheduleRefreshUsers crée un job REFRESH_USERS, sauf si un autre worker l'a déjà fait
+// pendant l'intervalle courant
+func scheduleRefreshUsers(st *store.Store) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Marge de 10 % : les tickers des workers ne sont pas synchronisés
+	recent, err := st.Jobs.CreatedWithin(ctx, store.JobRefreshUsers, refreshInterval-refreshInterval/10)
+	if err != nil || recent {
+		return err
+	}
+	_, err = st.Jobs.Enqueue(ctx, store.JobRefreshUsers, RefreshUsersPayload{
+		Limit: refreshLimit(refreshInterval, refreshBudget),
+	})
+	return err
+}
+
+func handleRefreshUsers(ctx context.Context, st *store.Store, tc *twitch.Client, job *store.Job) error {
+	var payload RefreshUsersPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if payload.Limit <= 0 {
+		return fmt.Errorf("invalid limit %d", payload.Limit)
+	}
+
+	now := time.Now().UTC()
+	ids, err := st.TwitchUsers.RefreshCandidates(ctx, now.Add(-usersFreshness), payload.Limit)
+	if err != nil {
+		return fmt.Errorf("RefreshCandidates: %w", err)
+	}
+	if len(ids) == 0 {
+		log.Printf("[REFRESH_USERS] job %d: nothing to refresh", job.ID)
+		return nil
+	}
+
+	// Sans token utilisateur : le proxy utilise l'app token ; son cache est ignoré pour voir les renommages
+	users, err := fetchUsersInfoFromTwitchAPI(twitch.NoCache(ctx), st, tc, job.ID, nil, ids)
+	if err != nil {
+		return fmt.Errorf("fetchUsersInfoFromTwitchAPI: %w", err)
+	}
+	if _, err := upsertTwitchUsers(ctx, st, users); err != nil {
+		return fmt.Errorf("upsertTwitchUsers: %w", err)
+	}
+
+	missing := missingIDs(ids, users)
+	if err := st.TwitchUsers.MarkMissing(ctx, missing, now); err != nil {
+		return fmt.Errorf("MarkMissing: %w", err)
+	}
+
+	log.Printf("[REFRESH_USERS] job %d refreshed=%d missing=%d", job.ID, len(users), len(missing))
+	return nil
+}
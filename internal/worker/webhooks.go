@@ -0,0 +1,185 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/events"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/webhooks"
+)
+
+// Livraison des webhooks : un job DELIVER_WEBHOOK par tentative. Une tentative en échec
+// est replanifiée après webhookRetryDelay × 4^(n-1) (WEBHOOK_RETRY_DELAY), jusqu'à
+// webhookMaxAttempts tentatives (WEBHOOK_MAX_ATTEMPTS). Les URL résolues vers une adresse
+// interne sont refusées, sauf WEBHOOK_ALLOW_PRIVATE_URLS=true.
+var (
+	webhookMaxAttempts  = 5
+	webhookRetryDelay   = 30 * time.Second
+	webhookTimeout      = 10 * time.Second
+	webhookAllowPrivate = false
+	webhookClient       *http.Client
+)
+
+// CaptureFinishedData accompagne la notification capture_finished
+type CaptureFinishedData struct {
+	CaptureID        int64  `json:"capture_id,omitempty"`
+	BroadcasterID    string `json:"broadcaster_id,omitempty"`
+	BroadcasterLogin string `json:"broadcaster_login,omitempty"`
+	Chatters         int    `json:"chatters"`
+	UsersEnriched    int    `json:"users_enriched"`
+	Missing          int    `json:"missing"`
+}
+
+// CreationBurstData accompagne la notification creation_burst
+type CreationBurstData struct {
+	BroadcasterID    string `json:"broadcaster_id"`
+	BroadcasterLogin string `json:"broadcaster_login"`
+	Date             string `json:"date"` // AAAA-MM-JJ
+	Accounts         int64  `json:"accounts"`
+}
+
+func handleDeliverWebhook(ctx context.Context, st *store.Store, job *store.Job) error {
+	var payload store.DeliverWebhookPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	d, w, err := st.Webhooks.Delivery(ctx, payload.DeliveryID)
+	if errors.Is(err, store.ErrNotFound) {
+		// webhook supprimé depuis
+		log.Printf("[DELIVER_WEBHOOK] delivery %d no longer exists", payload.DeliveryID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if d.Status != store.DeliveryPending {
+		return nil
+	}
+	if !w.Enabled {
+		return st.Webhooks.RecordAttempt(ctx, d.ID, store.DeliveryFailed, 0, "webhook disabled")
+	}
+
+	status, sendErr := webhooks.Send(ctx, webhookClient, w, d)
+	attempt := d.Attempts + 1
+	if sendErr == nil {
+		log.Printf("[DELIVER_WEBHOOK] delivery %d (%s) to webhook %d delivered, attempt %d, status %d",
+			d.ID, d.Event, w.ID, attempt, status)
+		return st.Webhooks.RecordAttempt(ctx, d.ID, store.DeliveryDelivered, status, "")
+	}
+
+	if attempt >= webhookMaxAttempts {
+		if err := st.Webhooks.RecordAttempt(ctx, d.ID, store.DeliveryFailed, status, sendErr.Error()); err != nil {
+			return err
+		}
+		return fmt.Errorf("delivery %d abandoned after %d attempts: %w", d.ID, attempt, sendErr)
+	}
+	if err := st.Webhooks.RecordAttempt(ctx, d.ID, store.DeliveryPending, status, sendErr.Error()); err != nil {
+		return err
+	}
+	delay := webhookRetryDelay << (2 * (attempt - 1))
+	if _, err := st.Jobs.EnqueueAt(ctx, store.JobDeliverWebhook, payload, time.Now().Add(delay)); err != nil {
+		return fmt.Errorf("cannot schedule retry of delivery %d: %w", d.ID, err)
+	}
+	return fmt.Errorf("delivery %d attempt %d: %w (retry in %s)", d.ID, attempt, sendErr, delay)
+}
+
+// notifyWebhooks planifie la notification n pour les webhooks du propriétaire de la session
+// abonnés à son événement et retenus par match (nil : tous) ; une erreur est journalisée
+// sans interrompre le job
+func notifyWebhooks(st *store.Store, sessionID int64, n webhooks.Notification, match func(store.Webhook) bool) {
+	if err := enqueueNotification(st, sessionID, n, match); err != nil {
+		log.Printf("cannot notify webhooks of %s for session %d: %v", n.Event, sessionID, err)
+	}
+}
+
+func enqueueNotification(st *store.Store, sessionID int64, n webhooks.Notification, match func(store.Webhook) bool) error {
+	// Contexte indépendant : un job qui a épuisé son délai notifie quand même son échec
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := st.Sessions.ByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	subscribers, err := st.Webhooks.Subscribers(ctx, session.UserID, n.Event)
+	if err != nil {
+		return err
+	}
+	n.SessionUUID = session.UUID
+	n.At = time.Now().UTC()
+	for _, w := range subscribers {
+		if match != nil && !match(w) {
+			continue
+		}
+		if _, err := webhooks.Enqueue(ctx, st, w, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyCaptureFinished notifie la fin d'une capture (enregistrée et enrichie) et une
+// éventuelle rafale de créations de comptes parmi les chatters de la chaîne
+func notifyCaptureFinished(ctx context.Context, st *store.Store, sessionID int64, data CaptureFinishedData) {
+	notifyWebhooks(st, sessionID, webhooks.Notification{
+		Event: store.WebhookCaptureFinished,
+		Title: "Capture de " + data.BroadcasterLogin + " terminée",
+		Text: fmt.Sprintf("%d chatters, %d compte(s) enrichi(s), %d disparu(s) de Twitch",
+			data.Chatters, data.UsersEnriched, data.Missing),
+		Data: data,
+	}, nil)
+
+	if data.BroadcasterID == "" {
+		return
+	}
+	days, err := st.TwitchUsers.CreationDays(ctx, sessionID, []string{data.BroadcasterID}, 1)
+	if err != nil {
+		log.Printf("cannot compute creation days of session %d: %v", sessionID, err)
+		return
+	}
+	if len(days) == 0 {
+		return
+	}
+	burst := CreationBurstData{
+		BroadcasterID:    data.BroadcasterID,
+		BroadcasterLogin: data.BroadcasterLogin,
+		Date:             days[0].Date.Format("2006-01-02"),
+		Accounts:         days[0].Count,
+	}
+	notifyWebhooks(st, sessionID, webhooks.Notification{
+		Event: store.WebhookCreationBurst,
+		Title: "Rafale de créations de comptes chez " + data.BroadcasterLogin,
+		Text:  fmt.Sprintf("%d chatters ont créé leur compte le %s", burst.Accounts, burst.Date),
+		Data:  burst,
+	}, func(w store.Webhook) bool { return burst.Accounts >= int64(w.CreationBurstThreshold) })
+}
+
+// notifySuspiciousAccounts notifie les comptes suspects d'un enrichissement, pour les
+// webhooks dont le seuil est atteint
+func notifySuspiciousAccounts(st *store.Store, sessionID int64, data *events.SuspiciousAccountsData) {
+	total := data.Missing + data.DefaultAvatars + len(data.Renamed)
+	notifyWebhooks(st, sessionID, webhooks.Notification{
+		Event: store.WebhookSuspiciousAccounts,
+		Title: fmt.Sprintf("%d compte(s) suspect(s)", total),
+		Text: fmt.Sprintf("%d disparu(s) de Twitch, %d avatar(s) par défaut, %d renommé(s)",
+			data.Missing, data.DefaultAvatars, len(data.Renamed)),
+		Data: data,
+	}, func(w store.Webhook) bool { return total >= w.SuspiciousThreshold })
+}
+
+// notifyJobFailed notifie l'échec d'un job d'une session
+func notifyJobFailed(st *store.Store, job *store.Job, errMsg string) {
+	notifyWebhooks(st, job.SessionID, webhooks.Notification{
+		Event: store.WebhookJobFailed,
+		Title: fmt.Sprintf("Échec du job #%d (%s)", job.ID, job.Type),
+		Text:  errMsg,
+		Data:  events.JobFailedData{JobType: job.Type, Error: errMsg},
+	}, nil)
+}
@@ -0,0 +1,711 @@
+// Package worker est le service worker : traitement des jobs (captures, enrichissement,
+// followers, réenrichissement, purge, webhooks) et listeners du chat et d'EventSub
+// WebSocket. Le binaire cmd/worker le lance selon sa sous-commande ; les tests
+// d'intégration le démarrent en mémoire avec New.
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/autocapture"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/avatars"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/env"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/events"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/redis"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/retention"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitch"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchauth"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/webhooks"
+)
+
+// usersFreshness : un compte enrichi depuis moins longtemps n'est pas redemandé
+// à Twitch (USERS_FRESHNESS_WINDOW, 0 pour tout réenrichir)
+var usersFreshness = 24 * time.Hour
+
+// avatarHasher identifie les images de profil par leur contenu (nil si PROFILE_IMAGE_HOSTS
+// est vide : pas de regroupement des comptes par image)
+var avatarHasher *avatars.Hasher
+
+// eventBus publie les événements des sessions (nil sans REDIS_URL : pas de mise à jour en direct)
+var eventBus *events.Bus
+
+// Délai d'exécution d'un job : jobTimeout (JOB_TIMEOUT), plus usersBatchTimeout par lot de
+// /users pour les enrichissements, dont la durée croît avec le nombre de comptes (appel,
+// pause entre deux lots, téléchargement des images de profil)
+var jobTimeout = 30 * time.Second
+
+const usersBatchTimeout = 10 * time.Second
+
+type FetchChattersPayload struct {
+	SessionID        int64  `json:"session_id"`
+	TwitchUserID     string `json:"twitch_user_id"`
+	BroadcasterID    string `json:"broadcaster_id"`
+	BroadcasterLogin string `json:"broadcaster_login"`
+}
+
+type FetchUsersInfoPayload struct {
+	SessionID int64    `json:"session_id"`
+	UserIDs   []string `json:"user_ids"`
+	// Capture à l'origine de l'enrichissement (notification capture_finished)
+	CaptureID        int64  `json:"capture_id,omitempty"`
+	BroadcasterID    string `json:"broadcaster_id,omitempty"`
+	BroadcasterLogin string `json:"broadcaster_login,omitempty"`
+	Chatters         int    `json:"chatters,omitempty"`
+	// Enrichissement des followers récupérés par FETCH_FOLLOWERS : pas de capture terminée
+	Followers bool `json:"followers,omitempty"`
+}
+
+// Config est la configuration du worker
+type Config struct {
+	TwitchAPIBaseURL string
+	// Pub/sub des événements de session (vide : événements non publiés)
+	RedisURL string
+
+	// Intervalle entre deux tentatives de prise d'un job
+	PollInterval time.Duration
+	// Délai d'un job, hors lots de /users (voir jobTimeout)
+	JobTimeout          time.Duration
+	UsersFreshness      time.Duration
+	FollowersFetchLimit int
+	// Hôtes autorisés des images de profil (vide : pas de regroupement par image)
+	ProfileImageHosts []string
+
+	RefreshInterval time.Duration
+	RefreshBudget   int
+
+	PurgeInterval   time.Duration
+	PurgeMaxBatches int
+	PurgeDryRun     bool
+	Retention       []retention.Policy
+
+	WebhookMaxAttempts  int
+	WebhookRetryDelay   time.Duration
+	WebhookTimeout      time.Duration
+	WebhookAllowPrivate bool
+
+	// Listener du chat (RunChat)
+	ChatIRCURL        string
+	ChatSyncInterval  time.Duration
+	ChatFlushInterval time.Duration
+
+	// Listener EventSub WebSocket (RunEventSub)
+	EventSubWSURL          string
+	EventSubWSSyncInterval time.Duration
+	SessionTTL             time.Duration
+}
+
+// ConfigFromEnv lit la configuration dans les variables d'environnement
+func ConfigFromEnv() Config {
+	return Config{
+		TwitchAPIBaseURL:       env.Get("TWITCH_API_BASE_URL", "http://twitch-api:8081"),
+		RedisURL:               env.Get("REDIS_URL", ""),
+		PollInterval:           time.Duration(env.Int("JOB_POLL_INTERVAL", 2)) * time.Second,
+		JobTimeout:             env.Duration("JOB_TIMEOUT", jobTimeout),
+		UsersFreshness:         env.Duration("USERS_FRESHNESS_WINDOW", usersFreshness),
+		FollowersFetchLimit:    env.Int("FOLLOWERS_FETCH_LIMIT", followersFetchLimit),
+		ProfileImageHosts:      strings.Split(env.Get("PROFILE_IMAGE_HOSTS", "static-cdn.jtvnw.net"), ","),
+		RefreshInterval:        env.Duration("REFRESH_USERS_INTERVAL", refreshInterval),
+		RefreshBudget:          env.Int("REFRESH_USERS_BUDGET", refreshBudget),
+		PurgeInterval:          env.Duration("PURGE_INTERVAL", purgeInterval),
+		PurgeMaxBatches:        env.Int("PURGE_MAX_BATCHES", purgeMaxBatches),
+		PurgeDryRun:            env.Bool("PURGE_DRY_RUN", purgeDryRun),
+		Retention:              retention.FromEnv(),
+		WebhookMaxAttempts:     env.Int("WEBHOOK_MAX_ATTEMPTS", webhookMaxAttempts),
+		WebhookRetryDelay:      env.Duration("WEBHOOK_RETRY_DELAY", webhookRetryDelay),
+		WebhookTimeout:         env.Duration("WEBHOOK_TIMEOUT", webhookTimeout),
+		WebhookAllowPrivate:    env.Bool("WEBHOOK_ALLOW_PRIVATE_URLS", webhookAllowPrivate),
+		ChatIRCURL:             env.Get("CHAT_IRC_URL", chatIRCURL),
+		ChatSyncInterval:       env.Duration("CHAT_SYNC_INTERVAL", chatSyncInterval),
+		ChatFlushInterval:      env.Duration("CHAT_FLUSH_INTERVAL", chatFlushInterval),
+		EventSubWSURL:          env.Get("EVENTSUB_WS_URL", eventSubWSURL),
+		EventSubWSSyncInterval: env.Duration("EVENTSUB_WS_SYNC_INTERVAL", eventSubWSSyncInterval),
+		SessionTTL:             env.Duration("SESSION_TTL", 24*time.Hour),
+	}
+}
+
+// Worker traite les jobs, ou écoute le chat ou EventSub WebSocket
+type Worker struct {
+	st           *store.Store
+	tc           *twitch.Client
+	rc           *redis.Client
+	pollInterval time.Duration
+	captures     *autocapture.Scheduler
+}
+
+// New crée le worker. La configuration est appliquée aux variables du paquet : un seul
+// worker par processus.
+func New(st *store.Store, cfg Config) (*Worker, error) {
+	jobTimeout = cfg.JobTimeout
+	usersFreshness = cfg.UsersFreshness
+	followersFetchLimit = cfg.FollowersFetchLimit
+	avatarHasher = avatars.NewHasher(cfg.ProfileImageHosts, 10*time.Second)
+	refreshInterval, refreshBudget = cfg.RefreshInterval, cfg.RefreshBudget
+	purgeInterval, purgeMaxBatches, purgeDryRun = cfg.PurgeInterval, cfg.PurgeMaxBatches, cfg.PurgeDryRun
+	retentionPolicies = cfg.Retention
+	webhookMaxAttempts = cfg.WebhookMaxAttempts
+	webhookRetryDelay = cfg.WebhookRetryDelay
+	webhookTimeout = cfg.WebhookTimeout
+	webhookAllowPrivate = cfg.WebhookAllowPrivate
+	webhookClient = webhooks.NewHTTPClient(webhookTimeout, webhookAllowPrivate)
+	chatIRCURL, chatSyncInterval, chatFlushInterval = cfg.ChatIRCURL, cfg.ChatSyncInterval, cfg.ChatFlushInterval
+	eventSubWSURL, eventSubWSSyncInterval = cfg.EventSubWSURL, cfg.EventSubWSSyncInterval
+
+	w := &Worker{
+		st:           st,
+		tc:           twitch.NewClient(cfg.TwitchAPIBaseURL),
+		pollInterval: cfg.PollInterval,
+		captures:     &autocapture.Scheduler{Store: st, SessionTTL: cfg.SessionTTL},
+	}
+	eventBus = nil
+	if cfg.RedisURL != "" {
+		rc, err := redis.NewClient(cfg.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to Redis: %w", err)
+		}
+		w.rc = rc
+		eventBus = events.NewBus(rc)
+	}
+	log.Printf("worker: twitch-api=%s", cfg.TwitchAPIBaseURL)
+	return w, nil
+}
+
+// Close ferme la connexion Redis
+func (w *Worker) Close() error {
+	if w.rc == nil {
+		return nil
+	}
+	return w.rc.Close()
+}
+
+// RunChat exécute le listener du chat (worker chat) jusqu'à l'annulation de ctx
+func (w *Worker) RunChat(ctx context.Context) {
+	runChatListener(ctx, w.st)
+}
+
+// RunEventSub exécute le listener EventSub WebSocket (worker eventsub-ws) jusqu'à
+// l'annulation de ctx
+func (w *Worker) RunEventSub(ctx context.Context) {
+	runEventSubListener(ctx, w.st, w.tc, w.captures)
+}
+
+// Purge implémente `worker purge [-dry-run] [-max-batches n]` (voir purgeCommand)
+func (w *Worker) Purge(args []string, out io.Writer) error {
+	return purgeCommand(w.st, args, out)
+}
+
+// Run traite les jobs et planifie le réenrichissement et la purge jusqu'à l'annulation de ctx
+func (w *Worker) Run(ctx context.Context) {
+	if eventBus == nil {
+		log.Println("warning: REDIS_URL not set; session events are not published")
+	}
+	log.Printf("worker started, poll interval=%s, users freshness=%s", w.pollInterval, usersFreshness)
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	// Planification du réenrichissement de fond (désactivé si intervalle ou budget nul)
+	var refreshC <-chan time.Time
+	if refreshInterval > 0 && refreshBudget > 0 {
+		refreshTicker := time.NewTicker(refreshInterval)
+		defer refreshTicker.Stop()
+		refreshC = refreshTicker.C
+		log.Printf("users refresh every %s, budget=%d calls/h", refreshInterval, refreshBudget)
+	}
+
+	// Planification de la purge (désactivée si intervalle nul)
+	var purgeC <-chan time.Time
+	if purgeInterval > 0 {
+		purgeTicker := time.NewTicker(purgeInterval)
+		defer purgeTicker.Stop()
+		purgeC = purgeTicker.C
+		log.Printf("purge every %s, dry_run=%t", purgeInterval, purgeDryRun)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := processOneJob(ctx, w.st, w.tc); err != nil {
+				log.Printf("processOneJob error: %v", err)
+			}
+		case <-refreshC:
+			if err := scheduleRefreshUsers(w.st); err != nil {
+				log.Printf("scheduleRefreshUsers error: %v", err)
+			}
+		case <-purgeC:
+			if err := schedulePurge(w.st); err != nil {
+				log.Printf("schedulePurge error: %v", err)
+			}
+		}
+	}
+}
+
+func processOneJob(ctx context.Context, st *store.Store, tc *twitch.Client) error {
+	claimCtx, cancelClaim := context.WithTimeout(ctx, 10*time.Second)
+	job, err := st.Jobs.ClaimNext(claimCtx)
+	cancelClaim()
+	if errors.Is(err, store.ErrNotFound) {
+		// aucun job en attente
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, jobDeadline(job))
+	defer cancel()
+
+	// traiter le job hors transaction
+	log.Printf("picked job id=%d type=%s payload=%s", job.ID, job.Type, string(job.Payload))
+
+	var errJob error
+	switch job.Type {
+	case store.JobFetchChatters:
+		errJob = handleFetchChatters(ctx, st, tc, job)
+	case store.JobFetchUsersInfo:
+		errJob = handleFetchUsersInfo(ctx, st, tc, job)
+	case store.JobFetchFollowers:
+		errJob = handleFetchFollowers(ctx, st, tc, job)
+	case store.JobRefreshUsers:
+		errJob = handleRefreshUsers(ctx, st, tc, job)
+	case store.JobPurge:
+		errJob = handlePurge(ctx, st, job)
+	case store.JobDeliverWebhook:
+		errJob = handleDeliverWebhook(ctx, st, job)
+	default:
+		log.Printf("unknown job type %s, marking as failed", job.Type)
+		errJob = fmt.Errorf("unknown job type")
+	}
+
+	errMsg := ""
+	if errJob != nil {
+		log.Printf("job %d error: %v", job.ID, errJob)
+		errMsg = errJob.Error()
+	}
+	if errJob != nil && job.SessionID != 0 {
+		publishEvent(events.JobFailed, job.SessionID, job.ID, events.JobFailedData{JobType: job.Type, Error: errMsg})
+		notifyJobFailed(st, job, errMsg)
+	}
+	// Contexte indépendant : le statut doit être enregistré même si le job a épuisé son délai
+	if err := st.Jobs.Finish(context.Background(), job.ID, errMsg); err != nil {
+		log.Printf("cannot finish job %d: %v", job.ID, err)
+	}
+	return nil
+}
+
+// jobDeadline retourne le délai d'exécution d'un job (voir jobTimeout)
+func jobDeadline(job *store.Job) time.Duration {
+	ids := 0
+	switch job.Type {
+	case store.JobFetchUsersInfo:
+		var payload FetchUsersInfoPayload
+		if json.Unmarshal(job.Payload, &payload) == nil {
+			ids = len(payload.UserIDs)
+		}
+	case store.JobRefreshUsers:
+		var payload RefreshUsersPayload
+		if json.Unmarshal(job.Payload, &payload) == nil {
+			ids = payload.Limit
+		}
+	}
+	batches := (ids + twitch.MaxUsersPerRequest - 1) / twitch.MaxUsersPerRequest
+	return jobTimeout + time.Duration(batches)*usersBatchTimeout
+}
+
+func handleFetchChatters(ctx context.Context, st *store.Store, tc *twitch.Client, job *store.Job) error {
+	var payload FetchChattersPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	// Récupérer le token Twitch de l'utilisateur (via web_sessions), renouvelé au besoin
+	token, err := twitchauth.ForAnalysisSession(ctx, st, tc, payload.SessionID)
+	if err != nil {
+		return fmt.Errorf("cannot get access token for session %d: %w", payload.SessionID, err)
+	}
+
+	// Appeler le service twitch-api proxy pour /chatters
+	chatters, err := fetchAllChatters(ctx, st, tc, job.ID, token, payload.BroadcasterID, payload.TwitchUserID)
+	if err != nil {
+		return fmt.Errorf("fetchAllChatters: %w", err)
+	}
+
+	log.Printf("[FETCH_CHATTERS] session_id=%d broadcaster=%s login=%s chatters_count=%d",
+		payload.SessionID, payload.BroadcasterID, payload.BroadcasterLogin, len(chatters))
+
+	// Enregistrer la capture + les chatters
+	if err := storeCapture(ctx, st, job.ID, payload, chatters); err != nil {
+		return fmt.Errorf("storeCapture: %w", err)
+	}
+
+	return nil
+}
+
+func fetchAllChatters(ctx context.Context, st *store.Store, tc *twitch.Client, jobID int64, token *twitchauth.Token, broadcasterID, moderatorID string) ([]string, error) {
+	allIDs := make([]string, 0, 1024)
+	cursor := ""
+	const pageSize = 1000 // max per page
+
+	for pageNum := 1; ; pageNum++ {
+		// Appel au proxy twitch-api au lieu de l'API Twitch directement
+		var page *twitch.ChattersPage
+		err := token.Do(ctx, func(accessToken string) (err error) {
+			page, err = tc.GetChatters(ctx, accessToken, broadcasterID, moderatorID, pageSize, cursor)
+			return err
+		})
+		if errors.Is(err, twitch.ErrRateLimited) {
+			log.Printf("rate limited from twitch-api proxy, sleeping 5s")
+			pageNum--
+			if err := wait(ctx, 5*time.Second); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range page.Chatters {
+			allIDs = append(allIDs, c.UserID)
+		}
+		cursor = page.Cursor
+
+		pages := (page.Total + pageSize - 1) / pageSize
+		setProgress(ctx, st, jobID, len(allIDs), max(page.Total, len(allIDs)),
+			fmt.Sprintf("page %d/%d des chatters", pageNum, max(pages, pageNum)))
+
+		if cursor == "" {
+			break
+		}
+
+		// Légère pause pour éviter de spammer le proxy
+		if err := wait(ctx, 200*time.Millisecond); err != nil {
+			return nil, err
+		}
+	}
+
+	return allIDs, nil
+}
+
+func storeCapture(ctx context.Context, st *store.Store, jobID int64, payload FetchChattersPayload, chatters []string) error {
+	captureID, err := st.Captures.Create(ctx, store.Capture{
+		SessionID:        payload.SessionID,
+		BroadcasterID:    payload.BroadcasterID,
+		BroadcasterLogin: payload.BroadcasterLogin,
+		CapturedAt:       time.Now().UTC(),
+	}, chatters)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[STORE_CAPTURE] capture_id=%d session_id=%d chatters=%d", captureID, payload.SessionID, len(chatters))
+
+	// Créer un job FETCH_USERS_INFO pour enrichir les comptes inconnus ou périmés
+	stale, err := st.TwitchUsers.Stale(ctx, chatters, usersFreshness)
+	if err != nil {
+		return err
+	}
+	log.Printf("[STORE_CAPTURE] capture_id=%d users_to_enrich=%d fresh=%d", captureID, len(stale), len(chatters)-len(stale))
+	if len(stale) > 0 {
+		_, err := st.Jobs.EnqueueForSession(ctx, store.JobFetchUsersInfo, payload.SessionID, FetchUsersInfoPayload{
+			SessionID:        payload.SessionID,
+			UserIDs:          stale,
+			CaptureID:        captureID,
+			BroadcasterID:    payload.BroadcasterID,
+			BroadcasterLogin: payload.BroadcasterLogin,
+			Chatters:         len(chatters),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	publishEvent(events.CaptureStored, payload.SessionID, jobID, events.CaptureStoredData{
+		CaptureID:        captureID,
+		BroadcasterID:    payload.BroadcasterID,
+		BroadcasterLogin: payload.BroadcasterLogin,
+		Chatters:         len(chatters),
+		UsersToEnrich:    len(stale),
+	})
+	if len(stale) == 0 {
+		// Aucun compte à enrichir : la capture est terminée
+		finished := CaptureFinishedData{
+			CaptureID:        captureID,
+			BroadcasterID:    payload.BroadcasterID,
+			BroadcasterLogin: payload.BroadcasterLogin,
+			Chatters:         len(chatters),
+		}
+		evaluateAlertRules(ctx, st, payload.SessionID, finished)
+		notifyCaptureFinished(ctx, st, payload.SessionID, finished)
+	}
+	return nil
+}
+
+func handleFetchUsersInfo(ctx context.Context, st *store.Store, tc *twitch.Client, job *store.Job) error {
+	var payload FetchUsersInfoPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if len(payload.UserIDs) == 0 {
+		log.Printf("[FETCH_USERS_INFO] job %d: no user_ids", job.ID)
+		return nil
+	}
+
+	// On déduplique pour éviter de faire des requêtes inutiles
+	unique := make(map[string]struct{}, len(payload.UserIDs))
+	for _, id := range payload.UserIDs {
+		unique[id] = struct{}{}
+	}
+	userIDs := make([]string, 0, len(unique))
+	for id := range unique {
+		userIDs = append(userIDs, id)
+	}
+
+	// Récupérer un token (on réutilise la même logique que pour FETCH_CHATTERS)
+	token, err := twitchauth.ForAnalysisSession(ctx, st, tc, payload.SessionID)
+	if err != nil {
+		return fmt.Errorf("cannot get access token for session %d: %w", payload.SessionID, err)
+	}
+
+	users, err := fetchUsersInfoFromTwitchAPI(ctx, st, tc, job.ID, token, userIDs)
+	if err != nil {
+		return fmt.Errorf("fetchUsersInfoFromTwitchAPI: %w", err)
+	}
+
+	changes, err := upsertTwitchUsers(ctx, st, users)
+	if err != nil {
+		return fmt.Errorf("upsertTwitchUsers: %w", err)
+	}
+
+	// Comptes disparus entre la capture et l'enrichissement : signal fort de bot
+	missing := missingIDs(userIDs, users)
+	if err := st.TwitchUsers.MarkMissing(ctx, missing, time.Now().UTC()); err != nil {
+		return fmt.Errorf("MarkMissing: %w", err)
+	}
+
+	log.Printf("[FETCH_USERS_INFO] job %d session_id=%d users_enriched=%d missing=%d", job.ID, payload.SessionID, len(users), len(missing))
+
+	publishEvent(events.EnrichmentFinished, payload.SessionID, job.ID, events.EnrichmentFinishedData{
+		UsersEnriched: len(users),
+		Missing:       len(missing),
+	})
+	if suspicious := suspiciousAccounts(users, missing, changes); suspicious != nil {
+		publishEvent(events.SuspiciousAccounts, payload.SessionID, job.ID, suspicious)
+		notifySuspiciousAccounts(st, payload.SessionID, suspicious)
+	}
+	if payload.Followers {
+		return nil
+	}
+	finished := CaptureFinishedData{
+		CaptureID:        payload.CaptureID,
+		BroadcasterID:    payload.BroadcasterID,
+		BroadcasterLogin: payload.BroadcasterLogin,
+		Chatters:         payload.Chatters,
+		UsersEnriched:    len(users),
+		Missing:          len(missing),
+	}
+	evaluateAlertRules(ctx, st, payload.SessionID, finished)
+	notifyCaptureFinished(ctx, st, payload.SessionID, finished)
+	return nil
+}
+
+// suspiciousAccounts résume les signaux de bot d'un enrichissement (comptes disparus,
+// avatars par défaut, renommages) ; nil s'il n'y en a aucun
+func suspiciousAccounts(users []twitch.User, missing []string, changes []store.NameChange) *events.SuspiciousAccountsData {
+	data := events.SuspiciousAccountsData{Missing: len(missing), Renamed: []events.Rename{}}
+	for _, u := range users {
+		if twitch.IsDefaultAvatar(u.ProfileImageURL) {
+			data.DefaultAvatars++
+		}
+	}
+	for _, c := range changes {
+		if c.OldLogin != c.NewLogin {
+			data.Renamed = append(data.Renamed, events.Rename{TwitchUserID: c.TwitchUserID, OldLogin: c.OldLogin, NewLogin: c.NewLogin})
+		}
+	}
+	if data.Missing == 0 && data.DefaultAvatars == 0 && len(data.Renamed) == 0 {
+		return nil
+	}
+	return &data
+}
+
+func fetchUsersInfoFromTwitchAPI(ctx context.Context, st *store.Store, tc *twitch.Client, jobID int64, token *twitchauth.Token, userIDs []string) ([]twitch.User, error) {
+	const batchSize = twitch.MaxUsersPerRequest // max IDs par requête
+	all := make([]twitch.User, 0, len(userIDs))
+
+	for start := 0; start < len(userIDs); {
+		end := start + batchSize
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+
+		// Appel au proxy twitch-api
+		var users []twitch.User
+		err := token.Do(ctx, func(accessToken string) (err error) {
+			users, err = tc.GetUsers(ctx, accessToken, userIDs[start:end])
+			return err
+		})
+		if errors.Is(err, twitch.ErrRateLimited) {
+			log.Printf("rate limited from twitch-api proxy on /users, sleeping 5s")
+			if err := wait(ctx, 5*time.Second); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, users...)
+		start = end
+		setProgress(ctx, st, jobID, start, len(userIDs), "enrichissement des comptes")
+		if start == len(userIDs) {
+			break
+		}
+
+		if err := wait(ctx, 100*time.Millisecond); err != nil {
+			return nil, err
+		}
+	}
+
+	return all, nil
+}
+
+// missingIDs retourne les IDs demandés absents de la réponse Twitch
+// (comptes supprimés, suspendus ou bannis)
+func missingIDs(ids []string, users []twitch.User) []string {
+	found := make(map[string]struct{}, len(users))
+	for _, u := range users {
+		found[u.ID] = struct{}{}
+	}
+	var missing []string
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// upsertTwitchUsers enregistre les comptes, avec le hash de leur image de profil, et retourne
+// les changements de nom détectés
+func upsertTwitchUsers(ctx context.Context, st *store.Store, users []twitch.User) ([]store.NameChange, error) {
+	hashes, err := profileImageHashes(ctx, st, users)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	rows := make([]store.TwitchUser, 0, len(users))
+	for _, u := range users {
+		row := store.TwitchUser{
+			TwitchUserID:     u.ID,
+			Login:            u.Login,
+			DisplayName:      u.DisplayName,
+			BroadcasterType:  u.BroadcasterType,
+			Type:             u.Type,
+			ViewCount:        u.ViewCount,
+			ProfileImageURL:  u.ProfileImageURL,
+			ProfileImageHash: hashes[u.ProfileImageURL],
+			DefaultAvatar:    twitch.IsDefaultAvatar(u.ProfileImageURL),
+			OfflineImageURL:  u.OfflineImageURL,
+			Description:      u.Description,
+			LastFetchedAt:    now,
+		}
+		// Parser la date de création
+		if t, err := time.Parse(time.RFC3339, u.CreatedAt); err == nil {
+			row.CreatedAt = &t
+		}
+		rows = append(rows, row)
+	}
+
+	changes, err := st.TwitchUsers.Upsert(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range changes {
+		log.Printf("[NAME_CHANGE] ✅ user_id=%s | login: %s → %s | display: %s → %s",
+			c.TwitchUserID, c.OldLogin, c.NewLogin, c.OldDisplayName, c.NewDisplayName)
+	}
+	return changes, nil
+}
+
+// profileImageHashes retourne le hash du contenu des images de profil des comptes (hors
+// avatars par défaut) : déjà connu pour une URL déjà vue, sinon calculé en téléchargeant l'image
+func profileImageHashes(ctx context.Context, st *store.Store, users []twitch.User) (map[string]string, error) {
+	if avatarHasher == nil {
+		return nil, nil
+	}
+	seen := make(map[string]bool, len(users))
+	var urls []string
+	for _, u := range users {
+		if !twitch.IsDefaultAvatar(u.ProfileImageURL) && !seen[u.ProfileImageURL] {
+			seen[u.ProfileImageURL] = true
+			urls = append(urls, u.ProfileImageURL)
+		}
+	}
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	hashes, err := st.TwitchUsers.ProfileImageHashes(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+	var unknown []string
+	for _, u := range urls {
+		if _, ok := hashes[u]; !ok {
+			unknown = append(unknown, u)
+		}
+	}
+	downloaded := avatarHasher.HashAll(ctx, unknown)
+	for u, hash := range downloaded {
+		hashes[u] = hash
+	}
+	log.Printf("[PROFILE_IMAGES] images=%d known=%d downloaded=%d failed=%d",
+		len(urls), len(urls)-len(unknown), len(downloaded), len(unknown)-len(downloaded))
+	return hashes, nil
+}
+
+// setProgress enregistre l'avancement d'un job ; une erreur n'interrompt pas le job
+func setProgress(ctx context.Context, st *store.Store, jobID int64, done, total int, message string) {
+	if err := st.Jobs.SetProgress(ctx, jobID, done, total, message); err != nil {
+		log.Printf("cannot update progress of job %d: %v", jobID, err)
+	}
+}
+
+// wait attend d, ou retourne l'erreur de ctx s'il est annulé ou expire avant
+func wait(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// publishEvent publie un événement de session ; sans Redis ou en cas d'erreur, l'événement
+// est perdu sans interrompre le job
+func publishEvent(typ string, sessionID, jobID int64, data any) {
+	if eventBus == nil {
+		return
+	}
+	ev, err := events.New(typ, sessionID, jobID, data)
+	if err == nil {
+		// Contexte indépendant : un job qui a épuisé son délai publie quand même son échec
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err = eventBus.Publish(ctx, ev)
+	}
+	if err != nil {
+		log.Printf("cannot publish %s event for session %d: %v", typ, sessionID, err)
+	}
+}
@@ -0,0 +1,158 @@
+package integration
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchmock"
+)
+
+type apiAlert struct {
+	ID               int64   `json:"id"`
+	RuleID           *int64  `json:"rule_id"`
+	SessionUUID      string  `json:"session_uuid"`
+	BroadcasterLogin string  `json:"broadcaster_login"`
+	Metric           string  `json:"metric"`
+	Threshold        float64 `json:"threshold"`
+	Value            float64 `json:"value"`
+	Details          struct {
+		RecentAccounts int `json:"recent_accounts"`
+		KnownAccounts  int `json:"known_accounts"`
+	} `json:"details"`
+	AcknowledgedAt *string `json:"acknowledged_at"`
+}
+
+func TestAlertRules(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 20, ModeratedChannels: 1})
+	s.login()
+
+	// Règle depuis la page (lien « Règle d'alerte » de /channels) : 15 % de comptes de moins de 7 jours
+	if _, page := s.get("/channels"); !strings.Contains(page, "/alerts?broadcaster_id="+twitchmock.StreamerID) {
+		t.Fatalf("no alert rule link on /channels:\n%s", page)
+	}
+	resp, body := s.post("/alerts/rules/create", url.Values{
+		"broadcaster_id": {twitchmock.StreamerID}, "broadcaster_login": {twitchmock.StreamerLogin},
+		"metric": {"recent_accounts_pct"}, "threshold": {"15"}, "window_days": {"7"},
+	})
+	if resp.Request.URL.Path != "/alerts" || !strings.Contains(body, "Règle créée") {
+		t.Fatalf("create rule ended on %s:\n%s", resp.Request.URL, body)
+	}
+	if _, body := s.post("/alerts/rules/create", url.Values{
+		"broadcaster_id": {twitchmock.StreamerID}, "broadcaster_login": {twitchmock.StreamerLogin},
+		"metric": {"default_avatar_pct"}, "threshold": {"150"},
+	}); !strings.Contains(body, "100 au plus pour un pourcentage") {
+		t.Errorf("percentage above 100 accepted:\n%s", body)
+	}
+
+	// Règles par l'API : création réservée à la portée alerts:manage
+	_, page := s.post("/tokens/create", url.Values{
+		"name": {"lecture"}, "scopes": {"analysis:read"}, "expires_in_days": {"30"},
+	})
+	readToken := regexp.MustCompile(`tca_[0-9a-f]{64}`).FindString(page)
+	if readToken == "" {
+		t.Fatalf("token not shown after creation:\n%s", page)
+	}
+	rule := map[string]any{
+		"broadcaster_id": twitchmock.StreamerID, "broadcaster_login": twitchmock.StreamerLogin,
+		"metric": "creation_day_accounts", "threshold": 50,
+	}
+	if status, out := s.apiToken(readToken, http.MethodPost, "/alert-rules", rule); status != http.StatusForbidden {
+		t.Errorf("create rule with analysis:read: status %d: %s", status, out)
+	}
+	if status, out := s.api(http.MethodPost, "/alert-rules", map[string]any{"broadcaster_id": "1", "broadcaster_login": "x", "metric": "nope", "threshold": 1}); status != http.StatusBadRequest {
+		t.Errorf("create rule with unknown metric: status %d: %s", status, out)
+	}
+	var created struct {
+		ID         int64 `json:"id"`
+		WindowDays int   `json:"window_days"`
+	}
+	s.apiJSON(http.MethodPost, "/alert-rules", rule, http.StatusCreated, &created)
+	if created.ID == 0 || created.WindowDays != 7 {
+		t.Errorf("created rule = %+v", created)
+	}
+	var rules struct {
+		Rules []struct {
+			Metric string `json:"metric"`
+		} `json:"rules"`
+	}
+	if status, out := s.apiToken(readToken, http.MethodGet, "/alert-rules", nil); status != http.StatusOK {
+		t.Fatalf("list rules: status %d: %s", status, out)
+	}
+	s.apiJSON(http.MethodGet, "/alert-rules", nil, http.StatusOK, &rules)
+	if len(rules.Rules) != 2 {
+		t.Fatalf("rules = %+v, want 2", rules.Rules)
+	}
+
+	// Capture sans vague : comptes répartis sur 10 ans, aucune règle atteinte
+	s.capture()
+	s.waitJobs(2)
+	if n := s.count(`SELECT COUNT(*) FROM alerts`); n != 0 {
+		t.Fatalf("alerts after a normal capture = %d, want 0", n)
+	}
+
+	// 10 bots créés il y a 3 jours : 10 comptes récents sur une trentaine, seule la première règle est atteinte
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-alerts", Steps: []twitchmock.Step{{Kind: twitchmock.StepBotWave, Count: 10}}}); err != nil {
+		t.Fatal(err)
+	}
+	s.capture()
+	s.waitJobs(4)
+
+	var list struct {
+		Alerts         []apiAlert `json:"alerts"`
+		Unacknowledged int        `json:"unacknowledged"`
+	}
+	s.apiJSON(http.MethodGet, "/alerts?unacknowledged=true", nil, http.StatusOK, &list)
+	if len(list.Alerts) != 1 || list.Unacknowledged != 1 {
+		t.Fatalf("alerts = %+v", list)
+	}
+	alert := list.Alerts[0]
+	if alert.Metric != "recent_accounts_pct" || alert.Threshold != 15 || alert.BroadcasterLogin != twitchmock.StreamerLogin ||
+		alert.SessionUUID == "" || alert.RuleID == nil || alert.Details.RecentAccounts < 10 || alert.Details.KnownAccounts < 30 ||
+		alert.Value < 30 {
+		t.Errorf("alert = %+v", alert)
+	}
+
+	// Badge sur la chaîne et dans l'en-tête
+	if _, page := s.get("/channels"); !strings.Contains(page, "🚨 1") {
+		t.Errorf("no alert badge on /channels:\n%s", page)
+	}
+	if _, page := s.get("/alerts"); !strings.Contains(page, "🚨 Acquitter") {
+		t.Errorf("alert not shown on /alerts:\n%s", page)
+	}
+
+	// Acquittement : par l'API, refusé sans la portée
+	path := "/alerts/" + strconv.FormatInt(alert.ID, 10) + "/acknowledge"
+	if status, out := s.apiToken(readToken, http.MethodPost, path, nil); status != http.StatusForbidden {
+		t.Errorf("acknowledge with analysis:read: status %d: %s", status, out)
+	}
+	s.apiJSON(http.MethodPost, path, nil, http.StatusNoContent, nil)
+	s.apiJSON(http.MethodPost, "/alerts/999999/acknowledge", nil, http.StatusNotFound, nil)
+	s.apiJSON(http.MethodGet, "/alerts", nil, http.StatusOK, &list)
+	if len(list.Alerts) != 1 || list.Unacknowledged != 0 || list.Alerts[0].AcknowledgedAt == nil {
+		t.Errorf("alerts after acknowledgement = %+v", list)
+	}
+	if _, page := s.get("/channels"); strings.Contains(page, "🚨") {
+		t.Error("alert badge still shown after acknowledgement")
+	}
+
+	// Suppression d'une règle : ses alertes restent, détachées
+	var ruleID int64
+	if err := s.db.QueryRow(`SELECT id FROM alert_rules WHERE metric = 'recent_accounts_pct'`).Scan(&ruleID); err != nil {
+		t.Fatal(err)
+	}
+	s.post("/alerts/rules/delete", url.Values{"rule_id": {strconv.FormatInt(ruleID, 10)}})
+	s.apiJSON(http.MethodDelete, "/alert-rules/"+strconv.FormatInt(created.ID, 10), nil, http.StatusNoContent, nil)
+	if n := s.count(`SELECT COUNT(*) FROM alert_rules`); n != 0 {
+		t.Errorf("rules after deletion = %d", n)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM alerts WHERE rule_id IS NULL`); n != 1 {
+		t.Errorf("detached alerts = %d, want 1", n)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM audit_logs WHERE event_type IN ('alert_rule_created', 'alert_rule_deleted')`); n != 4 {
+		t.Errorf("alert rule audit entries = %d, want 4", n)
+	}
+}
@@ -0,0 +1,386 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchmock"
+)
+
+// apiError est le corps d'erreur commun de /api/v1
+type apiError struct {
+	Error struct {
+		Code    string          `json:"code"`
+		Message string          `json:"message"`
+		Details json.RawMessage `json:"details"`
+	} `json:"error"`
+}
+
+// api appelle /api/v1 avec le client du navigateur (cookie de session) ; body est encodé en JSON
+func (s *stack) api(method, path string, body any) (int, []byte) {
+	s.t.Helper()
+	return s.apiRequest(s.client, "", method, path, body)
+}
+
+// apiToken appelle /api/v1 sans cookie, avec le token d'API donné
+func (s *stack) apiToken(token, method, path string, body any) (int, []byte) {
+	s.t.Helper()
+	return s.apiRequest(&http.Client{Timeout: 30 * time.Second}, token, method, path, body)
+}
+
+func (s *stack) apiRequest(client *http.Client, token, method, path string, body any) (int, []byte) {
+	s.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, s.gatewayURL+"/api/v1"+path, reader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp.StatusCode, []byte(readBody(s.t, resp))
+}
+
+// apiJSON appelle /api/v1, vérifie le statut et décode la réponse dans dest
+func (s *stack) apiJSON(method, path string, body any, wantStatus int, dest any) {
+	s.t.Helper()
+	status, out := s.api(method, path, body)
+	if status != wantStatus {
+		s.t.Fatalf("%s %s: status %d, want %d: %s", method, path, status, wantStatus, out)
+	}
+	if dest != nil {
+		if err := json.Unmarshal(out, dest); err != nil {
+			s.t.Fatalf("%s %s: invalid JSON: %v: %s", method, path, err, out)
+		}
+	}
+}
+
+type apiJob struct {
+	ID         int64      `json:"id"`
+	Type       string     `json:"type"`
+	Status     string     `json:"status"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Error      string     `json:"error"`
+	Progress   struct {
+		Done    int    `json:"done"`
+		Total   *int   `json:"total"`
+		Message string `json:"message"`
+	} `json:"progress"`
+}
+
+type apiSession struct {
+	SessionUUID string     `json:"session_uuid"`
+	Status      string     `json:"status"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// TestAPI parcourt l'API JSON : capture, suivi du job, analyse, export, sauvegarde et suppression
+func TestAPI(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 30, ModeratedChannels: 3})
+	chatters := len(s.mock.Chatters(twitchmock.StreamerID))
+
+	// Sans session : 401 JSON, pas de redirection vers le login
+	var unauth apiError
+	s.apiJSON(http.MethodGet, "/sessions", nil, http.StatusUnauthorized, &unauth)
+	if unauth.Error.Code != "unauthorized" {
+		t.Errorf("unauthenticated error code = %q", unauth.Error.Code)
+	}
+	var spec struct {
+		OpenAPI string         `json:"openapi"`
+		Paths   map[string]any `json:"paths"`
+	}
+	s.apiJSON(http.MethodGet, "/openapi.json", nil, http.StatusOK, &spec)
+	if !strings.HasPrefix(spec.OpenAPI, "3.") || spec.Paths["/api/v1/captures"] == nil {
+		t.Errorf("unexpected OpenAPI document: %+v", spec)
+	}
+
+	s.login()
+
+	var me struct {
+		Login string `json:"login"`
+		Tier  string `json:"tier"`
+	}
+	s.apiJSON(http.MethodGet, "/me", nil, http.StatusOK, &me)
+	if me.Login != twitchmock.ModeratorLogin || me.Tier != "free" {
+		t.Errorf("/me = %+v", me)
+	}
+
+	var channels struct {
+		Channels []struct {
+			BroadcasterID    string `json:"broadcaster_id"`
+			BroadcasterLogin string `json:"broadcaster_login"`
+		} `json:"channels"`
+		Total int `json:"total"`
+	}
+	s.apiJSON(http.MethodGet, "/channels?q="+twitchmock.StreamerLogin, nil, http.StatusOK, &channels)
+	if len(channels.Channels) != 1 || channels.Channels[0].BroadcasterID != twitchmock.StreamerID || channels.Total < 3 {
+		t.Errorf("/channels = %+v", channels)
+	}
+
+	// Capture et suivi du job
+	var bad apiError
+	s.apiJSON(http.MethodPost, "/captures", map[string]string{"broadcaster_id": twitchmock.StreamerID}, http.StatusBadRequest, &bad)
+	if bad.Error.Code != "invalid_request" {
+		t.Errorf("capture without login: code %q", bad.Error.Code)
+	}
+	var created struct {
+		JobID       int64  `json:"job_id"`
+		SessionUUID string `json:"session_uuid"`
+	}
+	s.apiJSON(http.MethodPost, "/captures", map[string]string{
+		"broadcaster_id":    twitchmock.StreamerID,
+		"broadcaster_login": twitchmock.StreamerLogin,
+	}, http.StatusAccepted, &created)
+	if created.JobID == 0 || created.SessionUUID == "" {
+		t.Fatalf("capture response = %+v", created)
+	}
+	s.waitJobs(2)
+
+	var job apiJob
+	s.apiJSON(http.MethodGet, fmt.Sprintf("/jobs/%d", created.JobID), nil, http.StatusOK, &job)
+	if job.ID != created.JobID || job.Type != "FETCH_CHATTERS" || job.Status != "done" || job.FinishedAt == nil {
+		t.Errorf("job = %+v", job)
+	}
+	if p := job.Progress; p.Done != chatters || p.Total == nil || *p.Total != chatters || !strings.Contains(p.Message, "page 1/1") {
+		t.Errorf("capture progress = %+v, want %d/%d on page 1/1", p, chatters, chatters)
+	}
+	s.apiJSON(http.MethodGet, "/jobs/999999", nil, http.StatusNotFound, nil)
+	s.apiJSON(http.MethodGet, "/jobs/abc", nil, http.StatusBadRequest, nil)
+
+	// Jobs de la session : la capture et l'enrichissement qu'elle a déclenché
+	var sessionJobs struct {
+		Jobs []apiJob `json:"jobs"`
+	}
+	s.apiJSON(http.MethodGet, "/sessions/"+created.SessionUUID+"/jobs", nil, http.StatusOK, &sessionJobs)
+	if len(sessionJobs.Jobs) != 2 || sessionJobs.Jobs[0].Type != "FETCH_USERS_INFO" || sessionJobs.Jobs[1].ID != created.JobID {
+		t.Fatalf("session jobs = %+v", sessionJobs.Jobs)
+	}
+	if p := sessionJobs.Jobs[0].Progress; p.Total == nil || p.Done != *p.Total || p.Done == 0 {
+		t.Errorf("enrichment progress = %+v", p)
+	}
+	s.apiJSON(http.MethodGet, "/sessions/"+created.SessionUUID+"/jobs?limit=100", nil, http.StatusBadRequest, nil)
+	if _, page := s.get("/channels"); !strings.Contains(page, `data-session-uuid="`+created.SessionUUID+`"`) {
+		t.Error("channels page has no job progress for the active session")
+	}
+
+	// Sessions, analyse et export
+	var sessions struct {
+		Active *apiSession               `json:"active"`
+		Saved  []apiSession              `json:"saved"`
+		Quota  struct{ Limit, Used int } `json:"quota"`
+	}
+	s.apiJSON(http.MethodGet, "/sessions", nil, http.StatusOK, &sessions)
+	if sessions.Active == nil || sessions.Active.SessionUUID != created.SessionUUID || sessions.Active.ExpiresAt == nil ||
+		len(sessions.Saved) != 0 || sessions.Quota.Limit != 10 {
+		t.Fatalf("/sessions = %+v", sessions)
+	}
+	uuid := created.SessionUUID
+
+	var summary summaryPayload
+	s.apiJSON(http.MethodGet, "/sessions/"+uuid+"/summary", nil, http.StatusOK, &summary)
+	if summary.TotalAccounts != int64(chatters) {
+		t.Errorf("summary total_accounts = %d, want %d", summary.TotalAccounts, chatters)
+	}
+	var export exportPayload
+	s.apiJSON(http.MethodGet, "/sessions/"+uuid+"/export", nil, http.StatusOK, &export)
+	if len(export.Accounts) != chatters {
+		t.Errorf("export has %d accounts, want %d", len(export.Accounts), chatters)
+	}
+	status, body := s.api(http.MethodGet, "/sessions/"+uuid+"/export?format=csv", nil)
+	if rows, err := csv.NewReader(bytes.NewReader(body)).ReadAll(); status != http.StatusOK || err != nil || len(rows) != chatters+1 {
+		t.Errorf("CSV export: status %d, %d rows, %v", status, len(rows), err)
+	}
+	s.apiJSON(http.MethodGet, "/sessions/"+uuid+"/export?format=xml", nil, http.StatusBadRequest, nil)
+	s.apiJSON(http.MethodGet, "/sessions/unknown/summary", nil, http.StatusNotFound, nil)
+
+	// Sauvegarde, puis suppression ; une session sauvegardée ne se purge pas
+	var conflict apiError
+	s.apiJSON(http.MethodDelete, "/sessions/"+uuid, nil, http.StatusConflict, &conflict)
+	if conflict.Error.Code != "conflict" {
+		t.Errorf("delete of active session: code %q", conflict.Error.Code)
+	}
+	var saved struct {
+		Session apiSession   `json:"session"`
+		Evicted []apiSession `json:"evicted"`
+	}
+	s.apiJSON(http.MethodPost, "/sessions/"+uuid+"/save", nil, http.StatusOK, &saved)
+	if saved.Session.Status != "saved" || saved.Session.ExpiresAt != nil || len(saved.Evicted) != 0 {
+		t.Errorf("save = %+v", saved)
+	}
+	s.apiJSON(http.MethodPost, "/sessions/"+uuid+"/purge", nil, http.StatusConflict, nil)
+	s.apiJSON(http.MethodGet, "/sessions/"+uuid+"/summary", nil, http.StatusOK, nil)
+	s.apiJSON(http.MethodDelete, "/sessions/"+uuid, nil, http.StatusNoContent, nil)
+	s.apiJSON(http.MethodGet, "/sessions/"+uuid, nil, http.StatusNotFound, nil)
+
+	// Purge d'une nouvelle session active
+	s.apiJSON(http.MethodPost, "/captures", map[string]string{
+		"broadcaster_id":    twitchmock.StreamerID,
+		"broadcaster_login": twitchmock.StreamerLogin,
+	}, http.StatusAccepted, &created)
+	// Comptes déjà enrichis : pas de job FETCH_USERS_INFO, le job de capture suffit
+	deadline := time.Now().Add(30 * time.Second)
+	for job.ID != created.JobID || job.Status != "done" {
+		if time.Now().After(deadline) {
+			t.Fatalf("capture job %d not done: %+v", created.JobID, job)
+		}
+		time.Sleep(200 * time.Millisecond)
+		s.apiJSON(http.MethodGet, fmt.Sprintf("/jobs/%d", created.JobID), nil, http.StatusOK, &job)
+	}
+	s.apiJSON(http.MethodPost, "/sessions/"+created.SessionUUID+"/purge", nil, http.StatusNoContent, nil)
+	s.apiJSON(http.MethodGet, "/sessions", nil, http.StatusOK, &sessions)
+	if sessions.Active != nil {
+		t.Errorf("active session still listed after purge: %+v", sessions.Active)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM captures`); n != 0 {
+		t.Errorf("captures = %d after delete and purge, want 0", n)
+	}
+}
+
+// TestAPISaveQuota vérifie l'erreur quota_exceeded et la sauvegarde avec evict
+func TestAPISaveQuota(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 5, ModeratedChannels: 1})
+	s.login()
+	var created struct {
+		SessionUUID string `json:"session_uuid"`
+	}
+	s.apiJSON(http.MethodPost, "/captures", map[string]string{
+		"broadcaster_id":    twitchmock.StreamerID,
+		"broadcaster_login": twitchmock.StreamerLogin,
+	}, http.StatusAccepted, &created)
+	s.waitJobs(2)
+
+	var userID int64
+	if err := s.db.QueryRow(`SELECT id FROM users LIMIT 1`).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := s.db.Exec(`
+INSERT INTO sessions (session_uuid, user_id, status, created_at, expires_at, updated_at)
+VALUES (?, ?, 'saved', NOW(6), NOW(6), NOW(6) - INTERVAL ? HOUR)`, fmt.Sprintf("old-%02d", i), userID, 100-i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var quota apiError
+	s.apiJSON(http.MethodPost, "/sessions/"+created.SessionUUID+"/save", nil, http.StatusConflict, &quota)
+	var details struct {
+		Quota      struct{ Limit, Used int } `json:"quota"`
+		WouldEvict []apiSession              `json:"would_evict"`
+	}
+	if quota.Error.Code != "quota_exceeded" || json.Unmarshal(quota.Error.Details, &details) != nil ||
+		details.Quota.Used != 10 || len(details.WouldEvict) != 1 || details.WouldEvict[0].SessionUUID != "old-00" {
+		t.Fatalf("save over quota = %+v (details %s)", quota.Error, quota.Error.Details)
+	}
+
+	var saved struct {
+		Evicted []apiSession `json:"evicted"`
+	}
+	s.apiJSON(http.MethodPost, "/sessions/"+created.SessionUUID+"/save", map[string]bool{"evict": true}, http.StatusOK, &saved)
+	if len(saved.Evicted) != 1 || saved.Evicted[0].SessionUUID != "old-00" {
+		t.Errorf("evicted = %+v, want old-00", saved.Evicted)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM sessions WHERE status = 'saved'`); n != 10 {
+		t.Errorf("%d saved sessions, want 10", n)
+	}
+}
+
+// TestAPITokens crée un token d'API depuis /tokens, l'utilise sans cookie, vérifie ses portées
+// puis le révoque
+func TestAPITokens(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 10, ModeratedChannels: 3})
+	s.login()
+
+	_, page := s.post("/tokens/create", url.Values{
+		"name":            {"bot de lecture"},
+		"scopes":          {"analysis:read"},
+		"expires_in_days": {"30"},
+	})
+	token := regexp.MustCompile(`tca_[0-9a-f]{64}`).FindString(page)
+	if token == "" {
+		t.Fatalf("token not shown after creation:\n%s", page)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM api_tokens WHERE token_hash = SHA2(?, 256) AND scopes = 'analysis:read'`, token); n != 1 {
+		t.Errorf("stored tokens with hash of the token = %d, want 1", n)
+	}
+	if _, page := s.get("/tokens"); strings.Contains(page, token) {
+		t.Error("token shown again on /tokens")
+	}
+
+	// Lecture autorisée, sans cookie ; les appels Twitch utilisent la session web
+	var me struct {
+		Login string `json:"login"`
+	}
+	status, body := s.apiToken(token, http.MethodGet, "/me", nil)
+	if status != http.StatusOK || json.Unmarshal(body, &me) != nil || me.Login != twitchmock.ModeratorLogin {
+		t.Fatalf("GET /me with token = %d %s", status, body)
+	}
+	if status, body := s.apiToken(token, http.MethodGet, "/channels", nil); status != http.StatusOK {
+		t.Fatalf("GET /channels with token = %d %s", status, body)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM api_tokens WHERE last_used_at IS NOT NULL`); n != 1 {
+		t.Errorf("tokens with last_used_at = %d, want 1", n)
+	}
+
+	// Capture hors portée
+	var forbidden apiError
+	status, body = s.apiToken(token, http.MethodPost, "/captures", map[string]string{
+		"broadcaster_id": twitchmock.StreamerID, "broadcaster_login": twitchmock.StreamerLogin,
+	})
+	if status != http.StatusForbidden || json.Unmarshal(body, &forbidden) != nil || forbidden.Error.Code != "insufficient_scope" {
+		t.Errorf("POST /captures with read-only token = %d %s, want 403 insufficient_scope", status, body)
+	}
+
+	// Token inconnu, puis token révoqué
+	if status, _ := s.apiToken("tca_"+strings.Repeat("0", 64), http.MethodGet, "/me", nil); status != http.StatusUnauthorized {
+		t.Errorf("GET /me with unknown token = %d, want 401", status)
+	}
+	var tokenID int64
+	if err := s.db.QueryRow(`SELECT id FROM api_tokens`).Scan(&tokenID); err != nil {
+		t.Fatal(err)
+	}
+	if _, page := s.post("/tokens/revoke", url.Values{"token_id": {fmt.Sprint(tokenID)}}); !strings.Contains(page, "Token révoqué") {
+		t.Errorf("revocation not confirmed:\n%s", page)
+	}
+	if status, _ := s.apiToken(token, http.MethodGet, "/me", nil); status != http.StatusUnauthorized {
+		t.Errorf("GET /me with revoked token = %d, want 401", status)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM audit_logs WHERE event_type IN ('api_token_created', 'api_token_revoked')`); n != 2 {
+		t.Errorf("token audit events = %d, want 2", n)
+	}
+
+	// Un token n'authentifie que l'API
+	req, _ := http.NewRequest(http.MethodGet, s.gatewayURL+"/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("GET /sessions with token = %d, want a redirection to the login", resp.StatusCode)
+	}
+}
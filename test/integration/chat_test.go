@@ -0,0 +1,116 @@
+package integration
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchmock"
+)
+
+func TestChatActivity(t *testing.T) {
+	s := newStackWith(t, twitchmock.Config{Chatters: 20, ModeratedChannels: 1}, stackOptions{chatListener: true})
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-bots", Steps: []twitchmock.Step{{Kind: twitchmock.StepBotWave, Count: 5}}}); err != nil {
+		t.Fatal(err)
+	}
+	s.login()
+	s.capture()
+	s.waitJobs(2)
+	captured := len(s.mock.Chatters(twitchmock.StreamerID))
+
+	// La session active a une capture : le listener rejoint la chaîne
+	s.waitIRCChannel(twitchmock.StreamerLogin)
+	const spam = "Cheap viewers and followers on example.com"
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-chat", Steps: []twitchmock.Step{
+		{Kind: twitchmock.StepChat, Count: 10, Messages: 2},
+		{Kind: twitchmock.StepChatSpam, Count: 5, Text: spam},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// RECONNECT : le listener rejoint la chaîne sur une nouvelle connexion
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-reconnect", Steps: []twitchmock.Step{{Kind: twitchmock.StepChatReconnect}}}); err != nil {
+		t.Fatal(err)
+	}
+	s.waitIRCChannel(twitchmock.StreamerLogin)
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-chat-2", Steps: []twitchmock.Step{{Kind: twitchmock.StepChat, Count: 3}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var sessionUUID string
+	if err := s.db.QueryRow(`SELECT session_uuid FROM sessions WHERE status = 'active'`).Scan(&sessionUUID); err != nil {
+		t.Fatal(err)
+	}
+	type chatSummary struct {
+		Channels []struct {
+			BroadcasterLogin string `json:"broadcaster_login"`
+		} `json:"channels"`
+		Messages     int64 `json:"messages"`
+		SilentCount  int64 `json:"silent_count"`
+		ActiveCount  int64 `json:"active_count"`
+		SpamCount    int64 `json:"spam_count"`
+		SpamAccounts []struct {
+			Login          string `json:"login"`
+			MessageCount   int64  `json:"message_count"`
+			DuplicateCount int64  `json:"duplicate_count"`
+		} `json:"spam_accounts"`
+		RepeatedMessages []struct {
+			Sample string `json:"sample"`
+			Count  int64  `json:"count"`
+		} `json:"repeated_messages"`
+	}
+	// 10×2 messages organiques, 5×3 répétitions et 3 messages après la reconnexion
+	const wantMessages = 38
+	var chat *chatSummary
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		var summary struct {
+			Chat *chatSummary `json:"chat"`
+		}
+		getJSON(t, s.analysisURL+"/sessions/"+sessionUUID+"/summary", &summary)
+		if chat = summary.Chat; chat != nil && chat.Messages == wantMessages {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("chat summary = %+v, want %d messages", chat, wantMessages)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	if len(chat.Channels) != 1 || chat.Channels[0].BroadcasterLogin != twitchmock.StreamerLogin {
+		t.Errorf("channels = %+v, want %s", chat.Channels, twitchmock.StreamerLogin)
+	}
+	if chat.ActiveCount != 10 || chat.SpamCount != 5 || chat.SilentCount != int64(captured-15) {
+		t.Errorf("active = %d, spam = %d, silent = %d; want 10, 5, %d", chat.ActiveCount, chat.SpamCount, chat.SilentCount, captured-15)
+	}
+	for _, a := range chat.SpamAccounts {
+		if !strings.HasPrefix(a.Login, "wavebot") || a.MessageCount != 3 || a.DuplicateCount < 2 {
+			t.Errorf("spam account %+v, want a bot with 3 messages", a)
+		}
+	}
+	if len(chat.SpamAccounts) != 5 {
+		t.Errorf("spam_accounts = %d, want 5", len(chat.SpamAccounts))
+	}
+	if len(chat.RepeatedMessages) != 1 || chat.RepeatedMessages[0].Count != 15 || !strings.HasPrefix(chat.RepeatedMessages[0].Sample, spam) {
+		t.Errorf("repeated_messages = %+v, want %q sent 15 times", chat.RepeatedMessages, spam)
+	}
+	if _, page := s.get("/analysis"); !strings.Contains(page, "Activité du chat") || !strings.Contains(page, spam) {
+		t.Errorf("analysis page does not show the chat activity")
+	}
+	if n := s.count(`SELECT COUNT(*) FROM chat_activity`); n != 15 {
+		t.Errorf("chat_activity rows = %d, want 15", n)
+	}
+}
+
+// waitIRCChannel attend qu'une connexion IRC du mock ait rejoint la chaîne login
+func (s *stack) waitIRCChannel(login string) {
+	s.t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for !slices.Contains(s.mock.IRCChannels(), login) {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("timeout waiting for the chat listener to join #%s", login)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
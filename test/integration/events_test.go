@@ -0,0 +1,133 @@
+package integration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchmock"
+)
+
+// sseEvent est un message du flux /api/v1/sessions/{uuid}/events
+type sseEvent struct {
+	Name  string // champ event: du message
+	Type  string `json:"type"`
+	JobID int64  `json:"job_id"`
+	Data  struct {
+		BroadcasterLogin string `json:"broadcaster_login"`
+		Chatters         int    `json:"chatters"`
+		UsersToEnrich    int    `json:"users_to_enrich"`
+		UsersEnriched    int    `json:"users_enriched"`
+		Missing          int    `json:"missing"`
+		DefaultAvatars   int    `json:"default_avatars"`
+		JobType          string `json:"job_type"`
+		Error            string `json:"error"`
+	} `json:"data"`
+}
+
+// readSSE décode les messages d'un flux text/event-stream jusqu'à sa fermeture
+func readSSE(t *testing.T, body io.Reader, out chan<- sseEvent) {
+	defer close(out)
+	var name string
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev := sseEvent{Name: name}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+				t.Errorf("invalid event data %q: %v", line, err)
+				return
+			}
+			out <- ev
+		case line == "":
+			name = ""
+		}
+	}
+}
+
+func TestSessionEvents(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 20, ModeratedChannels: 1})
+	s.login()
+	s.capture()
+	s.waitJobs(2)
+
+	var sessionUUID string
+	if err := s.db.QueryRow(`SELECT session_uuid FROM sessions WHERE status = 'active'`).Scan(&sessionUUID); err != nil {
+		t.Fatal(err)
+	}
+
+	var notFound apiError
+	s.apiJSON(http.MethodGet, "/sessions/unknown/events", nil, http.StatusNotFound, &notFound)
+
+	// Le gateway ne répond qu'une fois abonné au canal Redis de la session
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.gatewayURL+"/api/v1/sessions/"+sessionUUID+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Jar: s.client.Jar}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events stream: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	events := make(chan sseEvent)
+	go readSSE(t, resp.Body, events)
+
+	next := func(want string) sseEvent {
+		t.Helper()
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("events stream closed, want %s", want)
+			}
+			if ev.Type != want || ev.Name != want {
+				t.Fatalf("event %s (%s), want %s: %+v", ev.Name, ev.Type, want, ev)
+			}
+			return ev
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for %s event", want)
+		}
+		return sseEvent{}
+	}
+
+	// Trois bots à l'avatar par défaut rejoignent le chat : seuls eux sont à enrichir
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-events", Steps: []twitchmock.Step{{Kind: twitchmock.StepBotWave, Count: 3}}}); err != nil {
+		t.Fatal(err)
+	}
+	s.capture()
+
+	stored := next("capture_stored")
+	if stored.Data.BroadcasterLogin != twitchmock.StreamerLogin ||
+		stored.Data.Chatters != len(s.mock.Chatters(twitchmock.StreamerID)) || stored.Data.UsersToEnrich != 3 {
+		t.Errorf("capture_stored = %+v", stored.Data)
+	}
+	if enriched := next("enrichment_finished"); enriched.Data.UsersEnriched != 3 || enriched.Data.Missing != 0 {
+		t.Errorf("enrichment_finished = %+v", enriched.Data)
+	}
+	if suspicious := next("suspicious_accounts"); suspicious.Data.DefaultAvatars != 3 {
+		t.Errorf("suspicious_accounts = %+v", suspicious.Data)
+	}
+
+	// Job de la session en échec
+	if _, err := s.db.Exec(`
+INSERT INTO jobs (type, payload, session_id, user_id, status, created_at)
+SELECT 'BOGUS', '{}', id, user_id, 'pending', NOW(6) FROM sessions WHERE session_uuid = ?`, sessionUUID); err != nil {
+		t.Fatal(err)
+	}
+	failed := next("job_failed")
+	if failed.JobID == 0 || failed.Data.JobType != "BOGUS" || failed.Data.Error != "unknown job type" {
+		t.Errorf("job_failed = %+v", failed)
+	}
+}
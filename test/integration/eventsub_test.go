@@ -0,0 +1,279 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/eventsub"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchmock"
+)
+
+func TestEventSubCaptures(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 20, ModeratedChannels: 1})
+	s.login()
+
+	// Abonnements depuis la page (lien « Captures auto » de /channels)
+	if _, page := s.get("/channels"); !strings.Contains(page, "/eventsub?broadcaster_id="+twitchmock.StreamerID) {
+		t.Fatalf("no eventsub link on /channels:\n%s", page)
+	}
+	if _, body := s.post("/eventsub/subscriptions/create", url.Values{
+		"broadcaster_id": {twitchmock.StreamerID}, "type": {eventsub.ChannelRaid}, "offsets": {"0s, 7h"},
+	}); !strings.Contains(body, "Délais invalides") {
+		t.Errorf("offset above 6h accepted:\n%s", body)
+	}
+	if _, body := s.post("/eventsub/subscriptions/create", url.Values{
+		"broadcaster_id": {"999999"}, "type": {eventsub.ChannelRaid}, "offsets": {"0s"},
+	}); !strings.Contains(body, "Vous ne modérez pas cette chaîne") {
+		t.Errorf("unmoderated channel accepted:\n%s", body)
+	}
+	resp, body := s.post("/eventsub/subscriptions/create", url.Values{
+		"broadcaster_id": {twitchmock.StreamerID}, "type": {eventsub.ChannelRaid}, "offsets": {"0s, 2s"},
+	})
+	if resp.Request.URL.Path != "/eventsub" || !strings.Contains(body, "Abonnement créé") {
+		t.Fatalf("create subscription ended on %s:\n%s", resp.Request.URL, body)
+	}
+	s.post("/eventsub/subscriptions/create", url.Values{
+		"broadcaster_id": {twitchmock.StreamerID}, "type": {eventsub.ChannelFollow}, "offsets": {""},
+	})
+	if _, body := s.post("/eventsub/subscriptions/create", url.Values{
+		"broadcaster_id": {twitchmock.StreamerID}, "type": {eventsub.ChannelRaid}, "offsets": {"1m"},
+	}); !strings.Contains(body, "déjà abonnée") {
+		t.Errorf("duplicate subscription accepted:\n%s", body)
+	}
+
+	// Le mock vérifie le callback (challenge) : les deux abonnements passent à enabled
+	s.waitCount(`SELECT COUNT(*) FROM eventsub_subscriptions WHERE status = 'enabled'`, 2)
+	subs := s.mock.EventSubSubscriptions()
+	if len(subs) != 2 {
+		t.Fatalf("mock subscriptions = %d, want 2", len(subs))
+	}
+	for _, sub := range subs {
+		if sub.Status != eventsub.StatusEnabled || sub.Transport.Callback != s.gatewayURL+"/eventsub/callback" {
+			t.Errorf("mock subscription %s: status %s, callback %s", sub.Type, sub.Status, sub.Transport.Callback)
+		}
+	}
+	raidSub := subs[0]
+	if raidSub.Type != eventsub.ChannelRaid {
+		raidSub = subs[1]
+	}
+
+	// Messages non signés par le secret, ou trop anciens : refusés
+	event := json.RawMessage(`{"to_broadcaster_user_id":"` + twitchmock.StreamerID + `","viewers":1}`)
+	if status := s.sendEventSub(raidSub, "forged-1", time.Now(), event, "wrong-secret-123"); status != http.StatusForbidden {
+		t.Errorf("forged message: status %d, want 403", status)
+	}
+	if status := s.sendEventSub(raidSub, "stale-1", time.Now().Add(-eventsub.MaxMessageAge-time.Minute), event, testEventSubSecret); status != http.StatusForbidden {
+		t.Errorf("stale message: status %d, want 403", status)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM eventsub_events`); n != 0 {
+		t.Fatalf("rejected messages recorded: %d events", n)
+	}
+
+	// Raid : deux captures planifiées (immédiate et à +2 s) ; seule la première a des comptes à enrichir
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-raid", Steps: []twitchmock.Step{{Kind: twitchmock.StepRaid, Count: 30}}}); err != nil {
+		t.Fatal(err)
+	}
+	s.waitCount(`SELECT COUNT(*) FROM eventsub_events WHERE type = 'channel.raid' AND captures = 2`, 1)
+	if n := s.count(`SELECT COUNT(*) FROM jobs WHERE type = 'FETCH_CHATTERS' AND run_after IS NOT NULL AND session_id IS NOT NULL`); n != 2 {
+		t.Errorf("scheduled captures = %d, want 2", n)
+	}
+	s.waitJobs(3)
+	if n := s.count(`SELECT COUNT(*) FROM captures`); n != 2 {
+		t.Errorf("captures = %d, want 2", n)
+	}
+	if n := s.count(`SELECT COUNT(DISTINCT c.user_key) FROM capture_chatters c
+JOIN twitch_user_keys k ON k.user_key = c.user_key
+JOIN twitch_users u ON u.twitch_user_id = k.twitch_user_id
+WHERE u.login LIKE 'raider%'`); n != 30 {
+		t.Errorf("raid viewers captured = %d, want 30", n)
+	}
+
+	// Message renvoyé par Twitch (même id) : accepté mais ignoré
+	var messageID string
+	if err := s.db.QueryRow(`SELECT message_id FROM eventsub_events WHERE type = 'channel.raid'`).Scan(&messageID); err != nil {
+		t.Fatal(err)
+	}
+	if status := s.sendEventSub(raidSub, messageID, time.Now(), event, testEventSubSecret); status != http.StatusNoContent {
+		t.Errorf("replayed message: status %d, want 204", status)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM jobs WHERE type = 'FETCH_CHATTERS'`); n != 2 {
+		t.Errorf("replayed message scheduled captures: %d jobs, want 2", n)
+	}
+
+	// Follows : journalisés, sans capture
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-follow", Steps: []twitchmock.Step{{Kind: twitchmock.StepFollow, Count: 3}}}); err != nil {
+		t.Fatal(err)
+	}
+	s.waitCount(`SELECT COUNT(*) FROM eventsub_events WHERE type = 'channel.follow'`, 3)
+	if n := s.count(`SELECT COUNT(*) FROM jobs WHERE type = 'FETCH_CHATTERS'`); n != 2 {
+		t.Errorf("follows scheduled captures: %d jobs, want 2", n)
+	}
+	if _, page := s.get("/eventsub"); !strings.Contains(page, "channel.follow") || !strings.Contains(page, "0s, 2s") {
+		t.Errorf("subscriptions or events missing on /eventsub:\n%s", page)
+	}
+
+	// Suppression : l'abonnement Twitch disparaît avec le dernier utilisateur
+	var id int64
+	if err := s.db.QueryRow(`SELECT id FROM eventsub_subscriptions WHERE type = 'channel.raid'`).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := s.post("/eventsub/subscriptions/delete", url.Values{"subscription_id": {strconv.FormatInt(id, 10)}}); resp.Request.URL.Query().Get("notice") != "deleted" {
+		t.Fatalf("delete ended on %s", resp.Request.URL)
+	}
+	if subs := s.mock.EventSubSubscriptions(); len(subs) != 1 || subs[0].Type != eventsub.ChannelFollow {
+		t.Errorf("mock subscriptions after delete = %+v", subs)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM audit_logs WHERE event_type LIKE 'eventsub_subscription_%'`); n != 3 {
+		t.Errorf("audit entries = %d, want 3", n)
+	}
+
+	// Révocation par Twitch : le statut est enregistré
+	for _, sub := range s.mock.EventSubSubscriptions() {
+		s.mock.RevokeEventSubSubscription(sub.ID, eventsub.StatusAuthorizationRevoked)
+	}
+	s.waitCount(`SELECT COUNT(*) FROM eventsub_subscriptions WHERE status = 'authorization_revoked'`, 1)
+}
+
+// sendEventSub envoie au callback du gateway une notification signée avec secret
+func (s *stack) sendEventSub(sub eventsub.Subscription, messageID string, sentAt time.Time, event json.RawMessage, secret string) int {
+	s.t.Helper()
+	body, err := json.Marshal(eventsub.Message{Subscription: sub, Event: event})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	timestamp := sentAt.UTC().Format(time.RFC3339Nano)
+	req, err := http.NewRequest(http.MethodPost, s.gatewayURL+"/eventsub/callback", bytes.NewReader(body))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req.Header.Set(eventsub.HeaderMessageID, messageID)
+	req.Header.Set(eventsub.HeaderMessageTimestamp, timestamp)
+	req.Header.Set(eventsub.HeaderMessageSignature, eventsub.Sign(secret, messageID, timestamp, body))
+	req.Header.Set(eventsub.HeaderMessageType, eventsub.MessageNotification)
+	req.Header.Set(eventsub.HeaderSubscriptionType, sub.Type)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// waitCount attend que la requête SELECT COUNT(*) ... retourne want
+func (s *stack) waitCount(query string, want int) {
+	s.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for {
+		n := s.count(query)
+		if n == want {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			s.t.Fatalf("timeout waiting for %q: %d, want %d", query, n, want)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func TestEventSubWebSocket(t *testing.T) {
+	s := newStackWith(t, twitchmock.Config{Chatters: 20, ModeratedChannels: 1, EventSubKeepalive: time.Second},
+		stackOptions{eventsubWebSocket: true})
+	s.login()
+
+	// Le gateway enregistre les abonnements sans appeler Twitch ; le listener les crée sur sa session
+	for _, form := range []url.Values{
+		{"broadcaster_id": {twitchmock.StreamerID}, "type": {eventsub.ChannelRaid}, "offsets": {"0s"}},
+		{"broadcaster_id": {twitchmock.StreamerID}, "type": {eventsub.ChannelFollow}, "offsets": {""}},
+	} {
+		if _, body := s.post("/eventsub/subscriptions/create", form); !strings.Contains(body, "Abonnement créé") {
+			t.Fatalf("create %s subscription:\n%s", form.Get("type"), body)
+		}
+	}
+	s.waitCount(`SELECT COUNT(*) FROM eventsub_subscriptions WHERE transport = 'websocket' AND status = 'enabled'`, 2)
+	subs := s.waitMockSubscriptions(func(subs []eventsub.Subscription) bool { return len(subs) == 2 })
+	for _, sub := range subs {
+		if sub.Transport.Method != eventsub.TransportWebSocket || sub.Transport.SessionID == "" || sub.Transport.SessionID != subs[0].Transport.SessionID {
+			t.Errorf("mock subscription %s: transport %+v", sub.Type, sub.Transport)
+		}
+	}
+	if _, page := s.get("/eventsub"); !strings.Contains(page, "<code>websocket</code>") {
+		t.Errorf("transport missing on /eventsub:\n%s", page)
+	}
+
+	// Raid reçu sur la session : capture immédiate
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-raid", Steps: []twitchmock.Step{{Kind: twitchmock.StepRaid, Count: 10}}}); err != nil {
+		t.Fatal(err)
+	}
+	s.waitCount(`SELECT COUNT(*) FROM eventsub_events WHERE type = 'channel.raid' AND captures = 1`, 1)
+	s.waitJobs(2)
+	if n := s.count(`SELECT COUNT(*) FROM captures`); n != 1 {
+		t.Errorf("captures = %d, want 1", n)
+	}
+
+	// session_reconnect : les abonnements suivent le listener sur la nouvelle session
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-reconnect", Steps: []twitchmock.Step{{Kind: twitchmock.StepEventSubReconnect}}}); err != nil {
+		t.Fatal(err)
+	}
+	moved := s.waitMockSubscriptions(func(list []eventsub.Subscription) bool {
+		return len(list) == 2 && list[0].Transport.SessionID != subs[0].Transport.SessionID
+	})
+	if moved[0].ID != subs[0].ID || moved[1].ID != subs[1].ID {
+		t.Errorf("subscriptions recreated on reconnect: %+v, want %+v", moved, subs)
+	}
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-follow", Steps: []twitchmock.Step{{Kind: twitchmock.StepFollow, Count: 2}}}); err != nil {
+		t.Fatal(err)
+	}
+	s.waitCount(`SELECT COUNT(*) FROM eventsub_events WHERE type = 'channel.follow'`, 2)
+
+	// Coupure réseau : le listener se reconnecte et recrée les abonnements
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-drop", Steps: []twitchmock.Step{{Kind: twitchmock.StepEventSubDrop}}}); err != nil {
+		t.Fatal(err)
+	}
+	recreated := s.waitMockSubscriptions(func(list []eventsub.Subscription) bool {
+		return len(list) == 2 && list[0].ID != moved[0].ID && list[1].ID != moved[1].ID
+	})
+	s.waitCount(`SELECT COUNT(*) FROM eventsub_subscriptions WHERE status = 'enabled' AND twitch_subscription_id IN ('`+
+		recreated[0].ID+`', '`+recreated[1].ID+`')`, 2)
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-raid-2", Steps: []twitchmock.Step{{Kind: twitchmock.StepRaid, Count: 5}}}); err != nil {
+		t.Fatal(err)
+	}
+	s.waitCount(`SELECT COUNT(*) FROM eventsub_events WHERE type = 'channel.raid' AND captures = 1`, 2)
+	if _, page := s.get("/eventsub"); strings.Count(page, "<code>channel.raid</code>") != 3 {
+		t.Errorf("events before the reconnection missing on /eventsub:\n%s", page)
+	}
+
+	// Suppression : le listener supprime l'abonnement chez Twitch à la synchronisation suivante
+	var id int64
+	if err := s.db.QueryRow(`SELECT id FROM eventsub_subscriptions WHERE type = 'channel.raid'`).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	s.post("/eventsub/subscriptions/delete", url.Values{"subscription_id": {strconv.FormatInt(id, 10)}})
+	s.waitMockSubscriptions(func(list []eventsub.Subscription) bool {
+		return len(list) == 1 && list[0].Type == eventsub.ChannelFollow
+	})
+}
+
+// waitMockSubscriptions attend que les abonnements EventSub du mock vérifient ok et les retourne
+func (s *stack) waitMockSubscriptions(ok func([]eventsub.Subscription) bool) []eventsub.Subscription {
+	s.t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		subs := s.mock.EventSubSubscriptions()
+		if ok(subs) {
+			return subs
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("timeout waiting for mock subscriptions, got %+v", subs)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,594 @@
+package integration
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchmock"
+)
+
+// exportPayload est le format JSON de /analysis/export et /sessions/export/{uuid}
+type exportPayload struct {
+	SessionUUID string `json:"session_uuid"`
+	Accounts    []struct {
+		TwitchUserID string     `json:"twitch_user_id"`
+		Login        string     `json:"login"`
+		DisplayName  string     `json:"display_name"`
+		CreatedAt    *time.Time `json:"created_at"`
+		SeenCount    int64      `json:"seen_count"`
+	} `json:"accounts"`
+}
+
+// summaryPayload est le sous-ensemble utile de GET /sessions/{uuid}/summary (service analysis)
+type summaryPayload struct {
+	SessionUUID   string `json:"session_uuid"`
+	TotalAccounts int64  `json:"total_accounts"`
+	TopDays       []struct {
+		Date  string `json:"date"`
+		Count int64  `json:"count"`
+	} `json:"top_days"`
+	Broadcasters []struct {
+		BroadcasterID string `json:"broadcaster_id"`
+		CaptureCount  int64  `json:"capture_count"`
+	} `json:"broadcasters"`
+}
+
+func TestFullFlow(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 120, ModeratedChannels: 3})
+	chatters := s.mock.Chatters(twitchmock.StreamerID)
+
+	// --- Login OAuth ---
+	home := s.login()
+	if !strings.Contains(home, "MockMod") {
+		t.Fatalf("home page does not show the logged-in user")
+	}
+	var userID int64
+	if err := s.db.QueryRow(`SELECT id FROM users WHERE twitch_user_id = ? AND login = ?`, twitchmock.ModeratorID, twitchmock.ModeratorLogin).Scan(&userID); err != nil {
+		t.Fatalf("user not stored after login: %v", err)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM web_sessions WHERE user_id = ?`, userID); n != 1 {
+		t.Fatalf("web_sessions = %d, want 1", n)
+	}
+
+	// --- Chaînes modérées ---
+	_, channels := s.get("/channels")
+	for _, login := range []string{twitchmock.StreamerLogin, "channel001", "channel003"} {
+		if !strings.Contains(channels, login) {
+			t.Errorf("/channels does not list %s", login)
+		}
+	}
+
+	// --- Première capture + enrichissement ---
+	s.capture()
+	s.waitJobs(2)
+
+	var sessionID int64
+	var sessionUUID string
+	if err := s.db.QueryRow(`SELECT id, session_uuid FROM sessions WHERE user_id = ? AND status = 'active'`, userID).Scan(&sessionID, &sessionUUID); err != nil {
+		t.Fatalf("no active session after capture: %v", err)
+	}
+	var chattersCount int
+	if err := s.db.QueryRow(`SELECT chatters_count FROM captures WHERE session_id = ?`, sessionID).Scan(&chattersCount); err != nil {
+		t.Fatalf("capture not stored: %v", err)
+	}
+	if chattersCount != len(chatters) {
+		t.Errorf("chatters_count = %d, want %d", chattersCount, len(chatters))
+	}
+	if n := s.count(`SELECT COUNT(*) FROM capture_chatters`); n != len(chatters) {
+		t.Errorf("capture_chatters = %d, want %d", n, len(chatters))
+	}
+	if n := s.count(`SELECT COUNT(*) FROM twitch_users`); n != len(chatters) {
+		t.Errorf("twitch_users = %d, want %d", n, len(chatters))
+	}
+
+	// --- Renommages côté Twitch puis seconde capture ---
+	renamed := chatters[len(chatters)-3:]
+	oldLogins := make(map[string]string, len(renamed))
+	for _, id := range renamed {
+		oldLogins[id] = s.mock.User(id).Login
+	}
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-renames", Steps: []twitchmock.Step{{Kind: twitchmock.StepRename, UserIDs: renamed}}}); err != nil {
+		t.Fatal(err)
+	}
+	// Seuls les comptes enrichis hors de la fenêtre de fraîcheur sont redemandés
+	for _, id := range renamed {
+		if _, err := s.db.Exec(`UPDATE twitch_users SET last_fetched_at = ? WHERE twitch_user_id = ?`, time.Now().UTC().Add(-48*time.Hour), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.capture()
+	s.waitJobs(4)
+
+	var lastPayload string
+	if err := s.db.QueryRow(`SELECT payload FROM jobs WHERE type = 'FETCH_USERS_INFO' ORDER BY id DESC LIMIT 1`).Scan(&lastPayload); err != nil {
+		t.Fatal(err)
+	}
+	var refetched struct {
+		UserIDs []string `json:"user_ids"`
+	}
+	if err := json.Unmarshal([]byte(lastPayload), &refetched); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(refetched.UserIDs, ",") != strings.Join(renamed, ",") {
+		t.Errorf("second enrichment = %v, want only stale accounts %v", refetched.UserIDs, renamed)
+	}
+
+	for _, id := range renamed {
+		newLogin := s.mock.User(id).Login
+		var oldLogin, gotNew string
+		err := s.db.QueryRow(`SELECT old_login, new_login FROM twitch_user_names WHERE twitch_user_id = ?`, id).Scan(&oldLogin, &gotNew)
+		if err != nil {
+			t.Fatalf("rename of %s not recorded: %v", id, err)
+		}
+		if oldLogin != oldLogins[id] || gotNew != newLogin {
+			t.Errorf("rename of %s = %s -> %s, want %s -> %s", id, oldLogin, gotNew, oldLogins[id], newLogin)
+		}
+	}
+	if n := s.count(`SELECT COUNT(*) FROM twitch_user_names`); n != len(renamed) {
+		t.Errorf("twitch_user_names = %d, want %d", n, len(renamed))
+	}
+
+	// --- Analyse (service analysis et page du gateway) ---
+	var summary summaryPayload
+	getJSON(t, s.analysisURL+"/sessions/"+sessionUUID+"/summary", &summary)
+	if summary.TotalAccounts != int64(len(chatters)) {
+		t.Errorf("total_accounts = %d, want %d", summary.TotalAccounts, len(chatters))
+	}
+	if len(summary.Broadcasters) != 1 || summary.Broadcasters[0].CaptureCount != 2 {
+		t.Errorf("broadcasters = %+v, want one broadcaster with 2 captures", summary.Broadcasters)
+	}
+	if len(summary.TopDays) == 0 {
+		t.Errorf("top_days is empty")
+	}
+
+	resp, page := s.get("/analysis")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(page, sessionUUID) {
+		t.Fatalf("/analysis: status %d, session uuid present: %v", resp.StatusCode, strings.Contains(page, sessionUUID))
+	}
+
+	// --- Export de la session active ---
+	export := s.exportJSON("/analysis/export?format=json")
+	if len(export.Accounts) != len(chatters) {
+		t.Errorf("exported %d accounts, want %d", len(export.Accounts), len(chatters))
+	}
+	for _, acc := range export.Accounts {
+		if acc.SeenCount != 2 {
+			t.Errorf("account %s seen_count = %d, want 2", acc.TwitchUserID, acc.SeenCount)
+		}
+		if acc.Login == "" || acc.CreatedAt == nil {
+			t.Errorf("account %s not enriched in export: %+v", acc.TwitchUserID, acc)
+		}
+		if _, ok := oldLogins[acc.TwitchUserID]; ok && acc.Login != s.mock.User(acc.TwitchUserID).Login {
+			t.Errorf("account %s exported with stale login %s", acc.TwitchUserID, acc.Login)
+		}
+	}
+	if rows := s.exportCSV("/analysis/export?format=csv"); len(rows) != len(chatters)+1 {
+		t.Errorf("CSV export has %d rows, want %d (with header)", len(rows), len(chatters)+1)
+	}
+
+	// --- Historique d'un compte renommé ---
+	resp, history := s.get("/accounts/" + renamed[0] + "/history")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/accounts/%s/history: status %d", renamed[0], resp.StatusCode)
+	}
+	for _, login := range []string{oldLogins[renamed[0]], s.mock.User(renamed[0]).Login} {
+		if !strings.Contains(history, login) {
+			t.Errorf("account history does not mention %s", login)
+		}
+	}
+
+	// --- Sauvegarde ---
+	resp, _ = s.post("/sessions/save", nil)
+	if resp.Request.URL.Path != "/sessions" || resp.Request.URL.Query().Get("saved") != "1" {
+		t.Fatalf("save ended on %s", resp.Request.URL)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM sessions WHERE id = ? AND status = 'saved'`, sessionID); n != 1 {
+		t.Fatalf("session %d not saved", sessionID)
+	}
+	if _, page := s.get("/sessions"); !strings.Contains(page, sessionUUID) {
+		t.Errorf("/sessions does not list the saved session")
+	}
+	if resp, _ := s.get("/analysis/saved/" + sessionUUID); resp.StatusCode != http.StatusOK {
+		t.Errorf("/analysis/saved: status %d", resp.StatusCode)
+	}
+	if rows := s.exportCSV("/sessions/export/" + sessionUUID + "?format=csv"); len(rows) != len(chatters)+1 {
+		t.Errorf("saved CSV export has %d rows, want %d", len(rows), len(chatters)+1)
+	}
+
+	// --- Purge d'une nouvelle session active ---
+	s.capture()
+	s.waitJobs(6)
+	var purgedID int64
+	if err := s.db.QueryRow(`SELECT id FROM sessions WHERE user_id = ? AND status = 'active'`, userID).Scan(&purgedID); err != nil {
+		t.Fatalf("no new active session: %v", err)
+	}
+	resp, _ = s.post("/sessions/purge", nil)
+	if resp.Request.URL.Query().Get("purged") != "1" {
+		t.Fatalf("purge ended on %s", resp.Request.URL)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM sessions WHERE id = ? AND status = 'deleted'`, purgedID); n != 1 {
+		t.Errorf("session %d not marked deleted", purgedID)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM captures WHERE session_id = ?`, purgedID); n != 0 {
+		t.Errorf("purged session still has %d captures", n)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM captures WHERE session_id = ?`, sessionID); n != 2 {
+		t.Errorf("saved session has %d captures after purge, want 2", n)
+	}
+
+	// --- Suppression de la session sauvegardée ---
+	resp, _ = s.post("/sessions/delete", url.Values{"session_uuid": {sessionUUID}})
+	if resp.Request.URL.Query().Get("deleted") != "1" {
+		t.Fatalf("delete ended on %s", resp.Request.URL)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM sessions WHERE id = ?`, sessionID); n != 0 {
+		t.Errorf("saved session still present after delete")
+	}
+	if n := s.count(`SELECT COUNT(*) FROM capture_chatters`); n != 0 {
+		t.Errorf("capture_chatters = %d after purge and delete, want 0", n)
+	}
+
+	// --- Déconnexion : web_session supprimée et token révoqué ---
+	var accessToken string
+	if err := s.db.QueryRow(`SELECT access_token FROM web_sessions WHERE user_id = ?`, userID).Scan(&accessToken); err != nil {
+		t.Fatal(err)
+	}
+	s.get("/auth/logout")
+	if n := s.count(`SELECT COUNT(*) FROM web_sessions WHERE user_id = ?`, userID); n != 0 {
+		t.Errorf("web_sessions = %d after logout, want 0", n)
+	}
+	req, _ := http.NewRequest(http.MethodGet, s.mockURL+"/oauth2/validate", nil)
+	req.Header.Set("Authorization", "OAuth "+accessToken)
+	vresp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vresp.Body.Close()
+	if vresp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("token still valid after logout: status %d", vresp.StatusCode)
+	}
+}
+
+// TestRefreshUsers vérifie le réenrichissement de fond : un job REFRESH_USERS (app token,
+// sans session utilisateur) détecte les renommages et marque les comptes disparus.
+func TestRefreshUsers(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 30, ModeratedChannels: 1})
+	chatters := s.mock.Chatters(twitchmock.StreamerID)
+
+	// Compte suspendu entre la capture et l'enrichissement
+	suspended := chatters[3]
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-suspended", Steps: []twitchmock.Step{{Kind: twitchmock.StepRemoveUsers, UserIDs: []string{suspended}}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.login()
+	s.capture()
+	s.waitJobs(2)
+
+	var status, login string
+	if err := s.db.QueryRow(`SELECT status, login FROM twitch_users WHERE twitch_user_id = ? AND disappeared_at IS NOT NULL`, suspended).Scan(&status, &login); err != nil {
+		t.Fatalf("suspended account not recorded: %v", err)
+	}
+	if status != "missing" || login != "" {
+		t.Errorf("suspended account: status=%s login=%q, want missing without name", status, login)
+	}
+
+	// Les comptes ont quitté le chat : seule la tâche de fond peut voir leurs changements
+	renamed, removed := chatters[:2], chatters[2:3]
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-refresh", Steps: []twitchmock.Step{
+		{Kind: twitchmock.StepRename, UserIDs: renamed},
+		{Kind: twitchmock.StepRemoveUsers, UserIDs: removed},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().UTC().Add(-48 * time.Hour)
+	if _, err := s.db.Exec(`UPDATE twitch_users SET last_fetched_at = ?`, stale); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec(`INSERT INTO jobs (type, payload, status, created_at) VALUES ('REFRESH_USERS', '{"limit": 1000}', 'pending', NOW(6))`); err != nil {
+		t.Fatal(err)
+	}
+	s.waitJobs(3)
+
+	for _, id := range renamed {
+		var newLogin string
+		if err := s.db.QueryRow(`SELECT new_login FROM twitch_user_names WHERE twitch_user_id = ?`, id).Scan(&newLogin); err != nil {
+			t.Fatalf("rename of %s not recorded: %v", id, err)
+		}
+		if want := s.mock.User(id).Login; newLogin != want {
+			t.Errorf("rename of %s: new_login = %s, want %s", id, newLogin, want)
+		}
+	}
+	if n := s.count(`SELECT COUNT(*) FROM twitch_users WHERE last_fetched_at <= ?`, stale); n != 0 {
+		t.Errorf("%d accounts not refreshed (removed accounts included)", n)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM twitch_users WHERE status = 'missing'`); n != 2 {
+		t.Errorf("missing accounts = %d, want 2", n)
+	}
+
+	var sessionUUID string
+	if err := s.db.QueryRow(`SELECT session_uuid FROM sessions WHERE status = 'active'`).Scan(&sessionUUID); err != nil {
+		t.Fatal(err)
+	}
+	var summary struct {
+		MissingAccountsCount int64 `json:"missing_accounts_count"`
+	}
+	getJSON(t, s.analysisURL+"/sessions/"+sessionUUID+"/summary", &summary)
+	if summary.MissingAccountsCount != 2 {
+		t.Errorf("missing_accounts_count = %d, want 2", summary.MissingAccountsCount)
+	}
+	if _, page := s.get("/analysis"); !strings.Contains(page, "2 compte(s) de cette session ont depuis été suspendus") {
+		t.Errorf("analysis page does not report suspended accounts")
+	}
+}
+
+// TestLargeEnrichment vérifie qu'un enrichissement plus long que le délai de base des jobs
+// aboutit : le délai du job FETCH_USERS_INFO croît avec son nombre de lots de /users.
+func TestLargeEnrichment(t *testing.T) {
+	s := newStackWith(t, twitchmock.Config{Chatters: 20, ModeratedChannels: 1}, stackOptions{jobTimeout: 2 * time.Second})
+	s.login()
+	s.capture()
+	s.waitJobs(2)
+
+	// 25 lots de 100 comptes, espacés de 100 ms : plus que les 2 s accordées à un job. Le job
+	// est créé directement, la capture de 2500 chatters dépasserait elle aussi ce délai.
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-large", Steps: []twitchmock.Step{
+		{Kind: twitchmock.StepBotWave, Count: 2480, Prefix: "largebot"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	ids := s.mock.Chatters(twitchmock.StreamerID)
+	var sessionID int64
+	if err := s.db.QueryRow(`SELECT id FROM sessions WHERE status = 'active'`).Scan(&sessionID); err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(map[string]any{"session_id": sessionID, "user_ids": ids})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec(`INSERT INTO jobs (type, session_id, payload, status, created_at) VALUES ('FETCH_USERS_INFO', ?, ?, 'pending', NOW(6))`, sessionID, payload); err != nil {
+		t.Fatal(err)
+	}
+	s.waitJobs(3)
+
+	if n := s.count(`SELECT COUNT(*) FROM twitch_users WHERE last_fetched_at IS NOT NULL`); n != len(ids) {
+		t.Errorf("enriched accounts = %d, want %d", n, len(ids))
+	}
+	if n := s.count(`
+SELECT COUNT(*) FROM jobs
+WHERE type = 'FETCH_USERS_INFO' AND finished_at > started_at + INTERVAL 2 SECOND`); n != 1 {
+		t.Errorf("no FETCH_USERS_INFO job outlasted the base job timeout")
+	}
+}
+
+// capture demande une capture des chatters du streamer simulé
+func (s *stack) capture() {
+	s.t.Helper()
+	resp, _ := s.post("/sessions/capture", url.Values{
+		"broadcaster_id":    {twitchmock.StreamerID},
+		"broadcaster_login": {twitchmock.StreamerLogin},
+	})
+	if resp.Request.URL.Query().Get("capture_enqueued") != "1" {
+		s.t.Fatalf("capture ended on %s", resp.Request.URL)
+	}
+}
+
+func (s *stack) exportJSON(path string) exportPayload {
+	s.t.Helper()
+	resp, body := s.get(path)
+	if resp.StatusCode != http.StatusOK {
+		s.t.Fatalf("GET %s: status %d: %s", path, resp.StatusCode, body)
+	}
+	var out exportPayload
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		s.t.Fatalf("GET %s: invalid JSON: %v", path, err)
+	}
+	return out
+}
+
+func (s *stack) exportCSV(path string) [][]string {
+	s.t.Helper()
+	resp, body := s.get(path)
+	if resp.StatusCode != http.StatusOK {
+		s.t.Fatalf("GET %s: status %d: %s", path, resp.StatusCode, body)
+	}
+	rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if err != nil {
+		s.t.Fatalf("GET %s: invalid CSV: %v", path, err)
+	}
+	return rows
+}
+
+func getJSON(t *testing.T, u string, dest interface{}) {
+	t.Helper()
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatalf("GET %s: %v", u, err)
+	}
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", u, resp.StatusCode, body)
+	}
+	if err := json.Unmarshal([]byte(body), dest); err != nil {
+		t.Fatalf("GET %s: invalid JSON: %v", u, err)
+	}
+}
+
+func TestProfileSignals(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 20, ModeratedChannels: 1})
+	// Quatre bots envoient la même image, chacun sous sa propre URL
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-avatars", Steps: []twitchmock.Step{{Kind: twitchmock.StepBotWave, Count: 4, SharedAvatar: "it-shared"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.login()
+	s.capture()
+	s.waitJobs(2)
+
+	var defaultAvatars, emptyDescriptions int64
+	for _, id := range s.mock.Chatters(twitchmock.StreamerID) {
+		u := s.mock.User(id)
+		if u.ProfileImageURL == twitchmock.DefaultAvatarURL {
+			defaultAvatars++
+		}
+		if u.Description == "" {
+			emptyDescriptions++
+		}
+	}
+
+	var sessionUUID string
+	if err := s.db.QueryRow(`SELECT session_uuid FROM sessions WHERE status = 'active'`).Scan(&sessionUUID); err != nil {
+		t.Fatal(err)
+	}
+	var summary struct {
+		DefaultAvatarCount    int64 `json:"default_avatar_count"`
+		EmptyDescriptionCount int64 `json:"empty_description_count"`
+		AvatarClusters        []struct {
+			ProfileImageURL string   `json:"profile_image_url"`
+			Count           int64    `json:"count"`
+			Logins          []string `json:"logins"`
+		} `json:"avatar_clusters"`
+	}
+	getJSON(t, s.analysisURL+"/sessions/"+sessionUUID+"/summary", &summary)
+	if summary.DefaultAvatarCount != defaultAvatars || summary.EmptyDescriptionCount != emptyDescriptions {
+		t.Errorf("default avatars = %d, empty descriptions = %d; want %d, %d",
+			summary.DefaultAvatarCount, summary.EmptyDescriptionCount, defaultAvatars, emptyDescriptions)
+	}
+	if len(summary.AvatarClusters) != 1 || summary.AvatarClusters[0].Count != 4 || len(summary.AvatarClusters[0].Logins) != 4 ||
+		!strings.HasPrefix(summary.AvatarClusters[0].Logins[0], "wavebot") {
+		t.Fatalf("avatar_clusters = %+v, want the 4 bots sharing an image", summary.AvatarClusters)
+	}
+	if _, page := s.get("/analysis"); !strings.Contains(page, summary.AvatarClusters[0].ProfileImageURL) {
+		t.Errorf("analysis page does not show the shared avatar")
+	}
+}
+
+func TestPurge(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 10, ModeratedChannels: 1})
+	s.login()
+	s.capture()
+	s.waitJobs(2)
+
+	// Session, jobs et comptes périmés
+	old := time.Now().UTC().Add(-60 * 24 * time.Hour)
+	for _, q := range []string{
+		`UPDATE sessions SET expires_at = ?`,
+		`UPDATE jobs SET finished_at = ?`,
+		`UPDATE twitch_users SET last_fetched_at = ?`,
+	} {
+		if _, err := s.db.Exec(q, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	users := s.count(`SELECT COUNT(*) FROM twitch_users`)
+
+	if _, err := s.db.Exec(`INSERT INTO jobs (type, payload, status, created_at) VALUES ('PURGE', '{"dry_run": true}', 'pending', NOW(6))`); err != nil {
+		t.Fatal(err)
+	}
+	s.waitJobs(3)
+	if n := s.count(`SELECT COUNT(*) FROM sessions`); n != 1 {
+		t.Fatalf("dry run deleted sessions: %d left", n)
+	}
+	var details string
+	if err := s.db.QueryRow(`SELECT details FROM audit_logs WHERE event_type = 'retention_purge'`).Scan(&details); err != nil {
+		t.Fatalf("dry run not audited: %v", err)
+	}
+	var report struct {
+		DryRun  bool `json:"dry_run"`
+		Results []struct {
+			Policy string `json:"policy"`
+			Rows   int    `json:"rows"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(details), &report); err != nil {
+		t.Fatal(err)
+	}
+	rows := map[string]int{}
+	for _, r := range report.Results {
+		rows[r.Policy] = r.Rows
+	}
+	if !report.DryRun || rows["sessions"] != 1 || rows["jobs"] != 2 {
+		t.Errorf("dry run report = %s", details)
+	}
+
+	if _, err := s.db.Exec(`INSERT INTO jobs (type, payload, status, created_at) VALUES ('PURGE', '{}', 'pending', NOW(6))`); err != nil {
+		t.Fatal(err)
+	}
+	s.waitJobs(2)
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM sessions`:         0,
+		`SELECT COUNT(*) FROM captures`:         0,
+		`SELECT COUNT(*) FROM capture_chatters`: 0,
+		`SELECT COUNT(*) FROM twitch_users`:     0,
+		`SELECT COUNT(*) FROM jobs`:             2,
+		`SELECT COUNT(*) FROM audit_logs`:       2,
+	} {
+		if n := s.count(query); n != want {
+			t.Errorf("%s = %d, want %d (had %d accounts)", query, n, want, users)
+		}
+	}
+}
+
+func TestSavedSessionsQuota(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 5, ModeratedChannels: 1})
+	s.login()
+	s.capture()
+	s.waitJobs(2)
+
+	// Quota du palier free (10) déjà atteint
+	var userID int64
+	if err := s.db.QueryRow(`SELECT id FROM users LIMIT 1`).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := s.db.Exec(`
+INSERT INTO sessions (session_uuid, user_id, status, created_at, expires_at, updated_at)
+VALUES (?, ?, 'saved', NOW(6), NOW(6), NOW(6) - INTERVAL ? HOUR)`, fmt.Sprintf("old-%02d", i), userID, 100-i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, page := s.get("/analysis"); !strings.Contains(page, "old-00") || !strings.Contains(page, "quota de <strong>10</strong>") {
+		t.Errorf("analysis page does not warn about the eviction of old-00")
+	}
+	resp, _ := s.post("/sessions/save", nil)
+	if resp.Request.URL.Path != "/analysis" || resp.Request.URL.Query().Get("save_quota") != "1" {
+		t.Fatalf("save over quota ended on %s", resp.Request.URL)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM sessions WHERE status = 'saved'`); n != 10 {
+		t.Fatalf("%d saved sessions after refused save, want 10", n)
+	}
+
+	resp, page := s.post("/sessions/save", url.Values{"evict": {"1"}})
+	if resp.Request.URL.Query().Get("evicted") != "1" {
+		t.Fatalf("confirmed save ended on %s", resp.Request.URL)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM sessions WHERE session_uuid = 'old-00'`); n != 0 {
+		t.Errorf("oldest saved session not evicted")
+	}
+	if !strings.Contains(page, "10 / 10") || !strings.Contains(page, "old-01") {
+		t.Errorf("/sessions does not show the quota and the next eviction")
+	}
+
+	// Session active expirée : une nouvelle capture ouvre une nouvelle session
+	s.capture()
+	if _, err := s.db.Exec(`UPDATE sessions SET expires_at = NOW(6) - INTERVAL 1 MINUTE WHERE status = 'active'`); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := s.get("/analysis"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("/analysis on an expired session: status %d, want 404", resp.StatusCode)
+	}
+	s.capture()
+	if n := s.count(`SELECT COUNT(*) FROM sessions WHERE status = 'expired'`); n != 1 {
+		t.Errorf("%d expired sessions, want 1", n)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM sessions WHERE status = 'active'`); n != 1 {
+		t.Errorf("%d active sessions, want 1", n)
+	}
+}
@@ -0,0 +1,116 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchmock"
+)
+
+func TestFollowerWaves(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 20, ModeratedChannels: 1})
+	// 40 bots rejoignent le chat et suivent la chaîne, 15 autres comptes la suivent sans venir
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-follow-bots", Steps: []twitchmock.Step{
+		{Kind: twitchmock.StepBotWave, Count: 40, Prefix: "followbot", Follow: true},
+		{Kind: twitchmock.StepFollow, Count: 15, Prefix: "lurkbot"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	followers := 20 + 40 + 15
+
+	s.login()
+	s.capture()
+	s.waitJobs(2)
+
+	resp, _ := s.post("/sessions/followers", url.Values{
+		"broadcaster_id":    {twitchmock.StreamerID},
+		"broadcaster_login": {twitchmock.StreamerLogin},
+	})
+	if resp.Request.URL.Query().Get("followers_enqueued") != "1" {
+		t.Fatalf("followers fetch ended on %s", resp.Request.URL)
+	}
+	// FETCH_FOLLOWERS puis l'enrichissement des 15 comptes absents de la capture
+	s.waitJobs(4)
+	if n := s.count(`SELECT COUNT(*) FROM jobs WHERE type = 'FETCH_USERS_INFO'`); n != 2 {
+		t.Errorf("FETCH_USERS_INFO jobs = %d, want 2", n)
+	}
+
+	var sessionUUID string
+	if err := s.db.QueryRow(`SELECT session_uuid FROM sessions WHERE status = 'active'`).Scan(&sessionUUID); err != nil {
+		t.Fatal(err)
+	}
+	var summary struct {
+		Followers *struct {
+			Channels []struct {
+				BroadcasterLogin string `json:"broadcaster_login"`
+				Total            int    `json:"total"`
+				Fetched          int    `json:"fetched"`
+			} `json:"channels"`
+			Spikes []struct {
+				Follows         int64   `json:"follows"`
+				Expected        float64 `json:"expected"`
+				KnownAccounts   int64   `json:"known_accounts"`
+				InChatCount     int64   `json:"in_chat_count"`
+				TopCreationDays []struct {
+					Date     string `json:"date"`
+					Count    int64  `json:"count"`
+					Chatters int64  `json:"chatters"`
+				} `json:"top_creation_days"`
+				Logins []string `json:"logins"`
+			} `json:"spikes"`
+		} `json:"followers"`
+	}
+	getJSON(t, s.analysisURL+"/sessions/"+sessionUUID+"/summary", &summary)
+	f := summary.Followers
+	if f == nil {
+		t.Fatal("summary has no followers section")
+	}
+	if len(f.Channels) != 1 || f.Channels[0].BroadcasterLogin != twitchmock.StreamerLogin || f.Channels[0].Total != followers || f.Channels[0].Fetched != followers {
+		t.Errorf("channels = %+v, want %d followers of %s", f.Channels, followers, twitchmock.StreamerLogin)
+	}
+	if len(f.Spikes) != 1 {
+		t.Fatalf("spikes = %+v, want 1", f.Spikes)
+	}
+	spike := f.Spikes[0]
+	if spike.Follows != 55 || spike.KnownAccounts != 55 || spike.InChatCount != 40 || spike.Expected >= 1 {
+		t.Errorf("spike = %+v, want 55 enriched follows, 40 of them in chat", spike)
+	}
+	// Jour de la vague de bots (chatters compris), puis jour des follows sans chat
+	if days := spike.TopCreationDays; len(days) != 2 || days[0].Count != 40 || days[0].Chatters < 40 || days[1].Count != 15 || days[1].Chatters != 0 {
+		t.Errorf("top_creation_days = %+v", days)
+	}
+	if len(spike.Logins) != 50 {
+		t.Errorf("logins = %d, want 50", len(spike.Logins))
+	}
+	if _, page := s.get("/analysis"); !strings.Contains(page, "Vagues de follows") || !strings.Contains(page, "followbot") {
+		t.Errorf("analysis page does not show the follow waves")
+	}
+
+	// Par l'API : nouvelle récupération, les follows déjà connus sont mis à jour
+	var created struct {
+		JobID       int64  `json:"job_id"`
+		SessionUUID string `json:"session_uuid"`
+	}
+	s.apiJSON(http.MethodPost, "/followers", map[string]string{
+		"broadcaster_id":    twitchmock.StreamerID,
+		"broadcaster_login": twitchmock.StreamerLogin,
+	}, http.StatusAccepted, &created)
+	if created.SessionUUID != sessionUUID {
+		t.Errorf("session_uuid = %s, want the active session %s", created.SessionUUID, sessionUUID)
+	}
+	s.waitJobs(5)
+	var job apiJob
+	s.apiJSON(http.MethodGet, fmt.Sprintf("/jobs/%d", created.JobID), nil, http.StatusOK, &job)
+	if job.Type != "FETCH_FOLLOWERS" || job.Status != "done" {
+		t.Errorf("job = %+v, want a finished FETCH_FOLLOWERS", job)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM channel_followers`); n != followers {
+		t.Errorf("channel_followers rows = %d, want %d", n, followers)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM follower_fetches`); n != 1 {
+		t.Errorf("follower_fetches rows = %d, want 1", n)
+	}
+}
@@ -0,0 +1,433 @@
+// Package integration exécute le parcours complet de l'application (login, capture,
+// enrichissement, analyse, sauvegarde, export, purge) contre une vraie base MySQL/MariaDB
+// et le mock Twitch (internal/twitchmock).
+//
+// Les services gateway, analysis et twitch-api tournent en mémoire derrière des serveurs
+// httptest, avec les mêmes constructeurs que leurs binaires cmd/*, et le worker dans des
+// goroutines du test, avec une base jetable créée pour le test.
+//
+// Les tests sont ignorés si TCA_TEST_MYSQL_DSN n'est pas défini, par exemple :
+//
+//	TCA_TEST_MYSQL_DSN='root:rootpass@tcp(127.0.0.1:3306)/' go test -v -count=1 ./test/integration/...
+//
+// L'utilisateur doit pouvoir créer et supprimer des bases. TCA_TEST_KEEP_DB=1 conserve
+// la base après le test pour l'inspecter. Les tests ne sont pas parallèles : le worker
+// garde sa configuration dans des variables de paquet.
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/analysis"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/eventsub"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/gateway"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/migrate"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/store"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchapi"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchmock"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/worker"
+)
+
+const (
+	testClientID     = "it-client-id"
+	testClientSecret = "it-client-secret"
+	// Secret des abonnements EventSub (10 à 100 caractères)
+	testEventSubSecret = "it-eventsub-secret"
+)
+
+// repoRoot : racine du dépôt, d'où le gateway charge ses templates et fichiers statiques
+var repoRoot string
+
+func TestMain(m *testing.M) {
+	if os.Getenv("TCA_TEST_MYSQL_DSN") == "" {
+		fmt.Println("TCA_TEST_MYSQL_DSN not set, skipping integration tests")
+		os.Exit(0)
+	}
+
+	_, file, _, _ := runtime.Caller(0)
+	repoRoot = filepath.Clean(filepath.Join(filepath.Dir(file), "..", ".."))
+
+	os.Exit(m.Run())
+}
+
+// stack est une instance complète de l'application pour un test
+type stack struct {
+	t *testing.T
+
+	db     *sql.DB
+	dbName string
+
+	mock    *twitchmock.Server
+	mockURL string
+
+	// pub/sub des événements de session entre worker et gateway (fakeRedis)
+	redisURL string
+
+	gatewayURL  string
+	analysisURL string
+
+	// client navigateur : cookies conservés, redirections suivies
+	client *http.Client
+}
+
+// stackOptions ajuste la configuration des services d'une stack
+type stackOptions struct {
+	// eventsubWebSocket : captures automatiques en transport websocket, avec le listener
+	// (worker eventsub-ws) connecté au mock
+	eventsubWebSocket bool
+	// chatListener : listener du chat (worker chat) connecté à l'IRC du mock
+	chatListener bool
+	// jobTimeout : délai des jobs du worker hors lots de /users (défaut : JOB_TIMEOUT)
+	jobTimeout time.Duration
+}
+
+// newStack crée une base jetable, démarre le mock Twitch, un Redis simulé et les quatre services.
+// Le schéma est créé comme au démarrage des services (DB_AUTO_MIGRATE).
+func newStack(t *testing.T, cfg twitchmock.Config) *stack {
+	t.Helper()
+	return newStackWith(t, cfg, stackOptions{})
+}
+
+// newStackWith est newStack avec des options
+func newStackWith(t *testing.T, cfg twitchmock.Config, opts stackOptions) *stack {
+	t.Helper()
+
+	s := &stack{t: t}
+	s.captureLogs()
+	st := s.openStore(s.createDatabase())
+
+	// Le mock sert les images de profil sous sa propre URL, connue avant son démarrage
+	mockServer := httptest.NewUnstartedServer(nil)
+	s.mockURL = "http://" + mockServer.Listener.Addr().String()
+	cfg.ClientID, cfg.ClientSecret = testClientID, testClientSecret
+	cfg.ImageBaseURL = s.mockURL
+	s.mock = twitchmock.New(cfg)
+	mockServer.Config.Handler = s.mock.Handler()
+	mockServer.Start()
+	t.Cleanup(mockServer.Close)
+	s.redisURL = newFakeRedis(t)
+
+	twitchAPI, err := twitchapi.New(twitchapi.Config{
+		TwitchClientID:     testClientID,
+		TwitchClientSecret: testClientSecret,
+		HelixBaseURL:       s.mockURL + "/helix",
+		AuthBaseURL:        s.mockURL + "/oauth2",
+		RatePerSecond:      100,
+	})
+	if err != nil {
+		t.Fatalf("cannot create twitch-api: %v", err)
+	}
+	twitchAPIURL := s.serve(twitchAPI.Handler())
+	s.analysisURL = s.serve(analysis.New(st).Handler())
+
+	// Le gateway a besoin de sa propre URL (redirection OAuth, callback EventSub)
+	gatewayServer := httptest.NewUnstartedServer(nil)
+	s.gatewayURL = "http://" + gatewayServer.Listener.Addr().String()
+	gatewayCfg := gateway.ConfigFromEnv()
+	gatewayCfg.TwitchClientID = testClientID
+	gatewayCfg.TwitchClientSecret = testClientSecret
+	gatewayCfg.TwitchRedirectURL = s.gatewayURL + "/auth/callback"
+	gatewayCfg.TwitchAuthBaseURL = s.mockURL + "/oauth2"
+	gatewayCfg.TwitchAuthorizeURL = ""
+	gatewayCfg.TwitchAPIBaseURL = twitchAPIURL
+	gatewayCfg.AnalysisBaseURL = s.analysisURL
+	gatewayCfg.RedisURL = s.redisURL
+	gatewayCfg.EventSubCallbackURL = s.gatewayURL + "/eventsub/callback"
+	gatewayCfg.EventSubSecret = testEventSubSecret
+	gatewayCfg.EventSubTransport = eventsub.TransportWebhook
+	if opts.eventsubWebSocket {
+		gatewayCfg.EventSubTransport = eventsub.TransportWebSocket
+	}
+	gatewayCfg.TemplatesDir = filepath.Join(repoRoot, "web", "templates")
+	gatewayCfg.StaticDir = filepath.Join(repoRoot, "web", "static")
+	gw, err := gateway.New(st, gatewayCfg)
+	if err != nil {
+		t.Fatalf("cannot create gateway: %v", err)
+	}
+	gatewayServer.Config.Handler = gw.Handler()
+	gatewayServer.Start()
+	t.Cleanup(gatewayServer.Close)
+
+	workerCfg := worker.ConfigFromEnv()
+	workerCfg.TwitchAPIBaseURL = twitchAPIURL
+	workerCfg.RedisURL = s.redisURL
+	workerCfg.PollInterval = time.Second
+	if opts.jobTimeout > 0 {
+		workerCfg.JobTimeout = opts.jobTimeout
+	}
+	workerCfg.ProfileImageHosts = []string{"127.0.0.1"}
+	// Récepteurs de webhooks des tests sur 127.0.0.1, nouvelle tentative rapide
+	workerCfg.WebhookAllowPrivate = true
+	workerCfg.WebhookRetryDelay = time.Second
+	workerCfg.EventSubWSURL = "ws" + strings.TrimPrefix(s.mockURL, "http") + "/eventsub/ws"
+	workerCfg.EventSubWSSyncInterval = time.Second
+	workerCfg.ChatIRCURL = "ws" + strings.TrimPrefix(s.mockURL, "http") + "/irc"
+	workerCfg.ChatSyncInterval = time.Second
+	workerCfg.ChatFlushInterval = time.Second
+	w, err := worker.New(st, workerCfg)
+	if err != nil {
+		t.Fatalf("cannot create worker: %v", err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	runs := []func(context.Context){w.Run}
+	if opts.eventsubWebSocket {
+		runs = append(runs, w.RunEventSub)
+	}
+	if opts.chatListener {
+		runs = append(runs, w.RunChat)
+	}
+	s.runWorker(runs...)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.client = &http.Client{Jar: jar, Timeout: 30 * time.Second}
+	return s
+}
+
+// captureLogs redirige les logs des services vers un tampon, affiché si le test échoue
+func (s *stack) captureLogs() {
+	t := s.t
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		if t.Failed() {
+			t.Logf("--- service logs ---\n%s", logs.String())
+		}
+	})
+}
+
+// openStore ouvre la base du test et y applique les migrations
+func (s *stack) openStore(dbCfg *mysql.Config) *store.Store {
+	t := s.t
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(dbCfg.Addr)
+	if err != nil {
+		t.Fatalf("invalid DB address %q: %v", dbCfg.Addr, err)
+	}
+	storeCfg := store.Config{
+		User:         dbCfg.User,
+		Password:     dbCfg.Passwd,
+		Host:         host,
+		Port:         port,
+		Name:         s.dbName,
+		MaxOpenConns: 20,
+		MaxIdleConns: 5,
+	}
+	if err := migrate.AutoMigrate(context.Background(), storeCfg.DSN()); err != nil {
+		t.Fatalf("cannot migrate DB: %v", err)
+	}
+	st, err := store.Open(context.Background(), storeCfg)
+	if err != nil {
+		t.Fatalf("cannot open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	return st
+}
+
+// serve démarre un serveur httptest pour handler et retourne son URL
+func (s *stack) serve(handler http.Handler) string {
+	srv := httptest.NewServer(handler)
+	s.t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// runWorker lance les boucles du worker dans des goroutines, arrêtées et attendues à la fin
+// du test (avant la fermeture de la base)
+func (s *stack) runWorker(runs ...func(context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(ctx)
+		}()
+	}
+	s.t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+}
+
+// createDatabase crée une base vide dédiée au test
+func (s *stack) createDatabase() *mysql.Config {
+	t := s.t
+	t.Helper()
+
+	cfg, err := mysql.ParseDSN(os.Getenv("TCA_TEST_MYSQL_DSN"))
+	if err != nil {
+		t.Fatalf("invalid TCA_TEST_MYSQL_DSN: %v", err)
+	}
+	cfg.ParseTime = true
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	s.dbName = "tca_it_" + hex.EncodeToString(suffix)
+
+	cfg.DBName = ""
+	admin, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatalf("cannot open DB: %v", err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+	if _, err := admin.Exec("CREATE DATABASE " + s.dbName + " CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci"); err != nil {
+		t.Fatalf("cannot create database: %v", err)
+	}
+	t.Cleanup(func() {
+		if os.Getenv("TCA_TEST_KEEP_DB") != "" {
+			t.Logf("keeping database %s", s.dbName)
+			return
+		}
+		if _, err := admin.Exec("DROP DATABASE " + s.dbName); err != nil {
+			t.Logf("cannot drop database %s: %v", s.dbName, err)
+		}
+	})
+
+	cfg.DBName = s.dbName
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatalf("cannot open DB: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	s.db = db
+	return cfg
+}
+
+// login effectue le flux OAuth complet : /auth/login -> mock /oauth2/authorize -> /auth/callback -> /
+func (s *stack) login() string {
+	s.t.Helper()
+	resp, body := s.get("/auth/login")
+	if resp.Request.URL.Path != "/" {
+		s.t.Fatalf("login ended on %s, want /", resp.Request.URL)
+	}
+	return body
+}
+
+// get effectue un GET sur le gateway et retourne la réponse finale (après redirections) et son corps
+func (s *stack) get(path string) (*http.Response, string) {
+	s.t.Helper()
+	resp, err := s.client.Get(s.gatewayURL + path)
+	if err != nil {
+		s.t.Fatalf("GET %s: %v", path, err)
+	}
+	return resp, readBody(s.t, resp)
+}
+
+// post soumet un formulaire au gateway et retourne la réponse finale (après redirections)
+func (s *stack) post(path string, form url.Values) (*http.Response, string) {
+	s.t.Helper()
+	resp, err := s.client.PostForm(s.gatewayURL+path, form)
+	if err != nil {
+		s.t.Fatalf("POST %s: %v", path, err)
+	}
+	return resp, readBody(s.t, resp)
+}
+
+// waitJobs attend que total jobs soient terminés et qu'aucun ne soit en attente,
+// puis vérifie qu'aucun n'a échoué
+func (s *stack) waitJobs(total int) {
+	t := s.t
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	for {
+		var finished, inFlight int
+		err := s.db.QueryRowContext(ctx, `
+SELECT
+    COALESCE(SUM(status IN ('done','failed')), 0),
+    COALESCE(SUM(status IN ('pending','running')), 0)
+FROM jobs`).Scan(&finished, &inFlight)
+		if err != nil {
+			t.Fatalf("count jobs: %v", err)
+		}
+		if finished >= total && inFlight == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for jobs: finished=%d in_flight=%d want=%d", finished, inFlight, total)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	rows, err := s.db.Query(`SELECT id, type, COALESCE(error_message, '') FROM jobs WHERE status = 'failed'`)
+	if err != nil {
+		t.Fatalf("query failed jobs: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var typ, msg string
+		if err := rows.Scan(&id, &typ, &msg); err != nil {
+			t.Fatal(err)
+		}
+		t.Errorf("job %d (%s) failed: %s", id, typ, msg)
+	}
+	if t.Failed() {
+		t.FailNow()
+	}
+}
+
+// count exécute une requête SELECT COUNT(*) ...
+func (s *stack) count(query string, args ...interface{}) int {
+	s.t.Helper()
+	var n int
+	if err := s.db.QueryRow(query, args...).Scan(&n); err != nil {
+		s.t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return string(b)
+}
+
+// syncBuffer est un bytes.Buffer partagé entre les goroutines des services
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.TrimSpace(b.buf.String())
+}
@@ -0,0 +1,226 @@
+package integration
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/migrate"
+)
+
+// TestMigrations applique toutes les migrations depuis plusieurs runners concurrents
+// (réplicas démarrant en même temps), puis vérifie l'aller-retour down/up complet.
+func TestMigrations(t *testing.T) {
+	s := &stack{t: t}
+	dsn := s.createDatabase().FormatDSN()
+	ctx := context.Background()
+
+	all, err := migrate.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	applied := make([]int, 3)
+	errs := make([]error, 3)
+	for i := range applied {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, err := migrate.Open(dsn)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer r.Close()
+			done, err := r.Up(ctx)
+			applied[i], errs[i] = len(done), err
+		}(i)
+	}
+	wg.Wait()
+	total := 0
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("runner %d: %v", i, err)
+		}
+		total += applied[i]
+	}
+	if total != len(all) {
+		t.Fatalf("concurrent runners applied %d migrations, want %d", total, len(all))
+	}
+
+	r, err := migrate.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	assertStatus := func(wantApplied int) {
+		t.Helper()
+		states, err := r.Status(ctx)
+		if err != nil {
+			t.Fatalf("status: %v", err)
+		}
+		n := 0
+		for _, st := range states {
+			if st.Unknown {
+				t.Errorf("unexpected unknown version %d", st.Version)
+			}
+			if st.AppliedAt != nil {
+				n++
+			}
+		}
+		if n != wantApplied {
+			t.Fatalf("%d migrations applied, want %d", n, wantApplied)
+		}
+	}
+	assertStatus(len(all))
+
+	if got := s.count(`SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'twitch_user_names' AND COLUMN_NAME = 'old_login'`); got != 1 {
+		t.Fatalf("twitch_user_names.old_login missing after up")
+	}
+
+	reverted, err := r.Down(ctx, len(all))
+	if err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if len(reverted) != len(all) {
+		t.Fatalf("reverted %d migrations, want %d", len(reverted), len(all))
+	}
+	assertStatus(0)
+	if got := s.count(`SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME <> 'schema_migrations'`); got != 0 {
+		t.Fatalf("%d tables left after full down", got)
+	}
+
+	if _, err := r.Up(ctx); err != nil {
+		t.Fatalf("up after down: %v", err)
+	}
+	assertStatus(len(all))
+}
+
+// TestCaptureChattersConversion vérifie que la migration 0007 convertit les chatters déjà
+// stockés (doublons compris) en clés entières, et que son down restaure les lignes.
+func TestCaptureChattersConversion(t *testing.T) {
+	s := &stack{t: t}
+	dsn := s.createDatabase().FormatDSN()
+	ctx := context.Background()
+
+	r, err := migrate.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	steps := stepsFrom(t, 7)
+
+	if _, err := r.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if _, err := r.Down(ctx, steps); err != nil {
+		t.Fatalf("down 0007: %v", err)
+	}
+
+	for _, stmt := range []string{
+		`INSERT INTO users (id, twitch_user_id, login, display_name, created_at, updated_at) VALUES (1, '2000', 'mod', 'Mod', NOW(6), NOW(6))`,
+		`INSERT INTO sessions (id, session_uuid, user_id, created_at, expires_at, updated_at) VALUES (1, 'sess-1', 1, NOW(6), NOW(6), NOW(6))`,
+		`INSERT INTO captures (id, session_id, broadcaster_id, broadcaster_login, captured_at) VALUES (1, 1, '1000', 'streamer', NOW(6)), (2, 1, '1000', 'streamer', NOW(6))`,
+		`INSERT INTO capture_chatters (capture_id, twitch_user_id) VALUES (1, 'a'), (1, 'b'), (1, 'b'), (2, 'b'), (2, 'c')`,
+	} {
+		if _, err := s.db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	if _, err := r.Up(ctx); err != nil {
+		t.Fatalf("up 0007: %v", err)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM twitch_user_keys`); n != 3 {
+		t.Errorf("twitch_user_keys = %d, want 3", n)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM capture_chatters`); n != 4 {
+		t.Errorf("capture_chatters = %d, want 4 (duplicate removed)", n)
+	}
+	if n := s.count(`
+SELECT COUNT(*) FROM capture_chatters cc
+JOIN twitch_user_keys k ON k.user_key = cc.user_key
+WHERE k.twitch_user_id = 'b'`); n != 2 {
+		t.Errorf("captures of b = %d, want 2", n)
+	}
+
+	if _, err := r.Down(ctx, steps); err != nil {
+		t.Fatalf("down 0007 with data: %v", err)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM capture_chatters WHERE twitch_user_id = 'b'`); n != 2 {
+		t.Errorf("restored captures of b = %d, want 2", n)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM capture_chatters`); n != 4 {
+		t.Errorf("restored capture_chatters = %d, want 4", n)
+	}
+}
+
+// stepsFrom retourne le nombre de migrations à annuler pour revenir juste avant version
+func stepsFrom(t *testing.T, version int64) int {
+	t.Helper()
+	all, err := migrate.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := 0
+	for _, m := range all {
+		if m.Version >= version {
+			steps++
+		}
+	}
+	return steps
+}
+
+// TestJobsTrackingBackfill vérifie que la migration 0009 rattache les jobs existants
+// à leur session et à son propriétaire
+func TestJobsTrackingBackfill(t *testing.T) {
+	s := &stack{t: t}
+	dsn := s.createDatabase().FormatDSN()
+	ctx := context.Background()
+
+	r, err := migrate.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	steps := stepsFrom(t, 9)
+	if _, err := r.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if _, err := r.Down(ctx, steps); err != nil {
+		t.Fatalf("down 0009: %v", err)
+	}
+
+	for _, stmt := range []string{
+		`INSERT INTO users (id, twitch_user_id, login, display_name, created_at, updated_at) VALUES (7, '2000', 'mod', 'Mod', NOW(6), NOW(6))`,
+		`INSERT INTO sessions (id, session_uuid, user_id, created_at, expires_at, updated_at) VALUES (3, 'sess-1', 7, NOW(6), NOW(6), NOW(6))`,
+		`INSERT INTO jobs (id, type, payload, status, created_at) VALUES
+		  (1, 'FETCH_CHATTERS', '{"session_id": 3, "broadcaster_id": "1000"}', 'done', NOW(6)),
+		  (2, 'FETCH_USERS_INFO', '{"session_id": 3, "user_ids": ["a"]}', 'done', NOW(6)),
+		  (3, 'FETCH_CHATTERS', '{"session_id": 99}', 'failed', NOW(6)),
+		  (4, 'PURGE', '{"dry_run": false}', 'done', NOW(6))`,
+	} {
+		if _, err := s.db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	if _, err := r.Up(ctx); err != nil {
+		t.Fatalf("up 0009: %v", err)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM jobs WHERE session_id = 3 AND user_id = 7`); n != 2 {
+		t.Errorf("jobs of session 3 = %d, want 2", n)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM jobs WHERE id IN (3, 4) AND session_id IS NULL AND user_id IS NULL`); n != 2 {
+		t.Errorf("unlinked jobs = %d, want 2 (deleted session, maintenance)", n)
+	}
+
+	if _, err := r.Down(ctx, steps); err != nil {
+		t.Fatalf("down 0009 with data: %v", err)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM jobs`); n != 4 {
+		t.Errorf("jobs after down = %d, want 4", n)
+	}
+}
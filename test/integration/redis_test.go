@@ -0,0 +1,202 @@
+package integration
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRedis est un serveur Redis minimal (protocole RESP2) limité au pub/sub : PUBLISH,
+// SUBSCRIBE, UNSUBSCRIBE et PING, plus les commandes envoyées par go-redis à la connexion.
+// Il évite de dépendre d'un vrai Redis pour relier le worker et le gateway.
+type fakeRedis struct {
+	mu   sync.Mutex
+	subs map[string]map[*fakeRedisConn]bool // canal -> abonnés
+}
+
+type fakeRedisConn struct {
+	mu       sync.Mutex // sérialise les écritures (réponses et messages publiés)
+	w        *bufio.Writer
+	channels map[string]bool
+}
+
+// newFakeRedis démarre le serveur et retourne son URL redis://
+func newFakeRedis(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &fakeRedis{subs: map[string]map[*fakeRedisConn]bool{}}
+
+	var wg sync.WaitGroup
+	var connsMu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		_ = l.Close()
+		connsMu.Lock()
+		for _, c := range conns {
+			_ = c.Close()
+		}
+		connsMu.Unlock()
+		wg.Wait()
+	})
+
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			connsMu.Lock()
+			conns = append(conns, nc)
+			connsMu.Unlock()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				srv.serve(nc)
+			}()
+		}
+	}()
+	return "redis://" + l.Addr().String() + "/0"
+}
+
+func (s *fakeRedis) serve(nc net.Conn) {
+	defer nc.Close()
+	c := &fakeRedisConn{w: bufio.NewWriter(nc), channels: map[string]bool{}}
+	defer s.unsubscribe(c, nil)
+
+	r := bufio.NewReader(nc)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "HELLO":
+			// go-redis repasse alors en RESP2
+			c.reply("-ERR unknown command 'HELLO'\r\n")
+		case "PING":
+			s.mu.Lock()
+			subscribed := len(c.channels) > 0
+			s.mu.Unlock()
+			if subscribed {
+				c.reply("*2\r\n" + respBulk("pong") + respBulk(""))
+			} else {
+				c.reply("+PONG\r\n")
+			}
+		case "PUBLISH":
+			if len(args) != 3 {
+				c.reply("-ERR wrong number of arguments for 'publish' command\r\n")
+				continue
+			}
+			c.reply(":" + strconv.Itoa(s.publish(args[1], args[2])) + "\r\n")
+		case "SUBSCRIBE":
+			s.subscribe(c, args[1:])
+		case "UNSUBSCRIBE":
+			s.unsubscribe(c, args[1:])
+		case "QUIT":
+			c.reply("+OK\r\n")
+			return
+		default:
+			// SELECT, CLIENT SETINFO...
+			c.reply("+OK\r\n")
+		}
+	}
+}
+
+func (s *fakeRedis) publish(channel, message string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.subs[channel] {
+		c.reply("*3\r\n" + respBulk("message") + respBulk(channel) + respBulk(message))
+	}
+	return len(s.subs[channel])
+}
+
+func (s *fakeRedis) subscribe(c *fakeRedisConn, channels []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range channels {
+		if s.subs[ch] == nil {
+			s.subs[ch] = map[*fakeRedisConn]bool{}
+		}
+		s.subs[ch][c] = true
+		c.channels[ch] = true
+		c.reply(subscriptionReply("subscribe", ch, len(c.channels)))
+	}
+}
+
+// unsubscribe désabonne c des canaux donnés, ou de tous si channels est vide
+func (s *fakeRedis) unsubscribe(c *fakeRedisConn, channels []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(channels) == 0 {
+		for ch := range c.channels {
+			channels = append(channels, ch)
+		}
+	}
+	for _, ch := range channels {
+		delete(s.subs[ch], c)
+		delete(c.channels, ch)
+		c.reply(subscriptionReply("unsubscribe", ch, len(c.channels)))
+	}
+}
+
+func (c *fakeRedisConn) reply(data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, _ = c.w.WriteString(data)
+	_ = c.w.Flush()
+}
+
+func respBulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+// subscriptionReply confirme un (dés)abonnement avec le nombre d'abonnements restants
+func subscriptionReply(kind, channel string, count int) string {
+	return "*3\r\n" + respBulk(kind) + respBulk(channel) + ":" + strconv.Itoa(count) + "\r\n"
+}
+
+// readRESPCommand lit une commande client (tableau de chaînes RESP)
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil // commande inline
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid array header %q", line)
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimRight(header, "\r\n")[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk header %q", header)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
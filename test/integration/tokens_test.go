@@ -0,0 +1,62 @@
+package integration
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchmock"
+)
+
+// TestTokenRefresh vérifie qu'un token Twitch refusé est renouvelé par son refresh token,
+// par le gateway (liste des chaînes) comme par le worker (capture), et que les nouveaux
+// tokens sont enregistrés dans la session web
+func TestTokenRefresh(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 20})
+	s.login()
+
+	// Token révoqué chez Twitch : le gateway le renouvelle pour recharger les chaînes
+	accessToken, refreshToken := s.webSessionTokens()
+	s.revokeToken(accessToken)
+	resp, _ := s.post("/channels/refresh", nil)
+	if resp.Request.URL.Query().Get("refreshed") != "1" {
+		t.Fatalf("channels refresh ended on %s", resp.Request.URL)
+	}
+	renewed, renewedRefresh := s.webSessionTokens()
+	if renewed == accessToken || renewedRefresh == refreshToken {
+		t.Fatalf("tokens not rotated by the gateway: %q/%q", renewed, renewedRefresh)
+	}
+
+	// Idem pour le worker : la capture et l'enrichissement aboutissent
+	s.revokeToken(renewed)
+	s.capture()
+	s.waitJobs(2)
+	if n := s.count(`SELECT COUNT(*) FROM captures`); n != 1 {
+		t.Fatalf("captures = %d, want 1", n)
+	}
+	if latest, _ := s.webSessionTokens(); latest == renewed {
+		t.Fatalf("token not rotated by the worker")
+	}
+}
+
+// webSessionTokens retourne les tokens Twitch de l'unique session web
+func (s *stack) webSessionTokens() (accessToken, refreshToken string) {
+	s.t.Helper()
+	if err := s.db.QueryRow(`SELECT access_token, refresh_token FROM web_sessions`).Scan(&accessToken, &refreshToken); err != nil {
+		s.t.Fatalf("load web session tokens: %v", err)
+	}
+	return accessToken, refreshToken
+}
+
+// revokeToken révoque un token d'accès auprès du mock, comme à son expiration
+func (s *stack) revokeToken(accessToken string) {
+	s.t.Helper()
+	resp, err := http.PostForm(s.mockURL+"/oauth2/revoke", url.Values{"client_id": {testClientID}, "token": {accessToken}})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		s.t.Fatalf("revoke token: %s", resp.Status)
+	}
+}
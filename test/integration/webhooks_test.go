@@ -0,0 +1,195 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vignemail1/twitch-chatters-analyser/internal/twitchmock"
+	"github.com/vignemail1/twitch-chatters-analyser/internal/webhooks"
+)
+
+// webhookRequest est une requête reçue par le récepteur de test
+type webhookRequest struct {
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// webhookReceiver est un récepteur HTTP local ; les failures premières requêtes de
+// chaque chemin reçoivent une erreur 500
+type webhookReceiver struct {
+	URL      string
+	requests chan webhookRequest
+
+	mu       sync.Mutex
+	failures int
+	seen     map[string]int
+}
+
+func newWebhookReceiver(t *testing.T, failures int) *webhookReceiver {
+	t.Helper()
+	rcv := &webhookReceiver{requests: make(chan webhookRequest, 100), failures: failures, seen: map[string]int{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.requests <- webhookRequest{Path: r.URL.Path, Header: r.Header.Clone(), Body: body}
+
+		rcv.mu.Lock()
+		rcv.seen[r.URL.Path]++
+		fail := rcv.seen[r.URL.Path] <= rcv.failures
+		rcv.mu.Unlock()
+		if fail {
+			http.Error(w, "try again", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	rcv.URL = srv.URL
+	return rcv
+}
+
+// next attend la prochaine requête
+func (rcv *webhookReceiver) next(t *testing.T) webhookRequest {
+	t.Helper()
+	select {
+	case req := <-rcv.requests:
+		return req
+	case <-time.After(60 * time.Second):
+		t.Fatal("timeout waiting for webhook request")
+	}
+	return webhookRequest{}
+}
+
+func TestWebhooks(t *testing.T) {
+	s := newStack(t, twitchmock.Config{Chatters: 20, ModeratedChannels: 1})
+	s.login()
+	s.capture()
+	s.waitJobs(2)
+
+	// Chaque chemin échoue une fois avant d'être livré
+	rcv := newWebhookReceiver(t, 1)
+
+	// Formulaire invalide
+	if _, body := s.post("/webhooks/create", url.Values{
+		"name": {"bad"}, "url": {"ftp://example.com"}, "format": {"generic"}, "events": {"capture_finished"},
+		"creation_burst_threshold": {"50"}, "suspicious_threshold": {"10"},
+	}); !strings.Contains(body, "doit être une URL http://") {
+		t.Errorf("invalid URL accepted:\n%s", body)
+	}
+
+	resp, body := s.post("/webhooks/create", url.Values{
+		"name": {"generic"}, "url": {rcv.URL + "/generic"}, "format": {"generic"},
+		"events":                   {"suspicious_accounts", "job_failed"},
+		"creation_burst_threshold": {"50"}, "suspicious_threshold": {"3"},
+	})
+	if resp.Request.URL.Path != "/webhooks" || !strings.Contains(body, "Webhook créé") {
+		t.Fatalf("create webhook ended on %s:\n%s", resp.Request.URL, body)
+	}
+	s.post("/webhooks/create", url.Values{
+		"name": {"discord"}, "url": {rcv.URL + "/discord"}, "format": {"discord"},
+		"events":                   {"suspicious_accounts"},
+		"creation_burst_threshold": {"50"}, "suspicious_threshold": {"4"},
+	})
+	if n := s.count(`SELECT COUNT(*) FROM webhooks WHERE enabled`); n != 2 {
+		t.Fatalf("webhooks = %d, want 2", n)
+	}
+	var genericID int64
+	var secret string
+	if err := s.db.QueryRow(`SELECT id, secret FROM webhooks WHERE name = 'generic'`).Scan(&genericID, &secret); err != nil {
+		t.Fatal(err)
+	}
+
+	// Trois bots à l'avatar par défaut : seuil atteint pour "generic" (3), pas pour "discord" (4)
+	if err := s.mock.Run(twitchmock.Scenario{Name: "it-webhooks", Steps: []twitchmock.Step{{Kind: twitchmock.StepBotWave, Count: 3}}}); err != nil {
+		t.Fatal(err)
+	}
+	s.capture()
+
+	first, retry := rcv.next(t), rcv.next(t)
+	if first.Path != "/generic" || retry.Path != "/generic" {
+		t.Fatalf("requests to %s and %s, want /generic twice", first.Path, retry.Path)
+	}
+	if first.Header.Get(webhooks.HeaderDelivery) != retry.Header.Get(webhooks.HeaderDelivery) ||
+		string(first.Body) != string(retry.Body) {
+		t.Error("retry is not the same delivery")
+	}
+	ts, err := strconv.ParseInt(retry.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp header: %v", err)
+	}
+	if got := retry.Header.Get(webhooks.HeaderSignature); got != webhooks.Sign(secret, ts, retry.Body) {
+		t.Errorf("signature %q does not match the webhook secret", got)
+	}
+	if retry.Header.Get(webhooks.HeaderEvent) != "suspicious_accounts" {
+		t.Errorf("event header = %q", retry.Header.Get(webhooks.HeaderEvent))
+	}
+	var notification struct {
+		Event       string `json:"event"`
+		SessionUUID string `json:"session_uuid"`
+		Data        struct {
+			DefaultAvatars int `json:"default_avatars"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(retry.Body, &notification); err != nil {
+		t.Fatalf("invalid generic body %s: %v", retry.Body, err)
+	}
+	if notification.Event != "suspicious_accounts" || notification.SessionUUID == "" || notification.Data.DefaultAvatars != 3 {
+		t.Errorf("generic body = %s", retry.Body)
+	}
+
+	// Test depuis le gateway : au format Discord
+	var discordID int64
+	if err := s.db.QueryRow(`SELECT id FROM webhooks WHERE name = 'discord'`).Scan(&discordID); err != nil {
+		t.Fatal(err)
+	}
+	if resp, body := s.post("/webhooks/test", url.Values{"webhook_id": {strconv.FormatInt(discordID, 10)}}); !strings.Contains(body, "Notification de test planifiée") {
+		t.Fatalf("test webhook ended on %s:\n%s", resp.Request.URL, body)
+	}
+	rcv.next(t)
+	test := rcv.next(t)
+	var discord struct {
+		Embeds []struct {
+			Title string `json:"title"`
+		} `json:"embeds"`
+	}
+	if test.Path != "/discord" || json.Unmarshal(test.Body, &discord) != nil || len(discord.Embeds) != 1 ||
+		!strings.Contains(discord.Embeds[0].Title, "discord") {
+		t.Errorf("discord test request %s: %s", test.Path, test.Body)
+	}
+
+	// Journal : deux livraisons réussies à la seconde tentative
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for s.count(`SELECT COUNT(*) FROM webhook_deliveries WHERE status = 'delivered'`) != 2 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for delivered webhooks")
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	if n := s.count(`SELECT COUNT(*) FROM webhook_deliveries WHERE attempts = 2 AND response_status = 204`); n != 2 {
+		t.Errorf("deliveries delivered at the second attempt = %d, want 2", n)
+	}
+	_, page := s.get("/webhooks")
+	if strings.Count(page, "✅ livrée") != 2 || !strings.Contains(page, "HTTP 204") {
+		t.Errorf("delivery log not shown:\n%s", page)
+	}
+
+	// Suppression : le webhook et son journal
+	s.post("/webhooks/delete", url.Values{"webhook_id": {strconv.FormatInt(genericID, 10)}})
+	if n := s.count(`SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = ?`, genericID); n != 0 {
+		t.Errorf("deliveries of a deleted webhook = %d", n)
+	}
+	if n := s.count(`SELECT COUNT(*) FROM audit_logs WHERE event_type IN ('webhook_created', 'webhook_deleted')`); n != 3 {
+		t.Errorf("webhook audit entries = %d, want 3", n)
+	}
+}
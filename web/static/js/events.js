@@ -0,0 +1,119 @@
+// Événements en direct de la session (Server-Sent Events) : fil des événements et
+// rafraîchissement de l'analyse quand une capture ou un enrichissement se termine
+(function() {
+    'use strict';
+
+    // Regroupe les rafraîchissements d'une rafale d'événements
+    const REFRESH_DELAY = 1000;
+    const MAX_ITEMS = 20;
+
+    /**
+     * Texte d'un événement (textContent uniquement : error et logins viennent de Twitch ou du worker)
+     * @param {object} ev - Événement (schéma SessionEvent de /api/v1/openapi.json)
+     * @returns {string}
+     */
+    function describe(ev) {
+        const d = ev.data || {};
+        switch (ev.type) {
+        case 'capture_stored':
+            return '📥 Capture de ' + d.broadcaster_login + ' enregistrée : ' + d.chatters +
+                ' chatters, ' + d.users_to_enrich + ' compte(s) à enrichir';
+        case 'enrichment_finished':
+            return '✅ Enrichissement terminé : ' + d.users_enriched + ' compte(s), ' + d.missing + ' disparu(s)';
+        case 'job_failed':
+            return '❌ Échec du job #' + ev.job_id + ' (' + d.job_type + ') : ' + d.error;
+        case 'suspicious_accounts': {
+            const parts = [];
+            if (d.missing) parts.push(d.missing + ' disparu(s) de Twitch');
+            if (d.default_avatars) parts.push(d.default_avatars + ' avatar(s) par défaut');
+            if (d.renamed && d.renamed.length) {
+                parts.push(d.renamed.length + ' renommé(s) (' +
+                    d.renamed.slice(0, 5).map(r => r.old_login + ' → ' + r.new_login).join(', ') +
+                    (d.renamed.length > 5 ? ', …' : '') + ')');
+            }
+            return '⚠️ Comptes suspects : ' + parts.join(', ');
+        }
+        case 'alert_triggered': {
+            const unit = d.metric === 'creation_day_accounts' ? ' comptes' : ' %';
+            return '🚨 Alerte sur ' + d.broadcaster_login + ' : ' + d.metric + ' = ' + d.value + unit +
+                ' (seuil ' + d.threshold + unit + ')';
+        }
+        default:
+            return ev.type;
+        }
+    }
+
+    /**
+     * Recharge le contenu de l'analyse sans recharger la page (filtres conservés)
+     */
+    async function refreshAnalysis() {
+        const current = document.getElementById('analysis-content');
+        if (!current) return;
+        try {
+            const resp = await fetch(window.location.href, { credentials: 'same-origin' });
+            if (!resp.ok) return;
+            const doc = new DOMParser().parseFromString(await resp.text(), 'text/html');
+            const fresh = doc.getElementById('analysis-content');
+            if (!fresh) return;
+            current.replaceWith(fresh);
+        } catch (e) {
+            return;
+        }
+        // Les scripts insérés par DOMParser ne sont pas exécutés
+        document.querySelectorAll('#analysis-content script').forEach(old => {
+            const script = document.createElement('script');
+            script.textContent = old.textContent;
+            old.replaceWith(script);
+        });
+        if (window.tcaConvertDates) window.tcaConvertDates();
+    }
+
+    function start(box) {
+        const url = '/api/v1/sessions/' + encodeURIComponent(box.dataset.sessionUuid) + '/events';
+        const source = new EventSource(url);
+        const list = box.querySelector('ul');
+        let refreshTimer = null;
+
+        function onEvent(msg) {
+            let ev;
+            try {
+                ev = JSON.parse(msg.data);
+            } catch (e) {
+                return;
+            }
+
+            const item = document.createElement('li');
+            item.className = 'event event-' + ev.type;
+            const time = document.createElement('time');
+            time.dateTime = ev.at;
+            time.textContent = new Date(ev.at).toLocaleTimeString('fr-FR');
+            item.append(time, ' ' + describe(ev));
+            list.prepend(item);
+            while (list.children.length > MAX_ITEMS) list.lastChild.remove();
+            box.hidden = false;
+
+            // Le suivi des jobs reprend (capture lancée depuis un autre onglet ou l'API)
+            document.dispatchEvent(new CustomEvent('tca:session-event', { detail: ev }));
+
+            if (ev.type === 'capture_stored' || ev.type === 'enrichment_finished') {
+                clearTimeout(refreshTimer);
+                refreshTimer = setTimeout(refreshAnalysis, REFRESH_DELAY);
+            }
+        }
+
+        ['capture_stored', 'enrichment_finished', 'job_failed', 'suspicious_accounts', 'alert_triggered'].forEach(type => {
+            source.addEventListener(type, onEvent);
+        });
+        // Événements désactivés (503) ou session supprimée : EventSource abandonne sans reconnexion
+        source.addEventListener('error', () => {
+            if (source.readyState === EventSource.CLOSED) box.hidden = true;
+        });
+    }
+
+    document.addEventListener('DOMContentLoaded', function() {
+        const box = document.getElementById('session-events');
+        if (box && box.dataset.sessionUuid && window.EventSource) {
+            start(box);
+        }
+    });
+})();
@@ -0,0 +1,115 @@
+// Avancement en direct des jobs de la session active (captures, enrichissement des comptes)
+(function() {
+    'use strict';
+
+    const POLL_INTERVAL = 2000;
+    // Les échecs restent affichés 10 minutes
+    const FAILED_VISIBLE_MS = 10 * 60 * 1000;
+
+    const LABELS = {
+        FETCH_CHATTERS: 'Capture des chatters',
+        FETCH_USERS_INFO: 'Enrichissement des comptes',
+        FETCH_FOLLOWERS: 'Récupération des followers'
+    };
+    const STATUS = {
+        pending: 'en attente',
+        running: 'en cours',
+        done: 'terminé',
+        failed: 'échec'
+    };
+
+    /**
+     * Construit la ligne d'un job (textContent uniquement : error vient du worker)
+     * @param {object} job - Job de l'API (/api/v1/sessions/{uuid}/jobs)
+     * @returns {HTMLElement}
+     */
+    function renderJob(job) {
+        const row = document.createElement('div');
+        row.className = 'job job-' + job.status;
+
+        const title = document.createElement('p');
+        const label = document.createElement('strong');
+        label.textContent = (LABELS[job.type] || job.type) + ' #' + job.id;
+        title.appendChild(label);
+        title.appendChild(document.createTextNode(' : ' + (STATUS[job.status] || job.status)));
+        if (job.progress.message && job.status === 'running') {
+            title.appendChild(document.createTextNode(' (' + job.progress.message + ')'));
+        }
+        row.appendChild(title);
+
+        if (job.status === 'running' || job.status === 'pending') {
+            const bar = document.createElement('progress');
+            if (job.progress.total) {
+                bar.max = job.progress.total;
+                bar.value = job.progress.done;
+                bar.title = job.progress.done + ' / ' + job.progress.total;
+            }
+            row.appendChild(bar);
+        }
+
+        if (job.status === 'failed' && job.error) {
+            const err = document.createElement('p');
+            err.textContent = job.error;
+            row.appendChild(err);
+        }
+        return row;
+    }
+
+    function start(box) {
+        const url = '/api/v1/sessions/' + encodeURIComponent(box.dataset.sessionUuid) + '/jobs';
+        let sawActive = false;
+        let polling = false;
+
+        async function poll() {
+            polling = true;
+            let jobs;
+            try {
+                const resp = await fetch(url, { credentials: 'same-origin' });
+                if (!resp.ok) {
+                    polling = false; // session expirée ou supprimée : rien à suivre
+                    return;
+                }
+                jobs = (await resp.json()).jobs;
+            } catch (e) {
+                setTimeout(poll, POLL_INTERVAL * 5);
+                return;
+            }
+
+            const now = Date.now();
+            const active = jobs.filter(j => j.status === 'pending' || j.status === 'running');
+            const failed = jobs.filter(j => j.status === 'failed' && now - Date.parse(j.finished_at) < FAILED_VISIBLE_MS);
+
+            box.replaceChildren(...active.concat(failed).reverse().map(renderJob));
+            if (active.length > 0) {
+                sawActive = true;
+                setTimeout(poll, POLL_INTERVAL);
+                return;
+            }
+            polling = false;
+            if (sawActive) {
+                const done = document.createElement('p');
+                done.className = 'job job-done';
+                done.append('✅ Traitement terminé. ');
+                const link = document.createElement('a');
+                link.href = box.dataset.doneHref || window.location.pathname;
+                link.textContent = box.dataset.doneLabel || 'Recharger';
+                done.appendChild(link);
+                box.appendChild(done);
+            }
+        }
+
+        // Un événement de la session (events.js) relance le suivi s'il était arrêté
+        document.addEventListener('tca:session-event', function() {
+            if (!polling) poll();
+        });
+
+        poll();
+    }
+
+    document.addEventListener('DOMContentLoaded', function() {
+        const box = document.getElementById('job-progress');
+        if (box && box.dataset.sessionUuid) {
+            start(box);
+        }
+    });
+})();
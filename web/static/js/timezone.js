@@ -52,6 +52,9 @@
         });
     }
 
+    // Réutilisé après un rafraîchissement partiel de la page (events.js)
+    window.tcaConvertDates = convertAllDates;
+
     // Convertir dès que le DOM est prêt
     if (document.readyState === 'loading') {
         document.addEventListener('DOMContentLoaded', convertAllDates);